@@ -3,8 +3,12 @@ module incus-backup
 go 1.22
 
 require (
+	github.com/hanwen/go-fuse/v2 v2.7.2
 	github.com/lxc/incus v0.7.0
 	github.com/spf13/cobra v1.8.0
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/crypto v0.21.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -20,7 +24,6 @@ require (
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/zitadel/oidc/v2 v2.12.0 // indirect
-	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/oauth2 v0.18.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
@@ -29,5 +32,4 @@ require (
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/square/go-jose.v2 v2.6.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Compression names reported by Decompress.
+const (
+	CompressionNone  = "none"
+	CompressionGzip  = "gzip"
+	CompressionXz    = "xz"
+	CompressionBzip2 = "bzip2"
+	CompressionZstd  = "zstd"
+)
+
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicBzip2 = []byte("BZh")
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicUstar = []byte("ustar")
+)
+
+// HeaderSize is the number of leading bytes DetectCompression needs to
+// recognise every supported format (the tar magic sits at offset 257).
+const HeaderSize = 262
+
+// DetectCompression identifies the export format from its leading bytes. It
+// returns "" when the header matches no known format.
+func DetectCompression(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return CompressionGzip
+	case bytes.HasPrefix(head, magicXz):
+		return CompressionXz
+	case bytes.HasPrefix(head, magicBzip2):
+		return CompressionBzip2
+	case bytes.HasPrefix(head, magicZstd):
+		return CompressionZstd
+	case len(head) >= HeaderSize && bytes.Equal(head[257:262], magicUstar):
+		return CompressionNone
+	default:
+		return ""
+	}
+}
+
+// Decompress sniffs the stream's magic bytes and returns a reader yielding the
+// uncompressed tar data along with the detected compression name. Incus names
+// exports .tar.xz regardless of the server's configured algorithm, so the
+// extension cannot be trusted.
+func Decompress(r io.Reader) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, 1024)
+	head, err := br.Peek(HeaderSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", fmt.Errorf("archive: read header: %w", err)
+	}
+	compression := DetectCompression(head)
+	switch compression {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("archive: gzip: %w", err)
+		}
+		return zr, compression, nil
+	case CompressionXz:
+		zr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, "", fmt.Errorf("archive: xz: %w", err)
+		}
+		return zr, compression, nil
+	case CompressionBzip2:
+		return bzip2.NewReader(br), compression, nil
+	case CompressionZstd:
+		return nil, compression, errors.New("archive: zstd compressed exports are not supported")
+	case CompressionNone:
+		return br, compression, nil
+	}
+	if len(head) == 0 {
+		return nil, "", errors.New("archive: empty stream")
+	}
+	return nil, "", errors.New("archive: unrecognised export format (not tar, gzip, xz or bzip2)")
+}
@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathMatcher selects data paths by shell-style patterns. Patterns are
+// absolute within the data, like the paths of a Tree; a pattern selects the
+// paths it matches and everything below them.
+type PathMatcher struct {
+	patterns []string
+	matched  []bool
+}
+
+// NewPathMatcher validates patterns. A missing leading slash is added.
+func NewPathMatcher(patterns []string) (*PathMatcher, error) {
+	m := &PathMatcher{matched: make([]bool, len(patterns))}
+	for _, p := range patterns {
+		p = path.Clean("/" + p)
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", p, err)
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	return m, nil
+}
+
+// Match reports whether p or one of its parent directories matches a
+// pattern.
+func (m *PathMatcher) Match(p string) bool {
+	for q := path.Clean("/" + p); ; q = path.Dir(q) {
+		if m.MatchExact(q) {
+			return true
+		}
+		if q == "/" {
+			return false
+		}
+	}
+}
+
+// MatchExact reports whether p itself matches a pattern.
+func (m *PathMatcher) MatchExact(p string) bool {
+	p = path.Clean("/" + p)
+	ok := false
+	for i, pattern := range m.patterns {
+		if match, _ := path.Match(pattern, p); match {
+			m.matched[i] = true
+			ok = true
+		}
+	}
+	return ok
+}
+
+// Unmatched returns the patterns that matched no path so far.
+func (m *PathMatcher) Unmatched() []string {
+	var out []string
+	for i, p := range m.patterns {
+		if !m.matched[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Extract statuses.
+const (
+	Extracted     = "extracted"
+	WouldExtract  = "would_extract"
+	SkippedExists = "skipped_exists"
+	SkippedLink   = "skipped_link"
+	// SkippedSpecial is reported for devices, FIFOs and sockets.
+	SkippedSpecial = "skipped_special"
+)
+
+// ExtractedPath reports what happened to one selected path.
+type ExtractedPath struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+// ExtractOptions controls Extract.
+type ExtractOptions struct {
+	// Overwrite replaces files that already exist under the destination.
+	Overwrite bool
+	// DryRun only reports what would be extracted.
+	DryRun bool
+}
+
+// Extract stream-decompresses an export and writes the data paths m selects
+// under dest, keeping their layout, modes and modification times. Ownership
+// is not restored. Nothing is written through symlinks, including symlinks
+// extracted earlier, so an export cannot write outside dest. Hard links are
+// recreated when their target was extracted too; devices and other special
+// files are skipped. It fails after the walk
+// when a pattern matched nothing.
+func Extract(r io.Reader, dest string, m *PathMatcher, opts ExtractOptions) ([]ExtractedPath, error) {
+	var out []ExtractedPath
+	written := map[string]string{}
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+	_, _, err := WalkData(r, func(p string, hdr *tar.Header, body io.Reader) error {
+		if !m.Match(p) {
+			_, err := io.Copy(io.Discard, body)
+			return err
+		}
+		e := NewEntry(hdr)
+		res := ExtractedPath{Path: p, Type: e.Type, Size: e.Size, Status: Extracted}
+		target := filepath.Join(dest, filepath.FromSlash(p))
+		if opts.DryRun {
+			res.Status = WouldExtract
+			out = append(out, res)
+			return nil
+		}
+		if err := checkNoSymlinks(dest, filepath.Dir(target)); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if e.Type == EntryDir {
+			if err := os.MkdirAll(target, 0o700); err != nil {
+				return err
+			}
+			if err := checkNoSymlinks(dest, target); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{target, os.FileMode(e.Mode) & os.ModePerm})
+			out = append(out, res)
+			return nil
+		}
+		if _, err := os.Lstat(target); err == nil {
+			if !opts.Overwrite {
+				res.Status = SkippedExists
+				out = append(out, res)
+				return nil
+			}
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+		switch e.Type {
+		case EntryFile:
+			if err := writeFile(target, body, os.FileMode(e.Mode)&os.ModePerm); err != nil {
+				return err
+			}
+			_ = os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		case EntrySymlink:
+			if err := os.Symlink(e.Link, target); err != nil {
+				return err
+			}
+		case EntryHardlink:
+			src, ok := written[e.Link]
+			if !ok {
+				res.Status = SkippedLink
+				out = append(out, res)
+				return nil
+			}
+			if err := os.Link(src, target); err != nil {
+				return err
+			}
+		default:
+			res.Status = SkippedSpecial
+			out = append(out, res)
+			return nil
+		}
+		written[p] = target
+		out = append(out, res)
+		return nil
+	})
+	// Directory modes last, so read-only directories can be filled first.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Chmod(dirs[i].path, dirs[i].mode)
+	}
+	if err != nil {
+		return out, err
+	}
+	if missing := m.Unmatched(); len(missing) > 0 {
+		return out, fmt.Errorf("no paths match %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+func writeFile(target string, body io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkNoSymlinks fails when dir or one of its parents below dest is a
+// symlink.
+func checkNoSymlinks(dest, dir string) error {
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+	cur := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, part)
+		info, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to extract through symlink %s", cur)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// IndexPath is where Incus stores the backup index inside export tarballs.
+const IndexPath = "backup/index.yaml"
+
+// Index mirrors the subset of Incus' backup/index.yaml we inspect.
+type Index struct {
+	Name      string       `yaml:"name" json:"name"`
+	Backend   string       `yaml:"backend" json:"backend"`
+	Pool      string       `yaml:"pool" json:"pool"`
+	Type      string       `yaml:"type" json:"type"` // container|virtual-machine|custom|bucket
+	Snapshots []string     `yaml:"snapshots,omitempty" json:"snapshots,omitempty"`
+	Optimized *bool        `yaml:"optimized,omitempty" json:"optimized,omitempty"`
+	Config    *IndexConfig `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// IndexConfig is the embedded backup.yaml content.
+type IndexConfig struct {
+	Container *IndexInstance `yaml:"container,omitempty" json:"container,omitempty"`
+	Volume    *IndexVolume   `yaml:"volume,omitempty" json:"volume,omitempty"`
+}
+
+// IndexInstance carries the instance definition captured in the index.
+type IndexInstance struct {
+	Name         string                       `yaml:"name" json:"name"`
+	Project      string                       `yaml:"project" json:"project"`
+	Type         string                       `yaml:"type" json:"type"`
+	Architecture string                       `yaml:"architecture" json:"architecture"`
+	Profiles     []string                     `yaml:"profiles" json:"profiles"`
+	Config       map[string]string            `yaml:"config" json:"config"`
+	Devices      map[string]map[string]string `yaml:"devices" json:"devices"`
+}
+
+// IndexVolume carries the custom volume definition captured in the index.
+type IndexVolume struct {
+	Name        string            `yaml:"name" json:"name"`
+	Project     string            `yaml:"project" json:"project"`
+	ContentType string            `yaml:"content_type" json:"contentType"`
+	Config      map[string]string `yaml:"config" json:"config"`
+}
+
+// ParseIndex decodes an index.yaml document.
+func ParseIndex(data []byte) (*Index, error) {
+	var idx Index
+	if err := yaml.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("archive: parse %s: %w", IndexPath, err)
+	}
+	return &idx, nil
+}
+
+// Project returns the source project recorded in the index, if any.
+func (i *Index) Project() string {
+	if i == nil || i.Config == nil {
+		return ""
+	}
+	if i.Config.Container != nil {
+		return i.Config.Container.Project
+	}
+	if i.Config.Volume != nil {
+		return i.Config.Volume.Project
+	}
+	return ""
+}
+
+// CheckAgainst compares the index with the resource recorded in a manifest and
+// returns a list of human-readable mismatches. kind is "instance" or "volume".
+func (i *Index) CheckAgainst(kind, project, name string) []string {
+	var problems []string
+	if i.Name != name {
+		problems = append(problems, fmt.Sprintf("index name %q does not match manifest name %q", i.Name, name))
+	}
+	switch kind {
+	case "instance":
+		if i.Type != "container" && i.Type != "virtual-machine" {
+			problems = append(problems, fmt.Sprintf("index type %q is not an instance type", i.Type))
+		}
+	case "volume":
+		if i.Type != "custom" {
+			problems = append(problems, fmt.Sprintf("index type %q is not a custom volume", i.Type))
+		}
+	}
+	// Older servers do not embed the project; only compare when present.
+	if p := i.Project(); p != "" && project != "" && p != project {
+		problems = append(problems, fmt.Sprintf("index project %q does not match manifest project %q", p, project))
+	}
+	return problems
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Summary describes the structure of an Incus export tarball.
+type Summary struct {
+	Compression string `json:"compression"`
+	Entries     int    `json:"entries"`
+	// DataPath is the tar prefix or file holding the root filesystem or volume data.
+	DataPath  string `json:"dataPath,omitempty"`
+	DataFiles int    `json:"dataFiles"`
+	DataBytes int64  `json:"dataBytes"`
+	Index     *Index `json:"index,omitempty"`
+}
+
+// dataPrefixes lists where Incus places instance/volume contents, in order of
+// preference. Directory prefixes end with a slash; others are single files.
+var dataPrefixes = []string{
+	"backup/container/rootfs/",
+	"backup/virtual-machine.img",
+	"backup/volume/",
+	"backup/volume.img",
+	"backup/container.bin",
+	"backup/virtual-machine.bin",
+	"backup/volume.bin",
+}
+
+// DataPrefix returns the data prefix matched by a tar member name, if any.
+func DataPrefix(name string) (string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	for _, p := range dataPrefixes {
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(name, p) {
+				return p, true
+			}
+			continue
+		}
+		if name == p {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Inspect stream-decompresses an export and walks every tar member, reading
+// each body fully so truncation or corruption surfaces as an error. It parses
+// backup/index.yaml and tallies the files and bytes under the data prefix.
+func Inspect(r io.Reader) (Summary, error) {
+	var sum Summary
+	plain, compression, err := Decompress(r)
+	sum.Compression = compression
+	if err != nil {
+		return sum, err
+	}
+	err = Walk(plain, func(hdr *tar.Header, body io.Reader) error {
+		sum.Entries++
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if name == IndexPath {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			idx, err := ParseIndex(data)
+			if err != nil {
+				return err
+			}
+			sum.Index = idx
+			return nil
+		}
+		if prefix, ok := DataPrefix(name); ok && (sum.DataPath == "" || sum.DataPath == prefix) {
+			sum.DataPath = prefix
+			if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+				sum.DataFiles++
+				sum.DataBytes += hdr.Size
+			}
+		}
+		_, err := io.Copy(io.Discard, body)
+		return err
+	})
+	if err != nil {
+		return sum, err
+	}
+	// Drain the remainder so compressed trailers (CRCs) are validated.
+	if _, err := io.Copy(io.Discard, plain); err != nil {
+		return sum, fmt.Errorf("archive: read trailer: %w", err)
+	}
+	if sum.Index == nil {
+		return sum, fmt.Errorf("archive: %s not found", IndexPath)
+	}
+	return sum, nil
+}
+
+// Walk iterates over the tar members of an uncompressed stream, calling fn with
+// each header and a reader over its body.
+func Walk(r io.Reader, fn func(hdr *tar.Header, body io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("archive: read tar: %w", err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("archive: truncated member %s: %w", hdr.Name, err)
+			}
+			return err
+		}
+	}
+}
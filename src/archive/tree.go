@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Entry types reported in a Tree.
+const (
+	EntryFile     = "file"
+	EntryDir      = "dir"
+	EntrySymlink  = "symlink"
+	EntryHardlink = "hardlink"
+	EntryOther    = "other"
+)
+
+// Entry describes one member of an export's data.
+type Entry struct {
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	Mode int64  `json:"mode"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+	Link string `json:"link,omitempty"`
+	// SHA256 is the content digest of regular files.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Tree is the index and data listing of an export tarball.
+type Tree struct {
+	Index *Index `json:"index"`
+	// DataPath is the data prefix of the export, as in Summary.
+	DataPath string `json:"dataPath,omitempty"`
+	// Entries maps paths to their entries. Paths under a directory prefix
+	// (the container rootfs, a filesystem volume) are absolute within it,
+	// e.g. /etc/hostname; disk images are listed under their file name.
+	// Instance snapshots stored in the export are not listed.
+	Entries map[string]Entry `json:"entries"`
+}
+
+// ReadTree stream-decompresses an export and lists its data, hashing every
+// regular file.
+func ReadTree(r io.Reader) (*Tree, error) {
+	tree := &Tree{Entries: map[string]Entry{}}
+	var err error
+	tree.Index, tree.DataPath, err = WalkData(r, func(p string, hdr *tar.Header, body io.Reader) error {
+		entry := NewEntry(hdr)
+		if entry.Type == EntryFile {
+			h := sha256.New()
+			n, err := io.Copy(h, body)
+			if err != nil {
+				return err
+			}
+			entry.Size, entry.SHA256 = n, hex.EncodeToString(h.Sum(nil))
+		}
+		tree.Entries[p] = entry
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// DataFunc is called by WalkData for each member of an export's data, with
+// its path as in Tree.Entries.
+type DataFunc func(p string, hdr *tar.Header, body io.Reader) error
+
+// WalkData stream-decompresses an export and calls fn for each member of its
+// data, skipping instance snapshots. It returns the export's index and data
+// prefix.
+func WalkData(r io.Reader, fn DataFunc) (*Index, string, error) {
+	plain, _, err := Decompress(r)
+	if err != nil {
+		return nil, "", err
+	}
+	var index *Index
+	var dataPath string
+	err = Walk(plain, func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if name == IndexPath {
+			data, err := io.ReadAll(body)
+			if err != nil {
+				return err
+			}
+			index, err = ParseIndex(data)
+			return err
+		}
+		p, prefix, ok := DataMemberPath(name)
+		if !ok || (dataPath != "" && dataPath != prefix) || p == "/" {
+			_, err := io.Copy(io.Discard, body)
+			return err
+		}
+		dataPath = prefix
+		return fn(p, hdr, body)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := io.Copy(io.Discard, plain); err != nil {
+		return nil, "", fmt.Errorf("archive: read trailer: %w", err)
+	}
+	if index == nil {
+		return nil, "", fmt.Errorf("archive: %s not found", IndexPath)
+	}
+	return index, dataPath, nil
+}
+
+// DataMemberPath maps a tar member name to its data path and prefix: paths
+// under a directory prefix are absolute within it, disk images are their
+// file name.
+func DataMemberPath(name string) (string, string, bool) {
+	name = strings.TrimPrefix(name, "./")
+	prefix, ok := DataPrefix(name)
+	if !ok {
+		return "", "", false
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		return path.Base(prefix), prefix, true
+	}
+	return path.Clean("/" + strings.TrimPrefix(name, prefix)), prefix, true
+}
+
+// NewEntry describes a tar member of an export's data. Size is set for
+// regular files only.
+func NewEntry(hdr *tar.Header) Entry {
+	e := Entry{Type: entryType(hdr.Typeflag), Mode: hdr.Mode & 0o7777, UID: hdr.Uid, GID: hdr.Gid, Link: hdr.Linkname}
+	switch e.Type {
+	case EntryFile:
+		e.Size = hdr.Size
+	case EntryHardlink:
+		// Hard links name their target by tar member name.
+		if p, _, ok := DataMemberPath(hdr.Linkname); ok {
+			e.Link = p
+		}
+	}
+	return e
+}
+
+func entryType(flag byte) string {
+	switch flag {
+	case tar.TypeReg, tar.TypeRegA:
+		return EntryFile
+	case tar.TypeDir:
+		return EntryDir
+	case tar.TypeSymlink:
+		return EntrySymlink
+	case tar.TypeLink:
+		return EntryHardlink
+	default:
+		return EntryOther
+	}
+}
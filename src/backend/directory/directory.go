@@ -31,7 +31,7 @@ func New(root string) (*Backend, error) {
 }
 
 func (b *Backend) List(kind string) ([]backend.Entry, error) {
-    kinds := []string{backend.KindInstance, backend.KindVolume, backend.KindImage, backend.KindConfig}
+    kinds := []string{backend.KindInstance, backend.KindVolume, backend.KindBucket, backend.KindImage, backend.KindConfig}
     if kind != "" && kind != backend.KindAll {
         kinds = []string{kind}
     }
@@ -50,6 +50,12 @@ func (b *Backend) List(kind string) ([]backend.Entry, error) {
                 return nil, err
             }
             entries = append(entries, e...)
+        case backend.KindBucket:
+            e, err := b.listPoolScoped("buckets", "bucket")
+            if err != nil {
+                return nil, err
+            }
+            entries = append(entries, e...)
         case backend.KindImage:
             e, err := b.listImages()
             if err != nil {
@@ -94,8 +100,13 @@ func (b *Backend) listInstances() ([]backend.Entry, error) {
 }
 
 func (b *Backend) listVolumes() ([]backend.Entry, error) {
-    base := filepath.Join(b.Root, "volumes")
-    // volumes/<project>/<pool>/<name>/<timestamp>
+    return b.listPoolScoped("volumes", "volume")
+}
+
+// listPoolScoped lists <dir>/<project>/<pool>/<name>/<timestamp> versions as
+// entries of type typ.
+func (b *Backend) listPoolScoped(dir, typ string) ([]backend.Entry, error) {
+    base := filepath.Join(b.Root, dir)
     var entries []backend.Entry
     // project level
     projDirs, err := readDirNames(base)
@@ -125,7 +136,7 @@ func (b *Backend) listVolumes() ([]backend.Entry, error) {
                 }
                 for _, ts := range timestamps {
                     full := filepath.Join(tsPath, ts)
-                    entries = append(entries, backend.Entry{Type: "volume", Project: project, Pool: pool, Name: name, Timestamp: ts, Path: full})
+                    entries = append(entries, backend.Entry{Type: typ, Project: project, Pool: pool, Name: name, Timestamp: ts, Path: full})
                 }
             }
         }
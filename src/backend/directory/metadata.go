@@ -0,0 +1,144 @@
+package directory
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"incus-backup/src/util/flock"
+	"incus-backup/src/version"
+)
+
+const (
+	// MetadataFile is the repository header at the root of a directory target.
+	MetadataFile = "metadata.json"
+	// MetadataSchemaVersion is the repository layout version written by this build.
+	MetadataSchemaVersion = 1
+	// LockFile coordinates concurrent processes writing to or pruning a target.
+	LockFile = ".incus-backup.lock"
+)
+
+// ErrAlreadyInitialized is returned by Init when metadata.json already exists.
+var ErrAlreadyInitialized = errors.New("repository already initialized")
+
+// Metadata is the repository header stored in metadata.json.
+type Metadata struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	RepoID        string    `json:"repoId"`
+	CreatedAt     time.Time `json:"createdAt"`
+	ToolVersion   string    `json:"toolVersion,omitempty"`
+	Defaults      Defaults  `json:"defaults"`
+}
+
+// Defaults records how exports in this repository are stored.
+type Defaults struct {
+	// Compression is the export compression; "incus" means the server default.
+	Compression string `json:"compression"`
+	// Encryption is "none" for plain directory targets.
+	Encryption string `json:"encryption"`
+}
+
+// Init creates root if needed and writes a fresh metadata.json.
+func Init(root string, now time.Time) (Metadata, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return Metadata{}, err
+	}
+	path := filepath.Join(root, MetadataFile)
+	if _, err := os.Stat(path); err == nil {
+		return Metadata{}, fmt.Errorf("%w: %s", ErrAlreadyInitialized, path)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Metadata{}, err
+	}
+	md := Metadata{
+		SchemaVersion: MetadataSchemaVersion,
+		RepoID:        hex.EncodeToString(id),
+		CreatedAt:     now.UTC(),
+		ToolVersion:   version.Version,
+		Defaults:      Defaults{Compression: "incus", Encryption: "none"},
+	}
+	b, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return Metadata{}, err
+	}
+	// Write via a temp file so a crash never leaves a half-written header.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), 0o644); err != nil {
+		return Metadata{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return Metadata{}, err
+	}
+	return md, nil
+}
+
+// LoadMetadata reads and validates metadata.json. A missing file is reported
+// with an error wrapping os.ErrNotExist.
+func LoadMetadata(root string) (Metadata, error) {
+	path := filepath.Join(root, MetadataFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Metadata{}, err
+	}
+	var md Metadata
+	if err := json.Unmarshal(b, &md); err != nil {
+		return Metadata{}, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if md.SchemaVersion <= 0 || md.RepoID == "" {
+		return Metadata{}, fmt.Errorf("invalid %s: missing schemaVersion or repoId", path)
+	}
+	if md.SchemaVersion > MetadataSchemaVersion {
+		return Metadata{}, fmt.Errorf("%s uses repository schema v%d; this build supports up to v%d", path, md.SchemaVersion, MetadataSchemaVersion)
+	}
+	return md, nil
+}
+
+// ValidateMetadata checks metadata.json when present. Targets created before
+// repository headers existed (or not yet backed up to) are accepted.
+func ValidateMetadata(root string) error {
+	if _, err := LoadMetadata(root); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// EnsureMetadata loads metadata.json, initializing the repository on first use.
+func EnsureMetadata(root string, now time.Time) (Metadata, error) {
+	md, err := LoadMetadata(root)
+	if errors.Is(err, os.ErrNotExist) {
+		md, err = Init(root, now)
+		if errors.Is(err, ErrAlreadyInitialized) {
+			// Lost a race with a concurrent writer; use its header.
+			return LoadMetadata(root)
+		}
+	}
+	return md, err
+}
+
+// LockShared takes the target lock for writers such as backup. Any number of
+// shared holders may coexist, but they exclude an exclusive holder.
+func LockShared(root string) (*flock.Lock, error) {
+	return lockTarget(root, false, "")
+}
+
+// LockExclusive takes the target lock for destructive operations such as prune.
+func LockExclusive(root, owner string) (*flock.Lock, error) {
+	return lockTarget(root, true, owner)
+}
+
+func lockTarget(root string, exclusive bool, owner string) (*flock.Lock, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	l, err := flock.TryLock(filepath.Join(root, LockFile), exclusive, owner)
+	if errors.Is(err, flock.ErrLocked) {
+		return nil, fmt.Errorf("target %s is in use by another incus-backup process: %w", root, err)
+	}
+	return l, err
+}
@@ -37,7 +37,7 @@ func New(ctx context.Context, bin restic.BinaryInfo, repo string) (*Backend, err
 }
 
 func (b *Backend) List(kind string) ([]backend.Entry, error) {
-	kinds := []string{backend.KindInstance, backend.KindVolume, backend.KindImage, backend.KindConfig}
+	kinds := []string{backend.KindInstance, backend.KindVolume, backend.KindBucket, backend.KindImage, backend.KindConfig}
 	if kind != "" && kind != backend.KindAll {
 		kinds = []string{kind}
 	}
@@ -57,6 +57,12 @@ func (b *Backend) List(kind string) ([]backend.Entry, error) {
 				return nil, err
 			}
 			entries = append(entries, e...)
+		case backend.KindBucket:
+			e, err := b.listPoolScoped("bucket")
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e...)
 		case backend.KindImage:
 			e, err := b.listImages()
 			if err != nil {
@@ -102,13 +108,18 @@ func (b *Backend) List(kind string) ([]backend.Entry, error) {
 }
 
 func (b *Backend) listInstances() ([]backend.Entry, error) {
-	snaps, err := listSnapshots(b.ctx, b.bin, b.repo, []string{"type=instance", "part=manifest"})
+	snaps, err := listSnapshots(b.ctx, b.bin, b.repo, []string{"type=instance"})
 	if err != nil {
 		return nil, err
 	}
 	var entries []backend.Entry
 	seen := map[string]struct{}{}
 	for _, snap := range snaps {
+		// A version is listed once its manifest exists, either as a bundle
+		// or as a legacy part=manifest snapshot.
+		if !snap.HasPart("manifest") {
+			continue
+		}
 		tags := snap.TagMap()
 		project := tags["project"]
 		name := tags["name"]
@@ -133,13 +144,24 @@ func (b *Backend) listInstances() ([]backend.Entry, error) {
 }
 
 func (b *Backend) listVolumes() ([]backend.Entry, error) {
-	snaps, err := listSnapshots(b.ctx, b.bin, b.repo, []string{"type=volume", "part=manifest"})
+	return b.listPoolScoped("volume")
+}
+
+// listPoolScoped lists the versions of pool-scoped resources (volumes and
+// buckets) tagged type=typ.
+func (b *Backend) listPoolScoped(typ string) ([]backend.Entry, error) {
+	snaps, err := listSnapshots(b.ctx, b.bin, b.repo, []string{"type=" + typ})
 	if err != nil {
 		return nil, err
 	}
 	var entries []backend.Entry
 	seen := map[string]struct{}{}
 	for _, snap := range snaps {
+		// A version is listed once its manifest exists, either as a bundle
+		// or as a legacy part=manifest snapshot.
+		if !snap.HasPart("manifest") {
+			continue
+		}
 		tags := snap.TagMap()
 		project := tags["project"]
 		pool := tags["pool"]
@@ -154,7 +176,7 @@ func (b *Backend) listVolumes() ([]backend.Entry, error) {
 		}
 		seen[key] = struct{}{}
 		entries = append(entries, backend.Entry{
-			Type:      "volume",
+			Type:      typ,
 			Project:   project,
 			Pool:      pool,
 			Name:      name,
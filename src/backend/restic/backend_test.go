@@ -28,6 +28,16 @@ func TestBackendListInstances(t *testing.T) {
 					Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
 					Tags: []string{"type=instance", "part=manifest", "project=alpha", "name=vm1"},
 				},
+				{
+					ID:   "bundle-3",
+					Time: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+					Tags: []string{"type=instance", resticlib.BundleSchemaTag, "project=alpha", "name=vm1", "timestamp=20240103T000000Z"},
+				},
+				{
+					ID:   "orphan-data",
+					Time: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC),
+					Tags: []string{"type=instance", "part=data", "project=alpha", "name=vm1", "timestamp=20240104T000000Z"},
+				},
 			}, nil
 		}
 		return nil, nil
@@ -44,8 +54,8 @@ func TestBackendListInstances(t *testing.T) {
 	if err != nil {
 		t.Fatalf("List instances: %v", err)
 	}
-	if len(entries) != 2 {
-		t.Fatalf("expected 2 entries, got %d", len(entries))
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries (data-only parts are not listed), got %d", len(entries))
 	}
 
 	if entries[0].Project != "alpha" || entries[0].Name != "vm1" || entries[0].Timestamp != "20240101T000000Z" || entries[0].Path != "snap-1" {
@@ -54,6 +64,9 @@ func TestBackendListInstances(t *testing.T) {
 	if entries[1].Timestamp != "20240102T000000Z" {
 		t.Fatalf("expected fallback timestamp from snapshot time, got %q", entries[1].Timestamp)
 	}
+	if entries[2].Path != "bundle-3" {
+		t.Fatalf("expected bundle snapshot to be listed, got %#v", entries[2])
+	}
 }
 
 func TestBackendListVolumes(t *testing.T) {
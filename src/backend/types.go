@@ -3,10 +3,10 @@ package backend
 // Entry represents a single backup snapshot entry discovered in a backend.
 // It is intentionally generic so the CLI can render a consolidated view.
 type Entry struct {
-    Type        string // instance|volume|image|config
-    Project     string // for instances/volumes
-    Pool        string // for volumes
-    Name        string // instance or volume name
+    Type        string // instance|volume|bucket|image|config
+    Project     string // for instances/volumes/buckets
+    Pool        string // for volumes/buckets
+    Name        string // instance, volume or bucket name
     Fingerprint string // image fingerprint
     Timestamp   string // YYYYMMDDThhmmssZ
     Path        string // absolute filesystem path to snapshot directory
@@ -17,6 +17,7 @@ const (
     KindAll      = "all"
     KindInstance = "instances"
     KindVolume   = "volumes"
+    KindBucket   = "buckets"
     KindImage    = "images"
     KindConfig   = "config"
 )
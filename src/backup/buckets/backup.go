@@ -0,0 +1,130 @@
+package buckets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+	pg "incus-backup/src/util/progress"
+)
+
+// BackupBucket exports a storage bucket to
+// buckets/<project>/<pool>/<name>/<ts> under root. Keys are sealed in the
+// manifest when passphrase is not empty.
+func BackupBucket(client incusapi.Client, root, project, pool, name string, passphrase []byte, now time.Time, progressOut io.Writer) (_ string, err error) {
+	ts := now.UTC().Format("20060102T150405Z")
+	snapDir := filepath.Join(root, "buckets", project, pool, name, ts)
+	if err := os.MkdirAll(snapDir, 0o755); err != nil {
+		return "", err
+	}
+	// Do not leave a half-written version behind when the export fails or
+	// is cancelled.
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(snapDir)
+		}
+	}()
+
+	mf, err := newManifest(client, project, pool, name, passphrase, now, progressOut)
+	if err != nil {
+		return "", err
+	}
+
+	// Sealed keys must not also be stored in the export's index, which can
+	// only be rewritten uncompressed.
+	compression := ""
+	if len(passphrase) > 0 {
+		compression = resticCompressionNone
+	}
+	r, err := client.ExportBucket(project, pool, name, compression, progressOut)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	exportPath := filepath.Join(snapDir, "bucket.tar.xz")
+	f, err := os.Create(exportPath)
+	if err != nil {
+		return "", err
+	}
+	reader := io.Reader(r)
+	if s, ok := r.(interface{ Stat() (os.FileInfo, error) }); ok && progressOut != nil {
+		if fi, err := s.Stat(); err == nil {
+			reader = pg.NewReader(r, fi.Size(), "write", progressOut)
+		}
+	}
+	if len(passphrase) > 0 {
+		stripped := withoutIndexKeys(reader, true)
+		defer stripped.Close()
+		reader = stripped
+	}
+	rec := &manifest.Recorder{}
+	if _, err := io.Copy(f, io.TeeReader(reader, rec)); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	mf.Export = rec.Export("bucket.tar.xz")
+	if err := writeManifest(filepath.Join(snapDir, "manifest.json"), mf); err != nil {
+		return "", err
+	}
+	if err := writeChecksums(snapDir, []string{"bucket.tar.xz", "manifest.json"}); err != nil {
+		return "", err
+	}
+	return snapDir, nil
+}
+
+// writeManifest writes mf readable by the owner only, as it may hold
+// plaintext bucket keys.
+func writeManifest(path string, mf Manifest) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(mf)
+}
+
+func writeChecksums(dir string, files []string) error {
+	out, err := os.Create(filepath.Join(dir, "checksums.txt"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, name := range files {
+		p := filepath.Join(dir, name)
+		sum, err := sha256File(p)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%s  %s\n", sum, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
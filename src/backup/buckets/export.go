@@ -0,0 +1,88 @@
+package buckets
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// indexKeysField is where Incus records a bucket's keys, access and secret
+// keys included, in the export's backup/index.yaml.
+const indexKeysField = "bucket_keys"
+
+// withoutIndexKeys streams an uncompressed bucket export with bucket_keys
+// removed from backup/index.yaml, gzip-compressed when compress is set. It
+// is used when the keys are sealed in the manifest, so they are not also
+// stored in plaintext inside the export. Restores recreate them from the
+// manifest.
+func withoutIndexKeys(export io.Reader, compress bool) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		var w io.Writer = pw
+		var zw *gzip.Writer
+		if compress {
+			zw = gzip.NewWriter(pw)
+			w = zw
+		}
+		err := stripIndexKeys(export, w)
+		if err == nil && zw != nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// stripIndexKeys copies a tar stream from r to w, dropping bucket_keys from
+// backup/index.yaml.
+func stripIndexKeys(r io.Reader, w io.Writer) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read bucket export: %w", err)
+		}
+		if hdr.Name != "backup/index.yaml" {
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		var index yaml.MapSlice
+		if err := yaml.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("parse bucket export index: %w", err)
+		}
+		kept := index[:0]
+		for _, item := range index {
+			if item.Key != indexKeysField {
+				kept = append(kept, item)
+			}
+		}
+		if data, err = yaml.Marshal(kept); err != nil {
+			return err
+		}
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
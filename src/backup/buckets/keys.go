@@ -0,0 +1,132 @@
+package buckets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+
+	"incus-backup/src/incusapi"
+)
+
+// ErrKeysLocked is returned when a manifest holds encrypted keys and no
+// passphrase was given.
+var ErrKeysLocked = errors.New("bucket keys are encrypted; a passphrase is required to restore them")
+
+// scrypt parameters for deriving the AES-256 key from a passphrase.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// EncryptedKeys holds bucket keys sealed with AES-256-GCM under a key
+// derived from a passphrase with scrypt.
+type EncryptedKeys struct {
+	KDF        string `json:"kdf"` // scrypt
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// SealKeys encrypts keys with passphrase.
+func SealKeys(keys []Key, passphrase []byte) (*EncryptedKeys, error) {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	enc := &EncryptedKeys{KDF: "scrypt", Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, enc.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, enc.Salt)
+	if err != nil {
+		return nil, err
+	}
+	enc.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, enc.Nonce); err != nil {
+		return nil, err
+	}
+	enc.Ciphertext = aead.Seal(nil, enc.Nonce, plain, nil)
+	return enc, nil
+}
+
+// Open decrypts the keys with passphrase.
+func (e *EncryptedKeys) Open(passphrase []byte) ([]Key, error) {
+	if e.KDF != "scrypt" {
+		return nil, fmt.Errorf("bucket keys: unsupported kdf %q", e.KDF)
+	}
+	aead, err := newAEAD(passphrase, e.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, e.Nonce, e.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("bucket keys: wrong passphrase or corrupted manifest")
+	}
+	var keys []Key
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("bucket keys: %w", err)
+	}
+	return keys, nil
+}
+
+func newAEAD(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// BucketKeys returns the keys recorded in the manifest, decrypting them with
+// passphrase if needed. It returns ErrKeysLocked for encrypted keys when
+// passphrase is empty.
+func (m Manifest) BucketKeys(passphrase []byte) ([]Key, error) {
+	if m.EncryptedKeys == nil {
+		return m.Keys, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrKeysLocked
+	}
+	return m.EncryptedKeys.Open(passphrase)
+}
+
+// restoreKeys creates the keys missing from the restored bucket. Incus may
+// already have recreated them from the backup tarball; those are left alone.
+func restoreKeys(client incusapi.Client, project, pool, name string, keys []Key, progressOut io.Writer) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	existing, err := client.ListBucketKeys(project, pool, name)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for _, k := range existing {
+		have[k.Name] = true
+	}
+	created := 0
+	for _, k := range keys {
+		if have[k.Name] {
+			continue
+		}
+		if err := client.CreateBucketKey(project, pool, name, incusapi.BucketKey(k)); err != nil {
+			return fmt.Errorf("create key %s of bucket %s/%s: %w", k.Name, pool, name, err)
+		}
+		created++
+	}
+	if progressOut != nil {
+		fmt.Fprintf(progressOut, "[keys] %s/%s: created=%d existing=%d\n", pool, name, created, len(keys)-created)
+	}
+	return nil
+}
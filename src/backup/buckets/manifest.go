@@ -0,0 +1,138 @@
+package buckets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+)
+
+// Manifest captures metadata for a storage bucket export. Bucket keys are
+// stored either in Keys or, when a passphrase was given, sealed in
+// EncryptedKeys.
+type Manifest struct {
+	SchemaVersion int              `json:"schemaVersion"`
+	Type          string           `json:"type"` // bucket
+	Project       string           `json:"project"`
+	Pool          string           `json:"pool"`
+	Name          string           `json:"name"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	ToolVersion   string           `json:"toolVersion,omitempty"`
+	Server        *manifest.Server `json:"server,omitempty"`
+	Source        *Source          `json:"source,omitempty"`
+	Keys          []Key            `json:"keys,omitempty"`
+	EncryptedKeys *EncryptedKeys   `json:"encryptedKeys,omitempty"`
+	Export        *manifest.Export `json:"export,omitempty"`
+	Restic        *manifest.Restic `json:"restic,omitempty"`
+}
+
+// Source records the bucket definition at backup time.
+type Source struct {
+	PoolDriver  string            `json:"poolDriver,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+}
+
+// Key is a bucket access key as recorded in the manifest.
+type Key struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Role        string `json:"role"`
+	AccessKey   string `json:"accessKey"`
+	SecretKey   string `json:"secretKey"`
+}
+
+// ParseManifest decodes a bucket manifest, migrating older schemas.
+func ParseManifest(b []byte) (Manifest, error) {
+	var mf Manifest
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return Manifest{}, err
+	}
+	if err := manifest.Migrate(&mf.SchemaVersion); err != nil {
+		return Manifest{}, err
+	}
+	return mf, nil
+}
+
+// Compatibility returns warnings about restoring this backup onto dst.
+func (m Manifest) Compatibility(dst incusapi.ServerInfo) []string {
+	return manifest.Compatibility(m.Server, "", dst)
+}
+
+// newManifest gathers server, bucket and key metadata for a fresh backup.
+// Keys are sealed with passphrase when it is not empty. Server and bucket
+// metadata that cannot be read is left out with a warning.
+func newManifest(client incusapi.Client, project, pool, name string, passphrase []byte, now time.Time, progressOut io.Writer) (Manifest, error) {
+	mf := Manifest{
+		SchemaVersion: manifest.SchemaVersion,
+		Type:          "bucket",
+		Project:       project,
+		Pool:          pool,
+		Name:          name,
+		CreatedAt:     now.UTC(),
+		ToolVersion:   manifest.ToolVersion(),
+	}
+	// Server and source metadata only inform restores; an export is still
+	// worth keeping when they cannot be read. The keys are part of the
+	// backup and must be read.
+	warn := func(format string, args ...any) {
+		if progressOut != nil {
+			fmt.Fprintf(progressOut, "[warn] %s/%s: "+format+"\n", append([]any{pool, name}, args...)...)
+		}
+	}
+	info, err := client.Server()
+	if err != nil {
+		warn("server info not recorded: %v", err)
+	} else {
+		mf.Server = manifest.ServerFrom(info)
+	}
+	if b, err := client.GetBucket(project, pool, name); err != nil {
+		warn("bucket source not recorded: %v", err)
+	} else {
+		src := &Source{Description: b.Description, Config: b.Config}
+		pools, err := client.ListStoragePools()
+		if err != nil {
+			warn("storage pool driver not recorded: %v", err)
+		}
+		for _, p := range pools {
+			if p.Name == pool {
+				src.PoolDriver = p.Driver
+			}
+		}
+		mf.Source = src
+	}
+
+	apiKeys, err := client.ListBucketKeys(project, pool, name)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("list keys of bucket %s/%s: %w", pool, name, err)
+	}
+	keys := make([]Key, 0, len(apiKeys))
+	for _, k := range apiKeys {
+		keys = append(keys, Key(k))
+	}
+	if len(passphrase) == 0 {
+		mf.Keys = keys
+		return mf, nil
+	}
+	if mf.EncryptedKeys, err = SealKeys(keys, passphrase); err != nil {
+		return Manifest{}, err
+	}
+	return mf, nil
+}
+
+// warnCompatibility prints manifest compatibility warnings for the destination.
+func warnCompatibility(client incusapi.Client, mf Manifest, progressOut io.Writer) {
+	if progressOut == nil {
+		return
+	}
+	info, err := client.Server()
+	if err != nil {
+		return
+	}
+	for _, w := range mf.Compatibility(info) {
+		fmt.Fprintf(progressOut, "[warn] %s/%s: %s\n", mf.Pool, mf.Name, w)
+	}
+}
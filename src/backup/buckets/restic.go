@@ -0,0 +1,115 @@
+package buckets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	manifestpkg "incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/restic"
+)
+
+const (
+	resticBucketDataFilename      = "bucket.tar"
+	resticBucketManifestFilename  = "manifest.json"
+	resticBucketChecksumsFilename = "checksums.txt"
+	resticCompressionNone         = "none"
+)
+
+// BackupBucketRestic streams a bucket export into a restic repository.
+func BackupBucketRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, project, pool, name string, passphrase []byte, now time.Time, progressOut io.Writer) (manifestpkg.Stored, error) {
+	if err := restic.EnsureRepository(ctx, bin, repo); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+
+	manifest, err := newManifest(client, project, pool, name, passphrase, now, progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	ts := now.UTC().Format("20060102T150405Z")
+
+	export, err := client.ExportBucket(project, pool, name, resticCompressionNone, progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	defer export.Close()
+
+	data := io.Reader(export)
+	if len(passphrase) > 0 {
+		// Sealed keys must not also be stored in the export's index.
+		stripped := withoutIndexKeys(export, false)
+		defer stripped.Close()
+		data = stripped
+	}
+	hash := sha256.New()
+	rec := &manifestpkg.Recorder{}
+	reader := io.TeeReader(data, io.MultiWriter(hash, rec))
+
+	summary, err := restic.BackupStream(ctx, bin, repo, resticBucketDataFilename, ResticTags(project, pool, name, ts, "data"), reader, progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	manifest.Export = rec.Export(resticBucketDataFilename)
+	manifest.Restic = manifestpkg.ResticFrom(summary)
+	checksums := []byte(fmt.Sprintf("%s  %s\n", sum, resticBucketDataFilename))
+
+	// Store the manifest and checksums with the data as a single snapshot.
+	bundled := manifest
+	bundled.Restic = manifest.Restic.Bundled()
+	manifestBytes, err := json.MarshalIndent(bundled, "", "  ")
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	files := []restic.File{{Name: resticBucketManifestFilename, Data: manifestBytes}, {Name: resticBucketChecksumsFilename, Data: checksums}}
+	stored := manifestpkg.Stored{Version: ts, SnapshotID: summary.SnapshotID, DataFile: resticBucketDataFilename, Bytes: manifest.Export.Size, SHA256: sum}
+	bundle, err := restic.BackupBundle(ctx, bin, repo, summary, resticBucketDataFilename, files, ResticTags(project, pool, name, ts, ""), progressOut)
+	if err == nil {
+		stored.SnapshotID = bundle.SnapshotID
+		return stored, nil
+	}
+	if !errors.Is(err, restic.ErrBundleUnsupported) {
+		return manifestpkg.Stored{}, err
+	}
+
+	// Fall back to the legacy layout with one snapshot per part.
+	manifestBytes, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticBucketManifestFilename, ResticTags(project, pool, name, ts, "manifest"), manifestBytes, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticBucketChecksumsFilename, ResticTags(project, pool, name, ts, "checksums"), checksums, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	return stored, nil
+}
+
+// ResticTags returns the restic tags for one part of a bucket version; an
+// empty part tags a bundle snapshot.
+func ResticTags(project, pool, name, ts, part string) []string {
+	schema := "schema=v1"
+	if part == "" {
+		schema = restic.BundleSchemaTag
+	}
+	tags := []string{
+		"type=bucket",
+		schema,
+		fmt.Sprintf("project=%s", project),
+		fmt.Sprintf("pool=%s", pool),
+		fmt.Sprintf("name=%s", name),
+		fmt.Sprintf("timestamp=%s", ts),
+	}
+	if part != "" {
+		tags = append(tags, fmt.Sprintf("part=%s", part))
+	}
+	return tags
+}
@@ -0,0 +1,136 @@
+package buckets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"incus-backup/src/incusapi"
+	"incus-backup/src/restic"
+	pg "incus-backup/src/util/progress"
+)
+
+// RestoreBucket imports a bucket from a directory version and recreates its
+// keys from the manifest.
+func RestoreBucket(client incusapi.Client, snapDir, project, poolTarget, targetName string, passphrase []byte, progressOut io.Writer) error {
+	b, err := os.ReadFile(filepath.Join(snapDir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	mf, err := ParseManifest(b)
+	if err != nil {
+		return err
+	}
+	if mf.Type != "bucket" {
+		return fmt.Errorf("not a bucket snapshot: %s", snapDir)
+	}
+	// Decrypt first so a wrong passphrase fails before anything is imported.
+	keys, err := manifestKeys(mf, passphrase, progressOut)
+	if err != nil {
+		return err
+	}
+	warnCompatibility(client, mf, progressOut)
+	f, err := os.Open(filepath.Join(snapDir, "bucket.tar.xz"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var reader io.Reader = f
+	if st, err := f.Stat(); err == nil && progressOut != nil {
+		reader = pg.NewReader(f, st.Size(), "import", progressOut)
+	}
+	if err := client.ImportBucket(project, poolTarget, targetName, reader, progressOut); err != nil {
+		return err
+	}
+	return restoreKeys(client, project, poolTarget, targetName, keys, progressOut)
+}
+
+// RestoreBucketRestic streams a bucket tarball from restic into Incus and
+// recreates its keys from the stored manifest.
+func RestoreBucketRestic(ctx context.Context, bin restic.BinaryInfo, repo string, snapshot restic.Snapshot, client incusapi.Client, project, pool, name string, passphrase []byte, progressOut io.Writer) error {
+	var keys []Key
+	mf, ok, err := loadResticManifest(ctx, bin, repo, snapshot)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if keys, err = manifestKeys(mf, passphrase, progressOut); err != nil {
+			return err
+		}
+		warnCompatibility(client, mf, progressOut)
+	}
+
+	pr, pw := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		err := restic.Dump(ctx, bin, repo, snapshot.ID, resticBucketDataFilename, pw, progressOut)
+		_ = pw.CloseWithError(err)
+		errCh <- err
+	}()
+
+	var reader io.Reader = pr
+	if progressOut != nil {
+		reader = pg.NewReader(reader, 0, "import", progressOut)
+	}
+	importErr := client.ImportBucket(project, pool, name, reader, progressOut)
+	dumpErr := <-errCh
+	if importErr != nil {
+		return importErr
+	}
+	if dumpErr != nil {
+		return fmt.Errorf("restic dump: %w", dumpErr)
+	}
+	return restoreKeys(client, project, pool, name, keys, progressOut)
+}
+
+// manifestKeys returns the keys to recreate. Encrypted keys without a
+// passphrase are skipped with a warning so the contents can still be
+// restored.
+func manifestKeys(mf Manifest, passphrase []byte, progressOut io.Writer) ([]Key, error) {
+	keys, err := mf.BucketKeys(passphrase)
+	if errors.Is(err, ErrKeysLocked) {
+		if progressOut != nil {
+			fmt.Fprintf(progressOut, "[warn] %s/%s: keys are encrypted; pass --keys-passphrase-file to restore them\n", mf.Pool, mf.Name)
+		}
+		return nil, nil
+	}
+	return keys, err
+}
+
+// loadResticManifest loads the manifest stored alongside a data snapshot.
+// Bundles carry the manifest in the same snapshot; ok is false when no
+// manifest part exists.
+func loadResticManifest(ctx context.Context, bin restic.BinaryInfo, repo string, data restic.Snapshot) (_ Manifest, ok bool, _ error) {
+	tags := data.TagMap()
+	manifestID := data.ID
+	if !data.IsBundle() {
+		snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{
+			"type=bucket",
+			"project=" + tags["project"],
+			"pool=" + tags["pool"],
+			"name=" + tags["name"],
+			"timestamp=" + tags["timestamp"],
+			"part=manifest",
+		})
+		if err != nil {
+			return Manifest{}, false, err
+		}
+		if len(snaps) == 0 {
+			return Manifest{}, false, nil
+		}
+		manifestID = snaps[0].ID
+	}
+	var buf bytes.Buffer
+	if err := restic.Dump(ctx, bin, repo, manifestID, resticBucketManifestFilename, &buf, nil); err != nil {
+		return Manifest{}, false, fmt.Errorf("read bucket manifest: %w", err)
+	}
+	mf, err := ParseManifest(buf.Bytes())
+	if err != nil {
+		return Manifest{}, false, err
+	}
+	return mf, true, nil
+}
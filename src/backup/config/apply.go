@@ -1,77 +1,105 @@
 package config
 
 import (
-    "fmt"
-
     "incus-backup/src/incusapi"
 )
 
 // ApplyProjectsPlan applies the given plan using the Incus client.
-// It performs creations and updates before deletions. Returns a summary string.
-func ApplyProjectsPlan(client incusapi.Client, plan ProjectPlan) (string, error) {
-    created := 0
-    updated := 0
-    deleted := 0
+// It performs creations and updates before deletions, which are applied only
+// if allowDelete is true. Returns a summary string.
+func ApplyProjectsPlan(client incusapi.Client, plan ProjectPlan, allowDelete bool) (string, error) {
+    return applyAll(projectsStep(client, plan, allowDelete, nil))
+}
 
-    for _, p := range plan.ToCreate {
-        if err := client.CreateProject(p.Name, p.Config); err != nil {
-            return "", err
+func projectsStep(client incusapi.Client, plan ProjectPlan, allowDelete bool, j *Journal) applyStep {
+    c := &changes{kind: "projects"}
+    return applyStep{summary: c.String, apply: func(phase applyPhase) error {
+        if phase == phaseUpsert {
+            for _, p := range plan.ToCreate {
+                if err := j.record("projects", "create", p.Name, func() error { return client.CreateProject(p.Name, p.Config) }); err != nil {
+                    return err
+                }
+                c.created++
+            }
+            for _, u := range plan.ToUpdate {
+                if err := j.record("projects", "update", u.Name, func() error { return client.UpdateProject(u.Name, u.Desired) }); err != nil {
+                    return err
+                }
+                c.updated++
+            }
+            return nil
         }
-        created++
-    }
-    for _, u := range plan.ToUpdate {
-        if err := client.UpdateProject(u.Name, u.Desired); err != nil {
-            return "", err
+        if !allowDelete {
+            return nil
         }
-        updated++
-    }
-    for _, p := range plan.ToDelete {
-        if err := client.DeleteProject(p.Name); err != nil {
-            return "", err
+        for _, p := range plan.ToDelete {
+            if err := j.record("projects", "delete", p.Name, func() error { return client.DeleteProject(p.Name) }); err != nil {
+                return err
+            }
+            c.deleted++
         }
-        deleted++
-    }
-    return fmt.Sprintf("projects: created=%d updated=%d deleted=%d", created, updated, deleted), nil
+        return nil
+    }}
 }
 
 // ApplyNetworksPlan applies network creations and updates. Deletions are applied
 // only if allowDelete is true.
 func ApplyNetworksPlan(client incusapi.Client, plan NetworkPlan, allowDelete bool) (string, error) {
-    created, updated, deleted := 0, 0, 0
-    for _, n := range plan.ToCreate {
-        if err := client.CreateNetwork(n); err != nil { return "", err }
-        created++
-    }
-    for _, u := range plan.ToUpdate {
-        if err := client.UpdateNetwork(incusapi.Network{Name: u.Name, Config: u.DesiredConf}); err != nil { return "", err }
-        updated++
-    }
-    if allowDelete {
+    return applyAll(networksStep(client, plan, allowDelete, nil))
+}
+
+func networksStep(client incusapi.Client, plan NetworkPlan, allowDelete bool, j *Journal) applyStep {
+    c := &changes{kind: "networks"}
+    return applyStep{summary: c.String, apply: func(phase applyPhase) error {
+        if phase == phaseUpsert {
+            for _, n := range plan.ToCreate {
+                if err := j.record("networks", "create", n.Name, func() error { return client.CreateNetwork(n) }); err != nil { return err }
+                c.created++
+            }
+            for _, u := range plan.ToUpdate {
+                if err := j.record("networks", "update", u.Name, func() error { return client.UpdateNetwork(incusapi.Network{Name: u.Name, Config: u.DesiredConf}) }); err != nil { return err }
+                c.updated++
+            }
+            return nil
+        }
+        if !allowDelete {
+            return nil
+        }
         for _, n := range plan.ToDelete {
-            if err := client.DeleteNetwork(n.Name); err != nil { return "", err }
-            deleted++
+            if err := j.record("networks", "delete", n.Name, func() error { return client.DeleteNetwork(n.Name) }); err != nil { return err }
+            c.deleted++
         }
-    }
-    return fmt.Sprintf("networks: created=%d updated=%d deleted=%d", created, updated, deleted), nil
+        return nil
+    }}
 }
 
 // ApplyStoragePoolsPlan applies storage pool creations and updates. Deletions
 // only if allowDelete is true.
 func ApplyStoragePoolsPlan(client incusapi.Client, plan StoragePoolPlan, allowDelete bool) (string, error) {
-    created, updated, deleted := 0, 0, 0
-    for _, p := range plan.ToCreate {
-        if err := client.CreateStoragePool(p); err != nil { return "", err }
-        created++
-    }
-    for _, u := range plan.ToUpdate {
-        if err := client.UpdateStoragePool(incusapi.StoragePool{Name: u.Name, Config: u.DesiredConf}); err != nil { return "", err }
-        updated++
-    }
-    if allowDelete {
+    return applyAll(storagePoolsStep(client, plan, allowDelete, nil))
+}
+
+func storagePoolsStep(client incusapi.Client, plan StoragePoolPlan, allowDelete bool, j *Journal) applyStep {
+    c := &changes{kind: "storage_pools"}
+    return applyStep{summary: c.String, apply: func(phase applyPhase) error {
+        if phase == phaseUpsert {
+            for _, p := range plan.ToCreate {
+                if err := j.record("storage_pools", "create", p.Name, func() error { return client.CreateStoragePool(p) }); err != nil { return err }
+                c.created++
+            }
+            for _, u := range plan.ToUpdate {
+                if err := j.record("storage_pools", "update", u.Name, func() error { return client.UpdateStoragePool(incusapi.StoragePool{Name: u.Name, Config: u.DesiredConf}) }); err != nil { return err }
+                c.updated++
+            }
+            return nil
+        }
+        if !allowDelete {
+            return nil
+        }
         for _, p := range plan.ToDelete {
-            if err := client.DeleteStoragePool(p.Name); err != nil { return "", err }
-            deleted++
+            if err := j.record("storage_pools", "delete", p.Name, func() error { return client.DeleteStoragePool(p.Name) }); err != nil { return err }
+            c.deleted++
         }
-    }
-    return fmt.Sprintf("storage_pools: created=%d updated=%d deleted=%d", created, updated, deleted), nil
+        return nil
+    }}
 }
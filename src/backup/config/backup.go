@@ -23,8 +23,8 @@ func BackupAll(client incusapi.Client, root string, now time.Time) (string, erro
         return "", err
     }
 
-    includes := make([]string, 0, 4)
-    files := make([]string, 0, 8)
+    includes := make([]string, 0, 13)
+    files := make([]string, 0, 15)
 
     // Projects
     if err := writeProjects(client, snapDir); err != nil {
@@ -54,6 +54,24 @@ func BackupAll(client incusapi.Client, root string, now time.Time) (string, erro
     includes = append(includes, "storage_pools")
     files = append(files, "storage_pools.json")
 
+    // Network ACLs, zones, forwards, load balancers and peers; server
+    // config, trust store and cluster groups
+    objs, err := ListNetworkObjects(client)
+    if err != nil {
+        return "", err
+    }
+    server, err := ListServerState(client)
+    if err != nil {
+        return "", err
+    }
+    for _, doc := range append(objs.documents(), server.documents()...) {
+        if err := writeJSON(filepath.Join(snapDir, doc.name+".json"), doc.v); err != nil {
+            return "", err
+        }
+        includes = append(includes, doc.name)
+        files = append(files, doc.name+".json")
+    }
+
     // Manifest + checksums
     mf := Manifest{Type: "config", CreatedAt: now.UTC(), Includes: includes}
     if err := writeJSON(filepath.Join(snapDir, "manifest.json"), mf); err != nil {
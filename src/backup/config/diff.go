@@ -0,0 +1,113 @@
+package config
+
+import (
+	"incus-backup/src/incusapi"
+)
+
+// Change kinds reported by Diff.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one object that differs between two config states. From and To
+// hold the object on each side; one of them is nil for added and removed
+// objects.
+type Change struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	From   any    `json:"from,omitempty"`
+	To     any    `json:"to,omitempty"`
+}
+
+// Diff lists the objects sel selects that differ between from and to,
+// compared the same way restore plans compare them, in apply order. Kinds
+// that either side lacks (snapshots taken before they were backed up) are
+// skipped.
+func Diff(from, to State, sel Selection) []Change {
+	if from.NetworkObjects.Missing || to.NetworkObjects.Missing {
+		from.NetworkObjects = NetworkObjects{Missing: true}
+		to.NetworkObjects = NetworkObjects{Missing: true}
+	}
+	if from.Server.Missing || to.Server.Missing {
+		from.Server = ServerState{Missing: true}
+		to.Server = ServerState{Missing: true}
+	}
+	plan := BuildPlan(from, to).Select(sel)
+
+	var out []Change
+	for _, want := range plan.Server.Config.ToSet {
+		change := Change{Kind: "server_config", Name: want.Key, Change: Added, To: want.Desired}
+		if have, ok := from.Server.Config[want.Key]; ok {
+			change.Change, change.From = Changed, have
+		}
+		out = append(out, change)
+	}
+	for _, c := range plan.Server.Config.ToUnset {
+		out = append(out, Change{Kind: "server_config", Name: c.Key, Change: Removed, From: c.Current})
+	}
+	out = append(out, objectChanges("cluster_groups", plan.Server.ClusterGroups)...)
+	out = append(out, namedChanges("storage_pools", from.StoragePools, to.StoragePools,
+		plan.StoragePools.ToCreate, plan.StoragePools.ToDelete, len(plan.StoragePools.ToUpdate),
+		func(i int) string { return plan.StoragePools.ToUpdate[i].Name },
+		func(p incusapi.StoragePool) string { return p.Name })...)
+	out = append(out, namedChanges("networks", from.Networks, to.Networks,
+		plan.Networks.ToCreate, plan.Networks.ToDelete, len(plan.Networks.ToUpdate),
+		func(i int) string { return plan.Networks.ToUpdate[i].Name },
+		func(n incusapi.Network) string { return n.Name })...)
+	out = append(out, objectChanges("network_acls", plan.ACLs)...)
+	out = append(out, objectChanges("network_zones", plan.Zones)...)
+	out = append(out, objectChanges("network_zone_records", plan.ZoneRecords)...)
+	out = append(out, objectChanges("network_forwards", plan.Forwards)...)
+	out = append(out, objectChanges("network_load_balancers", plan.LoadBalancers)...)
+	out = append(out, objectChanges("network_peers", plan.Peers)...)
+	out = append(out, namedChanges("projects", from.Projects, to.Projects,
+		plan.Projects.ToCreate, plan.Projects.ToDelete, len(plan.Projects.ToUpdate),
+		func(i int) string { return plan.Projects.ToUpdate[i].Name },
+		func(p incusapi.Project) string { return p.Name })...)
+	out = append(out, objectChanges("profiles", plan.Profiles)...)
+	out = append(out, objectChanges("certificates", plan.Server.Certificates)...)
+	return out
+}
+
+func objectChanges[T any](kind string, p ObjectPlan[T]) []Change {
+	var out []Change
+	for _, v := range p.ToCreate {
+		out = append(out, Change{Kind: kind, Name: p.Key(v), Change: Added, To: v})
+	}
+	for _, u := range p.ToUpdate {
+		out = append(out, Change{Kind: kind, Name: u.Name, Change: Changed, From: u.Current, To: u.Desired})
+	}
+	for _, v := range p.ToDelete {
+		out = append(out, Change{Kind: kind, Name: p.Key(v), Change: Removed, From: v})
+	}
+	return out
+}
+
+// namedChanges is objectChanges for the older plan types, whose updates only
+// carry config; the full objects are looked up by name.
+func namedChanges[T any](kind string, from, to, created, deleted []T, updates int, updated func(int) string, name func(T) string) []Change {
+	find := func(items []T, n string) T {
+		for _, v := range items {
+			if name(v) == n {
+				return v
+			}
+		}
+		var zero T
+		return zero
+	}
+	var out []Change
+	for _, v := range created {
+		out = append(out, Change{Kind: kind, Name: name(v), Change: Added, To: v})
+	}
+	for i := 0; i < updates; i++ {
+		n := updated(i)
+		out = append(out, Change{Kind: kind, Name: n, Change: Changed, From: find(from, n), To: find(to, n)})
+	}
+	for _, v := range deleted {
+		out = append(out, Change{Kind: kind, Name: name(v), Change: Removed, From: v})
+	}
+	return out
+}
@@ -0,0 +1,306 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"incus-backup/src/incusapi"
+)
+
+// Journal statuses.
+const (
+	JournalApplying   = "applying"
+	JournalApplied    = "applied"
+	JournalFailed     = "failed"
+	JournalRolledBack = "rolled_back"
+)
+
+// Step statuses. A step is pending while its change is in flight; a pending
+// step in a saved journal means the apply was interrupted and the change may
+// or may not have been made.
+const (
+	StepPending = "pending"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	StepUndone  = "undone"
+)
+
+// Journal records a config apply: the server's config before it started and
+// every change in the order it was made, so the apply can be rolled back
+// after a failure or an interruption.
+type Journal struct {
+	// Path is where the journal is saved after every step.
+	Path      string    `json:"-"`
+	Snapshot  string    `json:"snapshot,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	// Before is the server's config when the apply started; rollback
+	// restores each changed object from it.
+	Before State         `json:"before"`
+	Steps  []JournalStep `json:"steps"`
+}
+
+// JournalStep is one create, update or delete. Name is the object's key as
+// in the plan; it is empty for server_config, which is written as a whole.
+type JournalStep struct {
+	Kind   string `json:"kind"`
+	Action string `json:"action"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+}
+
+// JournalPath returns the default path for a journal started at now:
+// INCUS_BACKUP_JOURNAL_DIR, or a directory under the user cache directory.
+func JournalPath(now time.Time) string {
+	dir := os.Getenv("INCUS_BACKUP_JOURNAL_DIR")
+	if dir == "" {
+		if cache, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(cache, "incus-backup", "journals")
+		} else {
+			dir = filepath.Join(os.TempDir(), "incus-backup-journals")
+		}
+	}
+	return filepath.Join(dir, "config-apply-"+now.UTC().Format("20060102T150405Z")+".json")
+}
+
+// StartJournal captures the server's current config and saves a new journal
+// at path for applying snapshot.
+func StartJournal(client incusapi.Client, path, snapshot string, now time.Time) (*Journal, error) {
+	before, err := ListState(client)
+	if err != nil {
+		return nil, fmt.Errorf("capture config before apply: %w", err)
+	}
+	j := &Journal{Path: path, Snapshot: snapshot, StartedAt: now.UTC(), Status: JournalApplying, Before: before}
+	if err := j.save(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// LoadJournal reads a journal saved by a previous apply.
+func LoadJournal(path string) (*Journal, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var j Journal
+	if err := json.Unmarshal(b, &j); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	j.Path = path
+	return &j, nil
+}
+
+// save writes the journal atomically. It holds the server config, which may
+// contain secrets, so it is only readable by the owner.
+func (j *Journal) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0o700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.Path); err != nil {
+		return fmt.Errorf("save journal: %w", err)
+	}
+	return nil
+}
+
+// record runs fn as one journaled change: the step is saved as pending
+// before fn runs and marked done or failed after. A nil journal just runs fn.
+func (j *Journal) record(kind, action, name string, fn func() error) error {
+	if j == nil {
+		return fn()
+	}
+	j.Steps = append(j.Steps, JournalStep{Kind: kind, Action: action, Name: name, Status: StepPending})
+	if err := j.save(); err != nil {
+		return err
+	}
+	step := &j.Steps[len(j.Steps)-1]
+	if err := fn(); err != nil {
+		step.Status = StepFailed
+		if serr := j.save(); serr != nil {
+			return fmt.Errorf("%w (journal: %v)", err, serr)
+		}
+		return err
+	}
+	step.Status = StepDone
+	return j.save()
+}
+
+func (j *Journal) finish(status string, err error) error {
+	j.Status = status
+	if err != nil {
+		j.Error = err.Error()
+	}
+	return j.save()
+}
+
+// Undo returns the steps a rollback undoes, most recent first. Failed steps
+// made no change and are left out.
+func (j *Journal) Undo() []JournalStep {
+	var out []JournalStep
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		if s := j.Steps[i]; s.Status == StepPending || s.Status == StepDone {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Rollback undoes the journal's steps in reverse order, restoring each
+// changed object to its state in j.Before. The server state is read again
+// before every step, since undoing one step can recreate objects of another
+// (a zone brings back its records). Progress is saved after every step, so
+// an interrupted rollback can be run again.
+func Rollback(client incusapi.Client, j *Journal, out io.Writer) error {
+	undone := 0
+	for i := len(j.Steps) - 1; i >= 0; i-- {
+		step := &j.Steps[i]
+		if step.Status != StepPending && step.Status != StepDone {
+			continue
+		}
+		fmt.Fprintf(out, "[rollback] undo %s %s %s\n", step.Action, step.Kind, step.Name)
+		current, err := ListState(client)
+		if err != nil {
+			return err
+		}
+		if err := undoStep(client, j.Before, current, *step); err != nil {
+			return fmt.Errorf("undo %s %s %s: %w", step.Action, step.Kind, step.Name, err)
+		}
+		step.Status = StepUndone
+		if err := j.save(); err != nil {
+			return err
+		}
+		undone++
+	}
+	if err := j.finish(JournalRolledBack, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "rollback: undone=%d\n", undone)
+	return nil
+}
+
+// undoStep puts the object of step back into its state in before: objects
+// that did not exist are deleted, deleted ones recreated and the rest
+// updated. Working from state rather than the action also covers pending
+// steps whose change may not have been made.
+func undoStep(client incusapi.Client, before, current State, step JournalStep) error {
+	switch step.Kind {
+	case "server_config":
+		return client.UpdateServerConfig(before.Server.Config)
+	case "storage_pools":
+		return restoreItem(step.Name, before.StoragePools, current.StoragePools,
+			func(p incusapi.StoragePool) string { return p.Name },
+			client.CreateStoragePool, client.UpdateStoragePool,
+			func(p incusapi.StoragePool) error { return client.DeleteStoragePool(p.Name) })
+	case "networks":
+		return restoreItem(step.Name, before.Networks, current.Networks,
+			func(n incusapi.Network) string { return n.Name },
+			client.CreateNetwork, client.UpdateNetwork,
+			func(n incusapi.Network) error { return client.DeleteNetwork(n.Name) })
+	case "network_acls":
+		return restoreItem(step.Name, before.NetworkObjects.ACLs, current.NetworkObjects.ACLs,
+			func(a incusapi.NetworkACL) string { return a.Name },
+			client.CreateNetworkACL, client.UpdateNetworkACL,
+			func(a incusapi.NetworkACL) error { return client.DeleteNetworkACL(a.Name) })
+	case "network_zones":
+		// A deleted zone took its records with it.
+		return restoreItem(step.Name, before.NetworkObjects.Zones, current.NetworkObjects.Zones,
+			func(z incusapi.NetworkZone) string { return z.Name },
+			func(z incusapi.NetworkZone) error {
+				if err := client.CreateNetworkZone(z); err != nil {
+					return err
+				}
+				for _, r := range before.NetworkObjects.ZoneRecords {
+					if r.Zone == z.Name {
+						if err := client.CreateNetworkZoneRecord(r); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			},
+			client.UpdateNetworkZone,
+			func(z incusapi.NetworkZone) error { return client.DeleteNetworkZone(z.Name) })
+	case "network_zone_records":
+		return restoreItem(step.Name, before.NetworkObjects.ZoneRecords, current.NetworkObjects.ZoneRecords,
+			func(r incusapi.NetworkZoneRecord) string { return r.Zone + "/" + r.Name },
+			client.CreateNetworkZoneRecord, client.UpdateNetworkZoneRecord,
+			func(r incusapi.NetworkZoneRecord) error { return client.DeleteNetworkZoneRecord(r.Zone, r.Name) })
+	case "network_forwards":
+		return restoreItem(step.Name, before.NetworkObjects.Forwards, current.NetworkObjects.Forwards,
+			func(f incusapi.NetworkForward) string { return f.Network + "/" + f.ListenAddress },
+			client.CreateNetworkForward, client.UpdateNetworkForward,
+			func(f incusapi.NetworkForward) error { return client.DeleteNetworkForward(f.Network, f.ListenAddress) })
+	case "network_load_balancers":
+		return restoreItem(step.Name, before.NetworkObjects.LoadBalancers, current.NetworkObjects.LoadBalancers,
+			func(lb incusapi.NetworkLoadBalancer) string { return lb.Network + "/" + lb.ListenAddress },
+			client.CreateNetworkLoadBalancer, client.UpdateNetworkLoadBalancer,
+			func(lb incusapi.NetworkLoadBalancer) error {
+				return client.DeleteNetworkLoadBalancer(lb.Network, lb.ListenAddress)
+			})
+	case "network_peers":
+		return restoreItem(step.Name, before.NetworkObjects.Peers, current.NetworkObjects.Peers,
+			func(p incusapi.NetworkPeer) string { return p.Network + "/" + p.Name },
+			client.CreateNetworkPeer, client.UpdateNetworkPeer,
+			func(p incusapi.NetworkPeer) error { return client.DeleteNetworkPeer(p.Network, p.Name) })
+	case "projects":
+		return restoreItem(step.Name, before.Projects, current.Projects,
+			func(p incusapi.Project) string { return p.Name },
+			func(p incusapi.Project) error { return client.CreateProject(p.Name, p.Config) },
+			func(p incusapi.Project) error { return client.UpdateProject(p.Name, p.Config) },
+			func(p incusapi.Project) error { return client.DeleteProject(p.Name) })
+	case "profiles":
+		return restoreItem(step.Name, before.Profiles, current.Profiles,
+			func(p incusapi.Profile) string { return p.Name },
+			client.CreateProfile, client.UpdateProfile,
+			func(p incusapi.Profile) error { return client.DeleteProfile(p.Name) })
+	case "certificates":
+		return restoreItem(step.Name, before.Server.Certificates, current.Server.Certificates,
+			func(c incusapi.Certificate) string { return c.Fingerprint },
+			client.CreateCertificate, client.UpdateCertificate,
+			func(c incusapi.Certificate) error { return client.DeleteCertificate(c.Fingerprint) })
+	case "cluster_groups":
+		return restoreItem(step.Name, before.Server.ClusterGroups, current.Server.ClusterGroups,
+			func(g incusapi.ClusterGroup) string { return g.Name },
+			client.CreateClusterGroup, client.UpdateClusterGroup,
+			func(g incusapi.ClusterGroup) error { return client.DeleteClusterGroup(g.Name) })
+	default:
+		return fmt.Errorf("unknown kind %q", step.Kind)
+	}
+}
+
+func restoreItem[T any](name string, before, current []T, key func(T) string, create, update, del func(T) error) error {
+	find := func(items []T) (T, bool) {
+		for _, v := range items {
+			if key(v) == name {
+				return v, true
+			}
+		}
+		var zero T
+		return zero, false
+	}
+	old, existed := find(before)
+	now, exists := find(current)
+	switch {
+	case existed && exists:
+		return update(old)
+	case existed:
+		return create(old)
+	case exists:
+		return del(now)
+	default:
+		return nil
+	}
+}
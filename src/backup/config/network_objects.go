@@ -0,0 +1,399 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"incus-backup/src/incusapi"
+)
+
+// NetworkObjects holds the objects that hang off managed networks: ACLs,
+// DNS zones and their records, forwards, load balancers and peerings.
+type NetworkObjects struct {
+	ACLs          []incusapi.NetworkACL
+	Zones         []incusapi.NetworkZone
+	ZoneRecords   []incusapi.NetworkZoneRecord
+	Forwards      []incusapi.NetworkForward
+	LoadBalancers []incusapi.NetworkLoadBalancer
+	Peers         []incusapi.NetworkPeer
+
+	// Missing is set for snapshots taken before network objects were backed
+	// up; plans then leave the server's objects alone.
+	Missing bool
+}
+
+type configDoc struct {
+	name string
+	v    any
+}
+
+// documents lists the snapshot documents of o in apply order. The values are
+// pointers so they can be loaded into as well as written.
+func (o *NetworkObjects) documents() []configDoc {
+	return []configDoc{
+		{"network_acls", &o.ACLs},
+		{"network_zones", &o.Zones},
+		{"network_zone_records", &o.ZoneRecords},
+		{"network_forwards", &o.Forwards},
+		{"network_load_balancers", &o.LoadBalancers},
+		{"network_peers", &o.Peers},
+	}
+}
+
+// networkSupports reports whether Incus offers the per-network feature
+// ("forwards", "load_balancers" or "peers") on n.
+func networkSupports(n incusapi.Network, feature string) bool {
+	if !n.Managed {
+		return false
+	}
+	switch feature {
+	case "forwards":
+		return n.Type == "bridge" || n.Type == "ovn"
+	case "load_balancers", "peers":
+		return n.Type == "ovn"
+	default:
+		return false
+	}
+}
+
+// ListNetworkObjects reads all network objects from the server in a
+// deterministic order.
+func ListNetworkObjects(client incusapi.Client) (NetworkObjects, error) {
+	var o NetworkObjects
+	var err error
+	if o.ACLs, err = client.ListNetworkACLs(); err != nil {
+		return o, err
+	}
+	sort.Slice(o.ACLs, func(i, j int) bool { return o.ACLs[i].Name < o.ACLs[j].Name })
+	if o.Zones, err = client.ListNetworkZones(); err != nil {
+		return o, err
+	}
+	sort.Slice(o.Zones, func(i, j int) bool { return o.Zones[i].Name < o.Zones[j].Name })
+	for _, z := range o.Zones {
+		records, err := client.ListNetworkZoneRecords(z.Name)
+		if err != nil {
+			return o, err
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+		o.ZoneRecords = append(o.ZoneRecords, records...)
+	}
+
+	networks, err := client.ListNetworks()
+	if err != nil {
+		return o, err
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	for _, n := range networks {
+		if networkSupports(n, "forwards") {
+			fwds, err := client.ListNetworkForwards(n.Name)
+			if err != nil {
+				return o, err
+			}
+			sort.Slice(fwds, func(i, j int) bool { return fwds[i].ListenAddress < fwds[j].ListenAddress })
+			o.Forwards = append(o.Forwards, fwds...)
+		}
+		if networkSupports(n, "load_balancers") {
+			lbs, err := client.ListNetworkLoadBalancers(n.Name)
+			if err != nil {
+				return o, err
+			}
+			sort.Slice(lbs, func(i, j int) bool { return lbs[i].ListenAddress < lbs[j].ListenAddress })
+			o.LoadBalancers = append(o.LoadBalancers, lbs...)
+		}
+		if networkSupports(n, "peers") {
+			peers, err := client.ListNetworkPeers(n.Name)
+			if err != nil {
+				return o, err
+			}
+			sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+			o.Peers = append(o.Peers, peers...)
+		}
+	}
+	return o, nil
+}
+
+// LoadNetworkObjectsDir reads network objects from a config snapshot
+// directory. Snapshots taken before these were backed up lack the files and
+// load as Missing.
+func LoadNetworkObjectsDir(dir string) (NetworkObjects, error) {
+	var o NetworkObjects
+	missing, err := loadDocumentsDir(dir, o.documents())
+	o.Missing = missing
+	return o, err
+}
+
+// loadDocumentsDir unmarshals each document from dir and reports whether any
+// of them is absent.
+func loadDocumentsDir(dir string, docs []configDoc) (bool, error) {
+	missing := false
+	for _, doc := range docs {
+		b, err := os.ReadFile(filepath.Join(dir, doc.name+".json"))
+		if errors.Is(err, os.ErrNotExist) {
+			missing = true
+			continue
+		}
+		if err != nil {
+			return missing, err
+		}
+		if err := json.Unmarshal(b, doc.v); err != nil {
+			return missing, fmt.Errorf("%s.json: %w", doc.name, err)
+		}
+	}
+	return missing, nil
+}
+
+// ObjectPlan describes differences for one kind of network object.
+type ObjectPlan[T any] struct {
+	ToCreate []T
+	ToDelete []T
+	ToUpdate []ObjectUpdate[T]
+
+	key func(T) string
+}
+
+// ObjectUpdate pairs the current and desired state of an object; Name is its
+// key, e.g. "network/listen-address" for forwards.
+type ObjectUpdate[T any] struct {
+	Name    string
+	Current T
+	Desired T
+}
+
+// Key returns the identifying name of v as used in ObjectUpdate.Name.
+func (p ObjectPlan[T]) Key(v T) string {
+	if p.key == nil {
+		return fmt.Sprint(v)
+	}
+	return p.key(v)
+}
+
+// Empty reports whether the plan has no changes.
+func (p ObjectPlan[T]) Empty() bool {
+	return len(p.ToCreate) == 0 && len(p.ToUpdate) == 0 && len(p.ToDelete) == 0
+}
+
+type (
+	NetworkACLPlan          = ObjectPlan[incusapi.NetworkACL]
+	NetworkZonePlan         = ObjectPlan[incusapi.NetworkZone]
+	NetworkZoneRecordPlan   = ObjectPlan[incusapi.NetworkZoneRecord]
+	NetworkForwardPlan      = ObjectPlan[incusapi.NetworkForward]
+	NetworkLoadBalancerPlan = ObjectPlan[incusapi.NetworkLoadBalancer]
+	NetworkPeerPlan         = ObjectPlan[incusapi.NetworkPeer]
+)
+
+func buildObjectPlan[T any](current, desired []T, key func(T) string, equal func(a, b T) bool) ObjectPlan[T] {
+	plan := ObjectPlan[T]{key: key}
+	cur := map[string]T{}
+	des := map[string]T{}
+	for _, v := range current {
+		cur[key(v)] = v
+	}
+	for _, v := range desired {
+		des[key(v)] = v
+	}
+	for name, want := range des {
+		have, ok := cur[name]
+		if !ok {
+			plan.ToCreate = append(plan.ToCreate, want)
+			continue
+		}
+		if !equal(have, want) {
+			plan.ToUpdate = append(plan.ToUpdate, ObjectUpdate[T]{Name: name, Current: have, Desired: want})
+		}
+	}
+	for name, have := range cur {
+		if _, ok := des[name]; !ok {
+			plan.ToDelete = append(plan.ToDelete, have)
+		}
+	}
+	sort.Slice(plan.ToCreate, func(i, j int) bool { return key(plan.ToCreate[i]) < key(plan.ToCreate[j]) })
+	sort.Slice(plan.ToDelete, func(i, j int) bool { return key(plan.ToDelete[i]) < key(plan.ToDelete[j]) })
+	sort.Slice(plan.ToUpdate, func(i, j int) bool { return plan.ToUpdate[i].Name < plan.ToUpdate[j].Name })
+	return plan
+}
+
+func BuildNetworkACLsPlan(current, desired []incusapi.NetworkACL) NetworkACLPlan {
+	return buildObjectPlan(current, desired,
+		func(a incusapi.NetworkACL) string { return a.Name },
+		func(a, b incusapi.NetworkACL) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config) &&
+				slices.Equal(a.Ingress, b.Ingress) && slices.Equal(a.Egress, b.Egress)
+		})
+}
+
+func BuildNetworkZonesPlan(current, desired []incusapi.NetworkZone) NetworkZonePlan {
+	return buildObjectPlan(current, desired,
+		func(z incusapi.NetworkZone) string { return z.Name },
+		func(a, b incusapi.NetworkZone) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config)
+		})
+}
+
+func BuildNetworkZoneRecordsPlan(current, desired []incusapi.NetworkZoneRecord) NetworkZoneRecordPlan {
+	return buildObjectPlan(current, desired,
+		func(r incusapi.NetworkZoneRecord) string { return r.Zone + "/" + r.Name },
+		func(a, b incusapi.NetworkZoneRecord) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config) &&
+				slices.Equal(a.Entries, b.Entries)
+		})
+}
+
+func BuildNetworkForwardsPlan(current, desired []incusapi.NetworkForward) NetworkForwardPlan {
+	return buildObjectPlan(current, desired,
+		func(f incusapi.NetworkForward) string { return f.Network + "/" + f.ListenAddress },
+		func(a, b incusapi.NetworkForward) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config) &&
+				slices.Equal(a.Ports, b.Ports)
+		})
+}
+
+func BuildNetworkLoadBalancersPlan(current, desired []incusapi.NetworkLoadBalancer) NetworkLoadBalancerPlan {
+	return buildObjectPlan(current, desired,
+		func(lb incusapi.NetworkLoadBalancer) string { return lb.Network + "/" + lb.ListenAddress },
+		func(a, b incusapi.NetworkLoadBalancer) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config) &&
+				slices.Equal(a.Backends, b.Backends) &&
+				slices.EqualFunc(a.Ports, b.Ports, func(x, y incusapi.NetworkLoadBalancerPort) bool {
+					return x.Description == y.Description && x.Protocol == y.Protocol &&
+						x.ListenPort == y.ListenPort && slices.Equal(x.TargetBackend, y.TargetBackend)
+				})
+		})
+}
+
+// BuildNetworkPeersPlan plans peer changes. Only description and config can
+// be updated in place; a changed target has to be recreated by hand.
+func BuildNetworkPeersPlan(current, desired []incusapi.NetworkPeer) NetworkPeerPlan {
+	return buildObjectPlan(current, desired,
+		func(p incusapi.NetworkPeer) string { return p.Network + "/" + p.Name },
+		func(a, b incusapi.NetworkPeer) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config)
+		})
+}
+
+// NetworkObjectsPlan groups the plans for all network objects.
+type NetworkObjectsPlan struct {
+	ACLs          NetworkACLPlan          `json:"network_acls"`
+	Zones         NetworkZonePlan         `json:"network_zones"`
+	ZoneRecords   NetworkZoneRecordPlan   `json:"network_zone_records"`
+	Forwards      NetworkForwardPlan      `json:"network_forwards"`
+	LoadBalancers NetworkLoadBalancerPlan `json:"network_load_balancers"`
+	Peers         NetworkPeerPlan         `json:"network_peers"`
+}
+
+// BuildNetworkObjectsPlan plans every kind of network object. Records of zones
+// that are deleted are not deleted separately, since they go with the zone.
+// A Missing desired state yields an empty plan.
+func BuildNetworkObjectsPlan(current, desired NetworkObjects) NetworkObjectsPlan {
+	if desired.Missing {
+		return NetworkObjectsPlan{}
+	}
+	plan := NetworkObjectsPlan{
+		ACLs:          BuildNetworkACLsPlan(current.ACLs, desired.ACLs),
+		Zones:         BuildNetworkZonesPlan(current.Zones, desired.Zones),
+		ZoneRecords:   BuildNetworkZoneRecordsPlan(current.ZoneRecords, desired.ZoneRecords),
+		Forwards:      BuildNetworkForwardsPlan(current.Forwards, desired.Forwards),
+		LoadBalancers: BuildNetworkLoadBalancersPlan(current.LoadBalancers, desired.LoadBalancers),
+		Peers:         BuildNetworkPeersPlan(current.Peers, desired.Peers),
+	}
+	deletedZones := map[string]bool{}
+	for _, z := range plan.Zones.ToDelete {
+		deletedZones[z.Name] = true
+	}
+	plan.ZoneRecords.ToDelete = slices.DeleteFunc(plan.ZoneRecords.ToDelete, func(r incusapi.NetworkZoneRecord) bool {
+		return deletedZones[r.Zone]
+	})
+	return plan
+}
+
+func objectStep[T any](kind string, plan ObjectPlan[T], allowDelete bool, j *Journal, create, update func(T) error, del func(T) error) applyStep {
+	c := &changes{kind: kind}
+	return applyStep{summary: c.String, apply: func(phase applyPhase) error {
+		if phase == phaseUpsert {
+			for _, v := range plan.ToCreate {
+				if err := j.record(kind, "create", plan.Key(v), func() error { return create(v) }); err != nil {
+					return fmt.Errorf("%s: create %s: %w", kind, plan.Key(v), err)
+				}
+				c.created++
+			}
+			for _, u := range plan.ToUpdate {
+				if err := j.record(kind, "update", u.Name, func() error { return update(u.Desired) }); err != nil {
+					return fmt.Errorf("%s: update %s: %w", kind, u.Name, err)
+				}
+				c.updated++
+			}
+			return nil
+		}
+		if !allowDelete {
+			return nil
+		}
+		for _, v := range plan.ToDelete {
+			if err := j.record(kind, "delete", plan.Key(v), func() error { return del(v) }); err != nil {
+				return fmt.Errorf("%s: delete %s: %w", kind, plan.Key(v), err)
+			}
+			c.deleted++
+		}
+		return nil
+	}}
+}
+
+// ApplyNetworkObjectsPlan applies the plan after networks exist: ACLs and
+// zones (with their records) are created and updated first, then forwards,
+// load balancers and peers; deletions run in the reverse order and only if
+// allowDelete is true. It returns one summary line per kind.
+func ApplyNetworkObjectsPlan(client incusapi.Client, plan NetworkObjectsPlan, allowDelete bool) ([]string, error) {
+	steps := networkObjectsSteps(client, plan, allowDelete, nil)
+	if err := runSteps(steps); err != nil {
+		return nil, err
+	}
+	summaries := make([]string, 0, len(steps))
+	for _, step := range steps {
+		summaries = append(summaries, step.summary())
+	}
+	return summaries, nil
+}
+
+func networkObjectsSteps(client incusapi.Client, plan NetworkObjectsPlan, allowDelete bool, j *Journal) []applyStep {
+	return []applyStep{
+		objectStep("network_acls", plan.ACLs, allowDelete, j,
+			client.CreateNetworkACL, client.UpdateNetworkACL,
+			func(a incusapi.NetworkACL) error { return client.DeleteNetworkACL(a.Name) }),
+		objectStep("network_zones", plan.Zones, allowDelete, j,
+			client.CreateNetworkZone, client.UpdateNetworkZone,
+			func(z incusapi.NetworkZone) error { return client.DeleteNetworkZone(z.Name) }),
+		objectStep("network_zone_records", plan.ZoneRecords, allowDelete, j,
+			client.CreateNetworkZoneRecord, client.UpdateNetworkZoneRecord,
+			func(r incusapi.NetworkZoneRecord) error { return client.DeleteNetworkZoneRecord(r.Zone, r.Name) }),
+		objectStep("network_forwards", plan.Forwards, allowDelete, j,
+			client.CreateNetworkForward, client.UpdateNetworkForward,
+			func(f incusapi.NetworkForward) error { return client.DeleteNetworkForward(f.Network, f.ListenAddress) }),
+		objectStep("network_load_balancers", plan.LoadBalancers, allowDelete, j,
+			client.CreateNetworkLoadBalancer, client.UpdateNetworkLoadBalancer,
+			func(lb incusapi.NetworkLoadBalancer) error {
+				return client.DeleteNetworkLoadBalancer(lb.Network, lb.ListenAddress)
+			}),
+		objectStep("network_peers", plan.Peers, allowDelete, j,
+			client.CreateNetworkPeer, client.UpdateNetworkPeer,
+			func(p incusapi.NetworkPeer) error { return client.DeleteNetworkPeer(p.Network, p.Name) }),
+	}
+}
+
+// Counts totals the creations, updates and deletions across all kinds.
+func (p NetworkObjectsPlan) Counts() (create, update, del int) {
+	add := func(c, u, d int) {
+		create += c
+		update += u
+		del += d
+	}
+	add(len(p.ACLs.ToCreate), len(p.ACLs.ToUpdate), len(p.ACLs.ToDelete))
+	add(len(p.Zones.ToCreate), len(p.Zones.ToUpdate), len(p.Zones.ToDelete))
+	add(len(p.ZoneRecords.ToCreate), len(p.ZoneRecords.ToUpdate), len(p.ZoneRecords.ToDelete))
+	add(len(p.Forwards.ToCreate), len(p.Forwards.ToUpdate), len(p.Forwards.ToDelete))
+	add(len(p.LoadBalancers.ToCreate), len(p.LoadBalancers.ToUpdate), len(p.LoadBalancers.ToDelete))
+	add(len(p.Peers.ToCreate), len(p.Peers.ToUpdate), len(p.Peers.ToDelete))
+	return create, update, del
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"incus-backup/src/incusapi"
+)
+
+// State is the declarative config of a server or of a config snapshot.
+type State struct {
+	Projects     []incusapi.Project
+	Profiles     []incusapi.Profile
+	Networks     []incusapi.Network
+	StoragePools []incusapi.StoragePool
+	// NetworkObjects is Missing for snapshots taken before network objects
+	// were backed up.
+	NetworkObjects NetworkObjects
+	// Server holds the server config, trust store and cluster groups.
+	Server ServerState
+}
+
+// documents lists the documents every config snapshot has.
+func (s *State) documents() []configDoc {
+	return []configDoc{
+		{"projects", &s.Projects},
+		{"profiles", &s.Profiles},
+		{"networks", &s.Networks},
+		{"storage_pools", &s.StoragePools},
+	}
+}
+
+// ListState reads the declarative config from the server.
+func ListState(client incusapi.Client) (State, error) {
+	var s State
+	var err error
+	if s.Projects, err = client.ListProjects(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.Projects, func(i, j int) bool { return s.Projects[i].Name < s.Projects[j].Name })
+	if s.Profiles, err = client.ListProfiles(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.Profiles, func(i, j int) bool { return s.Profiles[i].Name < s.Profiles[j].Name })
+	if s.Networks, err = client.ListNetworks(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.Networks, func(i, j int) bool { return s.Networks[i].Name < s.Networks[j].Name })
+	if s.StoragePools, err = client.ListStoragePools(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.StoragePools, func(i, j int) bool { return s.StoragePools[i].Name < s.StoragePools[j].Name })
+	if s.NetworkObjects, err = ListNetworkObjects(client); err != nil {
+		return s, err
+	}
+	if s.Server, err = ListServerState(client); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// LoadStateDir reads a config snapshot directory. Network objects and server
+// settings load as Missing when the snapshot predates them.
+func LoadStateDir(dir string) (State, error) {
+	var s State
+	for _, doc := range s.documents() {
+		b, err := os.ReadFile(filepath.Join(dir, doc.name+".json"))
+		if err != nil {
+			return s, err
+		}
+		if err := json.Unmarshal(b, doc.v); err != nil {
+			return s, fmt.Errorf("%s.json: %w", doc.name, err)
+		}
+	}
+	var err error
+	if s.NetworkObjects, err = LoadNetworkObjectsDir(dir); err != nil {
+		return s, err
+	}
+	if s.Server, err = LoadServerStateDir(dir); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Plan holds the changes that turn the server's config into a snapshot's.
+type Plan struct {
+	Projects     ProjectPlan     `json:"projects"`
+	Networks     NetworkPlan     `json:"networks"`
+	StoragePools StoragePoolPlan `json:"storage_pools"`
+	NetworkObjectsPlan
+	Profiles ProfilePlan `json:"profiles"`
+	Server   ServerPlan  `json:"server"`
+}
+
+// BuildPlan plans every kind of config object.
+func BuildPlan(current, desired State) Plan {
+	return Plan{
+		Projects:           BuildProjectsPlan(current.Projects, desired.Projects),
+		Networks:           BuildNetworksPlan(current.Networks, desired.Networks),
+		StoragePools:       BuildStoragePoolsPlan(current.StoragePools, desired.StoragePools),
+		NetworkObjectsPlan: BuildNetworkObjectsPlan(current.NetworkObjects, desired.NetworkObjects),
+		Profiles:           BuildProfilesPlan(current.Profiles, desired.Profiles),
+		Server:             BuildServerPlan(current.Server, desired.Server),
+	}
+}
+
+// ApplyOptions controls which parts of a Plan are applied.
+type ApplyOptions struct {
+	// PruneExtra deletes objects that exist on the server but not in the
+	// snapshot. Without it deletions are left out for every kind.
+	PruneExtra bool
+	// Force applies risky server config keys and certificate updates and
+	// deletions.
+	Force bool
+	// Server applies the server config, trust store and cluster groups.
+	Server bool
+	// Journal, when set, records each change as it is made and makes the
+	// apply transactional: on failure the changes made so far are rolled
+	// back in reverse.
+	Journal *Journal
+}
+
+// ApplyPlan creates and updates objects in dependency order: server config
+// and cluster groups, storage pools, networks, network objects, projects,
+// profiles and finally certificates. Deletions follow in the reverse order,
+// so nothing is deleted while an object being pruned still uses it. It writes
+// one summary line per kind to out and stops at the first error, after
+// rolling back when opts.Journal is set.
+func ApplyPlan(client incusapi.Client, plan Plan, opts ApplyOptions, out io.Writer) error {
+	j := opts.Journal
+	err := applyPlan(client, plan, opts, out)
+	if j == nil {
+		return err
+	}
+	if err == nil {
+		return j.finish(JournalApplied, nil)
+	}
+	if jerr := j.finish(JournalFailed, err); jerr != nil {
+		return fmt.Errorf("%w (journal %s: %v)", err, j.Path, jerr)
+	}
+	fmt.Fprintf(out, "apply failed, rolling back: %v\n", err)
+	if rerr := Rollback(client, j, out); rerr != nil {
+		return fmt.Errorf("%w; rollback failed: %v (retry with --rollback %s)", err, rerr, j.Path)
+	}
+	return fmt.Errorf("%w (changes rolled back)", err)
+}
+
+func applyPlan(client incusapi.Client, plan Plan, opts ApplyOptions, out io.Writer) error {
+	j := opts.Journal
+	var steps []applyStep
+	if opts.Server {
+		// Projects may be restricted to cluster groups.
+		steps = append(steps,
+			serverConfigStep(client, plan.Server.Config, opts.Force, j),
+			clusterGroupsStep(client, plan.Server.ClusterGroups, opts.PruneExtra, j))
+	}
+	steps = append(steps,
+		storagePoolsStep(client, plan.StoragePools, opts.PruneExtra, j),
+		networksStep(client, plan.Networks, opts.PruneExtra, j))
+	// ACLs and zones before the forwards, load balancers and peers that
+	// may refer to them.
+	steps = append(steps, networkObjectsSteps(client, plan.NetworkObjectsPlan, opts.PruneExtra, j)...)
+	steps = append(steps,
+		projectsStep(client, plan.Projects, opts.PruneExtra, j),
+		// Profile devices refer to networks and storage pools.
+		profilesStep(client, plan.Profiles, opts.PruneExtra, j))
+	if opts.Server {
+		// Certificates last, as they may be restricted to projects.
+		steps = append(steps, certificatesStep(client, plan.Server.Certificates, opts.Force, opts.PruneExtra, j))
+	}
+	if err := runSteps(steps); err != nil {
+		return err
+	}
+	for _, step := range steps {
+		fmt.Fprintln(out, step.summary())
+	}
+	return nil
+}
+
+// applyPhase selects the changes an apply step makes.
+type applyPhase int
+
+const (
+	// phaseUpsert makes the creations and updates.
+	phaseUpsert applyPhase = iota
+	// phaseDelete makes the deletions.
+	phaseDelete
+)
+
+// applyStep applies the changes to one kind of object, one phase at a time.
+type applyStep struct {
+	apply   func(phase applyPhase) error
+	summary func() string
+}
+
+// runSteps makes the creations and updates of every step in dependency
+// order, then the deletions in reverse order, so an object is deleted only
+// after the objects that may still refer to it.
+func runSteps(steps []applyStep) error {
+	for _, step := range steps {
+		if err := step.apply(phaseUpsert); err != nil {
+			return err
+		}
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := steps[i].apply(phaseDelete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyAll runs a single step and returns its summary.
+func applyAll(step applyStep) (string, error) {
+	if err := runSteps([]applyStep{step}); err != nil {
+		return "", err
+	}
+	return step.summary(), nil
+}
+
+// changes counts what a step changed for its summary line.
+type changes struct {
+	kind                               string
+	created, updated, deleted, skipped int
+	// withSkipped adds the skipped count to the summary.
+	withSkipped bool
+}
+
+func (c *changes) String() string {
+	s := fmt.Sprintf("%s: created=%d updated=%d deleted=%d", c.kind, c.created, c.updated, c.deleted)
+	if c.withSkipped {
+		s += fmt.Sprintf(" skipped=%d", c.skipped)
+	}
+	return s
+}
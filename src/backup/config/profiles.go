@@ -0,0 +1,39 @@
+package config
+
+import (
+	"maps"
+	"slices"
+
+	"incus-backup/src/incusapi"
+)
+
+type ProfilePlan = ObjectPlan[incusapi.Profile]
+
+// BuildProfilesPlan plans profile changes. The built-in "default" profile
+// cannot be deleted and is never planned for deletion.
+func BuildProfilesPlan(current, desired []incusapi.Profile) ProfilePlan {
+	plan := buildObjectPlan(current, desired,
+		func(p incusapi.Profile) string { return p.Name },
+		func(a, b incusapi.Profile) bool {
+			return a.Description == b.Description && equalConfig(a.Config, b.Config) &&
+				equalDevices(a.Devices, b.Devices)
+		})
+	plan.ToDelete = slices.DeleteFunc(plan.ToDelete, func(p incusapi.Profile) bool { return p.Name == "default" })
+	return plan
+}
+
+func equalDevices(a, b map[string]map[string]string) bool {
+	return maps.EqualFunc(a, b, func(x, y map[string]string) bool { return equalConfig(x, y) })
+}
+
+// ApplyProfilesPlan applies profile creations and updates. Deletions only if
+// allowDelete is true. Apply it after projects, networks and storage pools,
+// which profile devices refer to.
+func ApplyProfilesPlan(client incusapi.Client, plan ProfilePlan, allowDelete bool) (string, error) {
+	return applyAll(profilesStep(client, plan, allowDelete, nil))
+}
+
+func profilesStep(client incusapi.Client, plan ProfilePlan, allowDelete bool, j *Journal) applyStep {
+	return objectStep("profiles", plan, allowDelete, j, client.CreateProfile, client.UpdateProfile,
+		func(p incusapi.Profile) error { return client.DeleteProfile(p.Name) })
+}
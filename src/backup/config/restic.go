@@ -8,64 +8,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	manifestpkg "incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
 	"incus-backup/src/restic"
 )
 
 type SnapshotData struct {
-	Timestamp    string
-	Manifest     Manifest
-	Projects     []incusapi.Project
-	Profiles     []incusapi.Profile
-	Networks     []incusapi.Network
-	StoragePools []incusapi.StoragePool
+	Timestamp string
+	Manifest  Manifest
+	State
 }
 
-func BackupAllRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, now time.Time, progressOut io.Writer) (string, error) {
+func BackupAllRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, now time.Time, progressOut io.Writer) (manifestpkg.Stored, error) {
 	if err := restic.EnsureRepository(ctx, bin, repo); err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 
 	ts := now.UTC().Format("20060102T150405Z")
 	entries := make([]struct {
 		name string
 		hash string
-	}, 0, 4)
-
-	if data, hash, err := marshalProjects(client); err != nil {
-		return "", err
-	} else if err := restic.BackupBytes(ctx, bin, repo, configFileName("projects.json"), tagsConfig(ts, "projects"), data, progressOut); err != nil {
-		return "", err
-	} else {
-		entries = append(entries, struct{ name, hash string }{"projects", hash})
+	}, 0, 13)
+	var files []restic.File
+	for _, doc := range []struct {
+		name    string
+		marshal func(incusapi.Client) ([]byte, string, error)
+	}{
+		{"projects", marshalProjects},
+		{"profiles", marshalProfiles},
+		{"networks", marshalNetworks},
+		{"storage_pools", marshalStoragePools},
+	} {
+		data, hash, err := doc.marshal(client)
+		if err != nil {
+			return manifestpkg.Stored{}, err
+		}
+		entries = append(entries, struct{ name, hash string }{doc.name, hash})
+		files = append(files, restic.File{Name: configFileName(doc.name + ".json"), Data: data})
 	}
 
-	if data, hash, err := marshalProfiles(client); err != nil {
-		return "", err
-	} else if err := restic.BackupBytes(ctx, bin, repo, configFileName("profiles.json"), tagsConfig(ts, "profiles"), data, progressOut); err != nil {
-		return "", err
-	} else {
-		entries = append(entries, struct{ name, hash string }{"profiles", hash})
+	objs, err := ListNetworkObjects(client)
+	if err != nil {
+		return manifestpkg.Stored{}, err
 	}
-
-	if data, hash, err := marshalNetworks(client); err != nil {
-		return "", err
-	} else if err := restic.BackupBytes(ctx, bin, repo, configFileName("networks.json"), tagsConfig(ts, "networks"), data, progressOut); err != nil {
-		return "", err
-	} else {
-		entries = append(entries, struct{ name, hash string }{"networks", hash})
+	server, err := ListServerState(client)
+	if err != nil {
+		return manifestpkg.Stored{}, err
 	}
-
-	if data, hash, err := marshalStoragePools(client); err != nil {
-		return "", err
-	} else if err := restic.BackupBytes(ctx, bin, repo, configFileName("storage_pools.json"), tagsConfig(ts, "storage_pools"), data, progressOut); err != nil {
-		return "", err
-	} else {
-		entries = append(entries, struct{ name, hash string }{"storage_pools", hash})
+	for _, doc := range append(objs.documents(), server.documents()...) {
+		data, err := json.MarshalIndent(doc.v, "", "  ")
+		if err != nil {
+			return manifestpkg.Stored{}, err
+		}
+		entries = append(entries, struct{ name, hash string }{doc.name, hashBytes(data)})
+		files = append(files, restic.File{Name: configFileName(doc.name + ".json"), Data: data})
 	}
 
 	manifest := Manifest{Type: "config", CreatedAt: now.UTC()}
@@ -74,19 +75,22 @@ func BackupAllRestic(ctx context.Context, bin restic.BinaryInfo, repo string, cl
 	}
 	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
 	if err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 	manifestHash := hashBytes(manifestBytes)
-	if err := restic.BackupBytes(ctx, bin, repo, configFileName("manifest.json"), tagsConfig(ts, "manifest"), manifestBytes, progressOut); err != nil {
-		return "", err
-	}
-
 	checksums := buildChecksums(entries, manifestHash)
-	if err := restic.BackupBytes(ctx, bin, repo, configFileName("checksums.txt"), tagsConfig(ts, "checksums"), []byte(checksums), progressOut); err != nil {
-		return "", err
+	files = append(files,
+		restic.File{Name: configFileName("manifest.json"), Data: manifestBytes},
+		restic.File{Name: configFileName("checksums.txt"), Data: []byte(checksums)},
+	)
+
+	// All documents go into one snapshot so a config version is atomic.
+	summary, err := restic.BackupFiles(ctx, bin, repo, files, ResticTags(ts, ""), progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
 	}
 
-	return ts, nil
+	return manifestpkg.Stored{Version: ts, SnapshotID: summary.SnapshotID}, nil
 }
 
 func LoadSnapshotRestic(ctx context.Context, bin restic.BinaryInfo, repo string, version string) (SnapshotData, error) {
@@ -122,18 +126,53 @@ func LoadSnapshotRestic(ctx context.Context, bin restic.BinaryInfo, repo string,
 	if snapshot.StoragePools, err = loadStoragePoolsRestic(ctx, bin, repo, ts); err != nil {
 		return snapshot, err
 	}
+	// Network objects and server settings were added after config moved to
+	// bundles, so they are read from the manifest's snapshot when the
+	// manifest lists them.
+	missing, err := loadDocumentsRestic(ctx, bin, repo, manifestSnap, snapshot.Manifest, snapshot.NetworkObjects.documents())
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.NetworkObjects.Missing = missing
+	if missing, err = loadDocumentsRestic(ctx, bin, repo, manifestSnap, snapshot.Manifest, snapshot.Server.documents()); err != nil {
+		return snapshot, err
+	}
+	snapshot.Server.Missing = missing
 
 	return snapshot, nil
 }
 
+// loadDocumentsRestic unmarshals each document listed in mf from snap and
+// reports whether any of them is absent.
+func loadDocumentsRestic(ctx context.Context, bin restic.BinaryInfo, repo string, snap restic.Snapshot, mf Manifest, docs []configDoc) (bool, error) {
+	missing := false
+	for _, doc := range docs {
+		if !slices.Contains(mf.Includes, doc.name) {
+			missing = true
+			continue
+		}
+		data, err := dumpConfigFile(ctx, bin, repo, snap, configFileName(doc.name+".json"))
+		if err != nil {
+			return missing, err
+		}
+		if err := json.Unmarshal(data, doc.v); err != nil {
+			return missing, fmt.Errorf("%s.json: %w", doc.name, err)
+		}
+	}
+	return missing, nil
+}
+
 func ListResticConfigTimestamps(ctx context.Context, bin restic.BinaryInfo, repo string) ([]string, error) {
-	snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{"type=config", "part=manifest"})
+	snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{"type=config"})
 	if err != nil {
 		return nil, err
 	}
 	seen := map[string]struct{}{}
 	var ts []string
 	for _, snap := range snaps {
+		if !snap.HasPart("manifest") {
+			continue
+		}
 		value := snap.TagMap()["timestamp"]
 		if value == "" {
 			value = snap.Time.UTC().Format("20060102T150405Z")
@@ -212,7 +251,12 @@ func buildChecksums(entries []struct{ name, hash string }, manifestHash string)
 
 func configFileName(file string) string { return file }
 
-func tagsConfig(ts, part string) []string {
+// ResticTags returns the restic tags for a config version; an empty part
+// tags a bundle snapshot.
+func ResticTags(ts, part string) []string {
+	if part == "" {
+		return []string{"type=config", restic.BundleSchemaTag, fmt.Sprintf("timestamp=%s", ts)}
+	}
 	return []string{
 		"type=config",
 		"schema=v1",
@@ -227,14 +271,21 @@ func hashBytes(data []byte) string {
 }
 
 func findConfigSnapshot(ctx context.Context, bin restic.BinaryInfo, repo, version, part string) (restic.Snapshot, error) {
-	tags := []string{"type=config", fmt.Sprintf("part=%s", part)}
+	tags := []string{"type=config"}
 	if version != "" {
 		tags = append(tags, fmt.Sprintf("timestamp=%s", version))
 	}
-	snaps, err := restic.ListSnapshots(ctx, bin, repo, tags)
+	all, err := restic.ListSnapshots(ctx, bin, repo, tags)
 	if err != nil {
 		return restic.Snapshot{}, err
 	}
+	// Bundles hold every part; legacy backups have one snapshot per part.
+	var snaps []restic.Snapshot
+	for _, snap := range all {
+		if snap.HasPart(part) {
+			snaps = append(snaps, snap)
+		}
+	}
 	if len(snaps) == 0 {
 		if version == "" {
 			return restic.Snapshot{}, fmt.Errorf("no config snapshots found")
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"incus-backup/src/incusapi"
+)
+
+// Kinds lists the config kinds that a Selection can name, in apply order.
+var Kinds = []string{
+	"server_config",
+	"cluster_groups",
+	"storage_pools",
+	"networks",
+	"network_acls",
+	"network_zones",
+	"network_zone_records",
+	"network_forwards",
+	"network_load_balancers",
+	"network_peers",
+	"projects",
+	"profiles",
+	"certificates",
+}
+
+// Selection narrows a Plan to some kinds or items. The zero value selects
+// everything.
+type Selection struct {
+	only    []selector
+	exclude []selector
+}
+
+// selector matches a kind and, when pattern is set, the item names of that
+// kind.
+type selector struct {
+	kind    string
+	pattern string
+}
+
+func (s selector) matches(kind, name string) bool {
+	if s.kind != kind {
+		return false
+	}
+	if s.pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(s.pattern, name)
+	return ok
+}
+
+// ParseSelection builds a Selection from --only and --exclude entries. Each
+// entry is a kind ("profiles") or a kind and an item name pattern
+// ("profiles/web-*"). Item names are the keys shown in the preview, e.g.
+// "zone/record" for zone records or the config key for server_config.
+func ParseSelection(only, exclude []string) (Selection, error) {
+	var sel Selection
+	var err error
+	if sel.only, err = parseSelectors(only); err != nil {
+		return Selection{}, err
+	}
+	if sel.exclude, err = parseSelectors(exclude); err != nil {
+		return Selection{}, err
+	}
+	return sel, nil
+}
+
+func parseSelectors(entries []string) ([]selector, error) {
+	var out []selector
+	for _, e := range entries {
+		kind, pattern, _ := strings.Cut(strings.TrimSpace(e), "/")
+		if !slices.Contains(Kinds, kind) {
+			return nil, fmt.Errorf("unknown config kind %q (valid: %s)", kind, strings.Join(Kinds, ", "))
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern in %q: %w", e, err)
+		}
+		out = append(out, selector{kind: kind, pattern: pattern})
+	}
+	return out, nil
+}
+
+// Selects reports whether the item name of kind is selected: it must match
+// an --only entry, if there are any, and no --exclude entry.
+func (s Selection) Selects(kind, name string) bool {
+	match := func(sel selector) bool { return sel.matches(kind, name) }
+	if len(s.only) > 0 && !slices.ContainsFunc(s.only, match) {
+		return false
+	}
+	return !slices.ContainsFunc(s.exclude, match)
+}
+
+// Select returns the part of p that s selects.
+func (p Plan) Select(s Selection) Plan {
+	if len(s.only) == 0 && len(s.exclude) == 0 {
+		return p
+	}
+	keep := func(kind string) func(string) bool {
+		return func(name string) bool { return s.Selects(kind, name) }
+	}
+
+	projectName := func(v incusapi.Project) string { return v.Name }
+	networkName := func(v incusapi.Network) string { return v.Name }
+	poolName := func(v incusapi.StoragePool) string { return v.Name }
+
+	projects := keep("projects")
+	p.Projects = ProjectPlan{
+		ToCreate: filterItems(p.Projects.ToCreate, projectName, projects),
+		ToUpdate: filterItems(p.Projects.ToUpdate, func(u ProjectUpdate) string { return u.Name }, projects),
+		ToDelete: filterItems(p.Projects.ToDelete, projectName, projects),
+	}
+	networks := keep("networks")
+	p.Networks = NetworkPlan{
+		ToCreate: filterItems(p.Networks.ToCreate, networkName, networks),
+		ToUpdate: filterItems(p.Networks.ToUpdate, func(u NetworkUpdate) string { return u.Name }, networks),
+		ToDelete: filterItems(p.Networks.ToDelete, networkName, networks),
+	}
+	pools := keep("storage_pools")
+	p.StoragePools = StoragePoolPlan{
+		ToCreate: filterItems(p.StoragePools.ToCreate, poolName, pools),
+		ToUpdate: filterItems(p.StoragePools.ToUpdate, func(u StoragePoolUpdate) string { return u.Name }, pools),
+		ToDelete: filterItems(p.StoragePools.ToDelete, poolName, pools),
+	}
+	p.ACLs = selectObjects(p.ACLs, keep("network_acls"))
+	p.Zones = selectObjects(p.Zones, keep("network_zones"))
+	p.ZoneRecords = selectObjects(p.ZoneRecords, keep("network_zone_records"))
+	p.Forwards = selectObjects(p.Forwards, keep("network_forwards"))
+	p.LoadBalancers = selectObjects(p.LoadBalancers, keep("network_load_balancers"))
+	p.Peers = selectObjects(p.Peers, keep("network_peers"))
+	p.Profiles = selectObjects(p.Profiles, keep("profiles"))
+
+	configKey := func(c ServerConfigChange) string { return c.Key }
+	p.Server.Config = ServerConfigPlan{
+		ToSet:   filterItems(p.Server.Config.ToSet, configKey, keep("server_config")),
+		ToUnset: filterItems(p.Server.Config.ToUnset, configKey, keep("server_config")),
+	}
+	p.Server.Certificates = selectObjects(p.Server.Certificates, keep("certificates"))
+	p.Server.ClusterGroups = selectObjects(p.Server.ClusterGroups, keep("cluster_groups"))
+	return p
+}
+
+func selectObjects[T any](p ObjectPlan[T], keep func(string) bool) ObjectPlan[T] {
+	p.ToCreate = filterItems(p.ToCreate, p.Key, keep)
+	p.ToUpdate = filterItems(p.ToUpdate, func(u ObjectUpdate[T]) string { return u.Name }, keep)
+	p.ToDelete = filterItems(p.ToDelete, p.Key, keep)
+	return p
+}
+
+// filterItems returns the items whose name is kept, in a new slice.
+func filterItems[T any](items []T, name func(T) string, keep func(string) bool) []T {
+	var out []T
+	for _, v := range items {
+		if keep(name(v)) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
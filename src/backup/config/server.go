@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"incus-backup/src/incusapi"
+)
+
+// ServerState holds server-level settings: the server config, the trust store
+// and cluster groups.
+type ServerState struct {
+	Config        map[string]string
+	Certificates  []incusapi.Certificate
+	ClusterGroups []incusapi.ClusterGroup
+
+	// Missing is set for snapshots taken before server settings were backed
+	// up; plans then leave the server alone.
+	Missing bool
+}
+
+func (s *ServerState) documents() []configDoc {
+	return []configDoc{
+		{"server_config", &s.Config},
+		{"certificates", &s.Certificates},
+		{"cluster_groups", &s.ClusterGroups},
+	}
+}
+
+// ListServerState reads the server settings in a deterministic order.
+func ListServerState(client incusapi.Client) (ServerState, error) {
+	var s ServerState
+	var err error
+	if s.Config, err = client.GetServerConfig(); err != nil {
+		return s, err
+	}
+	if s.Certificates, err = client.ListCertificates(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.Certificates, func(i, j int) bool { return s.Certificates[i].Fingerprint < s.Certificates[j].Fingerprint })
+	if s.ClusterGroups, err = client.ListClusterGroups(); err != nil {
+		return s, err
+	}
+	sort.Slice(s.ClusterGroups, func(i, j int) bool { return s.ClusterGroups[i].Name < s.ClusterGroups[j].Name })
+	return s, nil
+}
+
+// LoadServerStateDir reads server settings from a config snapshot directory.
+func LoadServerStateDir(dir string) (ServerState, error) {
+	var s ServerState
+	missing, err := loadDocumentsDir(dir, s.documents())
+	s.Missing = missing
+	return s, err
+}
+
+// ServerKeyRisk explains why changing a server config key needs --force, or
+// returns "" for keys that are safe to apply.
+func ServerKeyRisk(key string) string {
+	switch {
+	case strings.HasPrefix(key, "core.https_"), key == "cluster.https_address",
+		strings.HasPrefix(key, "core.trust_"), strings.HasPrefix(key, "oidc."),
+		strings.HasPrefix(key, "openfga."):
+		return "can cut off API access"
+	case key == "storage.backups_volume", key == "storage.images_volume":
+		return "refers to a volume that may not exist yet"
+	default:
+		return ""
+	}
+}
+
+// ServerConfigChange is one server config key to set or unset.
+type ServerConfigChange struct {
+	Key     string
+	Current string
+	Desired string
+	// Risk is why applying needs --force; empty for safe keys.
+	Risk string
+}
+
+// ServerConfigPlan describes differences in the server config.
+type ServerConfigPlan struct {
+	ToSet   []ServerConfigChange
+	ToUnset []ServerConfigChange
+}
+
+// BuildServerConfigPlan compares the server config key by key.
+func BuildServerConfigPlan(current, desired map[string]string) ServerConfigPlan {
+	var plan ServerConfigPlan
+	for key, want := range desired {
+		if have, ok := current[key]; !ok || have != want {
+			plan.ToSet = append(plan.ToSet, ServerConfigChange{Key: key, Current: current[key], Desired: want, Risk: ServerKeyRisk(key)})
+		}
+	}
+	for key, have := range current {
+		if _, ok := desired[key]; !ok {
+			plan.ToUnset = append(plan.ToUnset, ServerConfigChange{Key: key, Current: have, Risk: ServerKeyRisk(key)})
+		}
+	}
+	sort.Slice(plan.ToSet, func(i, j int) bool { return plan.ToSet[i].Key < plan.ToSet[j].Key })
+	sort.Slice(plan.ToUnset, func(i, j int) bool { return plan.ToUnset[i].Key < plan.ToUnset[j].Key })
+	return plan
+}
+
+type (
+	CertificatePlan  = ObjectPlan[incusapi.Certificate]
+	ClusterGroupPlan = ObjectPlan[incusapi.ClusterGroup]
+)
+
+func BuildCertificatesPlan(current, desired []incusapi.Certificate) CertificatePlan {
+	return buildObjectPlan(current, desired,
+		func(c incusapi.Certificate) string { return c.Fingerprint },
+		func(a, b incusapi.Certificate) bool {
+			return a.Name == b.Name && a.Type == b.Type && a.Restricted == b.Restricted &&
+				a.Description == b.Description && equalSet(a.Projects, b.Projects)
+		})
+}
+
+// BuildClusterGroupsPlan plans cluster group changes. The built-in "default"
+// group cannot be deleted and is never planned for deletion.
+func BuildClusterGroupsPlan(current, desired []incusapi.ClusterGroup) ClusterGroupPlan {
+	plan := buildObjectPlan(current, desired,
+		func(g incusapi.ClusterGroup) string { return g.Name },
+		func(a, b incusapi.ClusterGroup) bool {
+			return a.Description == b.Description && equalSet(a.Members, b.Members)
+		})
+	plan.ToDelete = slices.DeleteFunc(plan.ToDelete, func(g incusapi.ClusterGroup) bool { return g.Name == "default" })
+	return plan
+}
+
+func equalSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// ServerPlan groups the plans for server-level settings.
+type ServerPlan struct {
+	Config        ServerConfigPlan `json:"server_config"`
+	Certificates  CertificatePlan  `json:"certificates"`
+	ClusterGroups ClusterGroupPlan `json:"cluster_groups"`
+}
+
+// BuildServerPlan plans server settings. A Missing desired state yields an
+// empty plan.
+func BuildServerPlan(current, desired ServerState) ServerPlan {
+	if desired.Missing {
+		return ServerPlan{}
+	}
+	return ServerPlan{
+		Config:        BuildServerConfigPlan(current.Config, desired.Config),
+		Certificates:  BuildCertificatesPlan(current.Certificates, desired.Certificates),
+		ClusterGroups: BuildClusterGroupsPlan(current.ClusterGroups, desired.ClusterGroups),
+	}
+}
+
+// Empty reports whether the plan has no changes.
+func (p ServerPlan) Empty() bool {
+	return len(p.Config.ToSet) == 0 && len(p.Config.ToUnset) == 0 && p.Certificates.Empty() && p.ClusterGroups.Empty()
+}
+
+// ApplyServerConfigPlan sets and unsets safe keys; keys with a Risk are only
+// changed when force is true. The config is written in a single update.
+func ApplyServerConfigPlan(client incusapi.Client, plan ServerConfigPlan, force bool) (string, error) {
+	return applyAll(serverConfigStep(client, plan, force, nil))
+}
+
+func serverConfigStep(client incusapi.Client, plan ServerConfigPlan, force bool, j *Journal) applyStep {
+	var summary string
+	return applyStep{summary: func() string { return summary }, apply: func(phase applyPhase) error {
+		if phase != phaseUpsert {
+			return nil
+		}
+		var err error
+		summary, err = applyServerConfigPlan(client, plan, force, j)
+		return err
+	}}
+}
+
+func applyServerConfigPlan(client incusapi.Client, plan ServerConfigPlan, force bool, j *Journal) (string, error) {
+	config, err := client.GetServerConfig()
+	if err != nil {
+		return "", err
+	}
+	if config == nil {
+		config = map[string]string{}
+	}
+	set, unset, skipped := 0, 0, 0
+	for _, c := range plan.ToSet {
+		if c.Risk != "" && !force {
+			skipped++
+			continue
+		}
+		config[c.Key] = c.Desired
+		set++
+	}
+	for _, c := range plan.ToUnset {
+		if c.Risk != "" && !force {
+			skipped++
+			continue
+		}
+		delete(config, c.Key)
+		unset++
+	}
+	if set+unset > 0 {
+		if err := j.record("server_config", "update", "", func() error { return client.UpdateServerConfig(config) }); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("server_config: set=%d unset=%d skipped=%d", set, unset, skipped), nil
+}
+
+// ApplyClusterGroupsPlan applies cluster group creations and updates.
+// Deletions only if allowDelete is true.
+func ApplyClusterGroupsPlan(client incusapi.Client, plan ClusterGroupPlan, allowDelete bool) (string, error) {
+	return applyAll(clusterGroupsStep(client, plan, allowDelete, nil))
+}
+
+func clusterGroupsStep(client incusapi.Client, plan ClusterGroupPlan, allowDelete bool, j *Journal) applyStep {
+	return objectStep("cluster_groups", plan, allowDelete, j, client.CreateClusterGroup, client.UpdateClusterGroup,
+		func(g incusapi.ClusterGroup) error { return client.DeleteClusterGroup(g.Name) })
+}
+
+// ApplyCertificatesPlan adds missing trust store entries. Updates and
+// deletions can restrict or remove the certificate in use, so they are only
+// applied when force is true; deletions also need allowDelete. Apply it after
+// projects, which certificates may be restricted to.
+func ApplyCertificatesPlan(client incusapi.Client, plan CertificatePlan, force, allowDelete bool) (string, error) {
+	return applyAll(certificatesStep(client, plan, force, allowDelete, nil))
+}
+
+func certificatesStep(client incusapi.Client, plan CertificatePlan, force, allowDelete bool, j *Journal) applyStep {
+	c := &changes{kind: "certificates", withSkipped: true}
+	return applyStep{summary: c.String, apply: func(phase applyPhase) error {
+		if phase == phaseUpsert {
+			for _, cert := range plan.ToCreate {
+				if err := j.record("certificates", "create", cert.Fingerprint, func() error { return client.CreateCertificate(cert) }); err != nil {
+					return fmt.Errorf("certificates: create %s: %w", cert.Fingerprint, err)
+				}
+				c.created++
+			}
+			if !force {
+				c.skipped += len(plan.ToUpdate)
+				return nil
+			}
+			for _, u := range plan.ToUpdate {
+				if err := j.record("certificates", "update", u.Name, func() error { return client.UpdateCertificate(u.Desired) }); err != nil {
+					return fmt.Errorf("certificates: update %s: %w", u.Name, err)
+				}
+				c.updated++
+			}
+			return nil
+		}
+		if !allowDelete {
+			return nil
+		}
+		if !force {
+			c.skipped += len(plan.ToDelete)
+			return nil
+		}
+		for _, cert := range plan.ToDelete {
+			if err := j.record("certificates", "delete", cert.Fingerprint, func() error { return client.DeleteCertificate(cert.Fingerprint) }); err != nil {
+				return fmt.Errorf("certificates: delete %s: %w", cert.Fingerprint, err)
+			}
+			c.deleted++
+		}
+		return nil
+	}}
+}
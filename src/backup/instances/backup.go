@@ -10,18 +10,28 @@ import (
 	"path/filepath"
 	"time"
 
+	"incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
 	pg "incus-backup/src/util/progress"
 )
 
 // BackupInstance exports a single instance to the directory backend layout.
 // It creates instances/<project>/<name>/<timestamp>/export.tar.xz and writes a manifest and checksums.
-func BackupInstance(client incusapi.Client, root, project, name string, optimized bool, snapshot bool, now time.Time, progressOut io.Writer) (string, error) {
+func BackupInstance(client incusapi.Client, root, project, name string, optimized bool, snapshot bool, now time.Time, progressOut io.Writer) (_ string, err error) {
 	ts := now.UTC().Format("20060102T150405Z")
 	snapDir := filepath.Join(root, "instances", project, name, ts)
 	if err := os.MkdirAll(snapDir, 0o755); err != nil {
 		return "", err
 	}
+	// Do not leave a half-written version behind when the export fails or
+	// is cancelled.
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(snapDir)
+		}
+	}()
+
+	mf := newManifest(client, project, name, optimized, snapshot, now, progressOut)
 
 	snapName := ""
 	if snapshot {
@@ -58,7 +68,8 @@ func BackupInstance(client incusapi.Client, root, project, name string, optimize
 			reader = pg.NewReader(r, fi.Size(), "write", progressOut)
 		}
 	}
-	if _, err := io.Copy(f, reader); err != nil {
+	rec := &manifest.Recorder{}
+	if _, err := io.Copy(f, io.TeeReader(reader, rec)); err != nil {
 		f.Close()
 		return "", err
 	}
@@ -66,16 +77,7 @@ func BackupInstance(client incusapi.Client, root, project, name string, optimize
 		return "", err
 	}
 
-	mf := Manifest{
-		Type:      "instance",
-		Project:   project,
-		Name:      name,
-		CreatedAt: now.UTC(),
-		Options: map[string]string{
-			"snapshot":  fmt.Sprintf("%t", snapshot),
-			"optimized": fmt.Sprintf("%t", optimized),
-		},
-	}
+	mf.Export = rec.Export("export.tar.xz")
 	if err := writeJSON(filepath.Join(snapDir, "manifest.json"), mf); err != nil {
 		return "", err
 	}
@@ -0,0 +1,156 @@
+package instances
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"incus-backup/src/archive"
+)
+
+// Change kinds reported by DiffVersions.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// VersionDiff lists what changed between two exports of an instance.
+type VersionDiff struct {
+	// Config holds changed config keys, plus "profiles" when the profile
+	// list changed.
+	Config []KeyChange `json:"config"`
+	// Devices holds changed device properties as DEVICE.KEY.
+	Devices   []KeyChange  `json:"devices"`
+	Snapshots []KeyChange  `json:"snapshots"`
+	Files     []FileChange `json:"files"`
+}
+
+// KeyChange is one added, removed or changed setting or snapshot.
+type KeyChange struct {
+	Key    string `json:"key"`
+	Change string `json:"change"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+}
+
+// FileChange is one added, removed or changed path of the instance data.
+// Sizes are those of regular files; From or To is nil for added and removed
+// paths.
+type FileChange struct {
+	Path   string         `json:"path"`
+	Change string         `json:"change"`
+	From   *archive.Entry `json:"from,omitempty"`
+	To     *archive.Entry `json:"to,omitempty"`
+}
+
+// Empty reports whether the two versions are the same.
+func (d VersionDiff) Empty() bool {
+	return len(d.Config)+len(d.Devices)+len(d.Snapshots)+len(d.Files) == 0
+}
+
+// DiffVersions compares two exports of an instance: the instance config,
+// profiles and devices in their index, their snapshots and their data.
+// Incus-managed volatile.* config keys are left out. Files
+// are compared by type, content, size, mode, ownership and link target;
+// timestamps are ignored.
+func DiffVersions(from, to *archive.Tree) VersionDiff {
+	a, b := indexInstance(from.Index), indexInstance(to.Index)
+	var d VersionDiff
+	d.Config = diffMaps(withoutVolatile(a.Config), withoutVolatile(b.Config))
+	if !slices.Equal(a.Profiles, b.Profiles) {
+		d.Config = append(d.Config, KeyChange{Key: "profiles", Change: Changed,
+			From: strings.Join(a.Profiles, ","), To: strings.Join(b.Profiles, ",")})
+	}
+	d.Devices = diffMaps(flattenDevices(a.Devices), flattenDevices(b.Devices))
+	d.Snapshots = diffMaps(setOf(from.Index.Snapshots), setOf(to.Index.Snapshots))
+
+	paths := make([]string, 0, len(from.Entries)+len(to.Entries))
+	for p := range from.Entries {
+		paths = append(paths, p)
+	}
+	for p := range to.Entries {
+		if _, ok := from.Entries[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		old, hadOld := from.Entries[p]
+		cur, hasCur := to.Entries[p]
+		switch {
+		case !hadOld:
+			d.Files = append(d.Files, FileChange{Path: p, Change: Added, To: &cur})
+		case !hasCur:
+			d.Files = append(d.Files, FileChange{Path: p, Change: Removed, From: &old})
+		case old != cur:
+			d.Files = append(d.Files, FileChange{Path: p, Change: Changed, From: &old, To: &cur})
+		}
+	}
+	return d
+}
+
+func indexInstance(idx *archive.Index) archive.IndexInstance {
+	if idx == nil || idx.Config == nil || idx.Config.Container == nil {
+		return archive.IndexInstance{}
+	}
+	return *idx.Config.Container
+}
+
+// withoutVolatile drops the volatile.* keys Incus updates on its own, such as
+// MAC addresses, UUIDs and the last power state.
+func withoutVolatile(config map[string]string) map[string]string {
+	out := make(map[string]string, len(config))
+	for k, v := range config {
+		if !strings.HasPrefix(k, "volatile.") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// diffMaps returns the changed keys of two maps in key order.
+func diffMaps(from, to map[string]string) []KeyChange {
+	keys := make([]string, 0, len(from)+len(to))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	for k := range to {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var out []KeyChange
+	for _, k := range keys {
+		old, hadOld := from[k]
+		cur, hasCur := to[k]
+		switch {
+		case !hadOld:
+			out = append(out, KeyChange{Key: k, Change: Added, To: cur})
+		case !hasCur:
+			out = append(out, KeyChange{Key: k, Change: Removed, From: old})
+		case old != cur:
+			out = append(out, KeyChange{Key: k, Change: Changed, From: old, To: cur})
+		}
+	}
+	return out
+}
+
+func flattenDevices(devices map[string]map[string]string) map[string]string {
+	out := map[string]string{}
+	for name, props := range devices {
+		for k, v := range props {
+			out[name+"."+k] = v
+		}
+	}
+	return out
+}
+
+func setOf(items []string) map[string]string {
+	out := make(map[string]string, len(items))
+	for _, v := range items {
+		out[v] = ""
+	}
+	return out
+}
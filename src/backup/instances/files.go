@@ -0,0 +1,179 @@
+package instances
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/incusapi"
+)
+
+// File restore statuses.
+const (
+	FileRestored     = "restored"
+	FileWouldRestore = "would_restore"
+	// FileConflict is reported by dry runs for files that exist in the
+	// instance and would be overwritten or skipped by the policy.
+	FileConflict = "conflict"
+	// FileExists is reported for directories that already exist; they are
+	// left as they are.
+	FileExists      = "exists"
+	FileSkipped     = "skipped_exists"
+	FileUnsupported = "skipped_unsupported"
+)
+
+// spoolMemoryLimit is the largest file kept in memory while it is pushed.
+const spoolMemoryLimit = 8 << 20
+
+// Existing-file policies for RestoreFiles.
+const (
+	OnExistingAsk       = "ask"
+	OnExistingOverwrite = "overwrite"
+	OnExistingSkip      = "skip"
+)
+
+// FileResult reports what happened to one selected path.
+type FileResult struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+// FilesOptions controls RestoreFiles.
+type FilesOptions struct {
+	// OnExisting is OnExistingAsk, OnExistingOverwrite or OnExistingSkip.
+	OnExisting string
+	// Confirm is asked once, with the first existing file, under
+	// OnExistingAsk; its answer applies to every existing file.
+	Confirm func(path string) (bool, error)
+	DryRun  bool
+}
+
+// RestoreFiles streams an instance export and pushes the paths m selects into
+// the instance project/name through the file API, with the ownership and
+// modes recorded in the export. Missing directories are created, existing
+// ones left as they are. Hard links, devices and other special files are
+// skipped. It fails after the walk when a pattern matched nothing.
+func RestoreFiles(client incusapi.Client, project, name string, export io.Reader, m *archive.PathMatcher, opts FilesOptions) ([]FileResult, error) {
+	var out []FileResult
+	decided := opts.OnExisting != OnExistingAsk
+	overwrite := opts.OnExisting == OnExistingOverwrite
+	_, _, err := archive.WalkData(export, func(p string, hdr *tar.Header, body io.Reader) error {
+		if !strings.HasPrefix(p, "/") {
+			return fmt.Errorf("export holds a disk image (%s); files can only be restored from container backups", p)
+		}
+		if !m.Match(p) {
+			_, err := io.Copy(io.Discard, body)
+			return err
+		}
+		e := archive.NewEntry(hdr)
+		res := FileResult{Path: p, Type: e.Type, Size: e.Size}
+		file := incusapi.InstanceFile{Path: p, UID: int64(e.UID), GID: int64(e.GID), Mode: int(e.Mode)}
+		switch e.Type {
+		case archive.EntryDir:
+			file.Type = "directory"
+		case archive.EntryFile:
+			file.Type = "file"
+		case archive.EntrySymlink:
+			file.Type = "symlink"
+			file.Content = strings.NewReader(e.Link)
+		default:
+			res.Status = FileUnsupported
+			out = append(out, res)
+			return nil
+		}
+
+		exists, err := client.InstanceFileExists(project, name, p)
+		if err != nil {
+			return err
+		}
+		switch {
+		case exists && file.Type == "directory":
+			res.Status = FileExists
+			out = append(out, res)
+			return nil
+		case opts.DryRun:
+			res.Status = FileWouldRestore
+			if exists {
+				res.Status = FileConflict
+			}
+			out = append(out, res)
+			return nil
+		case exists && !decided:
+			ok, err := opts.Confirm(p)
+			if err != nil {
+				return err
+			}
+			decided, overwrite = true, ok
+		}
+		if exists && !overwrite {
+			res.Status = FileSkipped
+			out = append(out, res)
+			return nil
+		}
+
+		if e.Type == archive.EntryFile {
+			content, err := spool(body, e.Size)
+			if err != nil {
+				return err
+			}
+			defer content.Close()
+			file.Content = content
+		}
+		if err := client.PushInstanceFile(project, name, file); err != nil {
+			return fmt.Errorf("push %s: %w", p, err)
+		}
+		res.Status = FileRestored
+		out = append(out, res)
+		return nil
+	})
+	if err != nil {
+		return out, err
+	}
+	if missing := m.Unmatched(); len(missing) > 0 {
+		return out, fmt.Errorf("no paths match %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// spooled is file content the file API can seek in: small files are kept in
+// memory, larger ones in a temporary file.
+type spooled struct {
+	io.ReadSeeker
+	tmp *os.File
+}
+
+func spool(body io.Reader, size int64) (*spooled, error) {
+	if size <= spoolMemoryLimit {
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return &spooled{ReadSeeker: bytes.NewReader(b)}, nil
+	}
+	f, err := os.CreateTemp("", "incus-backup-file-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name())
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &spooled{ReadSeeker: f, tmp: f}, nil
+}
+
+func (s *spooled) Close() {
+	if s.tmp != nil {
+		_ = s.tmp.Close()
+	}
+}
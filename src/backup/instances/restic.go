@@ -5,14 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"time"
 
+	manifestpkg "incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
 	"incus-backup/src/restic"
-	pg "incus-backup/src/util/progress"
 )
 
 const (
@@ -23,11 +23,13 @@ const (
 )
 
 // BackupInstanceRestic streams an instance export directly into a restic repository.
-func BackupInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, project, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (string, error) {
+func BackupInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, project, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (manifestpkg.Stored, error) {
 	if err := restic.EnsureRepository(ctx, bin, repo); err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 
+	manifest := newManifest(client, project, name, optimized, snapshot, now, progressOut)
+
 	ts := now.UTC().Format("20060102T150405Z")
 	snapName := ""
 	if snapshot {
@@ -36,7 +38,7 @@ func BackupInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo strin
 			fmt.Fprintf(progressOut, "[snapshot] create %s@%s\n", name, snapName)
 		}
 		if err := client.CreateInstanceSnapshot(project, name, snapName); err != nil {
-			return "", err
+			return manifestpkg.Stored{}, err
 		}
 		defer func() {
 			if progressOut != nil {
@@ -48,62 +50,76 @@ func BackupInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo strin
 
 	export, err := client.ExportInstance(project, name, optimized, snapName, resticCompressionNone, progressOut)
 	if err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 	defer export.Close()
 
-	var reader io.Reader = export
-	if statter, ok := export.(interface{ Stat() (os.FileInfo, error) }); ok && progressOut != nil {
-		if fi, err := statter.Stat(); err == nil {
-			reader = pg.NewReader(export, fi.Size(), "restic backup", progressOut)
-		}
-	}
 	hash := sha256.New()
-	reader = io.TeeReader(reader, hash)
+	rec := &manifestpkg.Recorder{}
+	// restic reports its own progress from --json status messages, so the
+	// export is not wrapped in a progress reader.
+	reader := io.TeeReader(export, io.MultiWriter(hash, rec))
 
 	filename := resticInstanceDataFilename
-	tags := resticTagsForInstance(project, name, ts, "data", optimized, snapshot)
-	if err := restic.BackupStream(ctx, bin, repo, filename, tags, reader, progressOut); err != nil {
-		return "", err
+	tags := ResticTags(project, name, ts, "data", optimized, snapshot)
+	summary, err := restic.BackupStream(ctx, bin, repo, filename, tags, reader, progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
 	}
 
 	sum := hex.EncodeToString(hash.Sum(nil))
-	manifest := Manifest{
-		Type:      "instance",
-		Project:   project,
-		Name:      name,
-		CreatedAt: now.UTC(),
-		Options: map[string]string{
-			"snapshot":  fmt.Sprintf("%t", snapshot),
-			"optimized": fmt.Sprintf("%t", optimized),
-		},
-	}
-	mfBytes, err := json.MarshalIndent(manifest, "", "  ")
+	manifest.Export = rec.Export(resticInstanceDataFilename)
+	manifest.Restic = manifestpkg.ResticFrom(summary)
+	checksums := []byte(fmt.Sprintf("%s  %s\n", sum, resticInstanceDataFilename))
+
+	// Store the manifest and checksums with the data as a single snapshot.
+	bundled := manifest
+	bundled.Restic = manifest.Restic.Bundled()
+	mfBytes, err := json.MarshalIndent(bundled, "", "  ")
 	if err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
-	manifestPath := resticInstanceManifestFilename
-	if err := restic.BackupBytes(ctx, bin, repo, manifestPath, resticTagsForInstance(project, name, ts, "manifest", optimized, snapshot), mfBytes, progressOut); err != nil {
-		return "", err
+	files := []restic.File{{Name: resticInstanceManifestFilename, Data: mfBytes}, {Name: resticInstanceChecksumsFilename, Data: checksums}}
+	stored := manifestpkg.Stored{Version: ts, SnapshotID: summary.SnapshotID, DataFile: resticInstanceDataFilename, Bytes: manifest.Export.Size, SHA256: sum}
+	bundle, err := restic.BackupBundle(ctx, bin, repo, summary, resticInstanceDataFilename, files, ResticTags(project, name, ts, "", optimized, snapshot), progressOut)
+	if err == nil {
+		stored.SnapshotID = bundle.SnapshotID
+		return stored, nil
 	}
-
-	checksums := fmt.Sprintf("%s  %s\n", sum, resticInstanceDataFilename)
-	checksumPath := resticInstanceChecksumsFilename
-	if err := restic.BackupBytes(ctx, bin, repo, checksumPath, resticTagsForInstance(project, name, ts, "checksums", optimized, snapshot), []byte(checksums), progressOut); err != nil {
-		return "", err
+	if !errors.Is(err, restic.ErrBundleUnsupported) {
+		return manifestpkg.Stored{}, err
 	}
 
-	return ts, nil
+	// Fall back to the legacy layout with one snapshot per part.
+	mfBytes, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticInstanceManifestFilename, ResticTags(project, name, ts, "manifest", optimized, snapshot), mfBytes, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticInstanceChecksumsFilename, ResticTags(project, name, ts, "checksums", optimized, snapshot), checksums, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	return stored, nil
 }
 
-func resticTagsForInstance(project, name, ts, part string, optimized, snapshot bool) []string {
+// ResticTags returns the restic tags for one part of an instance version;
+// an empty part tags a bundle snapshot.
+func ResticTags(project, name, ts, part string, optimized, snapshot bool) []string {
+	schema := "schema=v1"
+	if part == "" {
+		schema = restic.BundleSchemaTag
+	}
 	tags := []string{
 		"type=instance",
-		"schema=v1",
+		schema,
 		fmt.Sprintf("project=%s", project),
 		fmt.Sprintf("name=%s", name),
 		fmt.Sprintf("timestamp=%s", ts),
-		fmt.Sprintf("part=%s", part),
+	}
+	if part != "" {
+		tags = append(tags, fmt.Sprintf("part=%s", part))
 	}
 	if optimized {
 		tags = append(tags, "optimized=true")
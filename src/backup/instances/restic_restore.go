@@ -1,6 +1,7 @@
 package instances
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -12,6 +13,9 @@ import (
 
 // RestoreInstanceRestic streams an instance export from a restic snapshot into Incus.
 func RestoreInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo string, snapshot restic.Snapshot, client incusapi.Client, project, sourceName, targetName string, progressOut io.Writer) error {
+	if err := checkResticManifest(ctx, bin, repo, snapshot, client, progressOut); err != nil {
+		return err
+	}
 	exportPath := exportFilename(project, sourceName, snapshot)
 	pr, pw := io.Pipe()
 	errCh := make(chan error, 1)
@@ -38,4 +42,42 @@ func RestoreInstanceRestic(ctx context.Context, bin restic.BinaryInfo, repo stri
 	return nil
 }
 
+// checkResticManifest loads the manifest stored alongside a data snapshot and
+// reports compatibility warnings. Bundles carry the manifest in the same
+// snapshot; backups without a manifest part are restored without checks, but
+// a manifest that exists and cannot be read fails the restore.
+func checkResticManifest(ctx context.Context, bin restic.BinaryInfo, repo string, data restic.Snapshot, client incusapi.Client, progressOut io.Writer) error {
+	tags := data.TagMap()
+	if tags["timestamp"] == "" {
+		return nil
+	}
+	manifestID := data.ID
+	if !data.IsBundle() {
+		snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{
+			"type=instance",
+			"project=" + tags["project"],
+			"name=" + tags["name"],
+			"timestamp=" + tags["timestamp"],
+			"part=manifest",
+		})
+		if err != nil {
+			return fmt.Errorf("find manifest: %w", err)
+		}
+		if len(snaps) == 0 {
+			return nil
+		}
+		manifestID = snaps[0].ID
+	}
+	var buf bytes.Buffer
+	if err := restic.Dump(ctx, bin, repo, manifestID, resticInstanceManifestFilename, &buf, nil); err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	mf, err := ParseManifest(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	warnCompatibility(client, mf, progressOut)
+	return nil
+}
+
 func exportFilename(string, string, restic.Snapshot) string { return resticInstanceDataFilename }
@@ -1,7 +1,6 @@
 package instances
 
 import (
-    "encoding/json"
     "fmt"
     "io"
     "os"
@@ -16,9 +15,10 @@ func RestoreInstance(client incusapi.Client, snapDir, project, targetName string
     // sanity: load manifest to confirm type
     b, err := os.ReadFile(filepath.Join(snapDir, "manifest.json"))
     if err != nil { return err }
-    var mf Manifest
-    if err := json.Unmarshal(b, &mf); err != nil { return err }
+    mf, err := ParseManifest(b)
+    if err != nil { return err }
     if mf.Type != "instance" { return fmt.Errorf("not an instance snapshot: %s", snapDir) }
+    warnCompatibility(client, mf, progressOut)
     // open export
     exportPath := filepath.Join(snapDir, "export.tar.xz")
     f, err := os.Open(exportPath)
@@ -1,13 +1,123 @@
 package instances
 
-import "time"
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "time"
+
+    "incus-backup/src/backup/manifest"
+    "incus-backup/src/incusapi"
+)
 
 // Manifest captures metadata for an instance snapshot export.
 type Manifest struct {
-    Type        string            `json:"type"` // instance
-    Project     string            `json:"project"`
-    Name        string            `json:"name"`
-    CreatedAt   time.Time         `json:"createdAt"`
-    Options     map[string]string `json:"options,omitempty"` // snapshot, optimized
+    SchemaVersion int               `json:"schemaVersion"`
+    Type          string            `json:"type"` // instance
+    Project       string            `json:"project"`
+    Name          string            `json:"name"`
+    CreatedAt     time.Time         `json:"createdAt"`
+    Options       map[string]string `json:"options,omitempty"` // snapshot, optimized
+    ToolVersion   string            `json:"toolVersion,omitempty"`
+    Server        *manifest.Server  `json:"server,omitempty"`
+    Source        *Source           `json:"source,omitempty"`
+    Export        *manifest.Export  `json:"export,omitempty"`
+    Restic        *manifest.Restic  `json:"restic,omitempty"`
+}
+
+// Source records the instance definition at backup time.
+type Source struct {
+    InstanceType string                       `json:"instanceType"`
+    Architecture string                       `json:"architecture,omitempty"`
+    Pool         string                       `json:"pool,omitempty"`
+    PoolDriver   string                       `json:"poolDriver,omitempty"`
+    Profiles     []string                     `json:"profiles,omitempty"`
+    Config       map[string]string            `json:"config,omitempty"`
+    Devices      map[string]map[string]string `json:"devices,omitempty"`
+}
+
+// ParseManifest decodes an instance manifest, migrating older schemas.
+func ParseManifest(b []byte) (Manifest, error) {
+    var mf Manifest
+    if err := json.Unmarshal(b, &mf); err != nil { return Manifest{}, err }
+    if err := manifest.Migrate(&mf.SchemaVersion); err != nil { return Manifest{}, err }
+    return mf, nil
+}
+
+// Compatibility returns warnings about restoring this backup onto dst.
+func (m Manifest) Compatibility(dst incusapi.ServerInfo) []string {
+    arch := ""
+    if m.Source != nil { arch = m.Source.Architecture }
+    return manifest.Compatibility(m.Server, arch, dst)
+}
+
+// newManifest gathers server and instance metadata for a fresh backup;
+// metadata that cannot be read is left out with a warning.
+func newManifest(client incusapi.Client, project, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) Manifest {
+    mf := Manifest{
+        SchemaVersion: manifest.SchemaVersion,
+        Type:          "instance",
+        Project:       project,
+        Name:          name,
+        CreatedAt:     now.UTC(),
+        Options: map[string]string{
+            "snapshot":  fmt.Sprintf("%t", snapshot),
+            "optimized": fmt.Sprintf("%t", optimized),
+        },
+        ToolVersion: manifest.ToolVersion(),
+    }
+    // Server and source metadata only inform restores; an export is still
+    // worth keeping when they cannot be read.
+    warn := func(format string, args ...any) {
+        if progressOut != nil { fmt.Fprintf(progressOut, "[warn] %s/%s: "+format+"\n", append([]any{project, name}, args...)...) }
+    }
+    info, err := client.Server()
+    if err != nil {
+        warn("server info not recorded: %v", err)
+    } else {
+        mf.Server = manifest.ServerFrom(info)
+    }
+    in, err := client.GetInstance(project, name)
+    if err != nil {
+        warn("instance source not recorded: %v", err)
+        return mf
+    }
+    src := &Source{
+        InstanceType: in.Type,
+        Architecture: in.Architecture,
+        Profiles:     in.Profiles,
+        Config:       in.Config,
+        Devices:      in.Devices,
+    }
+    src.Pool = rootPool(in.ExpandedDevices)
+    if src.Pool == "" { src.Pool = rootPool(in.Devices) }
+    if src.Pool != "" {
+        pools, err := client.ListStoragePools()
+        if err != nil {
+            warn("storage pool driver not recorded: %v", err)
+        }
+        for _, p := range pools {
+            if p.Name == src.Pool { src.PoolDriver = p.Driver }
+        }
+    }
+    mf.Source = src
+    return mf
 }
 
+// rootPool returns the storage pool of the instance's root disk device.
+func rootPool(devices map[string]map[string]string) string {
+    for _, dev := range devices {
+        if dev["type"] == "disk" && dev["path"] == "/" { return dev["pool"] }
+    }
+    return ""
+}
+
+// warnCompatibility prints manifest compatibility warnings for the destination.
+func warnCompatibility(client incusapi.Client, mf Manifest, progressOut io.Writer) {
+    if progressOut == nil { return }
+    info, err := client.Server()
+    if err != nil { return }
+    for _, w := range mf.Compatibility(info) {
+        fmt.Fprintf(progressOut, "[warn] %s/%s: %s\n", mf.Project, mf.Name, w)
+    }
+}
@@ -0,0 +1,165 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/restic"
+	"incus-backup/src/version"
+)
+
+// SchemaVersion is the manifest schema written by this build.
+//
+//	v1: type/project/name/createdAt/options only (no schemaVersion field).
+//	v2: adds toolVersion, server, source and export metadata (and, for
+//	    restic targets, the data snapshot ID and dedup statistics).
+const SchemaVersion = 2
+
+// Server records the Incus server a backup was taken from.
+type Server struct {
+	Version       string   `json:"version,omitempty"`
+	APIVersion    string   `json:"apiVersion,omitempty"`
+	Architectures []string `json:"architectures,omitempty"`
+}
+
+// Export describes the stored export stream.
+type Export struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	Compression string `json:"compression,omitempty"`
+}
+
+// Restic records the restic snapshot holding the export data and how much
+// new data it added after deduplication.
+type Restic struct {
+	SnapshotID      string  `json:"snapshotId,omitempty"`
+	BytesProcessed  int64   `json:"bytesProcessed"`
+	DataAdded       int64   `json:"dataAdded"`
+	DataAddedPacked int64   `json:"dataAddedPacked,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+}
+
+// ResticFrom converts a restic backup summary into manifest form. It returns
+// nil when restic did not report a snapshot (e.g. very old versions).
+func ResticFrom(s restic.BackupSummary) *Restic {
+	if s.SnapshotID == "" {
+		return nil
+	}
+	return &Restic{
+		SnapshotID:      s.SnapshotID,
+		BytesProcessed:  s.TotalBytesProcessed,
+		DataAdded:       s.DataAdded,
+		DataAddedPacked: s.DataAddedPacked,
+		DurationSeconds: s.TotalDuration,
+	}
+}
+
+// Bundled returns a copy for a manifest stored inside the bundle snapshot
+// itself, whose ID is not known until it is written and is therefore omitted.
+func (r *Restic) Bundled() *Restic {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.SnapshotID = ""
+	return &c
+}
+
+// ToolVersion returns the incus-backup version recorded in new manifests.
+func ToolVersion() string { return version.Version }
+
+// ServerFrom converts the client's server info into manifest form.
+func ServerFrom(info incusapi.ServerInfo) *Server {
+	return &Server{Version: info.ServerVersion, APIVersion: info.APIVersion, Architectures: info.Architectures}
+}
+
+// Migrate upgrades a decoded schema version in place. Manifests written before
+// versioning decode with a zero version and are treated as v1; the fields added
+// in v2 are optional so no data needs rewriting. Manifests from a newer tool
+// are rejected rather than half-understood.
+func Migrate(schema *int) error {
+	if *schema == 0 {
+		*schema = 1
+	}
+	if *schema > SchemaVersion {
+		return fmt.Errorf("manifest schema v%d is newer than supported v%d; upgrade incus-backup", *schema, SchemaVersion)
+	}
+	return nil
+}
+
+// Compatibility compares a backup's recorded source against the destination
+// server and returns human-readable warnings. Missing source metadata (v1
+// manifests) yields no warnings.
+func Compatibility(src *Server, architecture string, dst incusapi.ServerInfo) []string {
+	var warnings []string
+	if architecture != "" && len(dst.Architectures) > 0 && !contains(dst.Architectures, architecture) {
+		warnings = append(warnings, fmt.Sprintf("backup architecture %s is not supported by the destination server (%s)", architecture, strings.Join(dst.Architectures, ", ")))
+	}
+	if src != nil && src.Version != "" && dst.ServerVersion != "" && compareVersions(src.Version, dst.ServerVersion) > 0 {
+		warnings = append(warnings, fmt.Sprintf("backup was taken on Incus %s; destination runs older %s and may reject the export", src.Version, dst.ServerVersion))
+	}
+	return warnings
+}
+
+// Recorder is an io.Writer that counts bytes and captures the leading header
+// of an export stream so its size and compression can be recorded.
+type Recorder struct {
+	size int64
+	head []byte
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	if missing := archive.HeaderSize - len(r.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		r.head = append(r.head, p[:missing]...)
+	}
+	r.size += int64(len(p))
+	return len(p), nil
+}
+
+// Export returns the export metadata observed so far.
+func (r *Recorder) Export(filename string) *Export {
+	return &Export{Filename: filename, Size: r.size, Compression: archive.DetectCompression(r.head)}
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares dotted numeric versions, ignoring any suffix.
+func compareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		na, nb := versionPart(pa, i), versionPart(pb, i)
+		if na != nb {
+			if na > nb {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := strings.TrimLeftFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+	end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		digits = digits[:end]
+	}
+	n, _ := strconv.Atoi(digits)
+	return n
+}
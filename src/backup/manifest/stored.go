@@ -0,0 +1,46 @@
+package manifest
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Stored describes a backup version as written to a target, for reporting
+// what a run produced.
+type Stored struct {
+	Version    string // timestamp of the version
+	Path       string // version directory (directory targets)
+	SnapshotID string // snapshot holding the version (restic targets)
+	DataFile   string // export file name; empty for config versions
+	Bytes      int64  // size of DataFile
+	SHA256     string // checksum of DataFile
+}
+
+// ReadStored describes the version directory dir written by a directory
+// backup, taking the checksum of dataFile from its checksums.txt.
+func ReadStored(dir, dataFile string) (Stored, error) {
+	s := Stored{Version: filepath.Base(dir), Path: dir, DataFile: dataFile}
+	if dataFile == "" {
+		return s, nil
+	}
+	fi, err := os.Stat(filepath.Join(dir, dataFile))
+	if err != nil {
+		return s, err
+	}
+	s.Bytes = fi.Size()
+	f, err := os.Open(filepath.Join(dir, "checksums.txt"))
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if sum, name, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "  "); ok && name == dataFile {
+			s.SHA256 = sum
+			break
+		}
+	}
+	return s, scanner.Err()
+}
@@ -10,25 +10,26 @@ import (
 	"path/filepath"
 	"time"
 
+	"incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
 	pg "incus-backup/src/util/progress"
 )
 
-type Manifest struct {
-	Type      string            `json:"type"` // volume
-	Project   string            `json:"project"`
-	Pool      string            `json:"pool"`
-	Name      string            `json:"name"`
-	CreatedAt time.Time         `json:"createdAt"`
-	Options   map[string]string `json:"options,omitempty"`
-}
-
-func BackupVolume(client incusapi.Client, root, project, pool, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (string, error) {
+func BackupVolume(client incusapi.Client, root, project, pool, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (_ string, err error) {
 	ts := now.UTC().Format("20060102T150405Z")
 	snapDir := filepath.Join(root, "volumes", project, pool, name, ts)
 	if err := os.MkdirAll(snapDir, 0o755); err != nil {
 		return "", err
 	}
+	// Do not leave a half-written version behind when the export fails or
+	// is cancelled.
+	defer func() {
+		if err != nil {
+			_ = os.RemoveAll(snapDir)
+		}
+	}()
+
+	mf := newManifest(client, project, pool, name, optimized, snapshot, now, progressOut)
 
 	snapName := ""
 	if snapshot {
@@ -64,7 +65,8 @@ func BackupVolume(client incusapi.Client, root, project, pool, name string, opti
 			reader = pg.NewReader(r, fi.Size(), "write", progressOut)
 		}
 	}
-	if _, err := io.Copy(f, reader); err != nil {
+	rec := &manifest.Recorder{}
+	if _, err := io.Copy(f, io.TeeReader(reader, rec)); err != nil {
 		f.Close()
 		return "", err
 	}
@@ -72,7 +74,7 @@ func BackupVolume(client incusapi.Client, root, project, pool, name string, opti
 		return "", err
 	}
 
-	mf := Manifest{Type: "volume", Project: project, Pool: pool, Name: name, CreatedAt: now.UTC(), Options: map[string]string{"snapshot": fmt.Sprintf("%t", snapshot), "optimized": fmt.Sprintf("%t", optimized)}}
+	mf.Export = rec.Export("volume.tar.xz")
 	if err := writeJSON(filepath.Join(snapDir, "manifest.json"), mf); err != nil {
 		return "", err
 	}
@@ -0,0 +1,113 @@
+package volumes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+)
+
+// Manifest captures metadata for a custom volume export.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Type          string            `json:"type"` // volume
+	Project       string            `json:"project"`
+	Pool          string            `json:"pool"`
+	Name          string            `json:"name"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	Options       map[string]string `json:"options,omitempty"`
+	ToolVersion   string            `json:"toolVersion,omitempty"`
+	Server        *manifest.Server  `json:"server,omitempty"`
+	Source        *Source           `json:"source,omitempty"`
+	Export        *manifest.Export  `json:"export,omitempty"`
+	Restic        *manifest.Restic  `json:"restic,omitempty"`
+}
+
+// Source records the volume definition at backup time.
+type Source struct {
+	PoolDriver  string            `json:"poolDriver,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+}
+
+// ParseManifest decodes a volume manifest, migrating older schemas.
+func ParseManifest(b []byte) (Manifest, error) {
+	var mf Manifest
+	if err := json.Unmarshal(b, &mf); err != nil {
+		return Manifest{}, err
+	}
+	if err := manifest.Migrate(&mf.SchemaVersion); err != nil {
+		return Manifest{}, err
+	}
+	return mf, nil
+}
+
+// Compatibility returns warnings about restoring this backup onto dst.
+func (m Manifest) Compatibility(dst incusapi.ServerInfo) []string {
+	return manifest.Compatibility(m.Server, "", dst)
+}
+
+// newManifest gathers server and volume metadata for a fresh backup;
+// metadata that cannot be read is left out with a warning.
+func newManifest(client incusapi.Client, project, pool, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) Manifest {
+	mf := Manifest{
+		SchemaVersion: manifest.SchemaVersion,
+		Type:          "volume",
+		Project:       project,
+		Pool:          pool,
+		Name:          name,
+		CreatedAt:     now.UTC(),
+		Options: map[string]string{
+			"snapshot":  fmt.Sprintf("%t", snapshot),
+			"optimized": fmt.Sprintf("%t", optimized),
+		},
+		ToolVersion: manifest.ToolVersion(),
+	}
+	// Server and source metadata only inform restores; an export is still
+	// worth keeping when they cannot be read.
+	warn := func(format string, args ...any) {
+		if progressOut != nil {
+			fmt.Fprintf(progressOut, "[warn] %s/%s: "+format+"\n", append([]any{pool, name}, args...)...)
+		}
+	}
+	info, err := client.Server()
+	if err != nil {
+		warn("server info not recorded: %v", err)
+	} else {
+		mf.Server = manifest.ServerFrom(info)
+	}
+	v, err := client.GetVolume(project, pool, name)
+	if err != nil {
+		warn("volume source not recorded: %v", err)
+		return mf
+	}
+	src := &Source{ContentType: v.ContentType, Config: v.Config}
+	pools, err := client.ListStoragePools()
+	if err != nil {
+		warn("storage pool driver not recorded: %v", err)
+	}
+	for _, p := range pools {
+		if p.Name == pool {
+			src.PoolDriver = p.Driver
+		}
+	}
+	mf.Source = src
+	return mf
+}
+
+// warnCompatibility prints manifest compatibility warnings for the destination.
+func warnCompatibility(client incusapi.Client, mf Manifest, progressOut io.Writer) {
+	if progressOut == nil {
+		return
+	}
+	info, err := client.Server()
+	if err != nil {
+		return
+	}
+	for _, w := range mf.Compatibility(info) {
+		fmt.Fprintf(progressOut, "[warn] %s/%s: %s\n", mf.Pool, mf.Name, w)
+	}
+}
@@ -5,14 +5,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"time"
 
+	manifestpkg "incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
 	"incus-backup/src/restic"
-	pg "incus-backup/src/util/progress"
 )
 
 const (
@@ -23,11 +23,13 @@ const (
 )
 
 // BackupVolumeRestic streams a volume export into a restic repository.
-func BackupVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, project, pool, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (string, error) {
+func BackupVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string, client incusapi.Client, project, pool, name string, optimized, snapshot bool, now time.Time, progressOut io.Writer) (manifestpkg.Stored, error) {
 	if err := restic.EnsureRepository(ctx, bin, repo); err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 
+	manifest := newManifest(client, project, pool, name, optimized, snapshot, now, progressOut)
+
 	ts := now.UTC().Format("20060102T150405Z")
 	snapName := ""
 	if snapshot {
@@ -36,7 +38,7 @@ func BackupVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string,
 			fmt.Fprintf(progressOut, "[snapshot] create %s/%s@%s\n", pool, name, snapName)
 		}
 		if err := client.CreateVolumeSnapshot(project, pool, name, snapName); err != nil {
-			return "", err
+			return manifestpkg.Stored{}, err
 		}
 		defer func() {
 			if progressOut != nil {
@@ -48,64 +50,76 @@ func BackupVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string,
 
 	export, err := client.ExportVolume(project, pool, name, optimized, snapName, resticCompressionNone, progressOut)
 	if err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
 	defer export.Close()
 
-	var reader io.Reader = export
-	if statter, ok := export.(interface{ Stat() (os.FileInfo, error) }); ok && progressOut != nil {
-		if fi, err := statter.Stat(); err == nil {
-			reader = pg.NewReader(export, fi.Size(), "restic backup", progressOut)
-		}
-	}
-
 	hash := sha256.New()
-	reader = io.TeeReader(reader, hash)
+	rec := &manifestpkg.Recorder{}
+	// restic reports its own progress from --json status messages, so the
+	// export is not wrapped in a progress reader.
+	reader := io.TeeReader(export, io.MultiWriter(hash, rec))
 
 	filename := resticVolumeDataFilename
-	if err := restic.BackupStream(ctx, bin, repo, filename, resticTagsForVolume(project, pool, name, ts, "data", optimized, snapshot), reader, progressOut); err != nil {
-		return "", err
+	summary, err := restic.BackupStream(ctx, bin, repo, filename, ResticTags(project, pool, name, ts, "data", optimized, snapshot), reader, progressOut)
+	if err != nil {
+		return manifestpkg.Stored{}, err
 	}
 
 	sum := hex.EncodeToString(hash.Sum(nil))
-	manifest := Manifest{
-		Type:      "volume",
-		Project:   project,
-		Pool:      pool,
-		Name:      name,
-		CreatedAt: now.UTC(),
-		Options: map[string]string{
-			"snapshot":  fmt.Sprintf("%t", snapshot),
-			"optimized": fmt.Sprintf("%t", optimized),
-		},
-	}
-	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	manifest.Export = rec.Export(resticVolumeDataFilename)
+	manifest.Restic = manifestpkg.ResticFrom(summary)
+	checksums := []byte(fmt.Sprintf("%s  %s\n", sum, resticVolumeDataFilename))
+
+	// Store the manifest and checksums with the data as a single snapshot.
+	bundled := manifest
+	bundled.Restic = manifest.Restic.Bundled()
+	manifestBytes, err := json.MarshalIndent(bundled, "", "  ")
 	if err != nil {
-		return "", err
+		return manifestpkg.Stored{}, err
 	}
-	manifestPath := resticVolumeManifestFilename
-	if err := restic.BackupBytes(ctx, bin, repo, manifestPath, resticTagsForVolume(project, pool, name, ts, "manifest", optimized, snapshot), manifestBytes, progressOut); err != nil {
-		return "", err
+	files := []restic.File{{Name: resticVolumeManifestFilename, Data: manifestBytes}, {Name: resticVolumeChecksumsFilename, Data: checksums}}
+	stored := manifestpkg.Stored{Version: ts, SnapshotID: summary.SnapshotID, DataFile: resticVolumeDataFilename, Bytes: manifest.Export.Size, SHA256: sum}
+	bundle, err := restic.BackupBundle(ctx, bin, repo, summary, resticVolumeDataFilename, files, ResticTags(project, pool, name, ts, "", optimized, snapshot), progressOut)
+	if err == nil {
+		stored.SnapshotID = bundle.SnapshotID
+		return stored, nil
 	}
-
-	checksums := fmt.Sprintf("%s  %s\n", sum, resticVolumeDataFilename)
-	checksumPath := resticVolumeChecksumsFilename
-	if err := restic.BackupBytes(ctx, bin, repo, checksumPath, resticTagsForVolume(project, pool, name, ts, "checksums", optimized, snapshot), []byte(checksums), progressOut); err != nil {
-		return "", err
+	if !errors.Is(err, restic.ErrBundleUnsupported) {
+		return manifestpkg.Stored{}, err
 	}
 
-	return ts, nil
+	// Fall back to the legacy layout with one snapshot per part.
+	manifestBytes, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticVolumeManifestFilename, ResticTags(project, pool, name, ts, "manifest", optimized, snapshot), manifestBytes, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	if _, err := restic.BackupBytes(ctx, bin, repo, resticVolumeChecksumsFilename, ResticTags(project, pool, name, ts, "checksums", optimized, snapshot), checksums, progressOut); err != nil {
+		return manifestpkg.Stored{}, err
+	}
+	return stored, nil
 }
 
-func resticTagsForVolume(project, pool, name, ts, part string, optimized, snapshot bool) []string {
+// ResticTags returns the restic tags for one part of a volume version; an
+// empty part tags a bundle snapshot.
+func ResticTags(project, pool, name, ts, part string, optimized, snapshot bool) []string {
+	schema := "schema=v1"
+	if part == "" {
+		schema = restic.BundleSchemaTag
+	}
 	tags := []string{
 		"type=volume",
-		"schema=v1",
+		schema,
 		fmt.Sprintf("project=%s", project),
 		fmt.Sprintf("pool=%s", pool),
 		fmt.Sprintf("name=%s", name),
 		fmt.Sprintf("timestamp=%s", ts),
-		fmt.Sprintf("part=%s", part),
+	}
+	if part != "" {
+		tags = append(tags, fmt.Sprintf("part=%s", part))
 	}
 	if optimized {
 		tags = append(tags, "optimized=true")
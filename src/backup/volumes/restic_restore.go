@@ -1,6 +1,7 @@
 package volumes
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -12,6 +13,9 @@ import (
 
 // RestoreVolumeRestic streams a volume tarball from restic into Incus.
 func RestoreVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string, snapshot restic.Snapshot, client incusapi.Client, project, pool, name string, progressOut io.Writer) error {
+	if err := checkResticManifest(ctx, bin, repo, snapshot, client, progressOut); err != nil {
+		return err
+	}
 	exportPath := volumeExportFilename(project, pool, name, snapshot)
 	pr, pw := io.Pipe()
 	errCh := make(chan error, 1)
@@ -38,6 +42,45 @@ func RestoreVolumeRestic(ctx context.Context, bin restic.BinaryInfo, repo string
 	return nil
 }
 
+// checkResticManifest loads the manifest stored alongside a data snapshot and
+// reports compatibility warnings. Bundles carry the manifest in the same
+// snapshot; backups without a manifest part are restored without checks, but
+// a manifest that exists and cannot be read fails the restore.
+func checkResticManifest(ctx context.Context, bin restic.BinaryInfo, repo string, data restic.Snapshot, client incusapi.Client, progressOut io.Writer) error {
+	tags := data.TagMap()
+	if tags["timestamp"] == "" {
+		return nil
+	}
+	manifestID := data.ID
+	if !data.IsBundle() {
+		snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{
+			"type=volume",
+			"project=" + tags["project"],
+			"pool=" + tags["pool"],
+			"name=" + tags["name"],
+			"timestamp=" + tags["timestamp"],
+			"part=manifest",
+		})
+		if err != nil {
+			return fmt.Errorf("find manifest: %w", err)
+		}
+		if len(snaps) == 0 {
+			return nil
+		}
+		manifestID = snaps[0].ID
+	}
+	var buf bytes.Buffer
+	if err := restic.Dump(ctx, bin, repo, manifestID, resticVolumeManifestFilename, &buf, nil); err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	mf, err := ParseManifest(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	warnCompatibility(client, mf, progressOut)
+	return nil
+}
+
 func volumeExportFilename(string, string, string, restic.Snapshot) string {
 	return resticVolumeDataFilename
 }
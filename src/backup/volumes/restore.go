@@ -1,7 +1,6 @@
 package volumes
 
 import (
-    "encoding/json"
     "fmt"
     "io"
     "os"
@@ -14,9 +13,10 @@ import (
 func RestoreVolume(client incusapi.Client, snapDir, project, poolTarget, targetName string, progressOut io.Writer) error {
     b, err := os.ReadFile(filepath.Join(snapDir, "manifest.json"))
     if err != nil { return err }
-    var mf Manifest
-    if err := json.Unmarshal(b, &mf); err != nil { return err }
+    mf, err := ParseManifest(b)
+    if err != nil { return err }
     if mf.Type != "volume" { return fmt.Errorf("not a volume snapshot: %s", snapDir) }
+    warnCompatibility(client, mf, progressOut)
     f, err := os.Open(filepath.Join(snapDir, "volume.tar.xz"))
     if err != nil { return err }
     defer f.Close()
@@ -0,0 +1,558 @@
+// Package browse serves instance backups as a read-only file tree,
+// instances/<project>/<name>/<version>/rootfs/..., for the mount command.
+// Each backup's export is indexed the first time its directory is read, and
+// file contents are streamed out of the export when a file is first opened
+// and kept in a bounded cache for later opens.
+package browse
+
+import (
+	"archive/tar"
+	"bytes"
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/logging"
+)
+
+// Backup identifies one instance backup in a Source.
+type Backup struct {
+	Project string
+	Name    string
+	Version string
+}
+
+// Source lists the instance backups of a target and streams their exports.
+type Source interface {
+	List() ([]Backup, error)
+	Open(b Backup) (io.ReadCloser, error)
+}
+
+// Attr describes a file in the tree.
+type Attr struct {
+	Mode    fs.FileMode
+	Size    int64
+	UID     uint32
+	GID     uint32
+	ModTime time.Time
+	// Link is the target of a symlink.
+	Link string
+}
+
+// DirEntry is one entry of a directory listing.
+type DirEntry struct {
+	Name string
+	Mode fs.FileMode
+}
+
+// memoryLimit is the largest file kept in memory; larger ones are spooled
+// to a temporary file.
+const memoryLimit = 8 << 20
+
+// cacheLimit bounds the extracted file contents kept once their files are
+// closed, so that reopening a file does not stream the export again.
+const cacheLimit = 256 << 20
+
+// DefaultListTTL is how long New's FS reuses the source's listing before
+// asking it again for new or pruned backups.
+const DefaultListTTL = 30 * time.Second
+
+type node struct {
+	attr     Attr
+	children map[string]*node
+	// offset is where a regular file's data starts in the uncompressed
+	// export.
+	offset int64
+	// backup is set on version directories, whose children come from the
+	// backup's export.
+	backup *backupIndex
+}
+
+type backupIndex struct {
+	Backup
+	once sync.Once
+	root *node
+	err  error
+}
+
+// FS is the tree of a Source's backups. It is safe for concurrent use.
+type FS struct {
+	// ListTTL is how long a listing of the source is reused; set it before
+	// the FS is used.
+	ListTTL time.Duration
+
+	src Source
+	log *slog.Logger
+	now func() time.Time
+
+	topMu    sync.Mutex
+	root     *node
+	listedAt time.Time
+	indexes  map[Backup]*backupIndex
+
+	cacheMu sync.Mutex
+	cache   map[*node]*content
+	lru     *list.List // of *content, most recently opened first
+	cached  int64
+}
+
+// New returns the tree of src's backups; log receives index and read
+// failures and may be nil.
+func New(src Source, log *slog.Logger) *FS {
+	if log == nil {
+		log = logging.Discard
+	}
+	return &FS{
+		ListTTL: DefaultListTTL,
+		src:     src,
+		log:     log,
+		now:     time.Now,
+		indexes: map[Backup]*backupIndex{},
+		cache:   map[*node]*content{},
+		lru:     list.New(),
+	}
+}
+
+// Stat describes the file at p, a slash-separated path relative to the
+// tree's root.
+func (f *FS) Stat(p string) (Attr, error) {
+	n, _, err := f.lookup(p)
+	if err != nil {
+		return Attr{}, err
+	}
+	return n.attr, nil
+}
+
+// ReadDir lists the directory at p, sorted by name.
+func (f *FS) ReadDir(p string) ([]DirEntry, error) {
+	n, _, err := f.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	children, err := f.children(n, p)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DirEntry, 0, len(children))
+	for name, c := range children {
+		out = append(out, DirEntry{Name: name, Mode: c.attr.Mode})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Readlink returns the target of the symlink at p.
+func (f *FS) Readlink(p string) (string, error) {
+	n, _, err := f.lookup(p)
+	if err != nil {
+		return "", err
+	}
+	if n.attr.Mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: p, Err: syscall.EINVAL}
+	}
+	return n.attr.Link, nil
+}
+
+// File is an open regular file.
+type File struct {
+	fsys *FS
+	c    *content
+}
+
+// content is the extracted data of one file, shared by its open Files and
+// kept in the FS cache until evicted.
+type content struct {
+	node *node
+	r    io.ReaderAt
+	size int64
+	tmp  *os.File
+	refs int
+	// elem is the content's place in the cache; nil once evicted.
+	elem *list.Element
+}
+
+// Open reads the regular file at p out of its backup's export, or from the
+// cache when it was opened before.
+func (f *FS) Open(p string) (*File, error) {
+	n, b, err := f.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case n.attr.Mode.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: p, Err: syscall.EISDIR}
+	case !n.attr.Mode.IsRegular() || b == nil:
+		return nil, &fs.PathError{Op: "open", Path: p, Err: syscall.EINVAL}
+	}
+	if c := f.cachedContent(n); c != nil {
+		return &File{fsys: f, c: c}, nil
+	}
+	c, err := f.read(b.Backup, n.offset, n.attr.Size)
+	if err != nil {
+		f.log.Error("read file from backup", "path", p, "err", err)
+		return nil, &fs.PathError{Op: "open", Path: p, Err: syscall.EIO}
+	}
+	c.node = n
+	return &File{fsys: f, c: f.addContent(c)}, nil
+}
+
+// ReadAt reads from the file's content.
+func (file *File) ReadAt(b []byte, off int64) (int, error) {
+	if off >= file.c.size {
+		return 0, io.EOF
+	}
+	return file.c.r.ReadAt(b, off)
+}
+
+// Size returns the file's size.
+func (file *File) Size() int64 { return file.c.size }
+
+// Close releases the file. Its content stays cached until evicted.
+func (file *File) Close() error {
+	f := file.fsys
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	file.c.refs--
+	if file.c.refs == 0 && file.c.elem == nil {
+		return file.c.release()
+	}
+	return nil
+}
+
+// cachedContent returns n's cached content, taking a reference on it.
+func (f *FS) cachedContent(n *node) *content {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	c := f.cache[n]
+	if c == nil {
+		return nil
+	}
+	c.refs++
+	f.lru.MoveToFront(c.elem)
+	return c
+}
+
+// addContent caches freshly read content with one reference, evicting the
+// least recently opened contents beyond cacheLimit. When another open read
+// the same file meanwhile, its content is used instead.
+func (f *FS) addContent(c *content) *content {
+	f.cacheMu.Lock()
+	defer f.cacheMu.Unlock()
+	if prev := f.cache[c.node]; prev != nil {
+		_ = c.release()
+		prev.refs++
+		f.lru.MoveToFront(prev.elem)
+		return prev
+	}
+	c.refs = 1
+	c.elem = f.lru.PushFront(c)
+	f.cache[c.node] = c
+	f.cached += c.size
+	for f.cached > cacheLimit && f.lru.Back() != c.elem {
+		old := f.lru.Remove(f.lru.Back()).(*content)
+		old.elem = nil
+		delete(f.cache, old.node)
+		f.cached -= old.size
+		if old.refs == 0 {
+			_ = old.release()
+		}
+	}
+	return c
+}
+
+func (c *content) release() error {
+	if c.tmp != nil {
+		return c.tmp.Close()
+	}
+	return nil
+}
+
+// read streams b's export up to offset and keeps the next size bytes.
+func (f *FS) read(b Backup, offset, size int64) (*content, error) {
+	rc, err := f.src.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	plain, _, err := archive.Decompress(rc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, plain, offset); err != nil {
+		return nil, fmt.Errorf("seek to file data: %w", err)
+	}
+	body := io.LimitReader(plain, size)
+	if size <= memoryLimit {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return &content{r: bytes.NewReader(data), size: int64(len(data))}, nil
+	}
+	tmp, err := os.CreateTemp("", "incus-backup-mount-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, body)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	return &content{r: tmp, size: n, tmp: tmp}, nil
+}
+
+// lookup resolves p, loading backup indexes on the way. It also returns
+// the backup p is in, if any.
+func (f *FS) lookup(p string) (*node, *backupIndex, error) {
+	n, err := f.top()
+	if err != nil {
+		return nil, nil, err
+	}
+	var b *backupIndex
+	cur := ""
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if !n.attr.Mode.IsDir() {
+			return nil, nil, &fs.PathError{Op: "lookup", Path: p, Err: syscall.ENOTDIR}
+		}
+		if n.backup != nil {
+			b = n.backup
+		}
+		children, err := f.children(n, cur)
+		if err != nil {
+			return nil, nil, err
+		}
+		child, ok := children[part]
+		if !ok {
+			return nil, nil, &fs.PathError{Op: "lookup", Path: p, Err: syscall.ENOENT}
+		}
+		n, cur = child, path.Join(cur, part)
+	}
+	return n, b, nil
+}
+
+// children returns a directory's entries, indexing the backup of a version
+// directory on first use.
+func (f *FS) children(n *node, p string) (map[string]*node, error) {
+	if !n.attr.Mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: syscall.ENOTDIR}
+	}
+	b := n.backup
+	if b == nil {
+		return n.children, nil
+	}
+	b.once.Do(func() {
+		b.root, b.err = indexBackup(f.src, b.Backup, n.attr)
+		if b.err != nil {
+			f.log.Error("index backup", "project", b.Project, "name", b.Name, "version", b.Version, "err", b.err)
+		}
+	})
+	if b.err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: syscall.EIO}
+	}
+	return b.root.children, nil
+}
+
+// top returns the tree's root, listing the source again once the previous
+// listing is older than ListTTL. When a new listing fails, the previous
+// tree is kept.
+func (f *FS) top() (*node, error) {
+	f.topMu.Lock()
+	defer f.topMu.Unlock()
+	now := f.now()
+	if f.root != nil && now.Sub(f.listedAt) < f.ListTTL {
+		return f.root, nil
+	}
+	root, err := f.buildTop(now)
+	if err != nil {
+		if f.root == nil {
+			return nil, err
+		}
+		f.log.Error("list backups", "err", err)
+		return f.root, nil
+	}
+	f.root, f.listedAt = root, now
+	return root, nil
+}
+
+// buildTop lists the source's backups as instances/<project>/<name>/<version>.
+// Backups listed before keep their index. Callers hold topMu.
+func (f *FS) buildTop(now time.Time) (*node, error) {
+	backups, err := f.src.List()
+	if err != nil {
+		return nil, err
+	}
+	indexes := make(map[Backup]*backupIndex, len(backups))
+	root := newDir(Attr{Mode: fs.ModeDir | 0o555, ModTime: now})
+	for _, b := range backups {
+		modTime := now
+		if t, err := time.Parse("20060102T150405Z", b.Version); err == nil {
+			modTime = t
+		}
+		dir := Attr{Mode: fs.ModeDir | 0o555, ModTime: now}
+		n := root
+		for _, part := range []string{"instances", b.Project, b.Name} {
+			if n.children[part] == nil {
+				n.children[part] = newDir(dir)
+			}
+			n = n.children[part]
+		}
+		version := newDir(Attr{Mode: fs.ModeDir | 0o555, ModTime: modTime})
+		version.backup = f.indexes[b]
+		if version.backup == nil {
+			version.backup = &backupIndex{Backup: b}
+		}
+		indexes[b] = version.backup
+		n.children[b.Version] = version
+	}
+	if root.children["instances"] == nil {
+		root.children["instances"] = newDir(Attr{Mode: fs.ModeDir | 0o555, ModTime: now})
+	}
+	f.indexes = indexes
+	return root, nil
+}
+
+func newDir(attr Attr) *node {
+	return &node{attr: attr, children: map[string]*node{}}
+}
+
+// indexBackup walks b's export once and builds its tree: the container root
+// filesystem under rootfs, or the disk image of a virtual machine. Parent
+// directories missing from the export are added with the version
+// directory's attributes.
+func indexBackup(src Source, b Backup, dir Attr) (*node, error) {
+	rc, err := src.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	plain, _, err := archive.Decompress(rc)
+	if err != nil {
+		return nil, err
+	}
+	cr := &countingReader{r: plain}
+	tr := tar.NewReader(cr)
+	root := newDir(dir)
+	links := map[*node]string{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: read tar: %w", err)
+		}
+		p, prefix, ok := archive.DataMemberPath(hdr.Name)
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(prefix, "/") {
+			p = path.Join("/rootfs", p)
+		}
+		n := &node{attr: headerAttr(hdr), offset: cr.n}
+		if hdr.Typeflag == tar.TypeLink {
+			if target, _, ok := archive.DataMemberPath(hdr.Linkname); ok {
+				if strings.HasSuffix(prefix, "/") {
+					target = path.Join("/rootfs", target)
+				}
+				links[n] = target
+			}
+		}
+		insert(root, p, n, dir)
+	}
+	// Hard links share their target's content.
+	for n, target := range links {
+		if t := find(root, target); t != nil && t.attr.Mode.IsRegular() {
+			n.attr.Mode, n.attr.Size, n.offset = t.attr.Mode, t.attr.Size, t.offset
+		}
+	}
+	return root, nil
+}
+
+func insert(root *node, p string, n *node, dir Attr) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	parent := root
+	for _, part := range parts[:len(parts)-1] {
+		child := parent.children[part]
+		if child == nil {
+			child = newDir(Attr{Mode: fs.ModeDir | 0o755, ModTime: dir.ModTime})
+			parent.children[part] = child
+		}
+		if child.children == nil {
+			// A file is in the way; the export is inconsistent.
+			return
+		}
+		parent = child
+	}
+	name := parts[len(parts)-1]
+	if old := parent.children[name]; old != nil && old.children != nil && n.attr.Mode.IsDir() {
+		// A directory seen before its own entry keeps its children.
+		old.attr = n.attr
+		return
+	}
+	if n.attr.Mode.IsDir() {
+		n.children = map[string]*node{}
+	}
+	parent.children[name] = n
+}
+
+func find(root *node, p string) *node {
+	n := root
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		if n = n.children[part]; n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func headerAttr(hdr *tar.Header) Attr {
+	a := Attr{
+		Mode:    fs.FileMode(hdr.Mode) & fs.ModePerm,
+		UID:     uint32(hdr.Uid),
+		GID:     uint32(hdr.Gid),
+		ModTime: hdr.ModTime,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		a.Size = hdr.Size
+	case tar.TypeDir:
+		a.Mode |= fs.ModeDir
+	case tar.TypeSymlink:
+		a.Mode |= fs.ModeSymlink
+		a.Link = hdr.Linkname
+		a.Size = int64(len(hdr.Linkname))
+	case tar.TypeChar:
+		a.Mode |= fs.ModeDevice | fs.ModeCharDevice
+	case tar.TypeBlock:
+		a.Mode |= fs.ModeDevice
+	case tar.TypeFifo:
+		a.Mode |= fs.ModeNamedPipe
+	}
+	return a
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,165 @@
+package browse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"syscall"
+	"time"
+
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Mount serves fsys read-only at mountpoint until the returned server is
+// unmounted.
+func Mount(mountpoint string, fsys *FS) (*fuse.Server, error) {
+	timeout := time.Minute
+	return gofs.Mount(mountpoint, &fuseNode{fsys: fsys}, &gofs.Options{
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		MountOptions: fuse.MountOptions{
+			FsName:  "incus-backup",
+			Name:    "incus-backup",
+			Options: []string{"ro"},
+			// Mount directly when running as root, falling back to fusermount.
+			DirectMount: true,
+		},
+	})
+}
+
+type fuseNode struct {
+	gofs.Inode
+	fsys *FS
+	path string
+}
+
+var (
+	_ gofs.NodeLookuper   = (*fuseNode)(nil)
+	_ gofs.NodeGetattrer  = (*fuseNode)(nil)
+	_ gofs.NodeReaddirer  = (*fuseNode)(nil)
+	_ gofs.NodeOpener     = (*fuseNode)(nil)
+	_ gofs.NodeReadlinker = (*fuseNode)(nil)
+)
+
+func (n *fuseNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	p := path.Join(n.path, name)
+	attr, err := n.fsys.Stat(p)
+	if err != nil {
+		return nil, errno(err)
+	}
+	fillAttr(&out.Attr, attr)
+	child := &fuseNode{fsys: n.fsys, path: p}
+	return n.NewInode(ctx, child, gofs.StableAttr{Mode: uint32(out.Attr.Mode) & syscall.S_IFMT}), 0
+}
+
+func (n *fuseNode) Getattr(ctx context.Context, fh gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	attr, err := n.fsys.Stat(n.path)
+	if err != nil {
+		return errno(err)
+	}
+	fillAttr(&out.Attr, attr)
+	return 0
+}
+
+func (n *fuseNode) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	entries, err := n.fsys.ReadDir(n.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	out := make([]fuse.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, fuse.DirEntry{Name: e.Name, Mode: modeBits(e.Mode) & syscall.S_IFMT})
+	}
+	return gofs.NewListDirStream(out), 0
+}
+
+func (n *fuseNode) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	f, err := n.fsys.Open(n.path)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	return &fuseFile{f: f}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (n *fuseNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	target, err := n.fsys.Readlink(n.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	return []byte(target), 0
+}
+
+type fuseFile struct {
+	f *File
+}
+
+var (
+	_ gofs.FileReader   = (*fuseFile)(nil)
+	_ gofs.FileReleaser = (*fuseFile)(nil)
+)
+
+func (h *fuseFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	n, err := h.f.ReadAt(dest, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, syscall.EIO
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *fuseFile) Release(ctx context.Context) syscall.Errno {
+	if err := h.f.Close(); err != nil {
+		return syscall.EIO
+	}
+	return 0
+}
+
+func fillAttr(out *fuse.Attr, a Attr) {
+	out.Mode = modeBits(a.Mode)
+	out.Size = uint64(a.Size)
+	out.Uid = a.UID
+	out.Gid = a.GID
+	out.SetTimes(nil, &a.ModTime, &a.ModTime)
+	out.Nlink = 1
+	if a.Mode.IsDir() {
+		out.Nlink = 2
+	}
+}
+
+// modeBits converts a FileMode to the stat mode the kernel expects.
+func modeBits(m fs.FileMode) uint32 {
+	bits := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		bits |= syscall.S_IFDIR
+	case m&fs.ModeSymlink != 0:
+		bits |= syscall.S_IFLNK
+	case m&fs.ModeCharDevice != 0:
+		bits |= syscall.S_IFCHR
+	case m&fs.ModeDevice != 0:
+		bits |= syscall.S_IFBLK
+	case m&fs.ModeNamedPipe != 0:
+		bits |= syscall.S_IFIFO
+	default:
+		bits |= syscall.S_IFREG
+	}
+	return bits
+}
+
+// errno maps an FS error to the errno reported to the kernel.
+func errno(err error) syscall.Errno {
+	var e syscall.Errno
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, fs.ErrNotExist):
+		return syscall.ENOENT
+	default:
+		return syscall.EIO
+	}
+}
@@ -10,8 +10,10 @@ import (
 
 	cfg "incus-backup/src/backup/config"
 	ibak "incus-backup/src/backup/instances"
+	"incus-backup/src/backup/manifest"
 	vbak "incus-backup/src/backup/volumes"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
 	"incus-backup/src/restic"
 	"incus-backup/src/target"
 )
@@ -20,6 +22,7 @@ func newBackupAllCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project string
 	var optimized bool
 	var noSnapshot bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "all",
 		Short: "Back up config, all custom volumes, and all instances",
@@ -32,11 +35,24 @@ func newBackupAllCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			unlock, err := lockTargetForBackup(tgt)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			defer recordInventory(cmd, tgt)
 
-			client, err := incusapi.ConnectLocal()
+			conn, err := incusapi.ConnectLocal()
 			if err != nil {
 				return err
 			}
+			// Exports stop when the command is cancelled (e.g. SIGTERM in daemon mode).
+			client, exported := countExports(incusapi.WithContext(cmd.Context(), conn))
 
 			resticMode := tgt.Scheme == "restic"
 			var (
@@ -54,21 +70,22 @@ func newBackupAllCmd(stdout, stderr io.Writer) *cobra.Command {
 				}
 			}
 
-			switch tgt.Scheme {
-			case "dir":
-				fmt.Fprintln(stdout, "[1/3] Backing up config")
-				if _, err := cfg.BackupAll(client, tgt.DirPath, time.Now()); err != nil {
-					return err
+			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
+				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+			}
+			log := cmdLogger(cmd)
+			err = backupResource(cmd, tgt, metrics.Resource{Type: "config"}, nil, rw, func(progress io.Writer) (manifest.Stored, error) {
+				if resticMode {
+					return cfg.BackupAllRestic(resticCtx, info, tgt.Value, client, time.Now(), progress)
 				}
-				fmt.Fprintln(stdout, "[1/3] Done config")
-			case "restic":
-				fmt.Fprintln(stdout, "[1/3] Backing up config")
-				if _, err := cfg.BackupAllRestic(resticCtx, info, tgt.Value, client, time.Now(), stdout); err != nil {
-					return err
+				dir, err := cfg.BackupAll(client, tgt.DirPath, time.Now())
+				if err != nil {
+					return manifest.Stored{}, err
 				}
-				fmt.Fprintln(stdout, "[1/3] Done config")
-			default:
-				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+				return manifest.ReadStored(dir, "")
+			})
+			if err != nil {
+				return err
 			}
 
 			// Volumes (all)
@@ -76,44 +93,49 @@ func newBackupAllCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, "[2/3] Backing up volumes (count=%d)\n", len(vols))
-			for i, v := range vols {
-				fmt.Fprintf(stdout, "  [%d/%d] %s/%s\n", i+1, len(vols), v.Pool, v.Name)
-				if resticMode {
-					if _, err := vbak.BackupVolumeRestic(resticCtx, info, tgt.Value, client, project, v.Pool, v.Name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+			log.Info("backing up volumes", "project", project, "count", len(vols))
+			for _, v := range vols {
+				err := backupResource(cmd, tgt, metrics.Resource{Type: "volume", Project: project, Pool: v.Pool, Name: v.Name}, exported, rw, func(progress io.Writer) (manifest.Stored, error) {
+					if resticMode {
+						return vbak.BackupVolumeRestic(resticCtx, info, tgt.Value, client, project, v.Pool, v.Name, optimized, !noSnapshot, time.Now(), progress)
 					}
-				} else {
-					if _, err := vbak.BackupVolume(client, tgt.DirPath, project, v.Pool, v.Name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+					dir, err := vbak.BackupVolume(client, tgt.DirPath, project, v.Pool, v.Name, optimized, !noSnapshot, time.Now(), progress)
+					if err != nil {
+						return manifest.Stored{}, err
 					}
+					return manifest.ReadStored(dir, "volume.tar.xz")
+				})
+				if err != nil {
+					return err
 				}
 			}
-			fmt.Fprintln(stdout, "[2/3] Done volumes")
 
 			// Instances (all)
 			insts, err := client.ListInstances(project)
 			if err != nil {
 				return err
 			}
-			fmt.Fprintf(stdout, "[3/3] Backing up instances (count=%d)\n", len(insts))
-			for i, in := range insts {
-				fmt.Fprintf(stdout, "  [%d/%d] %s\n", i+1, len(insts), in.Name)
-				if resticMode {
-					if _, err := ibak.BackupInstanceRestic(resticCtx, info, tgt.Value, client, project, in.Name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+			log.Info("backing up instances", "project", project, "count", len(insts))
+			for _, in := range insts {
+				err := backupResource(cmd, tgt, metrics.Resource{Type: "instance", Project: project, Name: in.Name}, exported, rw, func(progress io.Writer) (manifest.Stored, error) {
+					if resticMode {
+						return ibak.BackupInstanceRestic(resticCtx, info, tgt.Value, client, project, in.Name, optimized, !noSnapshot, time.Now(), progress)
 					}
-				} else {
-					if _, err := ibak.BackupInstance(client, tgt.DirPath, project, in.Name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+					dir, err := ibak.BackupInstance(client, tgt.DirPath, project, in.Name, optimized, !noSnapshot, time.Now(), progress)
+					if err != nil {
+						return manifest.Stored{}, err
 					}
+					return manifest.ReadStored(dir, "export.tar.xz")
+				})
+				if err != nil {
+					return err
 				}
 			}
-			fmt.Fprintln(stdout, "[3/3] Done instances")
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().BoolVar(&optimized, "optimized", false, "Use storage-optimized export format")
 	cmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "Do not create a temporary snapshot before export")
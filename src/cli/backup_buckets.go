@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	bkt "incus-backup/src/backup/buckets"
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
+	"incus-backup/src/target"
+)
+
+func newBackupBucketsCmd(stdout, stderr io.Writer) *cobra.Command {
+	var project, passphraseFile string
+	var format string
+	cmd := &cobra.Command{
+		Use:   "buckets [POOL/NAME ...]",
+		Short: "Back up storage buckets and their keys (all or selected)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return fmt.Errorf("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
+				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+			}
+			items, err := parseBucketSpecs(args)
+			if err != nil {
+				return err
+			}
+			passphrase, err := readKeysPassphrase(passphraseFile)
+			if err != nil {
+				return err
+			}
+			unlock, err := lockTargetForBackup(tgt)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			defer recordInventory(cmd, tgt)
+			conn, err := incusapi.ConnectLocal()
+			if err != nil {
+				return err
+			}
+			// Exports stop when the command is cancelled (e.g. SIGTERM in daemon mode).
+			client, exported := countExports(incusapi.WithContext(cmd.Context(), conn))
+			if len(items) == 0 {
+				buckets, err := client.ListBuckets(project)
+				if err != nil {
+					return err
+				}
+				for _, b := range buckets {
+					items = append(items, [2]string{b.Pool, b.Name})
+				}
+			}
+			total := len(items)
+			for i, it := range items {
+				pool, name := it[0], it[1]
+				cmdLogger(cmd).Debug("bucket queued", "index", i+1, "total", total)
+				err := backupResource(cmd, tgt, metrics.Resource{Type: "bucket", Project: project, Pool: pool, Name: name}, exported, rw, func(progress io.Writer) (manifest.Stored, error) {
+					if tgt.Scheme == "restic" {
+						info, err := checkResticBinary(cmd, true)
+						if err != nil {
+							return manifest.Stored{}, err
+						}
+						ctx := cmd.Context()
+						if ctx == nil {
+							ctx = context.Background()
+						}
+						return bkt.BackupBucketRestic(ctx, info, tgt.Value, client, project, pool, name, passphrase, time.Now(), progress)
+					}
+					dir, err := bkt.BackupBucket(client, tgt.DirPath, project, pool, name, passphrase, time.Now(), progress)
+					if err != nil {
+						return manifest.Stored{}, err
+					}
+					return manifest.ReadStored(dir, "bucket.tar.xz")
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&passphraseFile, "keys-passphrase-file", "", "File holding a passphrase to encrypt bucket keys in the manifest (default: keys stored in plaintext)")
+	return cmd
+}
+
+// parseBucketSpecs splits POOL/NAME arguments.
+func parseBucketSpecs(args []string) ([][2]string, error) {
+	var items [][2]string
+	for _, a := range args {
+		var pool, name string
+		if parts := strings.SplitN(a, "/", 2); len(parts) == 2 {
+			pool, name = parts[0], parts[1]
+		}
+		if pool == "" || name == "" {
+			return nil, fmt.Errorf("invalid bucket spec %q (expected POOL/NAME)", a)
+		}
+		items = append(items, [2]string{pool, name})
+	}
+	return items, nil
+}
+
+// readKeysPassphrase reads the bucket key passphrase from path; an empty path
+// means no passphrase.
+func readKeysPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keys passphrase: %w", err)
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, fmt.Errorf("keys passphrase file %s is empty", path)
+	}
+	return data, nil
+}
@@ -9,13 +9,16 @@ import (
 	"github.com/spf13/cobra"
 
 	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
 	"incus-backup/src/target"
 )
 
 func newBackupCmd(stdout, stderr io.Writer) *cobra.Command {
 	cmd := &cobra.Command{Use: "backup", Short: "Create backups"}
 	cmd.AddCommand(newBackupAllCmd(stdout, stderr))
+	cmd.AddCommand(newBackupBucketsCmd(stdout, stderr))
 	cmd.AddCommand(newBackupConfigCmd(stdout, stderr))
 	cmd.AddCommand(newBackupInstancesCmd(stdout, stderr))
 	cmd.AddCommand(newBackupVolumesCmd(stdout, stderr))
@@ -23,6 +26,7 @@ func newBackupCmd(stdout, stderr io.Writer) *cobra.Command {
 }
 
 func newBackupConfigCmd(stdout, stderr io.Writer) *cobra.Command {
+	var format string
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Back up declarative config (projects, etc.)",
@@ -35,30 +39,46 @@ func newBackupConfigCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			client, err := incusapi.ConnectLocal()
+			rw, err := newResultWriter(stdout, format)
 			if err != nil {
 				return err
 			}
-			switch tgt.Scheme {
-			case "dir":
-				_, err = cfg.BackupAll(client, tgt.DirPath, time.Now())
+			defer rw.flush()
+			unlock, err := lockTargetForBackup(tgt)
+			if err != nil {
 				return err
-			case "restic":
-				info, err := checkResticBinary(cmd, true)
-				if err != nil {
-					return err
-				}
-				ctx := cmd.Context()
-				if ctx == nil {
-					ctx = context.Background()
-				}
-				_, err = cfg.BackupAllRestic(ctx, info, tgt.Value, client, time.Now(), stdout)
+			}
+			defer unlock()
+			defer recordInventory(cmd, tgt)
+			client, err := incusapi.ConnectLocal()
+			if err != nil {
 				return err
-			default:
-				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
 			}
+			return backupResource(cmd, tgt, metrics.Resource{Type: "config"}, nil, rw, func(progress io.Writer) (manifest.Stored, error) {
+				switch tgt.Scheme {
+				case "dir":
+					dir, err := cfg.BackupAll(client, tgt.DirPath, time.Now())
+					if err != nil {
+						return manifest.Stored{}, err
+					}
+					return manifest.ReadStored(dir, "")
+				case "restic":
+					info, err := checkResticBinary(cmd, true)
+					if err != nil {
+						return manifest.Stored{}, err
+					}
+					ctx := cmd.Context()
+					if ctx == nil {
+						ctx = context.Background()
+					}
+					return cfg.BackupAllRestic(ctx, info, tgt.Value, client, time.Now(), progress)
+				default:
+					return manifest.Stored{}, fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+				}
+			})
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	return cmd
 }
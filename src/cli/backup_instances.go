@@ -9,7 +9,9 @@ import (
 	"github.com/spf13/cobra"
 
 	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/backup/manifest"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
 	"incus-backup/src/target"
 )
 
@@ -17,6 +19,7 @@ func newBackupInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project string
 	var optimized bool
 	var noSnapshot bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "instances [NAME...]",
 		Short: "Back up instances (all or selected by name)",
@@ -29,13 +32,26 @@ func newBackupInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
 			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
 			}
-			client, err := incusapi.ConnectLocal()
+			unlock, err := lockTargetForBackup(tgt)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			defer recordInventory(cmd, tgt)
+			conn, err := incusapi.ConnectLocal()
 			if err != nil {
 				return err
 			}
+			// Exports stop when the command is cancelled (e.g. SIGTERM in daemon mode).
+			client, exported := countExports(incusapi.WithContext(cmd.Context(), conn))
 			// If no args, list instances in project
 			names := args
 			if len(names) == 0 {
@@ -49,30 +65,34 @@ func newBackupInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 			total := len(names)
 			for idx, name := range names {
-				fmt.Fprintf(stdout, "[%d/%d] Backing up instance %s/%s\n", idx+1, total, project, name)
-				if tgt.Scheme == "restic" {
-					info, err := checkResticBinary(cmd, true)
-					if err != nil {
-						return err
-					}
-					ctx := cmd.Context()
-					if ctx == nil {
-						ctx = context.Background()
-					}
-					if _, err := inst.BackupInstanceRestic(ctx, info, tgt.Value, client, project, name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+				cmdLogger(cmd).Debug("instance queued", "index", idx+1, "total", total)
+				err := backupResource(cmd, tgt, metrics.Resource{Type: "instance", Project: project, Name: name}, exported, rw, func(progress io.Writer) (manifest.Stored, error) {
+					if tgt.Scheme == "restic" {
+						info, err := checkResticBinary(cmd, true)
+						if err != nil {
+							return manifest.Stored{}, err
+						}
+						ctx := cmd.Context()
+						if ctx == nil {
+							ctx = context.Background()
+						}
+						return inst.BackupInstanceRestic(ctx, info, tgt.Value, client, project, name, optimized, !noSnapshot, time.Now(), progress)
 					}
-				} else {
-					if _, err := inst.BackupInstance(client, tgt.DirPath, project, name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+					dir, err := inst.BackupInstance(client, tgt.DirPath, project, name, optimized, !noSnapshot, time.Now(), progress)
+					if err != nil {
+						return manifest.Stored{}, err
 					}
+					return manifest.ReadStored(dir, "export.tar.xz")
+				})
+				if err != nil {
+					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", idx+1, total, project, name)
 			}
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().BoolVar(&optimized, "optimized", false, "Use storage-optimized export format")
 	cmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "Do not create a temporary snapshot before export")
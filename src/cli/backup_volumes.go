@@ -8,8 +8,10 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"incus-backup/src/backup/manifest"
 	vol "incus-backup/src/backup/volumes"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
 	"incus-backup/src/target"
 	"strings"
 )
@@ -18,6 +20,7 @@ func newBackupVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project string
 	var optimized bool
 	var noSnapshot bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "volumes [POOL/NAME ...]",
 		Short: "Back up custom volumes (all or selected)",
@@ -30,13 +33,26 @@ func newBackupVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
 			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
 			}
-			client, err := incusapi.ConnectLocal()
+			unlock, err := lockTargetForBackup(tgt)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			defer recordInventory(cmd, tgt)
+			conn, err := incusapi.ConnectLocal()
 			if err != nil {
 				return err
 			}
+			// Exports stop when the command is cancelled (e.g. SIGTERM in daemon mode).
+			client, exported := countExports(incusapi.WithContext(cmd.Context(), conn))
 			var items [][2]string // pool, name
 			if len(args) == 0 {
 				vols, err := client.ListCustomVolumes(project)
@@ -61,30 +77,34 @@ func newBackupVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 			total := len(items)
 			for i, it := range items {
 				pool, name := it[0], it[1]
-				fmt.Fprintf(stdout, "[%d/%d] Backing up volume %s/%s (project %s)\n", i+1, total, pool, name, project)
-				if tgt.Scheme == "restic" {
-					info, err := checkResticBinary(cmd, true)
-					if err != nil {
-						return err
-					}
-					ctx := cmd.Context()
-					if ctx == nil {
-						ctx = context.Background()
-					}
-					if _, err := vol.BackupVolumeRestic(ctx, info, tgt.Value, client, project, pool, name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+				cmdLogger(cmd).Debug("volume queued", "index", i+1, "total", total)
+				err := backupResource(cmd, tgt, metrics.Resource{Type: "volume", Project: project, Pool: pool, Name: name}, exported, rw, func(progress io.Writer) (manifest.Stored, error) {
+					if tgt.Scheme == "restic" {
+						info, err := checkResticBinary(cmd, true)
+						if err != nil {
+							return manifest.Stored{}, err
+						}
+						ctx := cmd.Context()
+						if ctx == nil {
+							ctx = context.Background()
+						}
+						return vol.BackupVolumeRestic(ctx, info, tgt.Value, client, project, pool, name, optimized, !noSnapshot, time.Now(), progress)
 					}
-				} else {
-					if _, err := vol.BackupVolume(client, tgt.DirPath, project, pool, name, optimized, !noSnapshot, time.Now(), stdout); err != nil {
-						return err
+					dir, err := vol.BackupVolume(client, tgt.DirPath, project, pool, name, optimized, !noSnapshot, time.Now(), progress)
+					if err != nil {
+						return manifest.Stored{}, err
 					}
+					return manifest.ReadStored(dir, "volume.tar.xz")
+				})
+				if err != nil {
+					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", i+1, total, pool, name)
 			}
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().BoolVar(&optimized, "optimized", false, "Use storage-optimized export format")
 	cmd.Flags().BoolVar(&noSnapshot, "no-snapshot", false, "Do not create a temporary snapshot before export")
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/backend"
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/output"
+	"incus-backup/src/replicate"
+	"incus-backup/src/restic"
+	"incus-backup/src/target"
+)
+
+func newCopyCmd(stdout, stderr io.Writer) *cobra.Command {
+	var from, to, format, fromResticConfig string
+	var sel replicate.Selector
+	cmd := &cobra.Command{
+		Use:   "copy [all|instances|volumes|buckets|config] [NAME|POOL/NAME ...]",
+		Short: "Copy stored backup versions from one target to another",
+		Long: "Copy streams stored backup versions between targets (e.g. dir: to restic:) without a new export from Incus.\n" +
+			"Timestamps and manifests are kept, checksums are verified on arrival and versions already present\n" +
+			"on the destination are skipped. Restic flags apply to both repositories unless --from-restic-config\n" +
+			"is given for the source.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := output.Check(format); err != nil {
+				return err
+			}
+			if from == "" || to == "" {
+				return errors.New("--from and --to are required (e.g., --from dir:/a --to restic:/b)")
+			}
+			sel.Kind = backend.KindAll
+			if len(args) > 0 {
+				sel.Kind = strings.ToLower(args[0])
+				sel.Names = args[1:]
+			}
+			switch sel.Kind {
+			case backend.KindAll, backend.KindInstance, backend.KindVolume, backend.KindBucket, backend.KindConfig:
+			default:
+				return fmt.Errorf("copy: unsupported kind %s", sel.Kind)
+			}
+			if len(sel.Names) > 0 && (sel.Kind == backend.KindAll || sel.Kind == backend.KindConfig) {
+				return errors.New("copy: names require instances, volumes or buckets")
+			}
+			srcTgt, err := target.Parse(from)
+			if err != nil {
+				return fmt.Errorf("--from: %w", err)
+			}
+			dstTgt, err := target.Parse(to)
+			if err != nil {
+				return fmt.Errorf("--to: %w", err)
+			}
+			if srcTgt.Scheme == dstTgt.Scheme && srcTgt.Value == dstTgt.Value {
+				return errors.New("copy: --from and --to are the same target")
+			}
+			// Per-version events are logged; stdout carries only the results.
+			progressOut := opWriter(cmd, "op", "copy")
+			opts := getSafetyOptions(cmd)
+
+			src, err := openReplicaStore(cmd, srcTgt, fromResticConfig, progressOut)
+			if err != nil {
+				return fmt.Errorf("--from: %w", err)
+			}
+			unlockSrc, err := lockTargetShared(srcTgt)
+			if err != nil {
+				return err
+			}
+			defer unlockSrc()
+			var dst replicate.Store
+			if opts.DryRun && dstTgt.Scheme == "dir" && !dirExists(dstTgt.DirPath) {
+				// Nothing is written on a dry run; plan against an empty target.
+				dst = emptyStore{}
+			} else {
+				if dstTgt.Scheme == "dir" && !opts.DryRun {
+					unlock, err := lockTargetForBackup(dstTgt)
+					if err != nil {
+						return err
+					}
+					defer unlock()
+				}
+				dst, err = openReplicaStore(cmd, dstTgt, "", progressOut)
+				if err != nil {
+					return fmt.Errorf("--to: %w", err)
+				}
+			}
+
+			plan, todo, err := replicate.Plan(src, dst, sel)
+			if err != nil {
+				return err
+			}
+			results := plan
+			if !opts.DryRun {
+				copied := replicate.Copy(src, dst, todo, progressOut)
+				results = mergeCopyResults(plan, copied)
+			}
+
+			err = output.Render(stdout, format, results, func(w io.Writer) error {
+				renderCopyResults(w, results)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Status == "failed" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("copy: %d of %d versions failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "Source target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&to, "to", "", "Destination target URI (e.g., restic:/path)")
+	cmd.Flags().StringVar(&sel.Project, "project", "", "Only copy backups of this project (default: all)")
+	cmd.Flags().StringVar(&sel.Version, "version", "", "Only copy versions with this timestamp")
+	cmd.Flags().BoolVar(&sel.Latest, "latest", false, "Only copy the newest version of each resource")
+	cmd.Flags().StringVar(&fromResticConfig, "from-restic-config", "", "YAML restic settings for a restic --from repository (default: the --restic-* flags)")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+// openReplicaStore opens a copy source or destination. resticConfig, when
+// set, replaces the --restic-* flags for that repository.
+func openReplicaStore(cmd *cobra.Command, tgt target.Target, resticConfig string, progressOut io.Writer) (replicate.Store, error) {
+	switch tgt.Scheme {
+	case "dir":
+		if err := dir.ValidateMetadata(tgt.DirPath); err != nil {
+			return nil, err
+		}
+		return replicate.NewDirStore(tgt.DirPath)
+	case "restic":
+		info, err := checkResticBinary(cmd, true)
+		if err != nil {
+			return nil, err
+		}
+		if resticConfig != "" {
+			opts, err := loadResticConfig(resticConfig)
+			if err != nil {
+				return nil, err
+			}
+			if err := restic.Configure(tgt.Value, opts); err != nil {
+				return nil, err
+			}
+		} else if err := configureResticRepo(cmd, tgt.Value); err != nil {
+			return nil, err
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
+			return nil, err
+		}
+		return replicate.NewResticStore(ctx, info, tgt.Value, progressOut)
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+	}
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// emptyStore stands in for a dir destination that does not exist yet when
+// planning a dry run.
+type emptyStore struct{}
+
+func (emptyStore) List(string) ([]backend.Entry, error) { return nil, nil }
+func (emptyStore) DataName(string) string               { return "" }
+func (emptyStore) Open(backend.Entry, string) (io.ReadCloser, error) {
+	return nil, errors.New("empty target")
+}
+func (emptyStore) Put(replicate.Version) error { return errors.New("empty target") }
+
+// mergeCopyResults replaces the planned rows with the outcome of the copy.
+func mergeCopyResults(plan, copied []replicate.Result) []replicate.Result {
+	out := make([]replicate.Result, 0, len(plan))
+	i := 0
+	for _, r := range plan {
+		if r.Status == "planned" && i < len(copied) {
+			r = copied[i]
+			i++
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func renderCopyResults(w io.Writer, results []replicate.Result) {
+	if len(results) == 0 {
+		fmt.Fprintln(w, "No matching backups to copy")
+		return
+	}
+	t := output.NewTable(w, "TYPE", "PROJECT", "POOL", "NAME", "TIMESTAMP", "STATUS", "ERROR")
+	for _, r := range results {
+		t.Row(r.Type, r.Project, r.Pool, r.Name, r.Timestamp, r.Status, r.Error)
+	}
+	_ = t.Flush()
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/metrics"
+	"incus-backup/src/scheduler"
+	"incus-backup/src/util/flock"
+)
+
+func newDaemonCmd(stdout, stderr io.Writer) *cobra.Command {
+	var configPath, listen string
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run scheduled backup, prune and verify jobs from a config file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				return errors.New("--config is required")
+			}
+			cfg, err := scheduler.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			statePath := cfg.StateFile
+			if statePath == "" {
+				statePath = filepath.Join(filepath.Dir(configPath), "incus-backup-daemon.state.json")
+			}
+			s := &scheduler.Scheduler{
+				Jobs:      cfg.Jobs,
+				Exec:      daemonExec(stdout, stderr),
+				Clock:     scheduler.SystemClock,
+				StatePath: statePath,
+				Logger:    cmdLogger(cmd),
+			}
+			if check {
+				runs, err := s.NextRuns(scheduler.SystemClock.Now())
+				if err != nil {
+					return err
+				}
+				tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(tw, "JOB\tTASK\tSCHEDULE\tNEXT")
+				for _, r := range runs {
+					fmt.Fprintln(tw, r)
+				}
+				return tw.Flush()
+			}
+
+			// Only one daemon may own a state file.
+			lock, err := flock.TryLock(statePath+".lock", true, fmt.Sprintf("daemon pid %d", os.Getpid()))
+			if err != nil {
+				if errors.Is(err, flock.ErrLocked) {
+					return fmt.Errorf("another daemon is using %s: %w", statePath, err)
+				}
+				return err
+			}
+			defer lock.Unlock()
+
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			reg := metrics.FromContext(ctx)
+			if reg == nil {
+				reg = metrics.NewRegistry()
+				ctx = metrics.NewContext(ctx, reg)
+			}
+			textfile, _ := cmd.Flags().GetString("metrics-textfile")
+			s.Notify = func(job scheduler.Job, task string, run scheduler.RunState) {
+				reg.JobFinished(job.Name, task, run.Status, run.Start, run.End)
+				if textfile != "" {
+					if err := reg.WriteTextfile(textfile); err != nil {
+						cmdLogger(cmd).Error("write metrics failed", "path", textfile, "error", err)
+					}
+				}
+			}
+			if listen != "" {
+				ln, err := net.Listen("tcp", listen)
+				if err != nil {
+					return fmt.Errorf("metrics listener: %w", err)
+				}
+				mux := http.NewServeMux()
+				mux.Handle("/metrics", reg.Handler())
+				srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+				go func() { _ = srv.Serve(ln) }()
+				defer srv.Close()
+				cmdLogger(cmd).Info("serving metrics", "url", fmt.Sprintf("http://%s/metrics", ln.Addr()))
+			}
+			// SIGTERM/SIGINT cancel the running task; backups then remove their
+			// temporary snapshots and partial output before the daemon exits.
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return s.Run(ctx)
+		},
+	}
+	cmd.Flags().StringVar(&configPath, "config", "", "Daemon config file (YAML) with job definitions")
+	cmd.Flags().StringVar(&listen, "metrics-listen", "", "Serve Prometheus metrics on ADDR/metrics (e.g., :9108)")
+	cmd.Flags().BoolVar(&check, "check", false, "Validate the config, print the next run of each job and exit")
+	return cmd
+}
+
+// daemonExec runs job tasks as in-process invocations of the regular
+// commands so scheduled runs behave exactly like manual ones.
+func daemonExec(stdout, stderr io.Writer) scheduler.ExecFunc {
+	return func(ctx context.Context, job scheduler.Job, task string) error {
+		run := func(args []string) error {
+			if job.ResticConfig != "" {
+				args = append(args, "--restic-config", job.ResticConfig)
+			}
+			root := NewRootCmd(stdout, stderr)
+			root.SetArgs(args)
+			return root.ExecuteContext(ctx)
+		}
+		switch task {
+		case scheduler.TaskVerify:
+			return run([]string{"verify", job.Kind, "--target", job.Target})
+		case scheduler.TaskBackup:
+			if err := run(daemonBackupArgs(job)); err != nil {
+				return err
+			}
+			for _, args := range daemonPruneArgs(job) {
+				if err := run(args); err != nil {
+					return err
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("unknown task %q", task)
+		}
+	}
+}
+
+func daemonBackupArgs(job scheduler.Job) []string {
+	args := append([]string{"backup", job.Kind}, job.Names...)
+	args = append(args, "--target", job.Target, "--yes")
+	if job.Project != "" && job.Kind != "config" {
+		args = append(args, "--project", job.Project)
+	}
+	if job.Optimized && job.Kind != "config" && job.Kind != "buckets" {
+		args = append(args, "--optimized")
+	}
+	return args
+}
+
+// daemonPruneArgs returns the prune runs after a job's backup, limited to
+// what the job backs up so jobs sharing a target keep their own versions.
+func daemonPruneArgs(job scheduler.Job) [][]string {
+	if job.Keep <= 0 {
+		return nil
+	}
+	var runs [][]string
+	for _, kind := range job.Kinds() {
+		args := append([]string{"prune", kind}, job.Names...)
+		args = append(args, "--target", job.Target, "--keep", strconv.Itoa(job.Keep), "--yes")
+		if kind != "config" {
+			args = append(args, "--project", job.ProjectName())
+		}
+		runs = append(runs, args)
+	}
+	return runs
+}
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+func newDiffCmd(stdout, stderr io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare backups with each other or with the live server",
+	}
+
+	cmd.AddCommand(newDiffConfigCmd(stdout, stderr))
+	cmd.AddCommand(newDiffInstanceCmd(stdout, stderr))
+
+	return cmd
+}
+
+// driftError reports that diff found differences. It exits with status 2 so
+// scripts can tell drift from failures, which exit with 1.
+type driftError struct {
+	what string
+	n    int
+}
+
+func (e *driftError) Error() string {
+	return fmt.Sprintf("%s: %d differences", e.what, e.n)
+}
+
+func (e *driftError) ExitCode() int { return 2 }
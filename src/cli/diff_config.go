@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/spf13/cobra"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
+	"incus-backup/src/target"
+	"incus-backup/src/util/textdiff"
+)
+
+// unifiedFormat is the extra --output format of diff commands.
+const unifiedFormat = "unified"
+
+// configDiff is the JSON/YAML form of diff config.
+type configDiff struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Drift   bool         `json:"drift"`
+	Changes []cfg.Change `json:"changes"`
+}
+
+func newDiffConfigCmd(stdout, stderr io.Writer) *cobra.Command {
+	var version, from, to, format string
+	var only, exclude []string
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show config drift between the server and a backup, or between two backups",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if format != unifiedFormat {
+				if format, err = output.Check(format); err != nil {
+					return err
+				}
+			}
+			if version != "" && from != "" {
+				return errors.New("--version and --from are the same; pass one of them")
+			}
+			if from == "" {
+				from = version
+			}
+			sel, err := cfg.ParseSelection(only, exclude)
+			if err != nil {
+				return err
+			}
+
+			base, err := loadConfigSnapshot(cmd, tgt, from)
+			if err != nil {
+				return err
+			}
+			result := configDiff{From: base.Timestamp, To: "live"}
+			var other cfg.State
+			if to != "" {
+				snap, err := loadConfigSnapshot(cmd, tgt, to)
+				if err != nil {
+					return err
+				}
+				result.To, other = snap.Timestamp, snap.State
+			} else {
+				client, err := incusapi.ConnectLocal()
+				if err != nil {
+					return err
+				}
+				if other, err = cfg.ListState(client); err != nil {
+					return err
+				}
+			}
+			result.Changes = cfg.Diff(base.State, other, sel)
+			result.Drift = len(result.Changes) > 0
+
+			if format == unifiedFormat {
+				err = renderConfigDiffUnified(stdout, result)
+			} else {
+				err = output.Render(stdout, format, result, func(w io.Writer) error {
+					renderConfigDiff(w, result)
+					return nil
+				})
+			}
+			if err != nil {
+				return err
+			}
+			if result.Drift {
+				return &driftError{what: fmt.Sprintf("config drift between %s and %s", result.From, result.To), n: len(result.Changes)}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&version, "version", "", "Snapshot to compare the server with (default: latest)")
+	cmd.Flags().StringVar(&from, "from", "", "Older snapshot to compare (same as --version)")
+	cmd.Flags().StringVar(&to, "to", "", "Newer snapshot to compare with instead of the server")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "Compare only these kinds or items (e.g., profiles or profiles/web-*)")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Leave out these kinds or items (e.g., server_config)")
+	cmd.Flags().StringVarP(&format, "output", "o", output.Table, "Output format: "+output.Formats+"|"+unifiedFormat)
+	return cmd
+}
+
+func renderConfigDiff(w io.Writer, d configDiff) {
+	if !d.Drift {
+		fmt.Fprintf(w, "No config drift between %s and %s\n", d.From, d.To)
+		return
+	}
+	fmt.Fprintf(w, "Config drift between %s and %s\n", d.From, d.To)
+	t := output.NewTable(w, "CHANGE", "KIND", "NAME")
+	for _, c := range d.Changes {
+		t.Row(c.Change, c.Kind, c.Name)
+	}
+	_ = t.Flush()
+}
+
+// renderConfigDiffUnified prints each changed object as a unified diff of its
+// JSON form, labelled FROM/KIND/NAME and TO/KIND/NAME.
+func renderConfigDiffUnified(w io.Writer, d configDiff) error {
+	doc := func(v any) (string, error) {
+		if v == nil {
+			return "", nil
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	}
+	for _, c := range d.Changes {
+		a, err := doc(c.From)
+		if err != nil {
+			return err
+		}
+		b, err := doc(c.To)
+		if err != nil {
+			return err
+		}
+		fromName, toName := path.Join(d.From, c.Kind, c.Name), path.Join(d.To, c.Kind, c.Name)
+		if c.From == nil {
+			fromName = "/dev/null"
+		}
+		if c.To == nil {
+			toName = "/dev/null"
+		}
+		fmt.Fprint(w, textdiff.Unified(fromName, toName, a, b))
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/archive"
+	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/output"
+	"incus-backup/src/target"
+)
+
+// instanceDiff is the JSON/YAML form of diff instance.
+type instanceDiff struct {
+	Project string `json:"project"`
+	Name    string `json:"name"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	inst.VersionDiff
+}
+
+func newDiffInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
+	var project, from, to, format string
+	var exitCode bool
+	cmd := &cobra.Command{
+		Use:   "instance NAME",
+		Short: "Show what changed in an instance between two backups",
+		Long: `Show what changed in an instance between two backups: its config, profiles,
+devices, snapshots and files. Incus-managed volatile.* keys are not compared.
+
+Exits 0 whether or not the versions differ; with --exit-code it exits 2 when
+they differ.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if format, err = output.Check(format); err != nil {
+				return err
+			}
+			if from == "" {
+				return errors.New("--from is required")
+			}
+
+			result := instanceDiff{Project: project, Name: name}
+			var fromTree, toTree *archive.Tree
+			if result.From, fromTree, err = readInstanceTree(cmd, tgt, project, name, from); err != nil {
+				return err
+			}
+			if result.To, toTree, err = readInstanceTree(cmd, tgt, project, name, to); err != nil {
+				return err
+			}
+			result.VersionDiff = inst.DiffVersions(fromTree, toTree)
+
+			err = output.Render(stdout, format, result, func(w io.Writer) error {
+				renderInstanceDiff(w, result)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if exitCode && !result.Empty() {
+				n := len(result.Config) + len(result.Devices) + len(result.Snapshots) + len(result.Files)
+				return &driftError{what: fmt.Sprintf("instance %s changed between %s and %s", name, result.From, result.To), n: n}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&from, "from", "", "Older backup timestamp")
+	cmd.Flags().StringVar(&to, "to", "", "Newer backup timestamp (default: latest)")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with status 2 when the versions differ")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+// readInstanceTree streams one instance export out of the target and lists
+// it, returning the backup's timestamp.
+func readInstanceTree(cmd *cobra.Command, tgt target.Target, project, name, version string) (string, *archive.Tree, error) {
+	ts, r, err := openExport(cmd, tgt, exportRef{Kind: "instance", Project: project, Name: name, Version: version})
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+	tree, err := archive.ReadTree(r)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", ts, err)
+	}
+	return ts, tree, nil
+}
+
+func renderInstanceDiff(w io.Writer, d instanceDiff) {
+	if d.Empty() {
+		fmt.Fprintf(w, "No changes to instance %s/%s between %s and %s\n", d.Project, d.Name, d.From, d.To)
+		return
+	}
+	fmt.Fprintf(w, "Instance %s/%s: %s -> %s\n", d.Project, d.Name, d.From, d.To)
+	renderKeyChanges(w, "Config", d.Config)
+	renderKeyChanges(w, "Devices", d.Devices)
+	if len(d.Snapshots) > 0 {
+		fmt.Fprintf(w, "\nSnapshots\n")
+		t := output.NewTable(w, "CHANGE", "SNAPSHOT")
+		for _, c := range d.Snapshots {
+			t.Row(c.Change, c.Key)
+		}
+		_ = t.Flush()
+	}
+	if len(d.Files) > 0 {
+		counts := map[string]int{}
+		fmt.Fprintf(w, "\nFiles\n")
+		t := output.NewTable(w, "CHANGE", "PATH", "TYPE", "FROM_SIZE", "TO_SIZE")
+		for _, c := range d.Files {
+			counts[c.Change]++
+			typ, fromSize, toSize := "", "-", "-"
+			if c.From != nil {
+				typ, fromSize = c.From.Type, fmt.Sprint(c.From.Size)
+			}
+			if c.To != nil {
+				typ, toSize = c.To.Type, fmt.Sprint(c.To.Size)
+			}
+			t.Row(c.Change, c.Path, typ, fromSize, toSize)
+		}
+		_ = t.Flush()
+		fmt.Fprintf(w, "files: added=%d removed=%d changed=%d\n", counts[inst.Added], counts[inst.Removed], counts[inst.Changed])
+	}
+}
+
+func renderKeyChanges(w io.Writer, title string, changes []inst.KeyChange) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s\n", title)
+	t := output.NewTable(w, "CHANGE", "KEY", "FROM", "TO")
+	for _, c := range changes {
+		t.Row(c.Change, c.Key, c.From, c.To)
+	}
+	_ = t.Flush()
+}
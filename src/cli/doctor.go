@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/output"
+	"incus-backup/src/restic"
+	"incus-backup/src/safety"
+	"incus-backup/src/target"
+)
+
+// resticSetParts lists the parts a legacy snapshot set needs to be usable.
+var resticSetParts = map[string][]string{
+	"instance": {"data", "manifest", "checksums"},
+	"volume":   {"data", "manifest", "checksums"},
+	"bucket":   {"data", "manifest", "checksums"},
+	"config":   {"projects", "profiles", "networks", "storage_pools", "manifest", "checksums"},
+}
+
+// resticSetIssue describes one backup version whose restic snapshots do not
+// form a usable set.
+type resticSetIssue struct {
+	Type      string `json:"type"`
+	Project   string `json:"project,omitempty"`
+	Pool      string `json:"pool,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Timestamp string `json:"timestamp"`
+	// Status is "incomplete" (parts missing), "superseded" (legacy parts
+	// left next to a complete bundle) or "recent" (incomplete but possibly
+	// still being written, so not repaired).
+	Status    string   `json:"status"`
+	Missing   []string `json:"missing,omitempty"`
+	Snapshots []string `json:"snapshots"`
+}
+
+func newDoctorCmd(stdout, stderr io.Writer) *cobra.Command {
+	var format string
+	var repair bool
+	var minAge time.Duration
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Find (and with --repair, forget) incomplete restic snapshot sets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := output.Check(format); err != nil {
+				return err
+			}
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., restic:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if tgt.Scheme != "restic" {
+				return fmt.Errorf("doctor: unsupported backend %s (only restic targets store backups as snapshot sets)", tgt.Scheme)
+			}
+			info, err := checkResticBinary(cmd, true)
+			if err != nil {
+				return err
+			}
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
+				return err
+			}
+			opts := getSafetyOptions(cmd)
+			if repair && !opts.DryRun {
+				// Held from listing to forgetting, so no backup on this host
+				// can be writing a set that is classed incomplete.
+				unlock, err := lockTargetExclusive(cmd, tgt)
+				if err != nil {
+					return err
+				}
+				defer unlock()
+			}
+			var snaps []restic.Snapshot
+			for _, kind := range []string{"instance", "volume", "bucket", "config"} {
+				found, err := listSnapshotsForPrune(ctx, info, tgt.Value, []string{"type=" + kind})
+				if err != nil {
+					return err
+				}
+				snaps = append(snaps, found...)
+			}
+			issues := findResticSetIssues(snaps, time.Now().Add(-minAge))
+
+			err = output.Render(stdout, format, issues, func(w io.Writer) error {
+				renderResticSetIssues(w, issues)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			ids := repairableSnapshotIDs(issues)
+			if !repair || len(ids) == 0 {
+				return nil
+			}
+			// Keep JSON and YAML output parseable; messages go to stderr in
+			// those modes.
+			msgOut := stdout
+			if format != output.Table {
+				msgOut = stderr
+			}
+			if opts.DryRun {
+				fmt.Fprintf(msgOut, "Would forget %d snapshots\n", len(ids))
+				return nil
+			}
+			ok, err := safety.Confirm(opts, os.Stdin, msgOut, fmt.Sprintf("Forget %d snapshots from incomplete backup sets?", len(ids)))
+			if err != nil || !ok {
+				return err
+			}
+			if err := forgetSnapshotsFunc(ctx, info, tgt.Value, ids, true); err != nil {
+				return err
+			}
+			fmt.Fprintf(msgOut, "Forgot %d snapshots\n", len(ids))
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., restic:/path)")
+	addOutputFlag(cmd, &format)
+	cmd.Flags().BoolVar(&repair, "repair", false, "Forget the snapshots of incomplete and superseded sets (runs restic forget --prune)")
+	cmd.Flags().DurationVar(&minAge, "min-age", time.Hour, "Treat incomplete sets started less than this ago as in progress and leave them alone (for backups from other hosts)")
+	return cmd
+}
+
+// findResticSetIssues groups snapshots by type/project/pool/name/timestamp and
+// reports the groups that cannot be listed or restored as a whole. Sets with
+// snapshots taken after cutoff are reported as recent instead of incomplete.
+func findResticSetIssues(snaps []restic.Snapshot, cutoff time.Time) []resticSetIssue {
+	type group struct {
+		issue   resticSetIssue
+		bundled bool
+		parts   map[string]bool
+		legacy  []string
+		newest  time.Time
+	}
+	groups := map[string]*group{}
+	for _, snap := range snaps {
+		if !isResticBackupSnapshot(snap) {
+			continue
+		}
+		tags := snap.TagMap()
+		kind := tags["type"]
+		if _, ok := resticSetParts[kind]; !ok {
+			continue
+		}
+		ts := tags["timestamp"]
+		if ts == "" {
+			ts = snapshotTimestamp(snap)
+		}
+		key := strings.Join([]string{kind, tags["project"], tags["pool"], tags["name"], ts}, "\x00")
+		g := groups[key]
+		if g == nil {
+			g = &group{
+				issue: resticSetIssue{Type: kind, Project: tags["project"], Pool: tags["pool"], Name: tags["name"], Timestamp: ts},
+				parts: map[string]bool{},
+			}
+			groups[key] = g
+		}
+		if snap.Time.After(g.newest) {
+			g.newest = snap.Time
+		}
+		if snap.IsBundle() {
+			g.bundled = true
+			continue
+		}
+		g.parts[tags["part"]] = true
+		g.legacy = append(g.legacy, snap.ID)
+	}
+
+	var issues []resticSetIssue
+	for _, g := range groups {
+		if len(g.legacy) == 0 {
+			continue
+		}
+		issue := g.issue
+		issue.Snapshots = append([]string(nil), g.legacy...)
+		sort.Strings(issue.Snapshots)
+		if g.bundled {
+			// Left behind when a run died between writing the bundle and
+			// forgetting the streamed data snapshot.
+			issue.Status = "superseded"
+			issues = append(issues, issue)
+			continue
+		}
+		for _, part := range resticSetParts[issue.Type] {
+			if !g.parts[part] {
+				issue.Missing = append(issue.Missing, part)
+			}
+		}
+		if len(issue.Missing) == 0 {
+			continue
+		}
+		issue.Status = "incomplete"
+		if g.newest.After(cutoff) {
+			issue.Status = "recent"
+		}
+		issues = append(issues, issue)
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Pool != b.Pool {
+			return a.Pool < b.Pool
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Timestamp < b.Timestamp
+	})
+	if issues == nil {
+		return []resticSetIssue{}
+	}
+	return issues
+}
+
+// repairableSnapshotIDs returns the snapshots --repair forgets; recent sets
+// are skipped because another run may still be writing them.
+func repairableSnapshotIDs(issues []resticSetIssue) []string {
+	var ids []string
+	for _, issue := range issues {
+		if issue.Status == "recent" {
+			continue
+		}
+		ids = append(ids, issue.Snapshots...)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func renderResticSetIssues(w io.Writer, issues []resticSetIssue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "No incomplete snapshot sets found")
+		return
+	}
+	t := output.NewTable(w, "TYPE", "PROJECT", "POOL", "NAME", "TIMESTAMP", "STATUS", "MISSING", "SNAPSHOTS")
+	for _, issue := range issues {
+		t.Row(issue.Type, issue.Project, issue.Pool, issue.Name, issue.Timestamp, issue.Status,
+			strings.Join(issue.Missing, ","), strings.Join(issue.Snapshots, ","))
+	}
+	_ = t.Flush()
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/backend"
+	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/drill"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
+	"incus-backup/src/target"
+)
+
+func newDrillCmd(stdout, stderr io.Writer) *cobra.Command {
+	var project, selection, healthCmd, reportPath, scratchProject, format string
+	var start bool
+	var seed int64
+	var healthTimeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "drill [NAME ...]",
+		Short: "Test-restore instance backups into a scratch project and report pass/fail",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if healthCmd != "" && !start {
+				return errors.New("--health-cmd requires --start")
+			}
+			if _, err := output.Check(format); err != nil {
+				return err
+			}
+			be, err := openStorageBackend(cmd, tgt)
+			if err != nil {
+				return err
+			}
+			entries, err := be.List(backend.KindInstance)
+			if err != nil {
+				return err
+			}
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+			candidates, err := drill.Select(entries, project, args, selection, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				return err
+			}
+			if len(candidates) == 0 {
+				fmt.Fprintln(stdout, "No instance backups to drill")
+				return nil
+			}
+			if scratchProject == "" {
+				scratchProject = drill.ScratchProjectName(time.Now())
+			}
+
+			t := output.NewTable(stdout, "PROJECT", "NAME", "VERSION", "SCRATCH_PROJECT", "TARGET_NAME")
+			for _, c := range candidates {
+				t.Row(c.Project, c.Name, c.Timestamp, scratchProject, drill.TargetName(c.Name))
+			}
+			_ = t.Flush()
+			if getSafetyOptions(cmd).DryRun {
+				return nil
+			}
+
+			client, err := incusapi.ConnectLocal()
+			if err != nil {
+				return err
+			}
+			restore, err := drillRestoreFunc(cmd, tgt, client, opWriter(cmd, "op", "drill"))
+			if err != nil {
+				return err
+			}
+			opts := drill.Options{
+				ScratchProject: scratchProject,
+				Start:          start,
+				HealthTimeout:  healthTimeout,
+				Progress:       opWriter(cmd, "op", "drill"),
+			}
+			if healthCmd != "" {
+				opts.HealthCommand = []string{"sh", "-c", healthCmd}
+			}
+			report := drill.Run(client, candidates, restore, opts)
+			report.Target = tgt.String()
+			report.Selection = selection
+
+			if reportPath != "" {
+				if err := writeDrillReport(reportPath, report); err != nil {
+					return err
+				}
+			}
+			err = output.Render(stdout, format, report, func(w io.Writer) error {
+				renderDrillReport(w, report)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if report.Failed > 0 {
+				return fmt.Errorf("drill: %d of %d restores failed", report.Failed, len(report.Results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project the backups belong to")
+	cmd.Flags().StringVar(&selection, "select", drill.SelectLatest, "Which version to drill per instance: latest|random")
+	cmd.Flags().Int64Var(&seed, "seed", 0, "Random seed for --select random (default: time based)")
+	cmd.Flags().BoolVar(&start, "start", false, "Start each restored instance")
+	cmd.Flags().StringVar(&healthCmd, "health-cmd", "", "Shell command run inside the started instance; exit code 0 passes")
+	cmd.Flags().DurationVar(&healthTimeout, "health-timeout", 2*time.Minute, "How long to retry the health command while the instance boots")
+	cmd.Flags().StringVar(&scratchProject, "scratch-project", "", "Temporary project name (default: incus-backup-drill-<timestamp>)")
+	cmd.Flags().StringVar(&reportPath, "report", "", "Write the JSON report to this file")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+// drillRestoreFunc adapts the backend-specific instance restore paths to drill.RestoreFunc.
+func drillRestoreFunc(cmd *cobra.Command, tgt target.Target, client incusapi.Client, progress io.Writer) (drill.RestoreFunc, error) {
+	switch tgt.Scheme {
+	case "dir":
+		return func(c drill.Candidate, project, targetName string) error {
+			return inst.RestoreInstance(client, c.Ref, project, targetName, progress)
+		}, nil
+	case "restic":
+		info, err := checkResticBinary(cmd, true)
+		if err != nil {
+			return nil, err
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return func(c drill.Candidate, project, targetName string) error {
+			snap, err := findInstanceSnapshot(ctx, info, tgt.Value, c.Project, c.Name, c.Timestamp)
+			if err != nil {
+				return err
+			}
+			return inst.RestoreInstanceRestic(ctx, info, tgt.Value, snap, client, project, c.Name, targetName, progress)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+	}
+}
+
+func renderDrillReport(w io.Writer, report drill.Report) {
+	t := output.NewTable(w, "STATUS", "PROJECT", "NAME", "VERSION", "DURATION", "ERROR")
+	for _, r := range report.Results {
+		t.Row(r.Status, r.Project, r.Name, r.Version, fmt.Sprintf("%.1fs", r.DurationSeconds), r.Error)
+	}
+	_ = t.Flush()
+	fmt.Fprintf(w, "drill: passed=%d failed=%d\n", report.Passed, report.Failed)
+}
+
+func writeDrillReport(path string, report drill.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/restic"
+	"incus-backup/src/target"
+)
+
+// exportRef names the instance or volume backup whose export is read.
+type exportRef struct {
+	Kind    string // instance|volume
+	Project string
+	Pool    string // volumes only
+	Name    string
+	Version string // default: latest
+}
+
+func (r exportRef) String() string {
+	if r.Kind == "volume" {
+		return fmt.Sprintf("volume %s/%s/%s", r.Project, r.Pool, r.Name)
+	}
+	return fmt.Sprintf("instance %s/%s", r.Project, r.Name)
+}
+
+// openExport streams the export of a backup out of the target, from the
+// file in a directory target or through restic dump. It returns the backup's
+// timestamp; closing the reader stops a dump that was not read to the end.
+func openExport(cmd *cobra.Command, tgt target.Target, ref exportRef) (string, io.ReadCloser, error) {
+	switch tgt.Scheme {
+	case "dir":
+		var dir string
+		var err error
+		dataFile := "export.tar.xz"
+		if ref.Kind == "volume" {
+			dir, err = resolveVolumeSnapshotDir(tgt, ref.Project, ref.Pool, ref.Name, ref.Version)
+			dataFile = "volume.tar.xz"
+		} else {
+			dir, err = resolveInstanceSnapshotDir(tgt, ref.Project, ref.Name, ref.Version)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		f, err := os.Open(filepath.Join(dir, dataFile))
+		if err != nil {
+			return "", nil, err
+		}
+		return filepath.Base(dir), f, nil
+	case "restic":
+		info, err := checkResticBinary(cmd, true)
+		if err != nil {
+			return "", nil, err
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
+			return "", nil, err
+		}
+		var snap restic.Snapshot
+		var ts string
+		dataFile := "export.tar"
+		if ref.Kind == "volume" {
+			snap, err = findVolumeSnapshot(ctx, info, tgt.Value, ref.Project, ref.Pool, ref.Name, ref.Version)
+			ts, dataFile = volumeSnapshotTimestamp(snap), "volume.tar"
+		} else {
+			snap, err = findInstanceSnapshot(ctx, info, tgt.Value, ref.Project, ref.Name, ref.Version)
+			ts = snapshotTimestamp(snap)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(dumpSnapshot(ctx, info, tgt.Value, snap.ID, dataFile, pw, nil))
+		}()
+		return ts, pr, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+	}
+}
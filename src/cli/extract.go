@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/output"
+	"incus-backup/src/target"
+)
+
+func newExtractCmd(stdout, stderr io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "extract",
+		Short: "Copy files out of instance and volume backups",
+	}
+
+	cmd.AddCommand(newExtractResourceCmd("instance", stdout))
+	cmd.AddCommand(newExtractResourceCmd("volume", stdout))
+	cmd.AddCommand(newExtractLsCmd(stdout))
+
+	return cmd
+}
+
+// extractResult is the JSON/YAML form of extract.
+type extractResult struct {
+	Version string                  `json:"version"`
+	To      string                  `json:"to"`
+	Paths   []archive.ExtractedPath `json:"paths"`
+}
+
+func newExtractResourceCmd(kind string, stdout io.Writer) *cobra.Command {
+	var project, version, to, format string
+	var paths []string
+	var overwrite bool
+	use, what := "instance NAME", "an instance"
+	if kind == "volume" {
+		use, what = "volume POOL/NAME", "a custom volume"
+	}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: "Extract files from " + what + " backup into a local directory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgt, ref, err := parseExportArgs(cmd, kind, project, version, args[0])
+			if err != nil {
+				return err
+			}
+			if format, err = output.Check(format); err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				return errors.New("--path is required (e.g., /etc/nginx/nginx.conf or '/etc/*.conf')")
+			}
+			if to == "" {
+				return errors.New("--to is required")
+			}
+			m, err := archive.NewPathMatcher(paths)
+			if err != nil {
+				return err
+			}
+			opts := getSafetyOptions(cmd)
+			if !opts.DryRun {
+				if err := os.MkdirAll(to, 0o755); err != nil {
+					return err
+				}
+			}
+
+			ts, r, err := openExport(cmd, tgt, ref)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			result := extractResult{Version: ts, To: to}
+			var extractErr error
+			result.Paths, extractErr = archive.Extract(r, to, m, archive.ExtractOptions{Overwrite: overwrite, DryRun: opts.DryRun})
+			if err := output.Render(stdout, format, result, func(w io.Writer) error {
+				renderExtract(w, result)
+				return nil
+			}); err != nil {
+				return err
+			}
+			if extractErr != nil {
+				return fmt.Errorf("%s at %s: %w", ref, ts, extractErr)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
+	cmd.Flags().StringArrayVar(&paths, "path", nil, "Path or glob to extract, with everything below it (repeatable)")
+	cmd.Flags().StringVar(&to, "to", "", "Local directory to extract into")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Replace files that already exist under --to")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+// lsEntry is one row of extract ls.
+type lsEntry struct {
+	Path string `json:"path"`
+	archive.Entry
+}
+
+func newExtractLsCmd(stdout io.Writer) *cobra.Command {
+	var project, version, format string
+	var paths []string
+	var recursive bool
+	cmd := &cobra.Command{
+		Use:   "ls instance|volume NAME",
+		Short: "List the files in an instance or volume backup",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kind := args[0]
+			if kind != "instance" && kind != "volume" {
+				return fmt.Errorf("unknown kind %q (expected instance or volume)", kind)
+			}
+			tgt, ref, err := parseExportArgs(cmd, kind, project, version, args[1])
+			if err != nil {
+				return err
+			}
+			if format, err = output.Check(format); err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				paths = []string{"/"}
+			}
+			m, err := archive.NewPathMatcher(paths)
+			if err != nil {
+				return err
+			}
+
+			ts, r, err := openExport(cmd, tgt, ref)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			entries := []lsEntry{}
+			// Like ls: matching files, and the contents of matching
+			// directories (their whole subtree with --recursive).
+			_, _, err = archive.WalkData(r, func(p string, hdr *tar.Header, body io.Reader) error {
+				e := archive.NewEntry(hdr)
+				listed := (e.Type != archive.EntryDir && m.MatchExact(p)) || m.MatchExact(path.Dir(p))
+				if recursive {
+					listed = m.Match(p)
+				}
+				if listed {
+					entries = append(entries, lsEntry{Path: p, Entry: e})
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("%s at %s: %w", ref, ts, err)
+			}
+			return output.Render(stdout, format, entries, func(w io.Writer) error {
+				renderLs(w, entries)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
+	cmd.Flags().StringArrayVar(&paths, "path", nil, "Directory, file or glob to list (repeatable; default: /)")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "R", false, "List directories recursively")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+// parseExportArgs reads --target and the NAME or POOL/NAME argument of
+// extract commands.
+func parseExportArgs(cmd *cobra.Command, kind, project, version, arg string) (target.Target, exportRef, error) {
+	ref := exportRef{Kind: kind, Project: project, Name: arg, Version: version}
+	if kind == "volume" {
+		if parts := strings.SplitN(arg, "/", 2); len(parts) == 2 {
+			ref.Pool, ref.Name = parts[0], parts[1]
+		}
+		if ref.Pool == "" || ref.Name == "" {
+			return target.Target{}, ref, fmt.Errorf("invalid volume spec %q (expected POOL/NAME)", arg)
+		}
+	}
+	tgtStr, _ := cmd.Flags().GetString("target")
+	if tgtStr == "" {
+		return target.Target{}, ref, errors.New("--target is required (e.g., dir:/path)")
+	}
+	tgt, err := target.Parse(tgtStr)
+	return tgt, ref, err
+}
+
+func renderExtract(w io.Writer, r extractResult) {
+	t := output.NewTable(w, "STATUS", "PATH", "TYPE", "SIZE")
+	counts := map[string]int{}
+	for _, p := range r.Paths {
+		counts[p.Status]++
+		t.Row(p.Status, p.Path, p.Type, fmt.Sprint(p.Size))
+	}
+	_ = t.Flush()
+	if n := counts[archive.WouldExtract]; n > 0 {
+		fmt.Fprintf(w, "dry-run: would extract %d paths from %s to %s\n", n, r.Version, r.To)
+		return
+	}
+	skipped := len(r.Paths) - counts[archive.Extracted]
+	fmt.Fprintf(w, "extracted=%d skipped=%d from %s to %s\n", counts[archive.Extracted], skipped, r.Version, r.To)
+}
+
+func renderLs(w io.Writer, entries []lsEntry) {
+	t := output.NewTable(w, "MODE", "TYPE", "UID", "GID", "SIZE", "PATH")
+	for _, e := range entries {
+		name := e.Path
+		if e.Link != "" {
+			name += " -> " + e.Link
+		}
+		t.Row(fmt.Sprintf("%04o", e.Mode), e.Type, fmt.Sprint(e.UID), fmt.Sprint(e.GID), fmt.Sprint(e.Size), name)
+	}
+	_ = t.Flush()
+}
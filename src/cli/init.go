@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/restic"
+	"incus-backup/src/target"
+)
+
+func newInitCmd(stdout, stderr io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Initialize a backup target (writes metadata.json or runs restic init)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			dry := getSafetyOptions(cmd).DryRun
+			switch tgt.Scheme {
+			case "dir":
+				if dry {
+					fmt.Fprintf(stdout, "Would initialize directory repository at %s\n", tgt.DirPath)
+					return nil
+				}
+				md, err := dir.Init(tgt.DirPath, time.Now())
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Initialized directory repository %s at %s (schema v%d)\n", md.RepoID, tgt.DirPath, md.SchemaVersion)
+				return nil
+			case "restic":
+				if dry {
+					fmt.Fprintf(stdout, "Would initialize restic repository %s\n", tgt.Value)
+					return nil
+				}
+				info, err := checkResticBinary(cmd, true)
+				if err != nil {
+					return err
+				}
+				ctx := cmd.Context()
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Restic repository %s is ready\n", tgt.Value)
+				return nil
+			default:
+				return fmt.Errorf("init: unsupported backend %s", tgt.Scheme)
+			}
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	return cmd
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/logging"
+)
+
+func addLogFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("log-level", "info", "Log level: debug|info|warn|error")
+	cmd.PersistentFlags().String("log-format", "text", "Log record format on stderr: text|json")
+	cmd.PersistentFlags().BoolP("quiet", "q", false, "Do not draw progress bars")
+}
+
+// setupLogging puts the logger and progress stream on the command context.
+// Logs go to stderr so stdout stays reserved for command results; progress
+// is drawn on stderr only when it is a terminal and --quiet is not set.
+// Commands run by the daemon keep the daemon's logger.
+func setupLogging(cmd *cobra.Command, stderr io.Writer) error {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if logging.FromContext(ctx) != nil {
+		return nil
+	}
+	level, _ := cmd.Flags().GetString("log-level")
+	format, _ := cmd.Flags().GetString("log-format")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	logger, err := logging.New(stderr, logging.Options{Level: level, Format: format})
+	if err != nil {
+		return err
+	}
+	progress := io.Discard
+	if !quiet && logging.IsTerminal(stderr) {
+		progress = stderr
+	}
+	cmd.SetContext(logging.NewContext(ctx, logger, progress))
+	return nil
+}
+
+// cmdLogger returns the command's logger.
+func cmdLogger(cmd *cobra.Command) *slog.Logger {
+	if l := logging.FromContext(cmd.Context()); l != nil {
+		return l
+	}
+	return logging.Discard
+}
+
+// opWriter returns the progress/event stream for one operation, tagging its
+// records with args (e.g. "project", p, "name", n).
+func opWriter(cmd *cobra.Command, args ...any) io.Writer {
+	return logging.NewWriter(cmdLogger(cmd).With(args...), logging.ProgressFromContext(cmd.Context()))
+}
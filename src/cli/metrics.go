@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/metrics"
+	"incus-backup/src/restic"
+	"incus-backup/src/target"
+)
+
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("metrics-textfile", "", "Write Prometheus metrics to this file (node_exporter textfile collector) after the run")
+}
+
+// instrumentMetrics wraps every command so that, with --metrics-textfile,
+// it records into a registry seeded from the existing file and writes the
+// file back afterwards, whether or not the command failed. Commands started
+// by the daemon inherit the daemon's registry through their context.
+func instrumentMetrics(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		instrumentMetrics(sub)
+	}
+	run := cmd.RunE
+	if run == nil {
+		return
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		path, _ := cmd.Flags().GetString("metrics-textfile")
+		if path == "" {
+			return run(cmd, args)
+		}
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		reg := metrics.FromContext(ctx)
+		if reg == nil {
+			reg = metrics.NewRegistry()
+			if err := reg.LoadTextfile(path); err != nil {
+				return err
+			}
+			cmd.SetContext(metrics.NewContext(ctx, reg))
+		}
+		err := run(cmd, args)
+		if werr := reg.WriteTextfile(path); werr != nil && err == nil {
+			err = fmt.Errorf("write metrics: %w", werr)
+		}
+		return err
+	}
+}
+
+// metricsTarget is the target label value; restic credentials are redacted.
+func metricsTarget(tgt target.Target) string {
+	if tgt.Scheme == "dir" {
+		return "dir:" + tgt.DirPath
+	}
+	return tgt.Scheme + ":" + restic.Redact(tgt.Value)
+}
+
+// backupResource runs the backup of one resource, handing fn the event and
+// progress stream for it, then logs and records the outcome and the number
+// of bytes exported from Incus.
+func backupResource(cmd *cobra.Command, tgt target.Target, res metrics.Resource, exported *exportCounter, rw *resultWriter, fn func(progress io.Writer) (manifest.Stored, error)) error {
+	reg := metrics.FromContext(cmd.Context())
+	attrs := []any{"type", res.Type}
+	if res.Project != "" {
+		attrs = append(attrs, "project", res.Project)
+	}
+	if res.Pool != "" {
+		attrs = append(attrs, "pool", res.Pool)
+	}
+	if res.Name != "" {
+		attrs = append(attrs, "name", res.Name)
+	}
+	log := cmdLogger(cmd).With(attrs...)
+	log.Info("backup started")
+	result := newOpResult("backup", res.Type, res.Project, res.Pool, res.Name)
+	rw.start(result)
+	start := time.Now()
+	exported.take()
+	stored, err := fn(opWriter(cmd, attrs...))
+	if err != nil {
+		log.Error("backup failed", "duration", time.Since(start).Round(time.Millisecond), "error", err)
+		reg.BackupFailed(metricsTarget(tgt), res)
+		rw.add(result.finish(start, err))
+		return err
+	}
+	d, bytes := time.Since(start), exported.take()
+	log.Info("backup finished", "version", stored.Version, "duration", d.Round(time.Millisecond), "bytes", bytes)
+	reg.BackupSucceeded(metricsTarget(tgt), res, time.Now(), d, bytes)
+	rw.add(result.withStored(stored).finish(start, nil))
+	return nil
+}
+
+// recordInventory refreshes the per-resource version counts of tgt when
+// metrics are being collected.
+func recordInventory(cmd *cobra.Command, tgt target.Target) {
+	reg := metrics.FromContext(cmd.Context())
+	if reg == nil {
+		return
+	}
+	be, err := openStorageBackend(cmd, tgt)
+	if err == nil {
+		var entries []backend.Entry
+		if entries, err = be.List(backend.KindAll); err == nil {
+			reg.Inventory(metricsTarget(tgt), entries)
+			return
+		}
+	}
+	cmdLogger(cmd).Warn("list target for metrics", "target", metricsTarget(tgt), "err", err)
+}
+
+// exportCounter counts bytes read from Incus exports.
+type exportCounter struct{ n atomic.Int64 }
+
+// take returns the bytes counted since the previous call.
+func (c *exportCounter) take() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.n.Swap(0)
+}
+
+// countExports wraps client so the bytes of every export stream are counted.
+func countExports(client incusapi.Client) (incusapi.Client, *exportCounter) {
+	c := &exportCounter{}
+	return countingClient{Client: client, counter: c}, c
+}
+
+type countingClient struct {
+	incusapi.Client
+	counter *exportCounter
+}
+
+func (c countingClient) ExportInstance(project, name string, optimized bool, snapshot string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	rc, err := c.Client.ExportInstance(project, name, optimized, snapshot, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return countingReader{ReadCloser: rc, counter: c.counter}, nil
+}
+
+func (c countingClient) ExportVolume(project, pool, name string, optimized bool, snapshot string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	rc, err := c.Client.ExportVolume(project, pool, name, optimized, snapshot, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return countingReader{ReadCloser: rc, counter: c.counter}, nil
+}
+
+func (c countingClient) ExportBucket(project, pool, name string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	rc, err := c.Client.ExportBucket(project, pool, name, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return countingReader{ReadCloser: rc, counter: c.counter}, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	counter *exportCounter
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.n.Add(int64(n))
+	return n, err
+}
+
+// recordVerify records checked and failed versions per resource type.
+func recordVerify(cmd *cobra.Command, tgt target.Target, kind string, results []verifyResult) {
+	reg := metrics.FromContext(cmd.Context())
+	if reg == nil {
+		return
+	}
+	checked, failed := map[string]int{}, map[string]int{}
+	for _, typ := range metricTypes(kind) {
+		checked[typ] = 0
+	}
+	for _, r := range results {
+		checked[r.Type]++
+		if r.Status != "ok" {
+			failed[r.Type]++
+		}
+	}
+	now := time.Now()
+	for typ, n := range checked {
+		reg.Verified(metricsTarget(tgt), typ, n, failed[typ], now)
+	}
+}
+
+// recordPrune counts deleted versions per resource type and refreshes the
+// inventory of the target.
+func recordPrune(cmd *cobra.Command, tgt target.Target, deleted map[string]int) {
+	reg := metrics.FromContext(cmd.Context())
+	if reg == nil {
+		return
+	}
+	for typ, n := range deleted {
+		reg.Pruned(metricsTarget(tgt), typ, n)
+	}
+	recordInventory(cmd, tgt)
+}
+
+// metricTypes maps a kind argument to the resource types it covers.
+func metricTypes(kind string) []string {
+	switch kind {
+	case backend.KindInstance:
+		return []string{"instance"}
+	case backend.KindVolume:
+		return []string{"volume"}
+	case backend.KindImage:
+		return []string{"image"}
+	case backend.KindConfig:
+		return []string{"config"}
+	case backend.KindBucket:
+		return []string{"bucket"}
+	default:
+		return []string{"instance", "volume", "image", "config", "bucket"}
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/browse"
+	"incus-backup/src/target"
+)
+
+func newMountCmd(stdout, stderr io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mount MOUNTPOINT",
+		Short: "Browse instance backups through a read-only FUSE filesystem",
+		Long: `Mount the instance backups of a target read-only at MOUNTPOINT as
+instances/<project>/<name>/<version>/rootfs/... (virtual machines show their
+disk image instead of rootfs). A backup's export is indexed the first time its
+directory is read, and a file is streamed out of the export the first time it
+is opened and then served from a cache. New and pruned backups show up within
+a minute. A directory target stays locked against prune while it is mounted.
+
+The command stays in the foreground until interrupted or until the mountpoint
+is unmounted (fusermount -u MOUNTPOINT).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
+				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+			}
+			mountpoint := args[0]
+			if fi, err := os.Stat(mountpoint); err != nil {
+				return err
+			} else if !fi.IsDir() {
+				return fmt.Errorf("mountpoint %s is not a directory", mountpoint)
+			}
+			unlock, err := lockTargetShared(tgt)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			// Reads through the mount run under cmd's context, so an
+			// interrupt also stops the exports they stream.
+			cmd.SetContext(ctx)
+
+			log := cmdLogger(cmd)
+			server, err := browse.Mount(mountpoint, browse.New(&targetSource{cmd: cmd, tgt: tgt}, log))
+			if err != nil {
+				return fmt.Errorf("mount %s: %w", mountpoint, err)
+			}
+			fmt.Fprintf(stderr, "Mounted %s at %s (read-only); press Ctrl-C or run 'fusermount -u %s' to unmount\n", tgtStr, mountpoint, mountpoint)
+
+			done := make(chan struct{})
+			go func() {
+				select {
+				case <-ctx.Done():
+					// Restore the default handling so another signal still
+					// ends the process when the unmount fails, e.g. while a
+					// shell has its working directory inside the mount.
+					stop()
+					if err := server.Unmount(); err != nil {
+						log.Error("unmount; press Ctrl-C again to exit", "mountpoint", mountpoint, "err", err)
+					}
+				case <-done:
+				}
+			}()
+			server.Wait()
+			close(done)
+			log.Info("unmounted", "mountpoint", mountpoint)
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path or restic:/repo)")
+	return cmd
+}
+
+// targetSource serves the instance backups of a dir or restic target to the
+// mounted filesystem.
+type targetSource struct {
+	cmd *cobra.Command
+	tgt target.Target
+}
+
+func (s *targetSource) List() ([]browse.Backup, error) {
+	be, err := openStorageBackend(s.cmd, s.tgt)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := be.List(backend.KindInstance)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]browse.Backup, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, browse.Backup{Project: e.Project, Name: e.Name, Version: e.Timestamp})
+	}
+	return out, nil
+}
+
+func (s *targetSource) Open(b browse.Backup) (io.ReadCloser, error) {
+	_, rc, err := openExport(s.cmd, s.tgt, exportRef{Kind: "instance", Project: b.Project, Name: b.Name, Version: b.Version})
+	return rc, err
+}
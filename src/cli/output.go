@@ -0,0 +1,13 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/output"
+)
+
+// addOutputFlag registers -o/--output for commands rendered with the output
+// package.
+func addOutputFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", output.Table, "Output format: "+output.Formats)
+}
@@ -9,10 +9,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
+	"incus-backup/src/output"
 	"incus-backup/src/restic"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
@@ -20,18 +20,36 @@ import (
 
 func newPruneCmd(stdout, stderr io.Writer) *cobra.Command {
 	var keep int
+	var format, project string
 	cmd := &cobra.Command{
-		Use:   "prune [all|instances|volumes|images|config]",
+		Use:   "prune [all|instances|volumes|buckets|images|config] [NAME|POOL/NAME ...]",
 		Short: "Prune old snapshots (keep N per resource)",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Prune old snapshots, keeping the newest --keep versions of each resource.
+
+Names (POOL/NAME for volumes and buckets) and --project limit pruning to
+those resources; without them every resource of the kind is pruned.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			kind := "all"
-			if len(args) == 1 {
+			if len(args) >= 1 {
 				kind = strings.ToLower(args[0])
 			}
 			if keep <= 0 {
 				return errors.New("--keep must be > 0")
 			}
+			scope, err := newPruneScope(kind, project, args)
+			if err != nil {
+				return err
+			}
+			format, err = output.Check(format)
+			if err != nil {
+				return err
+			}
+			// Keep JSON and YAML output parseable; prompts and messages go
+			// to stderr in those modes.
+			msgOut := stdout
+			if format != output.Table {
+				msgOut = stderr
+			}
 			tgtStr, _ := cmd.Flags().GetString("target")
 			if tgtStr == "" {
 				return errors.New("--target is required (e.g., dir:/path)")
@@ -42,30 +60,44 @@ func newPruneCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 			switch tgt.Scheme {
 			case "dir":
-				toDelete, err := planPrune(tgt.DirPath, kind, keep)
+				if !getSafetyOptions(cmd).DryRun {
+					unlock, err := lockTargetExclusive(cmd, tgt)
+					if err != nil {
+						return err
+					}
+					defer unlock()
+				}
+				toDelete, err := planPrune(tgt.DirPath, kind, keep, scope)
 				if err != nil {
 					return err
 				}
 
 				// Preview
-				tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-				fmt.Fprintln(tw, "TYPE\tPROJECT\tPOOL\tNAME\tFINGERPRINT\tTIMESTAMP\tACTION")
-				for _, p := range toDelete {
-					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\tdelete\n", p.Type, p.Project, p.Pool, p.Name, p.Fingerprint, p.Timestamp)
+				err = output.Render(stdout, format, toDelete, func(w io.Writer) error {
+					t := output.NewTable(w, "TYPE", "PROJECT", "POOL", "NAME", "FINGERPRINT", "TIMESTAMP", "ACTION")
+					for _, p := range toDelete {
+						t.Row(p.Type, p.Project, p.Pool, p.Name, p.Fingerprint, p.Timestamp, "delete")
+					}
+					return t.Flush()
+				})
+				if err != nil {
+					return err
 				}
-				_ = tw.Flush()
 
 				opts := getSafetyOptions(cmd)
 				if opts.DryRun || len(toDelete) == 0 {
 					return nil
 				}
-				ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Delete %d snapshots?", len(toDelete)))
+				ok, err := safety.Confirm(opts, os.Stdin, msgOut, fmt.Sprintf("Delete %d snapshots?", len(toDelete)))
 				if err != nil || !ok {
 					return err
 				}
+				deleted := map[string]int{}
 				for _, p := range toDelete {
 					_ = os.RemoveAll(p.Path)
+					deleted[p.Type]++
 				}
+				recordPrune(cmd, tgt, deleted)
 				return nil
 			case "restic":
 				info, err := checkResticBinary(cmd, true)
@@ -79,17 +111,23 @@ func newPruneCmd(stdout, stderr io.Writer) *cobra.Command {
 				if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
 					return err
 				}
-				resticCandidates, err := planResticPrune(ctx, info, tgt.Value, kind, keep)
+				resticCandidates, err := planResticPrune(ctx, info, tgt.Value, kind, keep, scope)
+				if err != nil {
+					return err
+				}
+				err = output.Render(stdout, format, resticCandidates, func(w io.Writer) error {
+					renderResticPrunePreview(w, resticCandidates)
+					return nil
+				})
 				if err != nil {
 					return err
 				}
-				renderResticPrunePreview(stdout, resticCandidates)
 				opts := getSafetyOptions(cmd)
 				if opts.DryRun || len(resticCandidates) == 0 {
 					return nil
 				}
 				if !(opts.Yes || opts.Force) {
-					ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Delete %d restic snapshot sets?", len(resticCandidates)))
+					ok, err := safety.Confirm(opts, os.Stdin, msgOut, fmt.Sprintf("Delete %d restic snapshot sets?", len(resticCandidates)))
 					if err != nil || !ok {
 						return err
 					}
@@ -98,7 +136,12 @@ func newPruneCmd(stdout, stderr io.Writer) *cobra.Command {
 				if err := forgetSnapshotsFunc(ctx, info, tgt.Value, ids, true); err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, "Deleted %d snapshot sets\n", len(resticCandidates))
+				fmt.Fprintf(msgOut, "Deleted %d snapshot sets\n", len(resticCandidates))
+				deleted := map[string]int{}
+				for _, c := range resticCandidates {
+					deleted[c.Type]++
+				}
+				recordPrune(cmd, tgt, deleted)
 				return nil
 			default:
 				return fmt.Errorf("prune: unsupported backend %s", tgt.Scheme)
@@ -107,14 +150,66 @@ func newPruneCmd(stdout, stderr io.Writer) *cobra.Command {
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
 	cmd.Flags().IntVar(&keep, "keep", 3, "Number of recent snapshots to keep per resource")
+	cmd.Flags().StringVar(&project, "project", "", "Only prune instances, volumes and buckets of this project")
+	addOutputFlag(cmd, &format)
 	return cmd
 }
 
 type pruneCandidate struct {
-	Type, Project, Pool, Name, Fingerprint, Timestamp, Path string
+	Type        string `json:"type"`
+	Project     string `json:"project,omitempty"`
+	Pool        string `json:"pool,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Timestamp   string `json:"timestamp"`
+	Path        string `json:"path"`
+}
+
+// pruneScope limits pruning to the resources of one project and, when names
+// are given, to those resources. Config and images are not project scoped.
+type pruneScope struct {
+	project string
+	names   map[string]bool
+}
+
+func newPruneScope(kind, project string, args []string) (pruneScope, error) {
+	scope := pruneScope{project: project}
+	if len(args) <= 1 {
+		return scope, nil
+	}
+	switch kind {
+	case "instances", "volumes", "buckets":
+	default:
+		return scope, fmt.Errorf("names require kind instances, volumes or buckets")
+	}
+	scope.names = map[string]bool{}
+	for _, name := range args[1:] {
+		if kind != "instances" {
+			if parts := strings.SplitN(name, "/", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return scope, fmt.Errorf("invalid %s spec %q (expected POOL/NAME)", strings.TrimSuffix(kind, "s"), name)
+			}
+		}
+		scope.names[name] = true
+	}
+	return scope, nil
 }
 
-func planPrune(root, kind string, keep int) ([]pruneCandidate, error) {
+// match reports whether a project-scoped resource is in scope; pool is empty
+// for instances.
+func (s pruneScope) match(project, pool, name string) bool {
+	if s.project != "" && project != s.project {
+		return false
+	}
+	if s.names == nil {
+		return true
+	}
+	if pool != "" {
+		name = pool + "/" + name
+	}
+	return s.names[name]
+}
+
+func planPrune(root, kind string, keep int, scope pruneScope) ([]pruneCandidate, error) {
 	var del []pruneCandidate
 	// instances
 	if kind == "all" || kind == "instances" {
@@ -126,7 +221,7 @@ func planPrune(root, kind string, keep int) ([]pruneCandidate, error) {
 			}
 			names, _ := os.ReadDir(filepath.Join(base, pr.Name()))
 			for _, nm := range names {
-				if !nm.IsDir() || strings.HasPrefix(nm.Name(), ".") {
+				if !nm.IsDir() || strings.HasPrefix(nm.Name(), ".") || !scope.match(pr.Name(), "", nm.Name()) {
 					continue
 				}
 				snaps, _ := os.ReadDir(filepath.Join(base, pr.Name(), nm.Name()))
@@ -146,41 +241,12 @@ func planPrune(root, kind string, keep int) ([]pruneCandidate, error) {
 			}
 		}
 	}
-	// volumes
+	// volumes and buckets
 	if kind == "all" || kind == "volumes" {
-		base := filepath.Join(root, "volumes")
-		projects, _ := os.ReadDir(base)
-		for _, pr := range projects {
-			if !pr.IsDir() || strings.HasPrefix(pr.Name(), ".") {
-				continue
-			}
-			pools, _ := os.ReadDir(filepath.Join(base, pr.Name()))
-			for _, pool := range pools {
-				if !pool.IsDir() || strings.HasPrefix(pool.Name(), ".") {
-					continue
-				}
-				names, _ := os.ReadDir(filepath.Join(base, pr.Name(), pool.Name()))
-				for _, nm := range names {
-					if !nm.IsDir() || strings.HasPrefix(nm.Name(), ".") {
-						continue
-					}
-					snaps, _ := os.ReadDir(filepath.Join(base, pr.Name(), pool.Name(), nm.Name()))
-					var ts []string
-					for _, s := range snaps {
-						if s.IsDir() && !strings.HasPrefix(s.Name(), ".") {
-							ts = append(ts, s.Name())
-						}
-					}
-					sort.Strings(ts)
-					if len(ts) > keep {
-						for _, old := range ts[:len(ts)-keep] {
-							p := filepath.Join(base, pr.Name(), pool.Name(), nm.Name(), old)
-							del = append(del, pruneCandidate{Type: "volume", Project: pr.Name(), Pool: pool.Name(), Name: nm.Name(), Timestamp: old, Path: p})
-						}
-					}
-				}
-			}
-		}
+		del = append(del, planPrunePoolScoped(root, "volumes", "volume", keep, scope)...)
+	}
+	if kind == "all" || kind == "buckets" {
+		del = append(del, planPrunePoolScoped(root, "buckets", "bucket", keep, scope)...)
 	}
 	// images
 	if kind == "all" || kind == "images" {
@@ -226,3 +292,43 @@ func planPrune(root, kind string, keep int) ([]pruneCandidate, error) {
 	}
 	return del, nil
 }
+
+// planPrunePoolScoped plans the pruning of <dir>/<project>/<pool>/<name>
+// versions.
+func planPrunePoolScoped(root, dir, typ string, keep int, scope pruneScope) []pruneCandidate {
+	var del []pruneCandidate
+	base := filepath.Join(root, dir)
+	projects, _ := os.ReadDir(base)
+	for _, pr := range projects {
+		if !pr.IsDir() || strings.HasPrefix(pr.Name(), ".") {
+			continue
+		}
+		pools, _ := os.ReadDir(filepath.Join(base, pr.Name()))
+		for _, pool := range pools {
+			if !pool.IsDir() || strings.HasPrefix(pool.Name(), ".") {
+				continue
+			}
+			names, _ := os.ReadDir(filepath.Join(base, pr.Name(), pool.Name()))
+			for _, nm := range names {
+				if !nm.IsDir() || strings.HasPrefix(nm.Name(), ".") || !scope.match(pr.Name(), pool.Name(), nm.Name()) {
+					continue
+				}
+				snaps, _ := os.ReadDir(filepath.Join(base, pr.Name(), pool.Name(), nm.Name()))
+				var ts []string
+				for _, s := range snaps {
+					if s.IsDir() && !strings.HasPrefix(s.Name(), ".") {
+						ts = append(ts, s.Name())
+					}
+				}
+				sort.Strings(ts)
+				if len(ts) > keep {
+					for _, old := range ts[:len(ts)-keep] {
+						p := filepath.Join(base, pr.Name(), pool.Name(), nm.Name(), old)
+						del = append(del, pruneCandidate{Type: typ, Project: pr.Name(), Pool: pool.Name(), Name: nm.Name(), Timestamp: old, Path: p})
+					}
+				}
+			}
+		}
+	}
+	return del
+}
@@ -5,19 +5,19 @@ import (
 	"fmt"
 	"io"
 	"sort"
-	"text/tabwriter"
 
 	"incus-backup/src/backend"
+	"incus-backup/src/output"
 	"incus-backup/src/restic"
 )
 
 type resticPruneCandidate struct {
-	Type      string
-	Project   string
-	Pool      string
-	Name      string
-	Timestamp string
-	Snapshots []restic.Snapshot
+	Type      string            `json:"type"`
+	Project   string            `json:"project,omitempty"`
+	Pool      string            `json:"pool,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Timestamp string            `json:"timestamp"`
+	Snapshots []restic.Snapshot `json:"snapshots"`
 }
 
 type resticListForPruneFunc func(context.Context, restic.BinaryInfo, string, []string) ([]restic.Snapshot, error)
@@ -32,7 +32,7 @@ type resourceKey struct {
 var listSnapshotsForPrune resticListForPruneFunc = restic.ListSnapshots
 var forgetSnapshotsFunc resticForgetFunc = restic.ForgetSnapshots
 
-func planResticPrune(ctx context.Context, bin restic.BinaryInfo, repo, kind string, keep int) ([]resticPruneCandidate, error) {
+func planResticPrune(ctx context.Context, bin restic.BinaryInfo, repo, kind string, keep int, scope pruneScope) ([]resticPruneCandidate, error) {
 	if keep <= 0 {
 		return nil, fmt.Errorf("keep must be > 0")
 	}
@@ -43,14 +43,21 @@ func planResticPrune(ctx context.Context, bin restic.BinaryInfo, repo, kind stri
 		if err != nil {
 			return nil, err
 		}
-		candidates = append(candidates, pruneByKeep(inst, keep)...)
+		candidates = append(candidates, pruneByKeep(scope.filter(inst), keep)...)
 	}
 	if allKinds || kind == backend.KindVolume {
-		vols, err := collectResticVolumeVersions(ctx, bin, repo)
+		vols, err := collectResticPoolScopedVersions(ctx, bin, repo, "volume")
 		if err != nil {
 			return nil, err
 		}
-		candidates = append(candidates, pruneByKeep(vols, keep)...)
+		candidates = append(candidates, pruneByKeep(scope.filter(vols), keep)...)
+	}
+	if allKinds || kind == backend.KindBucket {
+		buckets, err := collectResticPoolScopedVersions(ctx, bin, repo, "bucket")
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, pruneByKeep(scope.filter(buckets), keep)...)
 	}
 	if allKinds || kind == backend.KindConfig {
 		cfgGroups, err := collectResticConfigVersions(ctx, bin, repo)
@@ -91,8 +98,7 @@ func collectResticInstanceVersions(ctx context.Context, bin restic.BinaryInfo, r
 		tags := snap.TagMap()
 		project := tags["project"]
 		name := tags["name"]
-		part := tags["part"]
-		if project == "" || name == "" || part == "" {
+		if project == "" || name == "" || !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -112,8 +118,10 @@ func collectResticInstanceVersions(ctx context.Context, bin restic.BinaryInfo, r
 	return convertGroupedToCandidates("instance", grouped), nil
 }
 
-func collectResticVolumeVersions(ctx context.Context, bin restic.BinaryInfo, repo string) (map[resourceKey][]resticPruneCandidate, error) {
-	snaps, err := listSnapshotsForPrune(ctx, bin, repo, []string{"type=volume"})
+// collectResticPoolScopedVersions groups the volume or bucket versions of
+// typ by project, pool and name.
+func collectResticPoolScopedVersions(ctx context.Context, bin restic.BinaryInfo, repo, typ string) (map[resourceKey][]resticPruneCandidate, error) {
+	snaps, err := listSnapshotsForPrune(ctx, bin, repo, []string{"type=" + typ})
 	if err != nil {
 		return nil, err
 	}
@@ -123,8 +131,7 @@ func collectResticVolumeVersions(ctx context.Context, bin restic.BinaryInfo, rep
 		project := tags["project"]
 		pool := tags["pool"]
 		name := tags["name"]
-		part := tags["part"]
-		if project == "" || pool == "" || name == "" || part == "" {
+		if project == "" || pool == "" || name == "" || !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -141,7 +148,7 @@ func collectResticVolumeVersions(ctx context.Context, bin restic.BinaryInfo, rep
 			buckets[ts] = append(buckets[ts], snap)
 		}
 	}
-	return convertGroupedToCandidates("volume", grouped), nil
+	return convertGroupedToCandidates(typ, grouped), nil
 }
 
 func collectResticConfigVersions(ctx context.Context, bin restic.BinaryInfo, repo string) (map[resourceKey][]resticPruneCandidate, error) {
@@ -154,8 +161,7 @@ func collectResticConfigVersions(ctx context.Context, bin restic.BinaryInfo, rep
 	}
 	for _, snap := range snaps {
 		tags := snap.TagMap()
-		part := tags["part"]
-		if part == "" {
+		if !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -170,6 +176,12 @@ func collectResticConfigVersions(ctx context.Context, bin restic.BinaryInfo, rep
 	return convertGroupedToCandidates("config", grouped), nil
 }
 
+// isResticBackupSnapshot reports whether snap belongs to a backup version,
+// either as a bundle or as one legacy part.
+func isResticBackupSnapshot(snap restic.Snapshot) bool {
+	return snap.IsBundle() || snap.TagMap()["part"] != ""
+}
+
 func convertGroupedToCandidates(kind string, grouped map[resourceKey]map[string][]restic.Snapshot) map[resourceKey][]resticPruneCandidate {
 	out := make(map[resourceKey][]resticPruneCandidate, len(grouped))
 	for key, versions := range grouped {
@@ -192,6 +204,17 @@ func convertGroupedToCandidates(kind string, grouped map[resourceKey]map[string]
 	return out
 }
 
+// filter drops the resources outside the scope.
+func (s pruneScope) filter(grouped map[resourceKey][]resticPruneCandidate) map[resourceKey][]resticPruneCandidate {
+	out := make(map[resourceKey][]resticPruneCandidate, len(grouped))
+	for key, versions := range grouped {
+		if s.match(key.Project, key.Pool, key.Name) {
+			out[key] = versions
+		}
+	}
+	return out
+}
+
 func pruneByKeep(grouped map[resourceKey][]resticPruneCandidate, keep int) []resticPruneCandidate {
 	var candidates []resticPruneCandidate
 	for _, versions := range grouped {
@@ -215,20 +238,11 @@ func snapshotExists(snaps []restic.Snapshot, id string) bool {
 }
 
 func renderResticPrunePreview(w io.Writer, candidates []resticPruneCandidate) {
-	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "TYPE\tPROJECT\tPOOL\tNAME\tFINGERPRINT\tTIMESTAMP\tSNAPSHOTS")
+	t := output.NewTable(w, "TYPE", "PROJECT", "POOL", "NAME", "FINGERPRINT", "TIMESTAMP", "SNAPSHOTS")
 	for _, c := range candidates {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d parts\n",
-			c.Type,
-			safePad(c.Project),
-			safePad(c.Pool),
-			safePad(c.Name),
-			"",
-			c.Timestamp,
-			len(c.Snapshots),
-		)
+		t.Row(c.Type, safePad(c.Project), safePad(c.Pool), safePad(c.Name), "", c.Timestamp, fmt.Sprintf("%d parts", len(c.Snapshots)))
 	}
-	_ = tw.Flush()
+	_ = t.Flush()
 }
 
 func collectSnapshotIDs(candidates []resticPruneCandidate) []string {
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/restic"
+	"incus-backup/src/target"
+)
+
+// validateTargetMetadata checks the repository header of a dir --target before
+// any command runs. Commands without a --target flag are skipped, and parse
+// errors are left for the command to report.
+func validateTargetMetadata(cmd *cobra.Command) error {
+	f := cmd.Flags().Lookup("target")
+	if f == nil || f.Value.String() == "" {
+		return nil
+	}
+	tgt, err := target.Parse(f.Value.String())
+	if err != nil || tgt.Scheme != "dir" {
+		return nil
+	}
+	return dir.ValidateMetadata(tgt.DirPath)
+}
+
+// lockTargetForBackup prepares a target for writing: dir targets get their
+// metadata.json on first use and a shared lock that keeps prune out while the
+// backup runs; restic targets get a shared host-local lock that keeps
+// doctor --repair from forgetting the set being written. The returned func
+// releases the lock.
+func lockTargetForBackup(tgt target.Target) (func(), error) {
+	switch tgt.Scheme {
+	case "dir":
+		if _, err := dir.EnsureMetadata(tgt.DirPath, time.Now()); err != nil {
+			return nil, err
+		}
+		l, err := dir.LockShared(tgt.DirPath)
+		if err != nil {
+			return nil, err
+		}
+		return func() { _ = l.Unlock() }, nil
+	case "restic":
+		l, err := restic.LockTarget(tgt.Value, false, "")
+		if err != nil {
+			return nil, err
+		}
+		return func() { _ = l.Unlock() }, nil
+	default:
+		return func() {}, nil
+	}
+}
+
+// lockTargetShared takes the shared lock on an existing dir target that is
+// only read, keeping prune out while the read runs. The returned func
+// releases the lock.
+func lockTargetShared(tgt target.Target) (func(), error) {
+	if tgt.Scheme != "dir" {
+		return func() {}, nil
+	}
+	l, err := dir.LockShared(tgt.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = l.Unlock() }, nil
+}
+
+// lockTargetExclusive takes the exclusive target lock used by destructive
+// operations such as prune and doctor --repair.
+func lockTargetExclusive(cmd *cobra.Command, tgt target.Target) (func(), error) {
+	switch tgt.Scheme {
+	case "dir":
+		l, err := dir.LockExclusive(tgt.DirPath, lockOwner(cmd))
+		if err != nil {
+			return nil, err
+		}
+		return func() { _ = l.Unlock() }, nil
+	case "restic":
+		l, err := restic.LockTarget(tgt.Value, true, lockOwner(cmd))
+		if err != nil {
+			return nil, err
+		}
+		return func() { _ = l.Unlock() }, nil
+	default:
+		return func() {}, nil
+	}
+}
+
+func lockOwner(cmd *cobra.Command) string {
+	return fmt.Sprintf("pid %d: %s", os.Getpid(), cmd.CommandPath())
+}
@@ -4,18 +4,108 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 
 	"incus-backup/src/restic"
 	"incus-backup/src/safety"
+	"incus-backup/src/target"
 )
 
 type resticDetectorFunc func(context.Context) (restic.BinaryInfo, error)
 
 var detectResticFn resticDetectorFunc = restic.Detect
 
+// addResticFlags adds the persistent flags that carry restic credentials and
+// repository options. They apply only to restic: targets.
+func addResticFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("restic-config", "", "YAML file with restic settings for the target (passwordFile, passwordCommand, cacheDir, options, env)")
+	cmd.PersistentFlags().String("restic-password-file", "", "File holding the restic repository password")
+	cmd.PersistentFlags().String("restic-password-command", "", "Command that prints the restic repository password")
+	cmd.PersistentFlags().String("restic-cache-dir", "", "Directory for the restic cache")
+	cmd.PersistentFlags().StringArray("restic-option", nil, "Extended restic option key=value, passed as -o (repeatable)")
+	cmd.PersistentFlags().String("restic-env-file", "", "File of KEY=VALUE backend credentials (e.g. AWS_*, B2_*) passed only to restic")
+}
+
+// resticOptionsFromFlags merges --restic-config with the individual flags;
+// flags take precedence over the file.
+func resticOptionsFromFlags(cmd *cobra.Command) (restic.Options, error) {
+	flags := cmd.Root().PersistentFlags()
+	var opts restic.Options
+	if path, _ := flags.GetString("restic-config"); path != "" {
+		var err error
+		if opts, err = loadResticConfig(path); err != nil {
+			return opts, err
+		}
+	}
+	if v, _ := flags.GetString("restic-password-file"); v != "" {
+		opts.PasswordFile, opts.PasswordCommand = v, ""
+	}
+	if v, _ := flags.GetString("restic-password-command"); v != "" {
+		opts.PasswordCommand, opts.PasswordFile = v, ""
+	}
+	if v, _ := flags.GetString("restic-cache-dir"); v != "" {
+		opts.CacheDir = v
+	}
+	if v, _ := flags.GetStringArray("restic-option"); len(v) > 0 {
+		opts.ExtendedOptions = append(opts.ExtendedOptions, v...)
+	}
+	if path, _ := flags.GetString("restic-env-file"); path != "" {
+		env, err := restic.LoadEnvFile(path)
+		if err != nil {
+			return opts, err
+		}
+		if opts.Env == nil {
+			opts.Env = map[string]string{}
+		}
+		for k, v := range env {
+			opts.Env[k] = v
+		}
+	}
+	return opts, nil
+}
+
+// loadResticConfig reads a --restic-config YAML file.
+func loadResticConfig(path string) (restic.Options, error) {
+	var opts restic.Options
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return opts, fmt.Errorf("read restic config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &opts); err != nil {
+		return opts, fmt.Errorf("parse restic config %s: %w", path, err)
+	}
+	return opts, nil
+}
+
+// configureResticTarget registers the credential flags for the command's
+// --target so every restic invocation against it picks them up.
+func configureResticTarget(cmd *cobra.Command) error {
+	if cmd.Flags().Lookup("target") == nil {
+		return nil
+	}
+	tgtStr, _ := cmd.Flags().GetString("target")
+	tgt, err := target.Parse(tgtStr)
+	if err != nil || tgt.Scheme != "restic" {
+		return nil
+	}
+	return configureResticRepo(cmd, tgt.Value)
+}
+
+func configureResticRepo(cmd *cobra.Command, repo string) error {
+	opts, err := resticOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	return restic.Configure(repo, opts)
+}
+
 func checkResticBinary(cmd *cobra.Command, interactive bool) (restic.BinaryInfo, error) {
+	if err := configureResticTarget(cmd); err != nil {
+		return restic.BinaryInfo{}, err
+	}
 	ctx := cmd.Context()
 	if ctx == nil {
 		ctx = context.Background()
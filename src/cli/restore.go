@@ -13,7 +13,9 @@ func newRestoreCmd(stdout, stderr io.Writer) *cobra.Command {
 	}
 
 	cmd.AddCommand(newRestoreAllCmd(stdout, stderr))
+	cmd.AddCommand(newRestoreBucketsCmd(stdout, stderr))
 	cmd.AddCommand(newRestoreConfigCmd(stdout, stderr))
+	cmd.AddCommand(newRestoreFilesCmd(stdout, stderr))
 	cmd.AddCommand(newRestoreInstanceCmd(stdout, stderr))
 	cmd.AddCommand(newRestoreInstancesCmd(stdout, stderr))
 	cmd.AddCommand(newRestoreVolumeCmd(stdout, stderr))
@@ -2,14 +2,13 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -17,6 +16,7 @@ import (
 	ibak "incus-backup/src/backup/instances"
 	vbak "incus-backup/src/backup/volumes"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
 	"incus-backup/src/restic"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
@@ -24,7 +24,8 @@ import (
 
 func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project, version string
-	var replace, skipExisting, applyConfig bool
+	var replace, skipExisting, applyConfig, pruneExtra bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "all",
 		Short: "Restore config (optional apply), all volumes, and all instances",
@@ -37,8 +38,14 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
 			if tgt.Scheme == "restic" {
-				return restoreAllFromRestic(cmd, tgt, project, version, replace, skipExisting, applyConfig, stdout)
+				return restoreAllFromRestic(cmd, tgt, project, version, replace, skipExisting, applyConfig, pruneExtra, rw, out)
 			}
 			if tgt.Scheme != "dir" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
@@ -53,15 +60,15 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
-			desiredProjects, _ := loadProjects(filepath.Join(cfgDir, "projects.json"))
-			desiredNetworks, _ := loadNetworks(filepath.Join(cfgDir, "networks.json"))
-			desiredPools, _ := loadStoragePools(filepath.Join(cfgDir, "storage_pools.json"))
-			currentProjects, _ := client.ListProjects()
-			currentNetworks, _ := client.ListNetworks()
-			currentPools, _ := client.ListStoragePools()
-			pplan := cfg.BuildProjectsPlan(currentProjects, desiredProjects)
-			nplan := cfg.BuildNetworksPlan(currentNetworks, desiredNetworks)
-			splan := cfg.BuildStoragePoolsPlan(currentPools, desiredPools)
+			desired, err := cfg.LoadStateDir(cfgDir)
+			if err != nil {
+				return err
+			}
+			current, err := cfg.ListState(client)
+			if err != nil {
+				return err
+			}
+			configPlan := buildRestoreAllConfigPlan(current, desired)
 
 			// Collect volumes
 			var volItems [][2]string
@@ -100,15 +107,8 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 			sort.Strings(instNames)
 
-			// Preview tables
-			fmt.Fprintln(stdout, "Config preview")
-			renderProjectsPlan(stdout, pplan)
-			renderNetworksPlan(stdout, nplan)
-			renderStoragePoolsPlan(stdout, splan)
-
 			// Volumes preview
-			type vrow struct{ Action, Project, Pool, Name, Version string }
-			var vrows []vrow
+			var rows []restorePlan
 			for _, it := range volItems {
 				pool, name := it[0], it[1]
 				snapDir, err := resolveVolumeSnapshotDir(tgt, project, pool, name, version)
@@ -126,18 +126,10 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 						action = "skip"
 					}
 				}
-				vrows = append(vrows, vrow{Action: action, Project: project, Pool: pool, Name: name, Version: filepath.Base(snapDir)})
-			}
-			tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(tw, "ACTION\tPROJECT\tPOOL\tNAME\tVERSION")
-			for _, r := range vrows {
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Pool, r.Name, r.Version)
+				rows = append(rows, restorePlan{Action: action, Type: "volume", Project: project, Pool: pool, Name: name, Version: filepath.Base(snapDir)})
 			}
-			_ = tw.Flush()
 
 			// Instances preview
-			type irow struct{ Action, Project, Name, Version string }
-			var irows []irow
 			for _, name := range instNames {
 				snapDir, err := resolveInstanceSnapshotDir(tgt, project, name, version)
 				if err != nil {
@@ -154,22 +146,19 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 						action = "skip"
 					}
 				}
-				irows = append(irows, irow{Action: action, Project: project, Name: name, Version: filepath.Base(snapDir)})
+				rows = append(rows, restorePlan{Action: action, Type: "instance", Project: project, Name: name, Version: filepath.Base(snapDir)})
 			}
-			tw = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(tw, "ACTION\tPROJECT\tNAME\tVERSION")
-			for _, r := range irows {
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Name, r.Version)
-			}
-			_ = tw.Flush()
 
 			opts := getSafetyOptions(cmd)
+			if err := previewRestoreAll(rw, out, opts.DryRun, configPlan, pruneExtra, rows); err != nil {
+				return err
+			}
 			if opts.DryRun {
 				return nil
 			}
 
 			// Confirm
-			ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Apply restore for config (apply=%v), %d volumes, %d instances?", applyConfig, len(volItems), len(instNames)))
+			ok, err := safety.Confirm(opts, os.Stdin, out, fmt.Sprintf("Apply restore for config (apply=%v), %d volumes, %d instances?", applyConfig, len(volItems), len(instNames)))
 			if err != nil {
 				return err
 			}
@@ -179,28 +168,9 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 
 			// Apply config (optional)
 			if applyConfig {
-				// Vol deletions gated by --force already in restore_config
-				renderProjectsPlan(stdout, pplan)
-				renderNetworksPlan(stdout, nplan)
-				renderStoragePoolsPlan(stdout, splan)
-				var buf strings.Builder
-				enc := json.NewEncoder(&buf)
-				enc.SetIndent("", "  ")
-				// Apply
-				if sum, err := cfg.ApplyStoragePoolsPlan(client, splan, opts.Force); err != nil {
+				renderConfigPlan(out, configPlan, pruneExtra)
+				if err := applyRestoreAllConfig(client, configPlan, filepath.Base(cfgDir), pruneExtra, opts.Force, out); err != nil {
 					return err
-				} else {
-					fmt.Fprintln(stdout, sum)
-				}
-				if sum, err := cfg.ApplyNetworksPlan(client, nplan, opts.Force); err != nil {
-					return err
-				} else {
-					fmt.Fprintln(stdout, sum)
-				}
-				if sum, err := cfg.ApplyProjectsPlan(client, pplan); err != nil {
-					return err
-				} else {
-					fmt.Fprintln(stdout, sum)
 				}
 			}
 
@@ -212,17 +182,23 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 					return err
 				}
 				exists, _ := client.VolumeExists(project, pool, name)
-				fmt.Fprintf(stdout, "[vol %d/%d] %s/%s\n", i+1, len(volItems), pool, name)
+				result := restoreResult("volume", project, pool, name, name, filepath.Base(snapDir))
+				result.Path = snapDir
+				fmt.Fprintf(out, "[vol %d/%d] %s/%s\n", i+1, len(volItems), pool, name)
 				if exists {
 					if skipExisting {
-						fmt.Fprintf(stdout, "[vol %d/%d] skip existing\n", i+1, len(volItems))
+						fmt.Fprintf(out, "[vol %d/%d] skip existing\n", i+1, len(volItems))
+						rw.add(result.skipped())
 						continue
 					}
 					if err := client.DeleteVolume(project, pool, name); err != nil {
 						return err
 					}
 				}
-				if err := vbak.RestoreVolume(client, snapDir, project, pool, name, stdout); err != nil {
+				err = restoreResource(cmd, rw, result, func(progress io.Writer) error {
+					return vbak.RestoreVolume(client, snapDir, project, pool, name, progress)
+				})
+				if err != nil {
 					return err
 				}
 			}
@@ -234,10 +210,13 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 					return err
 				}
 				exists, _ := client.InstanceExists(project, name)
-				fmt.Fprintf(stdout, "[inst %d/%d] %s\n", i+1, len(instNames), name)
+				result := restoreResult("instance", project, "", name, name, filepath.Base(snapDir))
+				result.Path = snapDir
+				fmt.Fprintf(out, "[inst %d/%d] %s\n", i+1, len(instNames), name)
 				if exists {
 					if skipExisting {
-						fmt.Fprintf(stdout, "[inst %d/%d] skip existing\n", i+1, len(instNames))
+						fmt.Fprintf(out, "[inst %d/%d] skip existing\n", i+1, len(instNames))
+						rw.add(result.skipped())
 						continue
 					}
 					_ = client.StopInstance(project, name, true)
@@ -245,7 +224,10 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 						return err
 					}
 				}
-				if err := ibak.RestoreInstance(client, snapDir, project, name, stdout); err != nil {
+				err = restoreResource(cmd, rw, result, func(progress io.Writer) error {
+					return ibak.RestoreInstance(client, snapDir, project, name, progress)
+				})
+				if err != nil {
 					return err
 				}
 			}
@@ -253,15 +235,17 @@ func newRestoreAllCmd(stdout, stderr io.Writer) *cobra.Command {
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest per item)")
 	cmd.Flags().BoolVar(&replace, "replace", false, "Replace existing resources if they exist")
 	cmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Skip resources that already exist")
 	cmd.Flags().BoolVar(&applyConfig, "apply-config", false, "Apply declarative config changes from backup")
+	cmd.Flags().BoolVar(&pruneExtra, "prune-extra", false, "With --apply-config, delete config objects that are not in the backup (default: keep them)")
 	return cmd
 }
 
-func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, version string, replace, skipExisting, applyConfig bool, stdout io.Writer) error {
+func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, version string, replace, skipExisting, applyConfig, pruneExtra bool, rw *resultWriter, stdout io.Writer) error {
 	info, err := checkResticBinary(cmd, true)
 	if err != nil {
 		return err
@@ -282,21 +266,11 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 	if err != nil {
 		return err
 	}
-	currentProjects, err := client.ListProjects()
-	if err != nil {
-		return err
-	}
-	projectPlan := cfg.BuildProjectsPlan(currentProjects, configData.Projects)
-	currentNetworks, err := client.ListNetworks()
+	current, err := cfg.ListState(client)
 	if err != nil {
 		return err
 	}
-	networkPlan := cfg.BuildNetworksPlan(currentNetworks, configData.Networks)
-	currentPools, err := client.ListStoragePools()
-	if err != nil {
-		return err
-	}
-	poolPlan := cfg.BuildStoragePoolsPlan(currentPools, configData.StoragePools)
+	configPlan := buildRestoreAllConfigPlan(current, configData.State)
 
 	volItems, err := volumeItemsFromArgs(ctx, info, tgt.Value, project, nil)
 	if err != nil {
@@ -338,13 +312,7 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 		instItems = append(instItems, instItem{name: name, snapshot: snap, exists: exists})
 	}
 
-	fmt.Fprintln(stdout, "Config preview")
-	renderProjectsPlan(stdout, projectPlan)
-	renderNetworksPlan(stdout, networkPlan)
-	renderStoragePoolsPlan(stdout, poolPlan)
-
-	type vrow struct{ Action, Project, Pool, Name, Version string }
-	var vrows []vrow
+	var rows []restorePlan
 	for _, it := range volItems {
 		action := "create"
 		if it.exists {
@@ -356,17 +324,8 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 				action = "skip"
 			}
 		}
-		vrows = append(vrows, vrow{Action: action, Project: project, Pool: it.pool, Name: it.name, Version: volumeSnapshotTimestamp(it.snapshot)})
-	}
-	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tPOOL\tNAME\tVERSION")
-	for _, r := range vrows {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Pool, r.Name, r.Version)
+		rows = append(rows, restorePlan{Action: action, Type: "volume", Project: project, Pool: it.pool, Name: it.name, Version: volumeSnapshotTimestamp(it.snapshot)})
 	}
-	_ = tw.Flush()
-
-	type irow struct{ Action, Project, Name, Version string }
-	var irows []irow
 	for _, it := range instItems {
 		action := "create"
 		if it.exists {
@@ -378,16 +337,13 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 				action = "skip"
 			}
 		}
-		irows = append(irows, irow{Action: action, Project: project, Name: it.name, Version: snapshotTimestamp(it.snapshot)})
-	}
-	tw = tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tNAME\tVERSION")
-	for _, r := range irows {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Name, r.Version)
+		rows = append(rows, restorePlan{Action: action, Type: "instance", Project: project, Name: it.name, Version: snapshotTimestamp(it.snapshot)})
 	}
-	_ = tw.Flush()
 
 	opts := getSafetyOptions(cmd)
+	if err := previewRestoreAll(rw, stdout, opts.DryRun, configPlan, pruneExtra, rows); err != nil {
+		return err
+	}
 	if opts.DryRun {
 		return nil
 	}
@@ -401,48 +357,42 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 	}
 
 	if applyConfig {
-		renderProjectsPlan(stdout, projectPlan)
-		renderNetworksPlan(stdout, networkPlan)
-		renderStoragePoolsPlan(stdout, poolPlan)
-
-		if sum, err := cfg.ApplyStoragePoolsPlan(client, poolPlan, opts.Force); err != nil {
-			return err
-		} else if sum != "" {
-			fmt.Fprintln(stdout, sum)
-		}
-		if sum, err := cfg.ApplyNetworksPlan(client, networkPlan, opts.Force); err != nil {
+		renderConfigPlan(stdout, configPlan, pruneExtra)
+		if err := applyRestoreAllConfig(client, configPlan, configData.Timestamp, pruneExtra, opts.Force, stdout); err != nil {
 			return err
-		} else if sum != "" {
-			fmt.Fprintln(stdout, sum)
-		}
-		if sum, err := cfg.ApplyProjectsPlan(client, projectPlan); err != nil {
-			return err
-		} else if sum != "" {
-			fmt.Fprintln(stdout, sum)
 		}
 	}
 
 	for i, it := range volItems {
+		result := restoreResult("volume", project, it.pool, it.name, it.name, volumeSnapshotTimestamp(it.snapshot))
+		result.SnapshotID = it.snapshot.ID
 		fmt.Fprintf(stdout, "[vol %d/%d] %s/%s\n", i+1, len(volItems), it.pool, it.name)
 		if it.exists {
 			if skipExisting {
 				fmt.Fprintf(stdout, "[vol %d/%d] skip existing\n", i+1, len(volItems))
+				rw.add(result.skipped())
 				continue
 			}
 			if err := client.DeleteVolume(project, it.pool, it.name); err != nil {
 				return err
 			}
 		}
-		if err := vbak.RestoreVolumeRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.pool, it.name, stdout); err != nil {
+		err := restoreResource(cmd, rw, result, func(progress io.Writer) error {
+			return vbak.RestoreVolumeRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.pool, it.name, progress)
+		})
+		if err != nil {
 			return err
 		}
 	}
 
 	for i, it := range instItems {
+		result := restoreResult("instance", project, "", it.name, it.name, snapshotTimestamp(it.snapshot))
+		result.SnapshotID = it.snapshot.ID
 		fmt.Fprintf(stdout, "[inst %d/%d] %s\n", i+1, len(instItems), it.name)
 		if it.exists {
 			if skipExisting {
 				fmt.Fprintf(stdout, "[inst %d/%d] skip existing\n", i+1, len(instItems))
+				rw.add(result.skipped())
 				continue
 			}
 			_ = client.StopInstance(project, it.name, true)
@@ -450,10 +400,64 @@ func restoreAllFromRestic(cmd *cobra.Command, tgt target.Target, project, versio
 				return err
 			}
 		}
-		if err := ibak.RestoreInstanceRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.name, it.name, stdout); err != nil {
+		err := restoreResource(cmd, rw, result, func(progress io.Writer) error {
+			return ibak.RestoreInstanceRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.name, it.name, progress)
+		})
+		if err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// buildRestoreAllConfigPlan plans the config part of restore all. Server
+// settings are left to restore config --server.
+func buildRestoreAllConfigPlan(current, desired cfg.State) cfg.Plan {
+	plan := cfg.BuildPlan(current, desired)
+	plan.Server = cfg.ServerPlan{}
+	return plan
+}
+
+// restoreAllPlan is the machine-readable preview of restore all.
+type restoreAllPlan struct {
+	Config    cfg.Plan      `json:"config"`
+	Resources []restorePlan `json:"resources"`
+}
+
+// previewRestoreAll shows the config plan followed by the volume and
+// instance tables.
+func previewRestoreAll(rw *resultWriter, out io.Writer, dryRun bool, configPlan cfg.Plan, pruneExtra bool, rows []restorePlan) error {
+	if rows == nil {
+		rows = []restorePlan{}
+	}
+	return rw.preview(out, dryRun, restoreAllPlan{Config: configPlan, Resources: rows}, func(w io.Writer) {
+		fmt.Fprintln(w, "Config preview")
+		renderConfigPlan(w, configPlan, pruneExtra)
+		t := output.NewTable(w, "ACTION", "PROJECT", "POOL", "NAME", "VERSION")
+		for _, r := range rows {
+			if r.Type == "volume" {
+				t.Row(r.Action, r.Project, r.Pool, r.Name, r.Version)
+			}
+		}
+		_ = t.Flush()
+		t = output.NewTable(w, "ACTION", "PROJECT", "NAME", "VERSION")
+		for _, r := range rows {
+			if r.Type == "instance" {
+				t.Row(r.Action, r.Project, r.Name, r.Version)
+			}
+		}
+		_ = t.Flush()
+	})
+}
+
+// applyRestoreAllConfig applies the config part of restore all with a
+// journal, so a failed apply is rolled back before any data is restored.
+func applyRestoreAllConfig(client incusapi.Client, plan cfg.Plan, snapshot string, pruneExtra, force bool, out io.Writer) error {
+	journal, err := cfg.StartJournal(client, cfg.JournalPath(time.Now()), snapshot, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "journal: %s\n", journal.Path)
+	return cfg.ApplyPlan(client, plan, cfg.ApplyOptions{PruneExtra: pruneExtra, Force: force, Journal: journal}, out)
+}
@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	bkt "incus-backup/src/backup/buckets"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/restic"
+	"incus-backup/src/safety"
+	"incus-backup/src/target"
+)
+
+// bucketItem is one bucket to restore with the version picked for it:
+// a directory for dir targets, a snapshot for restic targets.
+type bucketItem struct {
+	pool     string
+	name     string
+	version  string
+	dir      string
+	snapshot restic.Snapshot
+	exists   bool
+}
+
+func newRestoreBucketsCmd(stdout, stderr io.Writer) *cobra.Command {
+	var project, version, passphraseFile string
+	var replace, skipExisting bool
+	var format string
+	cmd := &cobra.Command{
+		Use:   "buckets [POOL/NAME ...]",
+		Short: "Restore storage buckets and their keys (all or selected)",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			if tgt.Scheme != "dir" && tgt.Scheme != "restic" {
+				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
+			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
+			passphrase, err := readKeysPassphrase(passphraseFile)
+			if err != nil {
+				return err
+			}
+			specs, err := parseBucketSpecs(args)
+			if err != nil {
+				return err
+			}
+			client, err := incusapi.ConnectLocal()
+			if err != nil {
+				return err
+			}
+
+			var info restic.BinaryInfo
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			var items []bucketItem
+			if tgt.Scheme == "restic" {
+				if info, err = checkResticBinary(cmd, true); err != nil {
+					return err
+				}
+				if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
+					return err
+				}
+				items, err = resticBucketItems(ctx, info, tgt.Value, project, version, specs)
+			} else {
+				items, err = dirBucketItems(tgt, project, version, specs)
+			}
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				return nil
+			}
+
+			var rows []restorePlan
+			for i := range items {
+				it := &items[i]
+				if it.exists, err = client.BucketExists(project, it.pool, it.name); err != nil {
+					return err
+				}
+				action := "create"
+				if it.exists {
+					action = "conflict"
+					if replace {
+						action = "replace"
+					}
+					if skipExisting {
+						action = "skip"
+					}
+				}
+				rows = append(rows, restorePlan{Action: action, Type: "bucket", Project: project, Pool: it.pool, Name: it.name, TargetName: it.name, Version: it.version})
+			}
+
+			opts := getSafetyOptions(cmd)
+			if err := rw.preview(out, opts.DryRun, rows, func(w io.Writer) { renderVolumeRestorePreview(w, rows) }); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return nil
+			}
+			if !(replace || skipExisting) {
+				ok, err := safety.Confirm(opts, cmd.InOrStdin(), out, fmt.Sprintf("Apply restore for %d buckets?", len(items)))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return nil
+				}
+			}
+
+			for i, it := range items {
+				result := restoreResult("bucket", project, it.pool, it.name, it.name, it.version)
+				result.Path = it.dir
+				result.SnapshotID = it.snapshot.ID
+				fmt.Fprintf(out, "[%d/%d] Restoring bucket %s/%s (project %s)\n", i+1, len(items), it.pool, it.name, project)
+				if it.exists {
+					if skipExisting {
+						fmt.Fprintf(out, "[%d/%d] Skip existing %s/%s\n", i+1, len(items), it.pool, it.name)
+						rw.add(result.skipped())
+						continue
+					}
+					if err := client.DeleteBucket(project, it.pool, it.name); err != nil {
+						return err
+					}
+				}
+				err := restoreResource(cmd, rw, result, func(progress io.Writer) error {
+					if tgt.Scheme == "restic" {
+						return bkt.RestoreBucketRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.pool, it.name, passphrase, progress)
+					}
+					return bkt.RestoreBucket(client, it.dir, project, it.pool, it.name, passphrase, progress)
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "[%d/%d] Done %s/%s\n", i+1, len(items), it.pool, it.name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest per bucket)")
+	cmd.Flags().StringVar(&passphraseFile, "keys-passphrase-file", "", "File holding the passphrase used to encrypt bucket keys at backup time")
+	cmd.Flags().BoolVar(&replace, "replace", false, "Replace existing buckets if they exist")
+	cmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Skip buckets that already exist")
+	return cmd
+}
+
+// dirBucketItems resolves the bucket versions to restore from a directory
+// target; without specs every bucket of the project is restored.
+func dirBucketItems(tgt target.Target, project, version string, specs [][2]string) ([]bucketItem, error) {
+	base := filepath.Join(tgt.DirPath, "buckets", project)
+	if len(specs) == 0 {
+		pools, err := os.ReadDir(base)
+		if err != nil {
+			return nil, fmt.Errorf("scan pools under %s: %w", base, err)
+		}
+		for _, p := range pools {
+			if !p.IsDir() || strings.HasPrefix(p.Name(), ".") {
+				continue
+			}
+			names, err := os.ReadDir(filepath.Join(base, p.Name()))
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range names {
+				if n.IsDir() && !strings.HasPrefix(n.Name(), ".") {
+					specs = append(specs, [2]string{p.Name(), n.Name()})
+				}
+			}
+		}
+	}
+	var items []bucketItem
+	for _, s := range specs {
+		dir, err := resolveLatestDir(filepath.Join(base, s[0], s[1]), version)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, bucketItem{pool: s[0], name: s[1], version: filepath.Base(dir), dir: dir})
+	}
+	sortBucketItems(items)
+	return items, nil
+}
+
+// resticBucketItems resolves the bucket snapshots to restore from a restic
+// repository; without specs every bucket of the project is restored.
+func resticBucketItems(ctx context.Context, bin restic.BinaryInfo, repo, project, version string, specs [][2]string) ([]bucketItem, error) {
+	snaps, err := listDataSnapshots(ctx, bin, repo, []string{"type=bucket", fmt.Sprintf("project=%s", project)})
+	if err != nil {
+		return nil, err
+	}
+	latest := map[[2]string]restic.Snapshot{}
+	for _, snap := range snaps {
+		tags := snap.TagMap()
+		key := [2]string{tags["pool"], tags["name"]}
+		if key[0] == "" || key[1] == "" {
+			continue
+		}
+		if version != "" && snapshotTimestamp(snap) != version {
+			continue
+		}
+		// Snapshots are listed oldest first, so the last one wins.
+		latest[key] = snap
+	}
+	if len(specs) == 0 {
+		for key := range latest {
+			specs = append(specs, key)
+		}
+	}
+	var items []bucketItem
+	for _, s := range specs {
+		snap, ok := latest[s]
+		if !ok {
+			if version != "" {
+				return nil, fmt.Errorf("restic snapshot with timestamp %s not found for bucket %s/%s", version, s[0], s[1])
+			}
+			return nil, fmt.Errorf("no restic snapshots found for bucket %s/%s", s[0], s[1])
+		}
+		items = append(items, bucketItem{pool: s[0], name: s[1], version: snapshotTimestamp(snap), snapshot: snap})
+	}
+	sortBucketItems(items)
+	return items, nil
+}
+
+func sortBucketItems(items []bucketItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].pool == items[j].pool {
+			return items[i].name < items[j].name
+		}
+		return items[i].pool < items[j].pool
+	})
+}
+
+// resolveLatestDir returns base/version, or the newest version directory
+// under base when version is empty.
+func resolveLatestDir(base, version string) (string, error) {
+	if version != "" {
+		return filepath.Join(base, version), nil
+	}
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return "", err
+	}
+	var snaps []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			snaps = append(snaps, e.Name())
+		}
+	}
+	if len(snaps) == 0 {
+		return "", fmt.Errorf("no snapshots found under %s", base)
+	}
+	sort.Strings(snaps)
+	return filepath.Join(base, snaps[len(snaps)-1]), nil
+}
@@ -2,37 +2,39 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	cfg "incus-backup/src/backup/config"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
 )
 
 type configSnapshot struct {
-	Timestamp    string
-	Projects     []incusapi.Project
-	Profiles     []incusapi.Profile
-	Networks     []incusapi.Network
-	StoragePools []incusapi.StoragePool
+	Timestamp string
+	cfg.State
 }
 
 func newRestoreConfigCmd(stdout, stderr io.Writer) *cobra.Command {
-	var version, output string
-	var apply bool
+	var version, format, journalPath, rollback string
+	var apply, server, pruneExtra bool
+	var only, exclude []string
 	cmd := &cobra.Command{
 		Use:   "config",
 		Short: "Preview or apply declarative config from a backup",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if rollback != "" {
+				return rollbackConfig(cmd, rollback, stdout)
+			}
 			tgtStr, _ := cmd.Flags().GetString("target")
 			if tgtStr == "" {
 				return fmt.Errorf("--target is required (e.g., dir:/path)")
@@ -41,71 +43,58 @@ func newRestoreConfigCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
-
-			snap, err := loadConfigSnapshot(cmd, tgt, version)
-			if err != nil {
+			if _, err := output.Check(format); err != nil {
 				return err
 			}
-
-			client, err := incusapi.ConnectLocal()
+			sel, err := cfg.ParseSelection(only, exclude)
 			if err != nil {
 				return err
 			}
-			currentProjects, err := client.ListProjects()
+
+			snap, err := loadConfigSnapshot(cmd, tgt, version)
 			if err != nil {
 				return err
 			}
-			projectPlan := cfg.BuildProjectsPlan(currentProjects, snap.Projects)
 
-			currentNetworks, err := client.ListNetworks()
+			client, err := incusapi.ConnectLocal()
 			if err != nil {
 				return err
 			}
-			networkPlan := cfg.BuildNetworksPlan(currentNetworks, snap.Networks)
-
-			currentPools, err := client.ListStoragePools()
+			current, err := cfg.ListState(client)
 			if err != nil {
 				return err
 			}
-			poolPlan := cfg.BuildStoragePoolsPlan(currentPools, snap.StoragePools)
+			plan := cfg.BuildPlan(current, snap.State).Select(sel)
 
-			if !apply {
-				switch output {
-				case "json":
-					enc := json.NewEncoder(stdout)
-					enc.SetIndent("", "  ")
-					return enc.Encode(struct {
-						Projects     cfg.ProjectPlan     `json:"projects"`
-						Networks     cfg.NetworkPlan     `json:"networks"`
-						StoragePools cfg.StoragePoolPlan `json:"storage_pools"`
-					}{projectPlan, networkPlan, poolPlan})
-				case "table", "":
-					renderProjectsPlan(stdout, projectPlan)
-					renderNetworksPlan(stdout, networkPlan)
-					renderStoragePoolsPlan(stdout, poolPlan)
+			opts := getSafetyOptions(cmd)
+			if !apply || opts.DryRun {
+				return output.Render(stdout, format, plan, func(w io.Writer) error {
+					renderConfigPlan(w, plan, pruneExtra)
 					return nil
-				default:
-					return fmt.Errorf("unsupported --output: %s", output)
-				}
+				})
 			}
+			renderConfigPlan(stdout, plan, pruneExtra)
 
-			opts := getSafetyOptions(cmd)
-			if opts.DryRun {
-				renderProjectsPlan(stdout, projectPlan)
-				renderNetworksPlan(stdout, networkPlan)
-				renderStoragePoolsPlan(stdout, poolPlan)
-				return nil
+			counts := func(create, update, del int) string {
+				s := fmt.Sprintf("Create: %d, Update: %d, Delete: %d", create, update, del)
+				if del > 0 && !pruneExtra {
+					s += " (kept without --prune-extra)"
+				}
+				return s
 			}
-
-			renderProjectsPlan(stdout, projectPlan)
-			renderNetworksPlan(stdout, networkPlan)
-			renderStoragePoolsPlan(stdout, poolPlan)
-
 			var buf strings.Builder
 			buf.WriteString("Apply config changes? (networks/storage pools may disrupt running workloads)\n")
-			buf.WriteString(fmt.Sprintf("Projects => Create: %d, Update: %d, Delete: %d\n", len(projectPlan.ToCreate), len(projectPlan.ToUpdate), len(projectPlan.ToDelete)))
-			buf.WriteString(fmt.Sprintf("Networks => Create: %d, Update: %d, Delete: %d\n", len(networkPlan.ToCreate), len(networkPlan.ToUpdate), len(networkPlan.ToDelete)))
-			buf.WriteString(fmt.Sprintf("Storage Pools => Create: %d, Update: %d, Delete: %d\n", len(poolPlan.ToCreate), len(poolPlan.ToUpdate), len(poolPlan.ToDelete)))
+			buf.WriteString(fmt.Sprintf("Projects => %s\n", counts(len(plan.Projects.ToCreate), len(plan.Projects.ToUpdate), len(plan.Projects.ToDelete))))
+			buf.WriteString(fmt.Sprintf("Profiles => %s\n", counts(len(plan.Profiles.ToCreate), len(plan.Profiles.ToUpdate), len(plan.Profiles.ToDelete))))
+			buf.WriteString(fmt.Sprintf("Networks => %s\n", counts(len(plan.Networks.ToCreate), len(plan.Networks.ToUpdate), len(plan.Networks.ToDelete))))
+			buf.WriteString(fmt.Sprintf("Storage Pools => %s\n", counts(len(plan.StoragePools.ToCreate), len(plan.StoragePools.ToUpdate), len(plan.StoragePools.ToDelete))))
+			buf.WriteString(fmt.Sprintf("Network objects => %s\n", counts(plan.NetworkObjectsPlan.Counts())))
+			if server {
+				buf.WriteString(fmt.Sprintf("Server => Config keys: %d, Certificates: %d, Cluster groups: %d\n",
+					len(plan.Server.Config.ToSet)+len(plan.Server.Config.ToUnset),
+					len(plan.Server.Certificates.ToCreate)+len(plan.Server.Certificates.ToUpdate)+len(plan.Server.Certificates.ToDelete),
+					len(plan.Server.ClusterGroups.ToCreate)+len(plan.Server.ClusterGroups.ToUpdate)+len(plan.Server.ClusterGroups.ToDelete)))
+			}
 			ok, err := safety.Confirm(opts, os.Stdin, stdout, buf.String())
 			if err != nil {
 				return err
@@ -114,91 +103,71 @@ func newRestoreConfigCmd(stdout, stderr io.Writer) *cobra.Command {
 				return nil
 			}
 
-			spCreated, spUpdated, spDeleted := 0, 0, 0
-			for _, p := range poolPlan.ToCreate {
-				fmt.Fprintf(stdout, "[storage] create %s\n", p.Name)
-				if err := client.CreateStoragePool(p); err != nil {
-					return err
-				}
-				spCreated++
-			}
-			for _, u := range poolPlan.ToUpdate {
-				fmt.Fprintf(stdout, "[storage] update %s\n", u.Name)
-				if err := client.UpdateStoragePool(incusapi.StoragePool{Name: u.Name, Config: u.DesiredConf}); err != nil {
-					return err
-				}
-				spUpdated++
-			}
-			if opts.Force {
-				for _, p := range poolPlan.ToDelete {
-					fmt.Fprintf(stdout, "[storage] delete %s\n", p.Name)
-					if err := client.DeleteStoragePool(p.Name); err != nil {
-						return err
-					}
-					spDeleted++
-				}
-			}
-			fmt.Fprintf(stdout, "storage_pools: created=%d updated=%d deleted=%d\n", spCreated, spUpdated, spDeleted)
-
-			netCreated, netUpdated, netDeleted := 0, 0, 0
-			for _, n := range networkPlan.ToCreate {
-				fmt.Fprintf(stdout, "[networks] create %s\n", n.Name)
-				if err := client.CreateNetwork(n); err != nil {
-					return err
-				}
-				netCreated++
+			if journalPath == "" {
+				journalPath = cfg.JournalPath(time.Now())
 			}
-			for _, u := range networkPlan.ToUpdate {
-				fmt.Fprintf(stdout, "[networks] update %s\n", u.Name)
-				if err := client.UpdateNetwork(incusapi.Network{Name: u.Name, Config: u.DesiredConf}); err != nil {
-					return err
-				}
-				netUpdated++
-			}
-			if opts.Force {
-				for _, n := range networkPlan.ToDelete {
-					fmt.Fprintf(stdout, "[networks] delete %s\n", n.Name)
-					if err := client.DeleteNetwork(n.Name); err != nil {
-						return err
-					}
-					netDeleted++
-				}
-			}
-			fmt.Fprintf(stdout, "networks: created=%d updated=%d deleted=%d\n", netCreated, netUpdated, netDeleted)
-
-			prCreated, prUpdated, prDeleted := 0, 0, 0
-			for _, p := range projectPlan.ToCreate {
-				fmt.Fprintf(stdout, "[projects] create %s\n", p.Name)
-				if err := client.CreateProject(p.Name, p.Config); err != nil {
-					return err
-				}
-				prCreated++
+			journal, err := cfg.StartJournal(client, journalPath, snap.Timestamp, time.Now())
+			if err != nil {
+				return err
 			}
-			for _, u := range projectPlan.ToUpdate {
-				fmt.Fprintf(stdout, "[projects] update %s\n", u.Name)
-				if err := client.UpdateProject(u.Name, u.Desired); err != nil {
-					return err
-				}
-				prUpdated++
+			fmt.Fprintf(stdout, "journal: %s\n", journal.Path)
+			applyOpts := cfg.ApplyOptions{PruneExtra: pruneExtra, Force: opts.Force, Server: server, Journal: journal}
+			if err := cfg.ApplyPlan(client, plan, applyOpts, stdout); err != nil {
+				return err
 			}
-			for _, p := range projectPlan.ToDelete {
-				fmt.Fprintf(stdout, "[projects] delete %s\n", p.Name)
-				if err := client.DeleteProject(p.Name); err != nil {
-					return err
-				}
-				prDeleted++
+			if !server && !plan.Server.Empty() {
+				fmt.Fprintln(stdout, "server: not applied (use --server to apply server config, trust store and cluster groups)")
 			}
-			fmt.Fprintf(stdout, "projects: created=%d updated=%d deleted=%d\n", prCreated, prUpdated, prDeleted)
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
 	cmd.Flags().BoolVar(&apply, "apply", false, "Apply changes (default: preview)")
-	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table|json")
+	cmd.Flags().BoolVar(&server, "server", false, "With --apply, also apply server config, trust store and cluster groups (access-related changes need --force)")
+	cmd.Flags().BoolVar(&pruneExtra, "prune-extra", false, "With --apply, delete objects that are not in the backup (default: keep them)")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "Restore only these kinds or items (e.g., profiles or profiles/web-*)")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Leave out these kinds or items (e.g., networks/incusbr1)")
+	cmd.Flags().StringVar(&journalPath, "journal", "", "With --apply, where to write the apply journal (default: under the user cache directory)")
+	cmd.Flags().StringVar(&rollback, "rollback", "", "Undo the changes recorded in an apply journal instead of restoring")
+	addOutputFlag(cmd, &format)
 	return cmd
 }
 
+// rollbackConfig undoes the changes recorded in the journal at path, most
+// recent first, after showing them and asking for confirmation.
+func rollbackConfig(cmd *cobra.Command, path string, stdout io.Writer) error {
+	journal, err := cfg.LoadJournal(path)
+	if err != nil {
+		return err
+	}
+	steps := journal.Undo()
+	fmt.Fprintf(stdout, "Rollback of config apply started %s (status %s)\n", journal.StartedAt.Format(time.RFC3339), journal.Status)
+	if len(steps) == 0 {
+		fmt.Fprintln(stdout, "Nothing to roll back")
+		return nil
+	}
+	for _, step := range steps {
+		fmt.Fprintf(stdout, "  undo %s %s %s\n", step.Action, step.Kind, step.Name)
+	}
+	opts := getSafetyOptions(cmd)
+	if opts.DryRun {
+		return nil
+	}
+	ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Roll back %d config changes?", len(steps)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	client, err := incusapi.ConnectLocal()
+	if err != nil {
+		return err
+	}
+	return cfg.Rollback(client, journal, stdout)
+}
+
 func loadConfigSnapshot(cmd *cobra.Command, tgt target.Target, version string) (configSnapshot, error) {
 	switch tgt.Scheme {
 	case "dir":
@@ -206,7 +175,11 @@ func loadConfigSnapshot(cmd *cobra.Command, tgt target.Target, version string) (
 		if err != nil {
 			return configSnapshot{}, err
 		}
-		return loadConfigSnapshotDir(dir)
+		state, err := cfg.LoadStateDir(dir)
+		if err != nil {
+			return configSnapshot{}, err
+		}
+		return configSnapshot{Timestamp: filepath.Base(dir), State: state}, nil
 	case "restic":
 		info, err := checkResticBinary(cmd, true)
 		if err != nil {
@@ -220,44 +193,12 @@ func loadConfigSnapshot(cmd *cobra.Command, tgt target.Target, version string) (
 		if err != nil {
 			return configSnapshot{}, err
 		}
-		return configSnapshot{
-			Timestamp:    data.Timestamp,
-			Projects:     data.Projects,
-			Profiles:     data.Profiles,
-			Networks:     data.Networks,
-			StoragePools: data.StoragePools,
-		}, nil
+		return configSnapshot{Timestamp: data.Timestamp, State: data.State}, nil
 	default:
 		return configSnapshot{}, fmt.Errorf("unsupported backend: %s", tgt.Scheme)
 	}
 }
 
-func loadConfigSnapshotDir(dir string) (configSnapshot, error) {
-	projects, err := loadProjects(filepath.Join(dir, "projects.json"))
-	if err != nil {
-		return configSnapshot{}, err
-	}
-	profiles, err := loadProfiles(filepath.Join(dir, "profiles.json"))
-	if err != nil {
-		return configSnapshot{}, err
-	}
-	networks, err := loadNetworks(filepath.Join(dir, "networks.json"))
-	if err != nil {
-		return configSnapshot{}, err
-	}
-	pools, err := loadStoragePools(filepath.Join(dir, "storage_pools.json"))
-	if err != nil {
-		return configSnapshot{}, err
-	}
-	return configSnapshot{
-		Timestamp:    filepath.Base(dir),
-		Projects:     projects,
-		Profiles:     profiles,
-		Networks:     networks,
-		StoragePools: pools,
-	}, nil
-}
-
 func resolveConfigSnapshotDir(tgt target.Target, version string) (string, error) {
 	base := filepath.Join(tgt.DirPath, "config")
 	if version != "" {
@@ -280,98 +221,89 @@ func resolveConfigSnapshotDir(tgt target.Target, version string) (string, error)
 	return filepath.Join(base, names[len(names)-1]), nil
 }
 
-func renderProjectsPlan(w io.Writer, p cfg.ProjectPlan) {
-	fmt.Fprintf(w, "Config preview (projects)\n")
-	fmt.Fprintf(w, "Create: %d\n", len(p.ToCreate))
-	for _, c := range p.ToCreate {
-		fmt.Fprintf(w, "  + %s\n", c.Name)
-	}
-	fmt.Fprintf(w, "Update: %d\n", len(p.ToUpdate))
-	for _, u := range p.ToUpdate {
-		fmt.Fprintf(w, "  ~ %s\n", u.Name)
-	}
-	fmt.Fprintf(w, "Delete: %d\n", len(p.ToDelete))
-	for _, d := range p.ToDelete {
-		fmt.Fprintf(w, "  - %s\n", d.Name)
-	}
-}
-
-func renderNetworksPlan(w io.Writer, p cfg.NetworkPlan) {
-	fmt.Fprintf(w, "Config preview (networks)\n")
-	fmt.Fprintf(w, "Create: %d\n", len(p.ToCreate))
-	for _, c := range p.ToCreate {
-		fmt.Fprintf(w, "  + %s\n", c.Name)
-	}
-	fmt.Fprintf(w, "Update: %d\n", len(p.ToUpdate))
-	for _, u := range p.ToUpdate {
-		fmt.Fprintf(w, "  ~ %s\n", u.Name)
-	}
-	fmt.Fprintf(w, "Delete: %d\n", len(p.ToDelete))
-	for _, d := range p.ToDelete {
-		fmt.Fprintf(w, "  - %s\n", d.Name)
-	}
+// renderConfigPlan prints the changes for every kind. Projects, networks and
+// storage pools are always listed; other kinds only when they have changes.
+// Without pruneExtra, deletions are marked as kept.
+func renderConfigPlan(w io.Writer, p cfg.Plan, pruneExtra bool) {
+	projectName := func(v incusapi.Project) string { return v.Name }
+	networkName := func(v incusapi.Network) string { return v.Name }
+	poolName := func(v incusapi.StoragePool) string { return v.Name }
+	renderPlanSection(w, "projects", names(p.Projects.ToCreate, projectName),
+		names(p.Projects.ToUpdate, func(u cfg.ProjectUpdate) string { return u.Name }),
+		names(p.Projects.ToDelete, projectName), pruneExtra)
+	renderPlanSection(w, "networks", names(p.Networks.ToCreate, networkName),
+		names(p.Networks.ToUpdate, func(u cfg.NetworkUpdate) string { return u.Name }),
+		names(p.Networks.ToDelete, networkName), pruneExtra)
+	renderPlanSection(w, "storage pools", names(p.StoragePools.ToCreate, poolName),
+		names(p.StoragePools.ToUpdate, func(u cfg.StoragePoolUpdate) string { return u.Name }),
+		names(p.StoragePools.ToDelete, poolName), pruneExtra)
+	renderObjectPlan(w, "network ACLs", p.ACLs, pruneExtra)
+	renderObjectPlan(w, "network zones", p.Zones, pruneExtra)
+	renderObjectPlan(w, "network zone records", p.ZoneRecords, pruneExtra)
+	renderObjectPlan(w, "network forwards", p.Forwards, pruneExtra)
+	renderObjectPlan(w, "network load balancers", p.LoadBalancers, pruneExtra)
+	renderObjectPlan(w, "network peers", p.Peers, pruneExtra)
+	renderObjectPlan(w, "profiles", p.Profiles, pruneExtra)
+	renderServerPlan(w, p.Server, pruneExtra)
 }
 
-func renderStoragePoolsPlan(w io.Writer, p cfg.StoragePoolPlan) {
-	fmt.Fprintf(w, "Config preview (storage pools)\n")
-	fmt.Fprintf(w, "Create: %d\n", len(p.ToCreate))
-	for _, c := range p.ToCreate {
-		fmt.Fprintf(w, "  + %s\n", c.Name)
-	}
-	fmt.Fprintf(w, "Update: %d\n", len(p.ToUpdate))
-	for _, u := range p.ToUpdate {
-		fmt.Fprintf(w, "  ~ %s\n", u.Name)
-	}
-	fmt.Fprintf(w, "Delete: %d\n", len(p.ToDelete))
-	for _, d := range p.ToDelete {
-		fmt.Fprintf(w, "  - %s\n", d.Name)
+// renderServerPlan prints server config, trust store and cluster group
+// changes; risky config keys are flagged with why they need --force.
+func renderServerPlan(w io.Writer, p cfg.ServerPlan, pruneExtra bool) {
+	if len(p.Config.ToSet)+len(p.Config.ToUnset) > 0 {
+		risk := func(c cfg.ServerConfigChange) string {
+			if c.Risk == "" {
+				return ""
+			}
+			return fmt.Sprintf(" (needs --force: %s)", c.Risk)
+		}
+		fmt.Fprintf(w, "Config preview (server config)\n")
+		fmt.Fprintf(w, "Set: %d\n", len(p.Config.ToSet))
+		for _, c := range p.Config.ToSet {
+			fmt.Fprintf(w, "  ~ %s: %q -> %q%s\n", c.Key, c.Current, c.Desired, risk(c))
+		}
+		fmt.Fprintf(w, "Unset: %d\n", len(p.Config.ToUnset))
+		for _, c := range p.Config.ToUnset {
+			fmt.Fprintf(w, "  - %s%s\n", c.Key, risk(c))
+		}
 	}
+	renderObjectPlan(w, "certificates", p.Certificates, pruneExtra)
+	renderObjectPlan(w, "cluster groups", p.ClusterGroups, pruneExtra)
 }
 
-func loadProjects(path string) ([]incusapi.Project, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+func renderObjectPlan[T any](w io.Writer, title string, p cfg.ObjectPlan[T], pruneExtra bool) {
+	if p.Empty() {
+		return
 	}
-	var out []incusapi.Project
-	if err := json.Unmarshal(b, &out); err != nil {
-		return nil, err
-	}
-	return out, nil
+	renderPlanSection(w, title, names(p.ToCreate, p.Key),
+		names(p.ToUpdate, func(u cfg.ObjectUpdate[T]) string { return u.Name }),
+		names(p.ToDelete, p.Key), pruneExtra)
 }
 
-func loadProfiles(path string) ([]incusapi.Profile, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+func renderPlanSection(w io.Writer, title string, create, update, del []string, pruneExtra bool) {
+	fmt.Fprintf(w, "Config preview (%s)\n", title)
+	fmt.Fprintf(w, "Create: %d\n", len(create))
+	for _, name := range create {
+		fmt.Fprintf(w, "  + %s\n", name)
 	}
-	var out []incusapi.Profile
-	if err := json.Unmarshal(b, &out); err != nil {
-		return nil, err
+	fmt.Fprintf(w, "Update: %d\n", len(update))
+	for _, name := range update {
+		fmt.Fprintf(w, "  ~ %s\n", name)
 	}
-	return out, nil
-}
-
-func loadNetworks(path string) ([]incusapi.Network, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+	if len(del) > 0 && !pruneExtra {
+		fmt.Fprintf(w, "Delete: %d (kept without --prune-extra)\n", len(del))
+	} else {
+		fmt.Fprintf(w, "Delete: %d\n", len(del))
 	}
-	var out []incusapi.Network
-	if err := json.Unmarshal(b, &out); err != nil {
-		return nil, err
+	for _, name := range del {
+		fmt.Fprintf(w, "  - %s\n", name)
 	}
-	return out, nil
 }
 
-func loadStoragePools(path string) ([]incusapi.StoragePool, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var out []incusapi.StoragePool
-	if err := json.Unmarshal(b, &out); err != nil {
-		return nil, err
+func names[T any](items []T, name func(T) string) []string {
+	out := make([]string, 0, len(items))
+	for _, v := range items {
+		out = append(out, name(v))
 	}
-	return out, nil
+	return out
 }
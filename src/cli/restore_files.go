@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/archive"
+	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
+	"incus-backup/src/safety"
+)
+
+func newRestoreFilesCmd(stdout, stderr io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "files",
+		Short: "Restore selected files from a backup into an existing instance",
+	}
+
+	cmd.AddCommand(newRestoreFilesInstanceCmd(stdout, stderr))
+
+	return cmd
+}
+
+// restoreFilesResult is the JSON/YAML form of restore files.
+type restoreFilesResult struct {
+	Version string            `json:"version"`
+	Into    string            `json:"into"`
+	Files   []inst.FileResult `json:"files"`
+}
+
+func newRestoreFilesInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
+	var project, version, into, format string
+	var paths []string
+	var overwrite, skipExisting bool
+	cmd := &cobra.Command{
+		Use:   "instance NAME",
+		Short: "Push files from an instance backup into a live instance",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgt, ref, err := parseExportArgs(cmd, "instance", project, version, args[0])
+			if err != nil {
+				return err
+			}
+			if format, err = output.Check(format); err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				return errors.New("--path is required (e.g., /var/lib/app/)")
+			}
+			if overwrite && skipExisting {
+				return errors.New("--overwrite and --skip-existing are mutually exclusive")
+			}
+			if into == "" {
+				into = ref.Name
+			}
+			m, err := archive.NewPathMatcher(paths)
+			if err != nil {
+				return err
+			}
+			client, err := incusapi.ConnectLocal()
+			if err != nil {
+				return err
+			}
+			if exists, err := client.InstanceExists(project, into); err != nil {
+				return err
+			} else if !exists {
+				return fmt.Errorf("instance %s not found in project %s", into, project)
+			}
+			human := stdout
+			if format != output.Table {
+				human = stderr
+			}
+
+			safetyOpts := getSafetyOptions(cmd)
+			opts := inst.FilesOptions{OnExisting: inst.OnExistingAsk, DryRun: safetyOpts.DryRun}
+			switch {
+			case overwrite:
+				opts.OnExisting = inst.OnExistingOverwrite
+			case skipExisting:
+				opts.OnExisting = inst.OnExistingSkip
+			}
+			opts.Confirm = func(path string) (bool, error) {
+				return safety.Confirm(safetyOpts, cmd.InOrStdin(), human,
+					fmt.Sprintf("%s already exists in instance %s. Overwrite existing files?", path, into))
+			}
+
+			ts, r, err := openExport(cmd, tgt, ref)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			result := restoreFilesResult{Version: ts, Into: into}
+			var restoreErr error
+			result.Files, restoreErr = inst.RestoreFiles(client, project, into, r, m, opts)
+			if err := output.Render(stdout, format, result, func(w io.Writer) error {
+				renderRestoreFiles(w, result)
+				return nil
+			}); err != nil {
+				return err
+			}
+			if restoreErr != nil {
+				return fmt.Errorf("%s at %s: %w", ref, ts, restoreErr)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
+	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
+	cmd.Flags().StringArrayVar(&paths, "path", nil, "Path or glob to restore, with everything below it (repeatable)")
+	cmd.Flags().StringVar(&into, "into", "", "Instance to push the files into (default: NAME)")
+	cmd.Flags().BoolVar(&overwrite, "overwrite", false, "Overwrite files that exist in the instance")
+	cmd.Flags().BoolVar(&skipExisting, "skip-existing", false, "Keep files that exist in the instance")
+	addOutputFlag(cmd, &format)
+	return cmd
+}
+
+func renderRestoreFiles(w io.Writer, r restoreFilesResult) {
+	t := output.NewTable(w, "STATUS", "PATH", "TYPE", "SIZE")
+	counts := map[string]int{}
+	for _, f := range r.Files {
+		counts[f.Status]++
+		t.Row(f.Status, f.Path, f.Type, fmt.Sprint(f.Size))
+	}
+	_ = t.Flush()
+	if n := counts[inst.FileWouldRestore] + counts[inst.FileConflict]; n > 0 {
+		fmt.Fprintf(w, "dry-run: would restore %d paths from %s into %s (%d already exist)\n", n, r.Version, r.Into, counts[inst.FileConflict])
+		return
+	}
+	fmt.Fprintf(w, "restored=%d skipped=%d from %s into %s\n", counts[inst.FileRestored], len(r.Files)-counts[inst.FileRestored], r.Version, r.Into)
+}
@@ -8,12 +8,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
 	inst "incus-backup/src/backup/instances"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
 )
@@ -22,6 +22,7 @@ func newRestoreInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project, version, targetName string
 	var replace bool
 	var skipExisting bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "instance NAME",
 		Short: "Restore a single instance from backup",
@@ -36,12 +37,18 @@ func newRestoreInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
 			if tgt.Scheme == "restic" {
 				client, err := incusapi.ConnectLocal()
 				if err != nil {
 					return err
 				}
-				return restoreInstanceFromRestic(cmd, client, tgt, project, name, version, targetName, replace, skipExisting, stdout)
+				return restoreInstanceFromRestic(cmd, client, tgt, project, name, version, targetName, replace, skipExisting, rw, out)
 			}
 			if tgt.Scheme != "dir" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
@@ -75,29 +82,37 @@ func newRestoreInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
 				}
 			}
 			versionID := filepath.Base(snapDir)
-			renderInstanceRestorePreview(stdout, []instancePreviewRow{{
+			rows := []restorePlan{{
 				Action:     action,
+				Type:       "instance",
 				Project:    project,
 				Name:       name,
 				TargetName: destName,
 				Version:    versionID,
-			}})
+			}}
+			if err := rw.preview(out, opts.DryRun, rows, func(w io.Writer) { renderInstanceRestorePreview(w, rows) }); err != nil {
+				return err
+			}
 			if opts.DryRun {
 				return nil
 			}
+			result := restoreResult("instance", project, "", name, destName, versionID)
+			result.Path = snapDir
 			if exists {
 				if skipExisting {
+					rw.add(result.skipped())
 					return nil
 				}
 				// If not replace, prompt user once
 				if !replace {
 					var b strings.Builder
 					b.WriteString(fmt.Sprintf("Instance %s already exists in project %s. Replace it?\n", destName, project))
-					ok, err := safety.Confirm(opts, os.Stdin, stdout, b.String())
+					ok, err := safety.Confirm(opts, os.Stdin, out, b.String())
 					if err != nil {
 						return err
 					}
 					if !ok {
+						rw.add(result.skipped())
 						return nil
 					}
 				}
@@ -107,10 +122,13 @@ func newRestoreInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
 					return err
 				}
 			}
-			return inst.RestoreInstance(client, snapDir, project, destName, stdout)
+			return restoreResource(cmd, rw, result, func(progress io.Writer) error {
+				return inst.RestoreInstance(client, snapDir, project, destName, progress)
+			})
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
 	cmd.Flags().StringVar(&targetName, "target-name", "", "Optional new name for the restored instance")
@@ -119,21 +137,12 @@ func newRestoreInstanceCmd(stdout, stderr io.Writer) *cobra.Command {
 	return cmd
 }
 
-type instancePreviewRow struct {
-	Action     string
-	Project    string
-	Name       string
-	TargetName string
-	Version    string
-}
-
-func renderInstanceRestorePreview(w io.Writer, rows []instancePreviewRow) {
-	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tNAME\tTARGET_NAME\tVERSION")
+func renderInstanceRestorePreview(w io.Writer, rows []restorePlan) {
+	t := output.NewTable(w, "ACTION", "PROJECT", "NAME", "TARGET_NAME", "VERSION")
 	for _, r := range rows {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Name, r.TargetName, r.Version)
+		t.Row(r.Action, r.Project, r.Name, r.TargetName, r.Version)
 	}
-	_ = tw.Flush()
+	_ = t.Flush()
 }
 
 func resolveInstanceSnapshotDir(tgt target.Target, project, name, version string) (string, error) {
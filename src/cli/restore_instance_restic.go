@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"sort"
-	"text/tabwriter"
 
 	inst "incus-backup/src/backup/instances"
 	"incus-backup/src/incusapi"
@@ -16,7 +15,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func restoreInstanceFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, name, version, targetName string, replace, skipExisting bool, stdout io.Writer) error {
+func restoreInstanceFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, name, version, targetName string, replace, skipExisting bool, rw *resultWriter, stdout io.Writer) error {
 	info, err := checkResticBinary(cmd, true)
 	if err != nil {
 		return err
@@ -55,27 +54,38 @@ func restoreInstanceFromRestic(cmd *cobra.Command, client incusapi.Client, tgt t
 		}
 	}
 
-	renderInstanceRestorePreview(stdout, []instancePreviewRow{{
+	rows := []restorePlan{{
 		Action:     action,
+		Type:       "instance",
 		Project:    project,
 		Name:       name,
 		TargetName: destName,
 		Version:    snapshotTimestamp(snap),
-	}})
+	}}
+	if err := rw.preview(stdout, opts.DryRun, rows, func(w io.Writer) { renderInstanceRestorePreview(w, rows) }); err != nil {
+		return err
+	}
 
 	if opts.DryRun {
 		return nil
 	}
 
+	result := restoreResult("instance", project, "", name, destName, snapshotTimestamp(snap))
+	result.SnapshotID = snap.ID
 	if exists {
 		if skipExisting {
+			rw.add(result.skipped())
 			return nil
 		}
 		if !replace {
 			ok, err := safety.Confirm(opts, cmd.InOrStdin(), stdout, fmt.Sprintf("Instance %s already exists in project %s. Replace it?", destName, project))
-			if err != nil || !ok {
+			if err != nil {
 				return err
 			}
+			if !ok {
+				rw.add(result.skipped())
+				return nil
+			}
 		}
 		_ = client.StopInstance(project, destName, true)
 		if err := client.DeleteInstance(project, destName); err != nil {
@@ -83,7 +93,9 @@ func restoreInstanceFromRestic(cmd *cobra.Command, client incusapi.Client, tgt t
 		}
 	}
 
-	return inst.RestoreInstanceRestic(ctx, info, tgt.Value, snap, client, project, name, destName, stdout)
+	return restoreResource(cmd, rw, result, func(progress io.Writer) error {
+		return inst.RestoreInstanceRestic(ctx, info, tgt.Value, snap, client, project, name, destName, progress)
+	})
 }
 
 func snapshotTimestamp(snap restic.Snapshot) string {
@@ -93,14 +105,29 @@ func snapshotTimestamp(snap restic.Snapshot) string {
 	return snap.Time.UTC().Format("20060102T150405Z")
 }
 
+// listDataSnapshots returns the snapshots matching tags that hold export data:
+// bundles and legacy part=data snapshots.
+func listDataSnapshots(ctx context.Context, bin restic.BinaryInfo, repo string, tags []string) ([]restic.Snapshot, error) {
+	snaps, err := restic.ListSnapshots(ctx, bin, repo, tags)
+	if err != nil {
+		return nil, err
+	}
+	out := snaps[:0]
+	for _, snap := range snaps {
+		if snap.HasPart("data") {
+			out = append(out, snap)
+		}
+	}
+	return out, nil
+}
+
 func findInstanceSnapshot(ctx context.Context, bin restic.BinaryInfo, repo, project, name, desiredTs string) (restic.Snapshot, error) {
 	tags := []string{
 		"type=instance",
-		"part=data",
 		fmt.Sprintf("project=%s", project),
 		fmt.Sprintf("name=%s", name),
 	}
-	snaps, err := restic.ListSnapshots(ctx, bin, repo, tags)
+	snaps, err := listDataSnapshots(ctx, bin, repo, tags)
 	if err != nil {
 		return restic.Snapshot{}, err
 	}
@@ -118,7 +145,7 @@ func findInstanceSnapshot(ctx context.Context, bin restic.BinaryInfo, repo, proj
 	return snaps[len(snaps)-1], nil
 }
 
-func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, version string, namesArg []string, replace, skipExisting bool, stdout io.Writer) error {
+func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, version string, namesArg []string, replace, skipExisting bool, rw *resultWriter, stdout io.Writer) error {
 	info, err := checkResticBinary(cmd, true)
 	if err != nil {
 		return err
@@ -162,8 +189,7 @@ func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt
 		items = append(items, item{name: name, snapshot: snap, exists: exists})
 	}
 
-	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tNAME\tTARGET_NAME\tVERSION")
+	var rows []restorePlan
 	for _, it := range items {
 		action := "create"
 		if it.exists {
@@ -175,11 +201,13 @@ func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt
 				action = "skip"
 			}
 		}
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", action, project, it.name, it.name, snapshotTimestamp(it.snapshot))
+		rows = append(rows, restorePlan{Action: action, Type: "instance", Project: project, Name: it.name, TargetName: it.name, Version: snapshotTimestamp(it.snapshot)})
 	}
-	_ = tw.Flush()
 
 	opts := getSafetyOptions(cmd)
+	if err := rw.preview(stdout, opts.DryRun, rows, func(w io.Writer) { renderInstanceRestorePreview(w, rows) }); err != nil {
+		return err
+	}
 	if opts.DryRun {
 		return nil
 	}
@@ -195,10 +223,13 @@ func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt
 	}
 
 	for i, it := range items {
+		result := restoreResult("instance", project, "", it.name, it.name, snapshotTimestamp(it.snapshot))
+		result.SnapshotID = it.snapshot.ID
 		fmt.Fprintf(stdout, "[%d/%d] Restoring instance %s/%s\n", i+1, len(items), project, it.name)
 		if it.exists {
 			if skipExisting {
 				fmt.Fprintf(stdout, "[%d/%d] Skip existing %s/%s\n", i+1, len(items), project, it.name)
+				rw.add(result.skipped())
 				continue
 			}
 			_ = client.StopInstance(project, it.name, true)
@@ -206,7 +237,10 @@ func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt
 				return err
 			}
 		}
-		if err := inst.RestoreInstanceRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.name, it.name, stdout); err != nil {
+		err := restoreResource(cmd, rw, result, func(progress io.Writer) error {
+			return inst.RestoreInstanceRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.name, it.name, progress)
+		})
+		if err != nil {
 			return err
 		}
 		fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", i+1, len(items), project, it.name)
@@ -215,9 +249,8 @@ func restoreInstancesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt
 }
 
 func listInstanceNames(ctx context.Context, bin restic.BinaryInfo, repo, project string) ([]string, error) {
-	snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{
+	snaps, err := listDataSnapshots(ctx, bin, repo, []string{
 		"type=instance",
-		"part=data",
 		fmt.Sprintf("project=%s", project),
 	})
 	if err != nil {
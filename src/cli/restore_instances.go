@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
@@ -21,6 +20,7 @@ import (
 func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project, version string
 	var replace, skipExisting bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "instances [NAME ...]",
 		Short: "Restore one or more instances (or all if omitted)",
@@ -33,6 +33,12 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
 
 			client, err := incusapi.ConnectLocal()
 			if err != nil {
@@ -40,7 +46,7 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 
 			if tgt.Scheme == "restic" {
-				return restoreInstancesFromRestic(cmd, client, tgt, project, version, args, replace, skipExisting, stdout)
+				return restoreInstancesFromRestic(cmd, client, tgt, project, version, args, replace, skipExisting, rw, out)
 			}
 
 			if tgt.Scheme != "dir" {
@@ -67,8 +73,7 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 				return nil
 			}
 
-			type row struct{ Action, Project, Name, TargetName, Version string }
-			var rows []row
+			var rows []restorePlan
 			for _, name := range names {
 				destName := name
 				snapDir, err := resolveInstanceSnapshotDir(tgt, project, name, version)
@@ -89,23 +94,19 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 						action = "skip"
 					}
 				}
-				rows = append(rows, row{Action: action, Project: project, Name: name, TargetName: destName, Version: filepath.Base(snapDir)})
-			}
-
-			tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(tw, "ACTION\tPROJECT\tNAME\tTARGET_NAME\tVERSION")
-			for _, r := range rows {
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Name, r.TargetName, r.Version)
+				rows = append(rows, restorePlan{Action: action, Type: "instance", Project: project, Name: name, TargetName: destName, Version: filepath.Base(snapDir)})
 			}
-			_ = tw.Flush()
 
 			opts := getSafetyOptions(cmd)
+			if err := rw.preview(out, opts.DryRun, rows, func(w io.Writer) { renderInstanceRestorePreview(w, rows) }); err != nil {
+				return err
+			}
 			if opts.DryRun {
 				return nil
 			}
 
 			if !(replace || skipExisting) {
-				ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Apply restore for %d instances?", len(names)))
+				ok, err := safety.Confirm(opts, os.Stdin, out, fmt.Sprintf("Apply restore for %d instances?", len(names)))
 				if err != nil {
 					return err
 				}
@@ -124,10 +125,13 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Restoring instance %s/%s\n", i+1, len(names), project, destName)
+				result := restoreResult("instance", project, "", name, destName, filepath.Base(snapDir))
+				result.Path = snapDir
+				fmt.Fprintf(out, "[%d/%d] Restoring instance %s/%s\n", i+1, len(names), project, destName)
 				if exists {
 					if skipExisting {
-						fmt.Fprintf(stdout, "[%d/%d] Skip existing %s/%s\n", i+1, len(names), project, destName)
+						fmt.Fprintf(out, "[%d/%d] Skip existing %s/%s\n", i+1, len(names), project, destName)
+						rw.add(result.skipped())
 						continue
 					}
 					_ = client.StopInstance(project, destName, true)
@@ -135,15 +139,19 @@ func newRestoreInstancesCmd(stdout, stderr io.Writer) *cobra.Command {
 						return err
 					}
 				}
-				if err := inst.RestoreInstance(client, snapDir, project, destName, stdout); err != nil {
+				err = restoreResource(cmd, rw, result, func(progress io.Writer) error {
+					return inst.RestoreInstance(client, snapDir, project, destName, progress)
+				})
+				if err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", i+1, len(names), project, destName)
+				fmt.Fprintf(out, "[%d/%d] Done %s/%s\n", i+1, len(names), project, destName)
 			}
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest per instance)")
 	cmd.Flags().BoolVar(&replace, "replace", false, "Replace existing instances if they exist")
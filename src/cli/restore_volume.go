@@ -8,12 +8,12 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
 	vol "incus-backup/src/backup/volumes"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
 )
@@ -21,6 +21,7 @@ import (
 func newRestoreVolumeCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project, version, targetName, pool string
 	var replace, skipExisting bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "volume POOL/NAME",
 		Short: "Restore a custom volume from backup",
@@ -42,12 +43,18 @@ func newRestoreVolumeCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
 			client, err := incusapi.ConnectLocal()
 			if err != nil {
 				return err
 			}
 			if tgt.Scheme == "restic" {
-				return restoreVolumeFromRestic(cmd, client, tgt, project, pool, name, version, targetName, replace, skipExisting, stdout)
+				return restoreVolumeFromRestic(cmd, client, tgt, project, pool, name, version, targetName, replace, skipExisting, rw, out)
 			}
 			if tgt.Scheme != "dir" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
@@ -75,21 +82,28 @@ func newRestoreVolumeCmd(stdout, stderr io.Writer) *cobra.Command {
 					action = "skip"
 				}
 			}
-			renderVolumeRestorePreview(stdout, []volumePreviewRow{{Action: action, Project: project, Pool: pool, Name: name, TargetName: destName, Version: filepath.Base(snapDir)}})
+			rows := []restorePlan{{Action: action, Type: "volume", Project: project, Pool: pool, Name: name, TargetName: destName, Version: filepath.Base(snapDir)}}
 			opts := getSafetyOptions(cmd)
+			if err := rw.preview(out, opts.DryRun, rows, func(w io.Writer) { renderVolumeRestorePreview(w, rows) }); err != nil {
+				return err
+			}
 			if opts.DryRun {
 				return nil
 			}
+			result := restoreResult("volume", project, pool, name, destName, filepath.Base(snapDir))
+			result.Path = snapDir
 			if exists {
 				if skipExisting {
+					rw.add(result.skipped())
 					return nil
 				}
 				if !replace {
-					ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Volume %s/%s exists. Replace it?", pool, destName))
+					ok, err := safety.Confirm(opts, os.Stdin, out, fmt.Sprintf("Volume %s/%s exists. Replace it?", pool, destName))
 					if err != nil {
 						return err
 					}
 					if !ok {
+						rw.add(result.skipped())
 						return nil
 					}
 				}
@@ -97,10 +111,13 @@ func newRestoreVolumeCmd(stdout, stderr io.Writer) *cobra.Command {
 					return err
 				}
 			}
-			return vol.RestoreVolume(client, snapDir, project, pool, destName, stdout)
+			return restoreResource(cmd, rw, result, func(progress io.Writer) error {
+				return vol.RestoreVolume(client, snapDir, project, pool, destName, progress)
+			})
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest)")
 	cmd.Flags().StringVar(&targetName, "target-name", "", "Optional new name for the restored volume")
@@ -109,15 +126,12 @@ func newRestoreVolumeCmd(stdout, stderr io.Writer) *cobra.Command {
 	return cmd
 }
 
-type volumePreviewRow struct{ Action, Project, Pool, Name, TargetName, Version string }
-
-func renderVolumeRestorePreview(w io.Writer, rows []volumePreviewRow) {
-	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tPOOL\tNAME\tTARGET_NAME\tVERSION")
+func renderVolumeRestorePreview(w io.Writer, rows []restorePlan) {
+	t := output.NewTable(w, "ACTION", "PROJECT", "POOL", "NAME", "TARGET_NAME", "VERSION")
 	for _, r := range rows {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Pool, r.Name, r.TargetName, r.Version)
+		t.Row(r.Action, r.Project, r.Pool, r.Name, r.TargetName, r.Version)
 	}
-	_ = tw.Flush()
+	_ = t.Flush()
 }
 
 func resolveVolumeSnapshotDir(tgt target.Target, project, pool, name, version string) (string, error) {
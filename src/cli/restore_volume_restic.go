@@ -6,10 +6,10 @@ import (
 	"io"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	vol "incus-backup/src/backup/volumes"
 	"incus-backup/src/incusapi"
+	"incus-backup/src/output"
 	"incus-backup/src/restic"
 	"incus-backup/src/safety"
 	"incus-backup/src/target"
@@ -17,7 +17,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func restoreVolumeFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, pool, name, version, targetName string, replace, skipExisting bool, stdout io.Writer) error {
+func restoreVolumeFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, pool, name, version, targetName string, replace, skipExisting bool, rw *resultWriter, stdout io.Writer) error {
 	info, err := checkResticBinary(cmd, true)
 	if err != nil {
 		return err
@@ -55,39 +55,52 @@ func restoreVolumeFromRestic(cmd *cobra.Command, client incusapi.Client, tgt tar
 		}
 	}
 
-	renderVolumeRestorePreview(stdout, []volumePreviewRow{{
+	rows := []restorePlan{{
 		Action:     action,
+		Type:       "volume",
 		Project:    project,
 		Pool:       pool,
 		Name:       name,
 		TargetName: destName,
 		Version:    volumeSnapshotTimestamp(snap),
-	}})
+	}}
 
 	opts := getSafetyOptions(cmd)
+	if err := rw.preview(stdout, opts.DryRun, rows, func(w io.Writer) { renderVolumeRestorePreview(w, rows) }); err != nil {
+		return err
+	}
 	if opts.DryRun {
 		return nil
 	}
 
+	result := restoreResult("volume", project, pool, name, destName, volumeSnapshotTimestamp(snap))
+	result.SnapshotID = snap.ID
 	if exists {
 		if skipExisting {
+			rw.add(result.skipped())
 			return nil
 		}
 		if !replace {
 			ok, err := safety.Confirm(opts, cmd.InOrStdin(), stdout, fmt.Sprintf("Volume %s/%s exists. Replace it?", pool, destName))
-			if err != nil || !ok {
+			if err != nil {
 				return err
 			}
+			if !ok {
+				rw.add(result.skipped())
+				return nil
+			}
 		}
 		if err := client.DeleteVolume(project, pool, destName); err != nil {
 			return err
 		}
 	}
 
-	return vol.RestoreVolumeRestic(ctx, info, tgt.Value, snap, client, project, pool, destName, stdout)
+	return restoreResource(cmd, rw, result, func(progress io.Writer) error {
+		return vol.RestoreVolumeRestic(ctx, info, tgt.Value, snap, client, project, pool, destName, progress)
+	})
 }
 
-func restoreVolumesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, version string, args []string, replace, skipExisting bool, stdout io.Writer) error {
+func restoreVolumesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt target.Target, project, version string, args []string, replace, skipExisting bool, rw *resultWriter, stdout io.Writer) error {
 	info, err := checkResticBinary(cmd, true)
 	if err != nil {
 		return err
@@ -135,12 +148,11 @@ func restoreVolumesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt ta
 		it.exists = exists
 	}
 
-	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(tw, "ACTION\tPROJECT\tPOOL\tNAME\tTARGET_NAME\tVERSION")
+	t := output.NewTable(stdout, "ACTION", "PROJECT", "POOL", "NAME", "TARGET_NAME", "VERSION")
 	for _, r := range rows {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Pool, r.Name, r.TargetName, r.Version)
+		t.Row(r.Action, r.Project, r.Pool, r.Name, r.TargetName, r.Version)
 	}
-	_ = tw.Flush()
+	_ = t.Flush()
 
 	opts := getSafetyOptions(cmd)
 	if opts.DryRun {
@@ -158,17 +170,23 @@ func restoreVolumesFromRestic(cmd *cobra.Command, client incusapi.Client, tgt ta
 	}
 
 	for i, it := range items {
+		result := restoreResult("volume", project, it.pool, it.name, it.name, volumeSnapshotTimestamp(it.snapshot))
+		result.SnapshotID = it.snapshot.ID
 		fmt.Fprintf(stdout, "[%d/%d] Restoring volume %s/%s\n", i+1, len(items), it.pool, it.name)
 		if it.exists {
 			if skipExisting {
 				fmt.Fprintf(stdout, "[%d/%d] Skip existing %s/%s\n", i+1, len(items), it.pool, it.name)
+				rw.add(result.skipped())
 				continue
 			}
 			if err := client.DeleteVolume(project, it.pool, it.name); err != nil {
 				return err
 			}
 		}
-		if err := vol.RestoreVolumeRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.pool, it.name, stdout); err != nil {
+		err := restoreResource(cmd, rw, result, func(progress io.Writer) error {
+			return vol.RestoreVolumeRestic(ctx, info, tgt.Value, it.snapshot, client, project, it.pool, it.name, progress)
+		})
+		if err != nil {
 			return err
 		}
 		fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", i+1, len(items), it.pool, it.name)
@@ -186,7 +204,7 @@ type volumeItem struct {
 func volumeItemsFromArgs(ctx context.Context, bin restic.BinaryInfo, repo, project string, args []string) ([]volumeItem, error) {
 	var out []volumeItem
 	if len(args) == 0 {
-		snaps, err := restic.ListSnapshots(ctx, bin, repo, []string{"type=volume", "part=data", fmt.Sprintf("project=%s", project)})
+		snaps, err := listDataSnapshots(ctx, bin, repo, []string{"type=volume", fmt.Sprintf("project=%s", project)})
 		if err != nil {
 			return nil, err
 		}
@@ -227,12 +245,11 @@ func volumeItemsFromArgs(ctx context.Context, bin restic.BinaryInfo, repo, proje
 func findVolumeSnapshot(ctx context.Context, bin restic.BinaryInfo, repo, project, pool, name, desiredTs string) (restic.Snapshot, error) {
 	tags := []string{
 		"type=volume",
-		"part=data",
 		fmt.Sprintf("project=%s", project),
 		fmt.Sprintf("pool=%s", pool),
 		fmt.Sprintf("name=%s", name),
 	}
-	snaps, err := restic.ListSnapshots(ctx, bin, repo, tags)
+	snaps, err := listDataSnapshots(ctx, bin, repo, tags)
 	if err != nil {
 		return restic.Snapshot{}, err
 	}
@@ -8,7 +8,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
-	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
@@ -21,6 +20,7 @@ import (
 func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 	var project, version string
 	var replace, skipExisting bool
+	var format string
 	cmd := &cobra.Command{
 		Use:   "volumes [POOL/NAME ...]",
 		Short: "Restore custom volumes (all or selected)",
@@ -33,6 +33,12 @@ func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			rw, err := newResultWriter(stdout, format)
+			if err != nil {
+				return err
+			}
+			defer rw.flush()
+			out := rw.human(stdout, stderr)
 
 			client, err := incusapi.ConnectLocal()
 			if err != nil {
@@ -40,7 +46,7 @@ func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 
 			if tgt.Scheme == "restic" {
-				return restoreVolumesFromRestic(cmd, client, tgt, project, version, args, replace, skipExisting, stdout)
+				return restoreVolumesFromRestic(cmd, client, tgt, project, version, args, replace, skipExisting, rw, out)
 			}
 			if tgt.Scheme != "dir" {
 				return fmt.Errorf("unsupported backend: %s", tgt.Scheme)
@@ -89,8 +95,7 @@ func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 				return nil
 			}
 
-			type row struct{ Action, Project, Pool, Name, TargetName, Version string }
-			var rows []row
+			var rows []restorePlan
 			for _, it := range items {
 				pool, name := it[0], it[1]
 				snapDir, err := resolveVolumeSnapshotDir(tgt, project, pool, name, version)
@@ -111,22 +116,18 @@ func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 						action = "skip"
 					}
 				}
-				rows = append(rows, row{Action: action, Project: project, Pool: pool, Name: name, TargetName: name, Version: filepath.Base(snapDir)})
-			}
-			tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(tw, "ACTION\tPROJECT\tPOOL\tNAME\tTARGET_NAME\tVERSION")
-			for _, r := range rows {
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Action, r.Project, r.Pool, r.Name, r.TargetName, r.Version)
+				rows = append(rows, restorePlan{Action: action, Type: "volume", Project: project, Pool: pool, Name: name, TargetName: name, Version: filepath.Base(snapDir)})
 			}
-			_ = tw.Flush()
-
 			opts := getSafetyOptions(cmd)
+			if err := rw.preview(out, opts.DryRun, rows, func(w io.Writer) { renderVolumeRestorePreview(w, rows) }); err != nil {
+				return err
+			}
 			if opts.DryRun {
 				return nil
 			}
 
 			if !(replace || skipExisting) {
-				ok, err := safety.Confirm(opts, os.Stdin, stdout, fmt.Sprintf("Apply restore for %d volumes?", len(items)))
+				ok, err := safety.Confirm(opts, os.Stdin, out, fmt.Sprintf("Apply restore for %d volumes?", len(items)))
 				if err != nil {
 					return err
 				}
@@ -145,25 +146,32 @@ func newRestoreVolumesCmd(stdout, stderr io.Writer) *cobra.Command {
 				if err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Restoring volume %s/%s (project %s)\n", i+1, len(items), pool, name, project)
+				result := restoreResult("volume", project, pool, name, name, filepath.Base(snapDir))
+				result.Path = snapDir
+				fmt.Fprintf(out, "[%d/%d] Restoring volume %s/%s (project %s)\n", i+1, len(items), pool, name, project)
 				if exists {
 					if skipExisting {
-						fmt.Fprintf(stdout, "[%d/%d] Skip existing %s/%s\n", i+1, len(items), pool, name)
+						fmt.Fprintf(out, "[%d/%d] Skip existing %s/%s\n", i+1, len(items), pool, name)
+						rw.add(result.skipped())
 						continue
 					}
 					if err := client.DeleteVolume(project, pool, name); err != nil {
 						return err
 					}
 				}
-				if err := vol.RestoreVolume(client, snapDir, project, pool, name, stdout); err != nil {
+				err = restoreResource(cmd, rw, result, func(progress io.Writer) error {
+					return vol.RestoreVolume(client, snapDir, project, pool, name, progress)
+				})
+				if err != nil {
 					return err
 				}
-				fmt.Fprintf(stdout, "[%d/%d] Done %s/%s\n", i+1, len(items), pool, name)
+				fmt.Fprintf(out, "[%d/%d] Done %s/%s\n", i+1, len(items), pool, name)
 			}
 			return nil
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
+	addResultOutputFlag(cmd, &format)
 	cmd.Flags().StringVar(&project, "project", "default", "Incus project")
 	cmd.Flags().StringVar(&version, "version", "", "Snapshot timestamp (default: latest per volume)")
 	cmd.Flags().BoolVar(&replace, "replace", false, "Replace existing volumes if they exist")
@@ -0,0 +1,220 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/output"
+)
+
+// opResult is the machine-readable outcome of backing up or restoring one
+// resource.
+type opResult struct {
+	// Event is set on NDJSON lines: "start" before work on a resource begins,
+	// "result" when it ends.
+	Event      string  `json:"event,omitempty"`
+	Operation  string  `json:"operation"` // backup|restore
+	Resource   string  `json:"resource"`  // e.g. instance/default/web
+	Type       string  `json:"type"`
+	Project    string  `json:"project,omitempty"`
+	Pool       string  `json:"pool,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	TargetName string  `json:"targetName,omitempty"`
+	Version    string  `json:"version,omitempty"`
+	Path       string  `json:"path,omitempty"`
+	SnapshotID string  `json:"snapshotID,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"`
+	SHA256     string  `json:"sha256,omitempty"`
+	Duration   float64 `json:"duration"` // seconds
+	Status     string  `json:"status"`   // ok|skipped|failed
+	Error      string  `json:"error,omitempty"`
+}
+
+// Result statuses.
+const (
+	resultOK      = "ok"
+	resultSkipped = "skipped"
+	resultFailed  = "failed"
+)
+
+func newOpResult(op, typ, project, pool, name string) opResult {
+	parts := []string{typ}
+	for _, p := range []string{project, pool, name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return opResult{Operation: op, Resource: strings.Join(parts, "/"), Type: typ, Project: project, Pool: pool, Name: name}
+}
+
+// withStored fills in what a backup wrote.
+func (r opResult) withStored(s manifest.Stored) opResult {
+	r.Version, r.Path, r.SnapshotID, r.Bytes, r.SHA256 = s.Version, s.Path, s.SnapshotID, s.Bytes, s.SHA256
+	return r
+}
+
+// skipped marks a resource left alone, e.g. because it already exists.
+func (r opResult) skipped() opResult {
+	r.Status = resultSkipped
+	return r
+}
+
+// finish sets the duration since start and the status for err.
+func (r opResult) finish(start time.Time, err error) opResult {
+	r.Duration = time.Since(start).Round(time.Millisecond).Seconds()
+	switch {
+	case err != nil:
+		r.Status, r.Error = resultFailed, err.Error()
+	case r.Status == "":
+		r.Status = resultOK
+	}
+	return r
+}
+
+// resultWriter reports opResults on stdout: a table, JSON array or YAML list
+// once the command ends, or one NDJSON event per line as work happens.
+type resultWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	format  string
+	results []opResult
+	// planned is set when a dry run rendered its plan on w.
+	planned bool
+}
+
+func addResultOutputFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output", "o", output.Table, "Output format: "+output.Formats+"|ndjson")
+}
+
+func newResultWriter(w io.Writer, format string) (*resultWriter, error) {
+	if format != "ndjson" {
+		var err error
+		if format, err = output.Check(format); err != nil {
+			return nil, err
+		}
+	}
+	return &resultWriter{w: w, format: format}, nil
+}
+
+// machine reports whether stdout carries JSON, so human text must go
+// elsewhere.
+func (rw *resultWriter) machine() bool { return rw.format != output.Table }
+
+// human returns where plans, prompts and other human text should go.
+func (rw *resultWriter) human(stdout, stderr io.Writer) io.Writer {
+	if rw.machine() {
+		return stderr
+	}
+	return stdout
+}
+
+func (rw *resultWriter) start(r opResult) {
+	if rw.format != "ndjson" {
+		return
+	}
+	r.Event = "start"
+	rw.emit(r)
+}
+
+func (rw *resultWriter) add(r opResult) {
+	rw.mu.Lock()
+	rw.results = append(rw.results, r)
+	rw.mu.Unlock()
+	if rw.format == "ndjson" {
+		r.Event = "result"
+		rw.emit(r)
+	}
+}
+
+func (rw *resultWriter) emit(r opResult) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	_ = json.NewEncoder(rw.w).Encode(r)
+}
+
+// flush writes the collected results unless they were streamed as NDJSON.
+func (rw *resultWriter) flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.format == "ndjson" || ((rw.format == output.Table || rw.planned) && len(rw.results) == 0) {
+		return nil
+	}
+	results := rw.results
+	if results == nil {
+		results = []opResult{}
+	}
+	return output.Render(rw.w, rw.format, results, func(w io.Writer) error {
+		t := output.NewTable(w, "RESOURCE", "VERSION", "BYTES", "DURATION", "STATUS")
+		for _, r := range results {
+			t.Row(r.Resource, r.Version, r.Bytes, time.Duration(r.Duration*float64(time.Second)).Round(time.Millisecond), r.Status)
+		}
+		return t.Flush()
+	})
+}
+
+// restorePlan is one resource in a restore preview.
+type restorePlan struct {
+	Action     string `json:"action"` // create|replace|skip|conflict
+	Type       string `json:"type"`
+	Project    string `json:"project"`
+	Pool       string `json:"pool,omitempty"`
+	Name       string `json:"name"`
+	TargetName string `json:"targetName,omitempty"`
+	Version    string `json:"version"`
+}
+
+// preview shows what a restore will do before it runs. Tables go to human.
+// With --output json or yaml the plan is rendered in that format instead:
+// on stdout for a dry run, in place of the empty results, and on human
+// (stderr) otherwise so stdout keeps only the results. NDJSON emits it as a
+// "plan" event.
+func (rw *resultWriter) preview(human io.Writer, dryRun bool, plan any, table func(io.Writer)) error {
+	switch rw.format {
+	case output.Table:
+		table(human)
+		return nil
+	case "ndjson":
+		rw.mu.Lock()
+		defer rw.mu.Unlock()
+		return json.NewEncoder(rw.w).Encode(struct {
+			Event string `json:"event"`
+			Plan  any    `json:"plan"`
+		}{"plan", plan})
+	}
+	w := human
+	if dryRun {
+		rw.mu.Lock()
+		rw.planned = true
+		rw.mu.Unlock()
+		w = rw.w
+	}
+	return output.Render(w, rw.format, plan, nil)
+}
+
+// restoreResource restores one resource with fn and reports the result. The
+// progress stream passed to fn logs with the resource's attributes.
+func restoreResource(cmd *cobra.Command, rw *resultWriter, r opResult, fn func(progress io.Writer) error) error {
+	attrs := []any{"type", r.Type, "project", r.Project}
+	if r.Pool != "" {
+		attrs = append(attrs, "pool", r.Pool)
+	}
+	attrs = append(attrs, "name", r.TargetName)
+	rw.start(r)
+	start := time.Now()
+	err := fn(opWriter(cmd, attrs...))
+	rw.add(r.finish(start, err))
+	return err
+}
+
+// restoreResult describes restoring name (as targetName) from version.
+func restoreResult(typ, project, pool, name, targetName, version string) opResult {
+	r := newOpResult("restore", typ, project, pool, name)
+	r.TargetName, r.Version = targetName, version
+	return r
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+    "errors"
     "fmt"
     "io"
     "os"
@@ -15,21 +16,41 @@ func NewRootCmd(stdout, stderr io.Writer) *cobra.Command {
         Short: "Back up and restore Incus instances, volumes, images, and config",
         SilenceUsage:  true,
         SilenceErrors: true,
+        PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+            if err := setupLogging(cmd, stderr); err != nil {
+                return err
+            }
+            return validateTargetMetadata(cmd)
+        },
     }
 
     cmd.SetOut(stdout)
     cmd.SetErr(stderr)
 
-    // Global flags (log level to be added later; safety flags now)
+    // Global flags
     addGlobalFlags(cmd)
+    addLogFlags(cmd)
+    addResticFlags(cmd)
+    addMetricsFlags(cmd)
 
     // Subcommands
     cmd.AddCommand(newVersionCmd(stdout))
+    cmd.AddCommand(newInitCmd(stdout, stderr))
     cmd.AddCommand(newListCmd(stdout, stderr))
     cmd.AddCommand(newBackupCmd(stdout, stderr))
     cmd.AddCommand(newRestoreCmd(stdout, stderr))
+    cmd.AddCommand(newDiffCmd(stdout, stderr))
+    cmd.AddCommand(newExtractCmd(stdout, stderr))
+    cmd.AddCommand(newMountCmd(stdout, stderr))
     cmd.AddCommand(newVerifyCmd(stdout, stderr))
     cmd.AddCommand(newPruneCmd(stdout, stderr))
+    cmd.AddCommand(newUnlockCmd(stdout, stderr))
+    cmd.AddCommand(newDoctorCmd(stdout, stderr))
+    cmd.AddCommand(newCopyCmd(stdout, stderr))
+    cmd.AddCommand(newDaemonCmd(stdout, stderr))
+    cmd.AddCommand(newDrillCmd(stdout, stderr))
+
+    instrumentMetrics(cmd)
 
     return cmd
 }
@@ -41,6 +62,11 @@ func Execute() int {
         // cobra already wrote the error to stderr if appropriate
         // return non-zero exit code
         fmt.Fprintln(os.Stderr, err)
+        // Errors may carry their own code, like diff's 2 for drift.
+        var coder interface{ ExitCode() int }
+        if errors.As(err, &coder) {
+            return coder.ExitCode()
+        }
         return 1
     }
     return 0
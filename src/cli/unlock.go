@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/restic"
+	"incus-backup/src/safety"
+	"incus-backup/src/target"
+	"incus-backup/src/util/flock"
+)
+
+type resticListLocksFunc func(context.Context, restic.BinaryInfo, string) ([]string, error)
+type resticUnlockFunc func(context.Context, restic.BinaryInfo, string, bool) error
+
+var listResticLocksFn resticListLocksFunc = restic.ListLocks
+var unlockResticFn resticUnlockFunc = restic.Unlock
+
+func newUnlockCmd(stdout, stderr io.Writer) *cobra.Command {
+	var removeAll bool
+	cmd := &cobra.Command{
+		Use:   "unlock",
+		Short: "Remove stale repository locks left by interrupted runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tgtStr, _ := cmd.Flags().GetString("target")
+			if tgtStr == "" {
+				return errors.New("--target is required (e.g., dir:/path)")
+			}
+			tgt, err := target.Parse(tgtStr)
+			if err != nil {
+				return err
+			}
+			opts := getSafetyOptions(cmd)
+			switch tgt.Scheme {
+			case "dir":
+				// Directory targets use kernel advisory locks that vanish with
+				// the holding process, so there is never anything stale.
+				path := filepath.Join(tgt.DirPath, dir.LockFile)
+				l, err := flock.TryLock(path, true, "")
+				if errors.Is(err, flock.ErrLocked) {
+					fmt.Fprintf(stdout, "Target %s is in use by a running incus-backup process: %v\n", tgt.DirPath, err)
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("check lock of %s: %w", tgt.DirPath, err)
+				}
+				_ = l.Unlock()
+				fmt.Fprintf(stdout, "Target %s is not locked\n", tgt.DirPath)
+				return nil
+			case "restic":
+				if removeAll && !opts.Force {
+					return errors.New("--all removes locks held by running processes; pass --force to confirm")
+				}
+				info, err := checkResticBinary(cmd, true)
+				if err != nil {
+					return err
+				}
+				ctx := cmd.Context()
+				if ctx == nil {
+					ctx = context.Background()
+				}
+				locks, err := listResticLocksFn(ctx, info, tgt.Value)
+				if err != nil {
+					return err
+				}
+				if len(locks) == 0 {
+					fmt.Fprintln(stdout, "No locks found")
+					return nil
+				}
+				fmt.Fprintf(stdout, "Found %d lock(s):\n", len(locks))
+				for _, id := range locks {
+					fmt.Fprintf(stdout, "  %s\n", id)
+				}
+				if opts.DryRun {
+					return nil
+				}
+				question := "Remove stale locks (restic unlock)?"
+				if removeAll {
+					question = fmt.Sprintf("Remove ALL %d locks, including ones held by running processes?", len(locks))
+				}
+				ok, err := safety.Confirm(opts, os.Stdin, stdout, question)
+				if err != nil || !ok {
+					return err
+				}
+				if err := unlockResticFn(ctx, info, tgt.Value, removeAll); err != nil {
+					return err
+				}
+				remaining, err := listResticLocksFn(ctx, info, tgt.Value)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Removed %d lock(s); %d remaining\n", len(locks)-len(remaining), len(remaining))
+				return nil
+			default:
+				return fmt.Errorf("unlock: unsupported backend %s", tgt.Scheme)
+			}
+		},
+	}
+	cmd.Flags().String("target", "", "Backend target URI (e.g., restic:/path)")
+	cmd.Flags().BoolVar(&removeAll, "all", false, "Remove all locks, not only stale ones (requires --force)")
+	return cmd
+}
+
+// SetResticUnlockForTest stubs the lock listing and unlock helpers.
+func SetResticUnlockForTest(list resticListLocksFunc, unlock resticUnlockFunc) func() {
+	prevList, prevUnlock := listResticLocksFn, unlockResticFn
+	listResticLocksFn, unlockResticFn = list, unlock
+	return func() { listResticLocksFn, unlockResticFn = prevList, prevUnlock }
+}
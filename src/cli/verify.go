@@ -5,7 +5,6 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -16,14 +15,16 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"incus-backup/src/output"
 	"incus-backup/src/restic"
 	"incus-backup/src/target"
 )
 
 func newVerifyCmd(stdout, stderr io.Writer) *cobra.Command {
-	var output string
+	var format string
+	var deep bool
 	cmd := &cobra.Command{
-		Use:   "verify [all|instances|volumes|images|config]",
+		Use:   "verify [all|instances|volumes|buckets|images|config]",
 		Short: "Verify checksums for snapshots in the target",
 		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -31,6 +32,10 @@ func newVerifyCmd(stdout, stderr io.Writer) *cobra.Command {
 			if len(args) == 1 {
 				kind = strings.ToLower(args[0])
 			}
+			format, err := output.Check(format)
+			if err != nil {
+				return err
+			}
 			tgtStr, _ := cmd.Flags().GetString("target")
 			if tgtStr == "" {
 				return errors.New("--target is required (e.g., dir:/path)")
@@ -41,15 +46,21 @@ func newVerifyCmd(stdout, stderr io.Writer) *cobra.Command {
 			}
 			switch tgt.Scheme {
 			case "dir":
-				if output == "json" {
-					// Collect then emit JSON to produce valid array output.
-					results, err := runVerifyDir(tgt.DirPath, kind)
+				if format != output.Table {
+					// Collect then encode to produce a valid document.
+					results, err := runVerifyDir(tgt.DirPath, kind, deep)
 					if err != nil {
 						return err
 					}
-					return encodeVerifyResultsJSON(stdout, results)
+					recordVerify(cmd, tgt, kind, results)
+					return output.Render(stdout, format, results, nil)
+				}
+				results, err := runVerifyDirStream(stdout, tgt.DirPath, kind, deep)
+				if err != nil {
+					return err
 				}
-				return runVerifyDirStream(stdout, tgt.DirPath, kind)
+				recordVerify(cmd, tgt, kind, results)
+				return nil
 			case "restic":
 				info, err := checkResticBinary(cmd, true)
 				if err != nil {
@@ -62,26 +73,23 @@ func newVerifyCmd(stdout, stderr io.Writer) *cobra.Command {
 				if err := restic.EnsureRepository(ctx, info, tgt.Value); err != nil {
 					return err
 				}
-				results, err := collectResticVerifyResults(ctx, info, tgt.Value, kind)
+				results, err := collectResticVerifyResults(ctx, info, tgt.Value, kind, deep)
 				if err != nil {
 					return err
 				}
-				switch output {
-				case "json":
-					return encodeVerifyResultsJSON(stdout, results)
-				case "table", "":
-					printVerifyTable(stdout, results)
+				recordVerify(cmd, tgt, kind, results)
+				return output.Render(stdout, format, results, func(w io.Writer) error {
+					printVerifyTable(w, results)
 					return nil
-				default:
-					return fmt.Errorf("unsupported --output: %s", output)
-				}
+				})
 			default:
 				return fmt.Errorf("verify: unsupported backend %s", tgt.Scheme)
 			}
 		},
 	}
 	cmd.Flags().String("target", "", "Backend target URI (e.g., dir:/path)")
-	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table|json")
+	addOutputFlag(cmd, &format)
+	cmd.Flags().BoolVar(&deep, "deep", false, "Also decompress each export, walk the tar and check backup/index.yaml against the manifest")
 	return cmd
 }
 
@@ -95,6 +103,7 @@ type verifyResult struct {
 	Status      string             `json:"status"`
 	Path        string             `json:"path"`
 	Files       []verifyFileResult `json:"files,omitempty"`
+	Deep        *verifyDeepResult  `json:"deep,omitempty"`
 }
 
 type verifyFileResult struct {
@@ -105,9 +114,9 @@ type verifyFileResult struct {
 	Error    string `json:"error,omitempty"`
 }
 
-func runVerify(root, kind string) ([]verifyResult, error) {
+func runVerify(root, kind string, deep bool) ([]verifyResult, error) {
 	var out []verifyResult
-	if err := walkSnapshots(root, kind, func(r verifyResult) { out = append(out, r) }); err != nil {
+	if err := walkSnapshots(root, kind, deep, func(r verifyResult) { out = append(out, r) }); err != nil {
 		return nil, err
 	}
 	return out, nil
@@ -139,15 +148,15 @@ func renderFileDetail(f verifyFileResult) string {
 
 // runVerifyStreaming walks snapshots and calls cb for each result, allowing
 // callers to print progress incrementally.
-func runVerifyStreaming(root, kind string, cb func(verifyResult)) error {
-	return walkSnapshots(root, kind, cb)
+func runVerifyStreaming(root, kind string, deep bool, cb func(verifyResult)) error {
+	return walkSnapshots(root, kind, deep, cb)
 }
 
-func runVerifyDir(root, kind string) ([]verifyResult, error) {
-	return runVerify(root, kind)
+func runVerifyDir(root, kind string, deep bool) ([]verifyResult, error) {
+	return runVerify(root, kind, deep)
 }
 
-func runVerifyDirStream(stdout io.Writer, root, kind string) error {
+func runVerifyDirStream(stdout io.Writer, root, kind string, deep bool) ([]verifyResult, error) {
 	const (
 		wType = 8
 		wProj = 12
@@ -160,9 +169,12 @@ func runVerifyDirStream(stdout io.Writer, root, kind string) error {
 		wType, wProj, wPool, wName, wFP, wTS)
 	rowFmt := headerFmt
 	fmt.Fprintf(stdout, headerFmt, "TYPE", "PROJECT", "POOL", "NAME", "FINGERPRINT", "TIMESTAMP", "STATUS")
-	return runVerifyStreaming(root, kind, func(r verifyResult) {
+	var results []verifyResult
+	err := runVerifyStreaming(root, kind, deep, func(r verifyResult) {
 		printVerifyRow(stdout, rowFmt, r)
+		results = append(results, r)
 	})
+	return results, err
 }
 
 func printVerifyTable(stdout io.Writer, results []verifyResult) {
@@ -189,15 +201,12 @@ func printVerifyRow(w io.Writer, rowFmt string, r verifyResult) {
 	for _, file := range r.Files {
 		fmt.Fprintf(w, "    - %s: %s\n", file.Name, renderFileDetail(file))
 	}
+	if r.Deep != nil {
+		fmt.Fprintf(w, "    - deep: %s\n", renderDeepDetail(r.Deep))
+	}
 }
 
-func encodeVerifyResultsJSON(out io.Writer, results []verifyResult) error {
-	enc := json.NewEncoder(out)
-	enc.SetIndent("", "  ")
-	return enc.Encode(results)
-}
-
-func walkSnapshots(root, kind string, cb func(verifyResult)) error {
+func walkSnapshots(root, kind string, deep bool, cb func(verifyResult)) error {
 	if kind == "all" || kind == "instances" {
 		instBase := filepath.Join(root, "instances")
 		for _, project := range sortedVisibleDirs(instBase) {
@@ -207,7 +216,11 @@ func walkSnapshots(root, kind string, cb func(verifyResult)) error {
 				for _, ts := range sortedVisibleDirs(snapPath) {
 					dir := filepath.Join(snapPath, ts)
 					status, files := verifySnapshotDir(dir)
-					cb(verifyResult{Type: "instance", Project: project, Name: name, Timestamp: ts, Status: status, Path: dir, Files: files})
+					res := verifyResult{Type: "instance", Project: project, Name: name, Timestamp: ts, Status: status, Path: dir, Files: files}
+					if deep {
+						applyDeep(&res, deepVerifyDir("instance", dir))
+					}
+					cb(res)
 				}
 			}
 		}
@@ -223,7 +236,30 @@ func walkSnapshots(root, kind string, cb func(verifyResult)) error {
 					for _, ts := range sortedVisibleDirs(namePath) {
 						dir := filepath.Join(namePath, ts)
 						status, files := verifySnapshotDir(dir)
-						cb(verifyResult{Type: "volume", Project: project, Pool: pool, Name: name, Timestamp: ts, Status: status, Path: dir, Files: files})
+						res := verifyResult{Type: "volume", Project: project, Pool: pool, Name: name, Timestamp: ts, Status: status, Path: dir, Files: files}
+						if deep {
+							applyDeep(&res, deepVerifyDir("volume", dir))
+						}
+						cb(res)
+					}
+				}
+			}
+		}
+	}
+	if kind == "all" || kind == "buckets" {
+		// Bucket exports carry no instance or volume index, so --deep does
+		// not apply to them.
+		bktBase := filepath.Join(root, "buckets")
+		for _, project := range sortedVisibleDirs(bktBase) {
+			projPath := filepath.Join(bktBase, project)
+			for _, pool := range sortedVisibleDirs(projPath) {
+				poolPath := filepath.Join(projPath, pool)
+				for _, name := range sortedVisibleDirs(poolPath) {
+					namePath := filepath.Join(poolPath, name)
+					for _, ts := range sortedVisibleDirs(namePath) {
+						dir := filepath.Join(namePath, ts)
+						status, files := verifySnapshotDir(dir)
+						cb(verifyResult{Type: "bucket", Project: project, Pool: pool, Name: name, Timestamp: ts, Status: status, Path: dir, Files: files})
 					}
 				}
 			}
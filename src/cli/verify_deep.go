@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/restic"
+)
+
+// verifyDeepResult reports the structural check of an export tarball.
+type verifyDeepResult struct {
+	Status      string   `json:"status"` // ok|invalid|error
+	Compression string   `json:"compression,omitempty"`
+	IndexName   string   `json:"indexName,omitempty"`
+	IndexType   string   `json:"indexType,omitempty"`
+	Entries     int      `json:"entries"`
+	DataFiles   int      `json:"dataFiles"`
+	DataBytes   int64    `json:"dataBytes"`
+	Problems    []string `json:"problems,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// deepManifest is the subset of instance/volume manifests compared to index.yaml.
+type deepManifest struct {
+	Type    string `json:"type"`
+	Project string `json:"project"`
+	Name    string `json:"name"`
+	Source  *struct {
+		InstanceType string `json:"instanceType"`
+	} `json:"source"`
+}
+
+// deepVerify inspects an export stream and compares its index to manifest.
+func deepVerify(kind string, manifestData []byte, export io.Reader) *verifyDeepResult {
+	var mf deepManifest
+	if err := json.Unmarshal(manifestData, &mf); err != nil {
+		return &verifyDeepResult{Status: "error", Error: fmt.Sprintf("parse manifest.json: %v", err)}
+	}
+	sum, err := archive.Inspect(export)
+	res := &verifyDeepResult{
+		Compression: sum.Compression,
+		Entries:     sum.Entries,
+		DataFiles:   sum.DataFiles,
+		DataBytes:   sum.DataBytes,
+	}
+	if sum.Index != nil {
+		res.IndexName = sum.Index.Name
+		res.IndexType = sum.Index.Type
+	}
+	if err != nil {
+		res.Status = "error"
+		res.Error = err.Error()
+		return res
+	}
+	// v1 manifests carry no type; the entry's location already implies it.
+	if mf.Type != "" && mf.Type != kind {
+		res.Problems = append(res.Problems, fmt.Sprintf("manifest type %q does not match %s backup", mf.Type, kind))
+	}
+	res.Problems = append(res.Problems, sum.Index.CheckAgainst(kind, mf.Project, mf.Name)...)
+	if kind == "instance" && mf.Source != nil && mf.Source.InstanceType != "" && mf.Source.InstanceType != sum.Index.Type {
+		res.Problems = append(res.Problems, fmt.Sprintf("index type %q does not match manifest instance type %q", sum.Index.Type, mf.Source.InstanceType))
+	}
+	if len(res.Problems) > 0 {
+		res.Status = "invalid"
+	} else {
+		res.Status = "ok"
+	}
+	return res
+}
+
+// deepVerifyDir runs the deep check against a directory-backend snapshot.
+func deepVerifyDir(kind, dir string) *verifyDeepResult {
+	dataFile := "export.tar.xz"
+	if kind == "volume" {
+		dataFile = "volume.tar.xz"
+	}
+	manifestData, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return &verifyDeepResult{Status: "error", Error: err.Error()}
+	}
+	f, err := os.Open(filepath.Join(dir, dataFile))
+	if err != nil {
+		return &verifyDeepResult{Status: "error", Error: err.Error()}
+	}
+	defer f.Close()
+	return deepVerify(kind, manifestData, f)
+}
+
+// deepVerifyRestic streams the data part out of restic and runs the deep check.
+func deepVerifyRestic(ctx context.Context, bin restic.BinaryInfo, repo, kind string, parts map[string]restic.Snapshot) *verifyDeepResult {
+	dataFile := "export.tar"
+	if kind == "volume" {
+		dataFile = "volume.tar"
+	}
+	manifestSnap, ok := parts["manifest"]
+	if !ok {
+		return &verifyDeepResult{Status: "error", Error: "manifest snapshot missing"}
+	}
+	dataSnap, ok := parts["data"]
+	if !ok {
+		return &verifyDeepResult{Status: "error", Error: "data snapshot missing"}
+	}
+	var manifestBuf bytes.Buffer
+	if err := dumpSnapshot(ctx, bin, repo, manifestSnap.ID, "manifest.json", &manifestBuf, nil); err != nil {
+		return &verifyDeepResult{Status: "error", Error: err.Error()}
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(dumpSnapshot(ctx, bin, repo, dataSnap.ID, dataFile, pw, nil))
+	}()
+	res := deepVerify(kind, manifestBuf.Bytes(), pr)
+	// Unblock the dump if inspection stopped early.
+	pr.Close()
+	return res
+}
+
+// applyDeep attaches a deep result and downgrades an otherwise ok status.
+func applyDeep(r *verifyResult, deep *verifyDeepResult) {
+	r.Deep = deep
+	if r.Status == "ok" && deep.Status != "ok" {
+		r.Status = "invalid"
+	}
+}
+
+func renderDeepDetail(d *verifyDeepResult) string {
+	summary := fmt.Sprintf("index=%s/%s compression=%s files=%d bytes=%d", d.IndexType, d.IndexName, d.Compression, d.DataFiles, d.DataBytes)
+	switch {
+	case d.Error != "":
+		return fmt.Sprintf("%s (%s)", d.Status, d.Error)
+	case len(d.Problems) > 0:
+		return fmt.Sprintf("%s (%s) %s", d.Status, strings.Join(d.Problems, "; "), summary)
+	default:
+		return d.Status + " " + summary
+	}
+}
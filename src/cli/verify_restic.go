@@ -21,7 +21,7 @@ type resticDumpFunc func(context.Context, restic.BinaryInfo, string, string, str
 var listSnapshotsRestic resticListSnapshotsFunc = restic.ListSnapshots
 var dumpSnapshot resticDumpFunc = restic.Dump
 
-func collectResticVerifyResults(ctx context.Context, bin restic.BinaryInfo, repo, kind string) ([]verifyResult, error) {
+func collectResticVerifyResults(ctx context.Context, bin restic.BinaryInfo, repo, kind string, deep bool) ([]verifyResult, error) {
 	var results []verifyResult
 	appendResults := func(items []verifyResult, err error) error {
 		if err != nil {
@@ -31,18 +31,24 @@ func collectResticVerifyResults(ctx context.Context, bin restic.BinaryInfo, repo
 		return nil
 	}
 	switch kind {
-	case backend.KindAll, "", backend.KindInstance, backend.KindVolume, backend.KindImage, backend.KindConfig:
+	case backend.KindAll, "", backend.KindInstance, backend.KindVolume, backend.KindBucket, backend.KindImage, backend.KindConfig:
 		// handled below
 	default:
 		return nil, fmt.Errorf("restic verify: unsupported kind %s", kind)
 	}
 	if kind == backend.KindAll || kind == "" || kind == backend.KindInstance {
-		if err := appendResults(verifyResticInstances(ctx, bin, repo)); err != nil {
+		if err := appendResults(verifyResticInstances(ctx, bin, repo, deep)); err != nil {
 			return nil, err
 		}
 	}
 	if kind == backend.KindAll || kind == "" || kind == backend.KindVolume {
-		if err := appendResults(verifyResticVolumes(ctx, bin, repo)); err != nil {
+		if err := appendResults(verifyResticPoolScoped(ctx, bin, repo, "volume", deep)); err != nil {
+			return nil, err
+		}
+	}
+	if kind == backend.KindAll || kind == "" || kind == backend.KindBucket {
+		// Bucket exports carry no index for --deep to check.
+		if err := appendResults(verifyResticPoolScoped(ctx, bin, repo, "bucket", false)); err != nil {
 			return nil, err
 		}
 	}
@@ -74,7 +80,7 @@ func collectResticVerifyResults(ctx context.Context, bin restic.BinaryInfo, repo
 	return results, nil
 }
 
-func verifyResticInstances(ctx context.Context, bin restic.BinaryInfo, repo string) ([]verifyResult, error) {
+func verifyResticInstances(ctx context.Context, bin restic.BinaryInfo, repo string, deep bool) ([]verifyResult, error) {
 	snaps, err := listSnapshotsRestic(ctx, bin, repo, []string{"type=instance"})
 	if err != nil {
 		return nil, err
@@ -84,8 +90,7 @@ func verifyResticInstances(ctx context.Context, bin restic.BinaryInfo, repo stri
 		tags := snap.TagMap()
 		project := tags["project"]
 		name := tags["name"]
-		part := tags["part"]
-		if project == "" || name == "" || part == "" {
+		if project == "" || name == "" || !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -103,7 +108,7 @@ func verifyResticInstances(ctx context.Context, bin restic.BinaryInfo, repo stri
 			}
 			groups[key] = grp
 		}
-		grp.parts[part] = snap
+		addResticParts(grp.parts, snap)
 	}
 	var keys []string
 	for k := range groups {
@@ -120,13 +125,17 @@ func verifyResticInstances(ctx context.Context, bin restic.BinaryInfo, repo stri
 		if dataSnap, ok := grp.parts["data"]; ok {
 			res.Path = dataSnap.ID
 		}
+		if deep {
+			applyDeep(&res, deepVerifyRestic(ctx, bin, repo, "instance", grp.parts))
+		}
 		results = append(results, res)
 	}
 	return results, nil
 }
 
-func verifyResticVolumes(ctx context.Context, bin restic.BinaryInfo, repo string) ([]verifyResult, error) {
-	snaps, err := listSnapshotsRestic(ctx, bin, repo, []string{"type=volume"})
+// verifyResticPoolScoped verifies the volume or bucket versions of typ.
+func verifyResticPoolScoped(ctx context.Context, bin restic.BinaryInfo, repo, typ string, deep bool) ([]verifyResult, error) {
+	snaps, err := listSnapshotsRestic(ctx, bin, repo, []string{"type=" + typ})
 	if err != nil {
 		return nil, err
 	}
@@ -136,8 +145,7 @@ func verifyResticVolumes(ctx context.Context, bin restic.BinaryInfo, repo string
 		project := tags["project"]
 		pool := tags["pool"]
 		name := tags["name"]
-		part := tags["part"]
-		if project == "" || pool == "" || name == "" || part == "" {
+		if project == "" || pool == "" || name == "" || !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -156,7 +164,7 @@ func verifyResticVolumes(ctx context.Context, bin restic.BinaryInfo, repo string
 			}
 			groups[key] = grp
 		}
-		grp.parts[part] = snap
+		addResticParts(grp.parts, snap)
 	}
 	var keys []string
 	for k := range groups {
@@ -166,13 +174,16 @@ func verifyResticVolumes(ctx context.Context, bin restic.BinaryInfo, repo string
 	var results []verifyResult
 	for _, k := range keys {
 		grp := groups[k]
-		res := verifyResult{Type: "volume", Project: grp.Project, Pool: grp.Pool, Name: grp.Name, Timestamp: grp.ts}
+		res := verifyResult{Type: typ, Project: grp.Project, Pool: grp.Pool, Name: grp.Name, Timestamp: grp.ts}
 		files, status := verifyVolumeGroup(ctx, bin, repo, grp)
 		res.Files = files
 		res.Status = status
 		if dataSnap, ok := grp.parts["data"]; ok {
 			res.Path = dataSnap.ID
 		}
+		if deep {
+			applyDeep(&res, deepVerifyRestic(ctx, bin, repo, "volume", grp.parts))
+		}
 		results = append(results, res)
 	}
 	return results, nil
@@ -186,8 +197,7 @@ func verifyResticConfig(ctx context.Context, bin restic.BinaryInfo, repo string)
 	groups := make(map[string]*resticConfigGroup)
 	for _, snap := range snaps {
 		tags := snap.TagMap()
-		part := tags["part"]
-		if part == "" {
+		if !isResticBackupSnapshot(snap) {
 			continue
 		}
 		ts := tags["timestamp"]
@@ -199,7 +209,7 @@ func verifyResticConfig(ctx context.Context, bin restic.BinaryInfo, repo string)
 			grp = &resticConfigGroup{ts: ts, parts: map[string]restic.Snapshot{}}
 			groups[ts] = grp
 		}
-		grp.parts[part] = snap
+		addResticParts(grp.parts, snap)
 	}
 	var timestamps []string
 	for ts := range groups {
@@ -221,6 +231,22 @@ func verifyResticConfig(ctx context.Context, bin restic.BinaryInfo, repo string)
 	return results, nil
 }
 
+// addResticParts records snap under its part, or under every part when it is a
+// bundle. A bundle wins over legacy parts of the same version.
+func addResticParts(parts map[string]restic.Snapshot, snap restic.Snapshot) {
+	if part := snap.TagMap()["part"]; part != "" {
+		if existing, ok := parts[part]; !ok || !existing.IsBundle() {
+			parts[part] = snap
+		}
+		return
+	}
+	for _, part := range []string{"data", "manifest", "checksums", "projects", "profiles", "networks", "storage_pools",
+		"network_acls", "network_zones", "network_zone_records", "network_forwards", "network_load_balancers", "network_peers",
+		"server_config", "certificates", "cluster_groups"} {
+		parts[part] = snap
+	}
+}
+
 type resticInstanceGroup struct {
 	Project string
 	Name    string
@@ -443,7 +469,7 @@ func volumeFilePath(_, _, _, _, file string) string { return file }
 
 func volumePartForFile(file string) string {
 	switch file {
-	case "volume.tar":
+	case "volume.tar", "bucket.tar":
 		return "data"
 	case "manifest.json":
 		return "manifest"
@@ -466,6 +492,10 @@ func configPartForFile(file string) string {
 		return "networks"
 	case "storage_pools.json":
 		return "storage_pools"
+	case "network_acls.json", "network_zones.json", "network_zone_records.json",
+		"network_forwards.json", "network_load_balancers.json", "network_peers.json",
+		"server_config.json", "certificates.json", "cluster_groups.json":
+		return strings.TrimSuffix(file, ".json")
 	case "manifest.json":
 		return "manifest"
 	default:
@@ -475,7 +505,12 @@ func configPartForFile(file string) string {
 
 // CollectResticVerifyResultsForTest allows tests to inject fake restic behaviours.
 func CollectResticVerifyResultsForTest(ctx context.Context, bin restic.BinaryInfo, repo, kind string) ([]verifyResult, error) {
-	return collectResticVerifyResults(ctx, bin, repo, kind)
+	return collectResticVerifyResults(ctx, bin, repo, kind, false)
+}
+
+// CollectResticDeepVerifyResultsForTest runs restic verification with --deep enabled.
+func CollectResticDeepVerifyResultsForTest(ctx context.Context, bin restic.BinaryInfo, repo, kind string) ([]verifyResult, error) {
+	return collectResticVerifyResults(ctx, bin, repo, kind, true)
 }
 
 // SetResticVerifyListSnapshotsForTest stubs the list snapshots helper within tests.
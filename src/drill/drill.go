@@ -0,0 +1,275 @@
+package drill
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/incusapi"
+)
+
+// Selection modes for picking which backup version of each instance to drill.
+const (
+	SelectLatest = "latest"
+	SelectRandom = "random"
+)
+
+// Result statuses.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+)
+
+// Candidate identifies one instance backup version chosen for a drill.
+type Candidate struct {
+	Project   string
+	Name      string
+	Timestamp string
+	// Ref is the backend-specific reference (snapshot dir or restic snapshot ID).
+	Ref string
+}
+
+// RestoreFunc imports candidate c into project under targetName.
+type RestoreFunc func(c Candidate, project, targetName string) error
+
+// Options controls how a drill run behaves.
+type Options struct {
+	// ScratchProject is the temporary project created for the run and deleted afterwards.
+	ScratchProject string
+	// Start boots each restored instance before running the health command.
+	Start bool
+	// HealthCommand, when non-empty, is executed inside the started instance;
+	// a zero exit code marks the drill as passed.
+	HealthCommand []string
+	// HealthTimeout bounds how long exec is retried while the instance boots.
+	HealthTimeout time.Duration
+	Progress      io.Writer
+	Now           func() time.Time
+	Sleep         func(time.Duration)
+}
+
+// Result captures the outcome of drilling a single backup version.
+type Result struct {
+	Project         string    `json:"project"`
+	Name            string    `json:"name"`
+	Version         string    `json:"version"`
+	ScratchProject  string    `json:"scratchProject"`
+	TargetName      string    `json:"targetName"`
+	Restored        bool      `json:"restored"`
+	Started         bool      `json:"started"`
+	HealthExitCode  *int      `json:"healthExitCode,omitempty"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	StartedAt       time.Time `json:"startedAt"`
+	FinishedAt      time.Time `json:"finishedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// Report is the JSON document written at the end of a drill run.
+type Report struct {
+	Target         string    `json:"target"`
+	Selection      string    `json:"selection"`
+	ScratchProject string    `json:"scratchProject"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+	Passed         int       `json:"passed"`
+	Failed         int       `json:"failed"`
+	Results        []Result  `json:"results"`
+}
+
+// ScratchProjectName returns the default temporary project name for a run.
+func ScratchProjectName(now time.Time) string {
+	return "incus-backup-drill-" + strings.ToLower(now.UTC().Format("20060102T150405Z"))
+}
+
+// TargetName returns the name a drilled instance is restored under.
+func TargetName(name string) string { return name + "-drill" }
+
+// Select picks one backup version per instance from the listed entries.
+// When names is empty every instance in project is included. mode is either
+// SelectLatest or SelectRandom; rng is only consulted for random selection.
+func Select(entries []backend.Entry, project string, names []string, mode string, rng *rand.Rand) ([]Candidate, error) {
+	if mode == "" {
+		mode = SelectLatest
+	}
+	if mode != SelectLatest && mode != SelectRandom {
+		return nil, fmt.Errorf("unsupported selection %q (expected latest|random)", mode)
+	}
+	wanted := map[string]bool{}
+	for _, n := range names {
+		wanted[n] = true
+	}
+	versions := map[string][]backend.Entry{}
+	for _, e := range entries {
+		if e.Type != "instance" || e.Project != project {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[e.Name] {
+			continue
+		}
+		versions[e.Name] = append(versions[e.Name], e)
+	}
+	for n := range wanted {
+		if len(versions[n]) == 0 {
+			return nil, fmt.Errorf("no backups found for instance %s/%s", project, n)
+		}
+	}
+	var keys []string
+	for n := range versions {
+		keys = append(keys, n)
+	}
+	sort.Strings(keys)
+	out := make([]Candidate, 0, len(keys))
+	for _, n := range keys {
+		vs := versions[n]
+		sort.Slice(vs, func(i, j int) bool { return vs[i].Timestamp < vs[j].Timestamp })
+		pick := vs[len(vs)-1]
+		if mode == SelectRandom {
+			if rng == nil {
+				return nil, errors.New("random selection requires a random source")
+			}
+			pick = vs[rng.Intn(len(vs))]
+		}
+		out = append(out, Candidate{Project: pick.Project, Name: pick.Name, Timestamp: pick.Timestamp, Ref: pick.Path})
+	}
+	return out, nil
+}
+
+// Run restores each candidate into a scratch project, optionally starts it and
+// runs the health command, records pass/fail, and tears everything down.
+func Run(client incusapi.Client, candidates []Candidate, restore RestoreFunc, opts Options) Report {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	sleep := opts.Sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+	report := Report{ScratchProject: opts.ScratchProject, StartedAt: now().UTC()}
+
+	projectErr := client.CreateProject(opts.ScratchProject, scratchProjectConfig())
+	if projectErr == nil {
+		defer func() {
+			logf(opts.Progress, "[drill] delete project %s\n", opts.ScratchProject)
+			if err := client.DeleteProject(opts.ScratchProject); err != nil {
+				logf(opts.Progress, "[warn] delete project %s: %v\n", opts.ScratchProject, err)
+			}
+		}()
+	}
+
+	for i, c := range candidates {
+		logf(opts.Progress, "[%d/%d] Drilling instance %s/%s@%s\n", i+1, len(candidates), c.Project, c.Name, c.Timestamp)
+		var res Result
+		if projectErr != nil {
+			res = Result{Project: c.Project, Name: c.Name, Version: c.Timestamp, ScratchProject: opts.ScratchProject, TargetName: TargetName(c.Name), StartedAt: now().UTC()}
+			res.Error = fmt.Sprintf("create scratch project: %v", projectErr)
+			res.Status = StatusFail
+			res.FinishedAt = now().UTC()
+		} else {
+			res = drillOne(client, c, restore, opts, now, sleep)
+		}
+		logf(opts.Progress, "[%d/%d] %s %s/%s@%s\n", i+1, len(candidates), res.Status, c.Project, c.Name, c.Timestamp)
+		if res.Status == StatusPass {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Results = append(report.Results, res)
+	}
+	report.FinishedAt = now().UTC()
+	return report
+}
+
+func drillOne(client incusapi.Client, c Candidate, restore RestoreFunc, opts Options, now func() time.Time, sleep func(time.Duration)) (res Result) {
+	project := opts.ScratchProject
+	target := TargetName(c.Name)
+	res = Result{Project: c.Project, Name: c.Name, Version: c.Timestamp, ScratchProject: project, TargetName: target, StartedAt: now().UTC()}
+	defer func() {
+		res.FinishedAt = now().UTC()
+		res.DurationSeconds = res.FinishedAt.Sub(res.StartedAt).Seconds()
+		if res.Error == "" {
+			res.Status = StatusPass
+		} else {
+			res.Status = StatusFail
+		}
+	}()
+
+	if err := restore(c, project, target); err != nil {
+		res.Error = fmt.Sprintf("restore: %v", err)
+		// A partially imported instance may still exist; best-effort cleanup.
+		if exists, _ := client.InstanceExists(project, target); exists {
+			_ = client.DeleteInstance(project, target)
+		}
+		return res
+	}
+	res.Restored = true
+	defer func() {
+		logf(opts.Progress, "[drill] delete %s/%s\n", project, target)
+		_ = client.StopInstance(project, target, true)
+		if err := client.DeleteInstance(project, target); err != nil && res.Error == "" {
+			res.Error = fmt.Sprintf("teardown: %v", err)
+		}
+	}()
+
+	if !opts.Start {
+		return res
+	}
+	logf(opts.Progress, "[drill] start %s/%s\n", project, target)
+	if err := client.StartInstance(project, target); err != nil {
+		res.Error = fmt.Sprintf("start: %v", err)
+		return res
+	}
+	res.Started = true
+
+	if len(opts.HealthCommand) == 0 {
+		return res
+	}
+	code, err := execWithRetry(client, project, target, opts.HealthCommand, opts.HealthTimeout, now, sleep)
+	if err != nil {
+		res.Error = fmt.Sprintf("health command: %v", err)
+		return res
+	}
+	res.HealthExitCode = &code
+	if code != 0 {
+		res.Error = fmt.Sprintf("health command exited with code %d", code)
+	}
+	return res
+}
+
+// execWithRetry retries exec errors (e.g. the VM agent is not up yet) until
+// timeout elapses. A completed command with any exit code is returned as-is.
+func execWithRetry(client incusapi.Client, project, name string, command []string, timeout time.Duration, now func() time.Time, sleep func(time.Duration)) (int, error) {
+	deadline := now().Add(timeout)
+	for {
+		code, err := client.ExecInstance(project, name, command, nil, nil)
+		if err == nil {
+			return code, nil
+		}
+		if !now().Before(deadline) {
+			return -1, err
+		}
+		sleep(2 * time.Second)
+	}
+}
+
+// scratchProjectConfig shares profiles, images and custom volumes with the
+// default project so restored instances resolve the same references.
+func scratchProjectConfig() map[string]string {
+	return map[string]string{
+		"features.images":          "false",
+		"features.profiles":        "false",
+		"features.storage.volumes": "false",
+	}
+}
+
+func logf(w io.Writer, format string, args ...any) {
+	if w != nil {
+		fmt.Fprintf(w, format, args...)
+	}
+}
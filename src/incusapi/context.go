@@ -0,0 +1,87 @@
+package incusapi
+
+import (
+	"context"
+	"io"
+)
+
+// WithContext wraps client so export streams stop with ctx: once ctx is
+// cancelled the stream is closed and reads fail with ctx.Err(), letting the
+// backup return and run its cleanup (such as deleting the temporary
+// snapshot). Other calls are passed through unchanged.
+func WithContext(ctx context.Context, client Client) Client {
+	if ctx == nil || ctx.Done() == nil {
+		return client
+	}
+	return ctxClient{Client: client, ctx: ctx}
+}
+
+type ctxClient struct {
+	Client
+	ctx context.Context
+}
+
+func (c ctxClient) ExportInstance(project, name string, optimized bool, snapshot string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := c.Client.ExportInstance(project, name, optimized, snapshot, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return newCtxReader(c.ctx, rc), nil
+}
+
+func (c ctxClient) ExportVolume(project, pool, name string, optimized bool, snapshot string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := c.Client.ExportVolume(project, pool, name, optimized, snapshot, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return newCtxReader(c.ctx, rc), nil
+}
+
+func (c ctxClient) ExportBucket(project, pool, name string, compression string, progress io.Writer) (io.ReadCloser, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	rc, err := c.Client.ExportBucket(project, pool, name, compression, progress)
+	if err != nil {
+		return nil, err
+	}
+	return newCtxReader(c.ctx, rc), nil
+}
+
+type ctxReader struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop func() bool
+}
+
+func newCtxReader(ctx context.Context, rc io.ReadCloser) *ctxReader {
+	r := &ctxReader{ctx: ctx, rc: rc}
+	// Closing the stream unblocks a read waiting on the server.
+	r.stop = context.AfterFunc(ctx, func() { _ = rc.Close() })
+	return r
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.rc.Read(p)
+	if err != nil && r.ctx.Err() != nil {
+		return n, r.ctx.Err()
+	}
+	return n, err
+}
+
+func (r *ctxReader) Close() error {
+	if !r.stop() {
+		// AfterFunc already closed the stream.
+		return nil
+	}
+	return r.rc.Close()
+}
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"io"
 	"sort"
+	"strings"
 )
 
 // FakeClient is an in-memory implementation for unit tests.
 type FakeClient struct {
 	ServerVersionStr string
+	ServerArches     []string
 	ProjectsMap      map[string]Project
 	ProfilesMap      map[string]Profile
 	NetworksMap      map[string]Network
@@ -16,6 +18,33 @@ type FakeClient struct {
 	Instances        map[string]map[string][]byte            // project -> name -> export bytes
 	Snapshots        map[string]map[string]struct{}          // key: project/name@snap -> exists
 	Volumes          map[string]map[string]map[string][]byte // project -> pool -> name -> export bytes
+	Running          map[string]bool                         // key: project/name -> started
+	InstanceDetails  map[string]Instance                     // key: project/name -> GetInstance result
+	VolumeDetails    map[string]Volume                       // key: project/pool/name -> GetVolume result
+
+	NetworkACLsMap  map[string]NetworkACL
+	NetworkZonesMap map[string]NetworkZone
+	// Per-network and per-zone resources, keyed by network/listen-address,
+	// network/name and zone/name.
+	NetworkZoneRecordsMap   map[string]NetworkZoneRecord
+	NetworkForwardsMap      map[string]NetworkForward
+	NetworkLoadBalancersMap map[string]NetworkLoadBalancer
+	NetworkPeersMap         map[string]NetworkPeer
+
+	ServerConfig     map[string]string
+	CertificatesMap  map[string]Certificate // key: fingerprint
+	ClusterGroupsMap map[string]ClusterGroup
+
+	// Storage buckets, keyed by project/pool/name.
+	BucketsMap    map[string]Bucket
+	BucketData    map[string][]byte // export bytes
+	BucketKeysMap map[string][]BucketKey
+
+	// Instance files, keyed by project/name/path.
+	Files map[string]FakeFile
+
+	// ExecFunc, when set, handles ExecInstance calls; otherwise exec succeeds with code 0.
+	ExecFunc func(project, name string, command []string) (int, error)
 }
 
 func NewFake() *FakeClient {
@@ -27,11 +56,113 @@ func NewFake() *FakeClient {
 		Instances:       map[string]map[string][]byte{},
 		Snapshots:       map[string]map[string]struct{}{},
 		Volumes:         map[string]map[string]map[string][]byte{},
+		Running:         map[string]bool{},
+		InstanceDetails: map[string]Instance{},
+		VolumeDetails:   map[string]Volume{},
+
+		NetworkACLsMap:          map[string]NetworkACL{},
+		NetworkZonesMap:         map[string]NetworkZone{},
+		NetworkZoneRecordsMap:   map[string]NetworkZoneRecord{},
+		NetworkForwardsMap:      map[string]NetworkForward{},
+		NetworkLoadBalancersMap: map[string]NetworkLoadBalancer{},
+		NetworkPeersMap:         map[string]NetworkPeer{},
+
+		ServerConfig:     map[string]string{},
+		CertificatesMap:  map[string]Certificate{},
+		ClusterGroupsMap: map[string]ClusterGroup{},
+
+		BucketsMap:    map[string]Bucket{},
+		BucketData:    map[string][]byte{},
+		BucketKeysMap: map[string][]BucketKey{},
+
+		Files: map[string]FakeFile{},
 	}
 }
 
 func (f *FakeClient) Server() (ServerInfo, error) {
-	return ServerInfo{ServerVersion: f.ServerVersionStr}, nil
+	return ServerInfo{ServerVersion: f.ServerVersionStr, Architectures: f.ServerArches}, nil
+}
+
+func (f *FakeClient) GetServerConfig() (map[string]string, error) {
+	out := make(map[string]string, len(f.ServerConfig))
+	for k, v := range f.ServerConfig {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (f *FakeClient) UpdateServerConfig(config map[string]string) error {
+	f.ServerConfig = make(map[string]string, len(config))
+	for k, v := range config {
+		f.ServerConfig[k] = v
+	}
+	return nil
+}
+
+func (f *FakeClient) ListCertificates() ([]Certificate, error) {
+	out := make([]Certificate, 0, len(f.CertificatesMap))
+	for _, c := range f.CertificatesMap {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out, nil
+}
+
+func (f *FakeClient) CreateCertificate(c Certificate) error {
+	if _, ok := f.CertificatesMap[c.Fingerprint]; ok {
+		return &ConflictError{Resource: "certificate", Name: c.Fingerprint}
+	}
+	f.CertificatesMap[c.Fingerprint] = c
+	return nil
+}
+
+func (f *FakeClient) UpdateCertificate(c Certificate) error {
+	if _, ok := f.CertificatesMap[c.Fingerprint]; !ok {
+		return &NotFoundError{Resource: "certificate", Name: c.Fingerprint}
+	}
+	f.CertificatesMap[c.Fingerprint] = c
+	return nil
+}
+
+func (f *FakeClient) DeleteCertificate(fingerprint string) error {
+	if _, ok := f.CertificatesMap[fingerprint]; !ok {
+		return &NotFoundError{Resource: "certificate", Name: fingerprint}
+	}
+	delete(f.CertificatesMap, fingerprint)
+	return nil
+}
+
+func (f *FakeClient) ListClusterGroups() ([]ClusterGroup, error) {
+	out := make([]ClusterGroup, 0, len(f.ClusterGroupsMap))
+	for _, g := range f.ClusterGroupsMap {
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *FakeClient) CreateClusterGroup(g ClusterGroup) error {
+	if _, ok := f.ClusterGroupsMap[g.Name]; ok {
+		return &ConflictError{Resource: "cluster_group", Name: g.Name}
+	}
+	f.ClusterGroupsMap[g.Name] = g
+	return nil
+}
+
+func (f *FakeClient) UpdateClusterGroup(g ClusterGroup) error {
+	if _, ok := f.ClusterGroupsMap[g.Name]; !ok {
+		return &NotFoundError{Resource: "cluster_group", Name: g.Name}
+	}
+	f.ClusterGroupsMap[g.Name] = g
+	return nil
+}
+
+func (f *FakeClient) DeleteClusterGroup(name string) error {
+	if _, ok := f.ClusterGroupsMap[name]; !ok {
+		return &NotFoundError{Resource: "cluster_group", Name: name}
+	}
+	delete(f.ClusterGroupsMap, name)
+	return nil
 }
 
 func (f *FakeClient) ListProjects() ([]Project, error) {
@@ -90,6 +221,30 @@ func (f *FakeClient) ListProfiles() ([]Profile, error) {
 	return out, nil
 }
 
+func (f *FakeClient) CreateProfile(p Profile) error {
+	if _, ok := f.ProfilesMap[p.Name]; ok {
+		return &ConflictError{Resource: "profile", Name: p.Name}
+	}
+	f.ProfilesMap[p.Name] = p
+	return nil
+}
+
+func (f *FakeClient) UpdateProfile(p Profile) error {
+	if _, ok := f.ProfilesMap[p.Name]; !ok {
+		return &NotFoundError{Resource: "profile", Name: p.Name}
+	}
+	f.ProfilesMap[p.Name] = p
+	return nil
+}
+
+func (f *FakeClient) DeleteProfile(name string) error {
+	if _, ok := f.ProfilesMap[name]; !ok {
+		return &NotFoundError{Resource: "profile", Name: name}
+	}
+	delete(f.ProfilesMap, name)
+	return nil
+}
+
 func (f *FakeClient) ListNetworks() ([]Network, error) {
 	out := make([]Network, 0, len(f.NetworksMap))
 	for _, n := range f.NetworksMap {
@@ -128,6 +283,9 @@ func (f *FakeClient) DeleteNetwork(name string) error {
 	if _, ok := f.NetworksMap[name]; !ok {
 		return &NotFoundError{Resource: "network", Name: name}
 	}
+	if f.profileDeviceUses("network", name) || f.networkHasObjects(name) {
+		return &InUseError{Resource: "network", Name: name}
+	}
 	delete(f.NetworksMap, name)
 	return nil
 }
@@ -152,10 +310,258 @@ func (f *FakeClient) DeleteStoragePool(name string) error {
 	if _, ok := f.StoragePoolsMap[name]; !ok {
 		return &NotFoundError{Resource: "storage_pool", Name: name}
 	}
+	if f.profileDeviceUses("pool", name) {
+		return &InUseError{Resource: "storage_pool", Name: name}
+	}
 	delete(f.StoragePoolsMap, name)
 	return nil
 }
 
+func (f *FakeClient) ListNetworkACLs() ([]NetworkACL, error) {
+	out := make([]NetworkACL, 0, len(f.NetworkACLsMap))
+	for _, a := range f.NetworkACLsMap {
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkACL(a NetworkACL) error {
+	if _, ok := f.NetworkACLsMap[a.Name]; ok {
+		return &ConflictError{Resource: "network_acl", Name: a.Name}
+	}
+	f.NetworkACLsMap[a.Name] = a
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkACL(a NetworkACL) error {
+	if _, ok := f.NetworkACLsMap[a.Name]; !ok {
+		return &NotFoundError{Resource: "network_acl", Name: a.Name}
+	}
+	f.NetworkACLsMap[a.Name] = a
+	return nil
+}
+
+func (f *FakeClient) DeleteNetworkACL(name string) error {
+	if _, ok := f.NetworkACLsMap[name]; !ok {
+		return &NotFoundError{Resource: "network_acl", Name: name}
+	}
+	if f.networkConfigUses(name, "security.acls") || f.profileDeviceUses("security.acls", name) {
+		return &InUseError{Resource: "network_acl", Name: name}
+	}
+	delete(f.NetworkACLsMap, name)
+	return nil
+}
+
+func (f *FakeClient) ListNetworkZones() ([]NetworkZone, error) {
+	out := make([]NetworkZone, 0, len(f.NetworkZonesMap))
+	for _, z := range f.NetworkZonesMap {
+		out = append(out, z)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkZone(z NetworkZone) error {
+	if _, ok := f.NetworkZonesMap[z.Name]; ok {
+		return &ConflictError{Resource: "network_zone", Name: z.Name}
+	}
+	f.NetworkZonesMap[z.Name] = z
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkZone(z NetworkZone) error {
+	if _, ok := f.NetworkZonesMap[z.Name]; !ok {
+		return &NotFoundError{Resource: "network_zone", Name: z.Name}
+	}
+	f.NetworkZonesMap[z.Name] = z
+	return nil
+}
+
+// DeleteNetworkZone removes the zone and, like Incus, its records.
+func (f *FakeClient) DeleteNetworkZone(name string) error {
+	if _, ok := f.NetworkZonesMap[name]; !ok {
+		return &NotFoundError{Resource: "network_zone", Name: name}
+	}
+	if f.networkConfigUses(name, "dns.zone.forward", "dns.zone.reverse.ipv4", "dns.zone.reverse.ipv6") {
+		return &InUseError{Resource: "network_zone", Name: name}
+	}
+	delete(f.NetworkZonesMap, name)
+	for key, rec := range f.NetworkZoneRecordsMap {
+		if rec.Zone == name {
+			delete(f.NetworkZoneRecordsMap, key)
+		}
+	}
+	return nil
+}
+
+func (f *FakeClient) ListNetworkZoneRecords(zone string) ([]NetworkZoneRecord, error) {
+	if _, ok := f.NetworkZonesMap[zone]; !ok {
+		return nil, &NotFoundError{Resource: "network_zone", Name: zone}
+	}
+	var out []NetworkZoneRecord
+	for _, rec := range f.NetworkZoneRecordsMap {
+		if rec.Zone == zone {
+			out = append(out, rec)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkZoneRecord(r NetworkZoneRecord) error {
+	if _, ok := f.NetworkZonesMap[r.Zone]; !ok {
+		return &NotFoundError{Resource: "network_zone", Name: r.Zone}
+	}
+	key := r.Zone + "/" + r.Name
+	if _, ok := f.NetworkZoneRecordsMap[key]; ok {
+		return &ConflictError{Resource: "network_zone_record", Name: key}
+	}
+	f.NetworkZoneRecordsMap[key] = r
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkZoneRecord(r NetworkZoneRecord) error {
+	key := r.Zone + "/" + r.Name
+	if _, ok := f.NetworkZoneRecordsMap[key]; !ok {
+		return &NotFoundError{Resource: "network_zone_record", Name: key}
+	}
+	f.NetworkZoneRecordsMap[key] = r
+	return nil
+}
+
+func (f *FakeClient) DeleteNetworkZoneRecord(zone, name string) error {
+	key := zone + "/" + name
+	if _, ok := f.NetworkZoneRecordsMap[key]; !ok {
+		return &NotFoundError{Resource: "network_zone_record", Name: key}
+	}
+	delete(f.NetworkZoneRecordsMap, key)
+	return nil
+}
+
+func (f *FakeClient) ListNetworkForwards(network string) ([]NetworkForward, error) {
+	var out []NetworkForward
+	for _, fwd := range f.NetworkForwardsMap {
+		if fwd.Network == network {
+			out = append(out, fwd)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ListenAddress < out[j].ListenAddress })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkForward(fwd NetworkForward) error {
+	if _, ok := f.NetworksMap[fwd.Network]; !ok {
+		return &NotFoundError{Resource: "network", Name: fwd.Network}
+	}
+	key := fwd.Network + "/" + fwd.ListenAddress
+	if _, ok := f.NetworkForwardsMap[key]; ok {
+		return &ConflictError{Resource: "network_forward", Name: key}
+	}
+	f.NetworkForwardsMap[key] = fwd
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkForward(fwd NetworkForward) error {
+	key := fwd.Network + "/" + fwd.ListenAddress
+	if _, ok := f.NetworkForwardsMap[key]; !ok {
+		return &NotFoundError{Resource: "network_forward", Name: key}
+	}
+	f.NetworkForwardsMap[key] = fwd
+	return nil
+}
+
+func (f *FakeClient) DeleteNetworkForward(network, listenAddress string) error {
+	key := network + "/" + listenAddress
+	if _, ok := f.NetworkForwardsMap[key]; !ok {
+		return &NotFoundError{Resource: "network_forward", Name: key}
+	}
+	delete(f.NetworkForwardsMap, key)
+	return nil
+}
+
+func (f *FakeClient) ListNetworkLoadBalancers(network string) ([]NetworkLoadBalancer, error) {
+	var out []NetworkLoadBalancer
+	for _, lb := range f.NetworkLoadBalancersMap {
+		if lb.Network == network {
+			out = append(out, lb)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ListenAddress < out[j].ListenAddress })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkLoadBalancer(lb NetworkLoadBalancer) error {
+	if _, ok := f.NetworksMap[lb.Network]; !ok {
+		return &NotFoundError{Resource: "network", Name: lb.Network}
+	}
+	key := lb.Network + "/" + lb.ListenAddress
+	if _, ok := f.NetworkLoadBalancersMap[key]; ok {
+		return &ConflictError{Resource: "network_load_balancer", Name: key}
+	}
+	f.NetworkLoadBalancersMap[key] = lb
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkLoadBalancer(lb NetworkLoadBalancer) error {
+	key := lb.Network + "/" + lb.ListenAddress
+	if _, ok := f.NetworkLoadBalancersMap[key]; !ok {
+		return &NotFoundError{Resource: "network_load_balancer", Name: key}
+	}
+	f.NetworkLoadBalancersMap[key] = lb
+	return nil
+}
+
+func (f *FakeClient) DeleteNetworkLoadBalancer(network, listenAddress string) error {
+	key := network + "/" + listenAddress
+	if _, ok := f.NetworkLoadBalancersMap[key]; !ok {
+		return &NotFoundError{Resource: "network_load_balancer", Name: key}
+	}
+	delete(f.NetworkLoadBalancersMap, key)
+	return nil
+}
+
+func (f *FakeClient) ListNetworkPeers(network string) ([]NetworkPeer, error) {
+	var out []NetworkPeer
+	for _, p := range f.NetworkPeersMap {
+		if p.Network == network {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (f *FakeClient) CreateNetworkPeer(p NetworkPeer) error {
+	if _, ok := f.NetworksMap[p.Network]; !ok {
+		return &NotFoundError{Resource: "network", Name: p.Network}
+	}
+	key := p.Network + "/" + p.Name
+	if _, ok := f.NetworkPeersMap[key]; ok {
+		return &ConflictError{Resource: "network_peer", Name: key}
+	}
+	f.NetworkPeersMap[key] = p
+	return nil
+}
+
+func (f *FakeClient) UpdateNetworkPeer(p NetworkPeer) error {
+	key := p.Network + "/" + p.Name
+	if _, ok := f.NetworkPeersMap[key]; !ok {
+		return &NotFoundError{Resource: "network_peer", Name: key}
+	}
+	f.NetworkPeersMap[key] = p
+	return nil
+}
+
+func (f *FakeClient) DeleteNetworkPeer(network, name string) error {
+	key := network + "/" + name
+	if _, ok := f.NetworkPeersMap[key]; !ok {
+		return &NotFoundError{Resource: "network_peer", Name: key}
+	}
+	delete(f.NetworkPeersMap, key)
+	return nil
+}
+
 func (f *FakeClient) ListInstances(project string) ([]Instance, error) {
 	var out []Instance
 	if m, ok := f.Instances[project]; ok {
@@ -167,6 +573,16 @@ func (f *FakeClient) ListInstances(project string) ([]Instance, error) {
 	return out, nil
 }
 
+func (f *FakeClient) GetInstance(project, name string) (Instance, error) {
+	if _, ok := f.Instances[project][name]; !ok {
+		return Instance{}, &NotFoundError{Resource: "instance", Name: name}
+	}
+	if in, ok := f.InstanceDetails[project+"/"+name]; ok {
+		return in, nil
+	}
+	return Instance{Project: project, Name: name, Type: "container"}, nil
+}
+
 func (f *FakeClient) ExportInstance(project, name string, optimized bool, snapshot string, compression string, _ io.Writer) (io.ReadCloser, error) {
 	if f.Instances[project] == nil {
 		return io.NopCloser(bytes.NewReader([]byte(""))), nil
@@ -203,8 +619,59 @@ func (f *FakeClient) InstanceExists(project, name string) (bool, error) {
 	return ok, nil
 }
 
+func (f *FakeClient) StartInstance(project, name string) error {
+	if exists, _ := f.InstanceExists(project, name); !exists {
+		return &NotFoundError{Resource: "instance", Name: name}
+	}
+	f.Running[project+"/"+name] = true
+	return nil
+}
+
 func (f *FakeClient) StopInstance(project, name string, force bool) error {
-	// No-op in fake
+	delete(f.Running, project+"/"+name)
+	return nil
+}
+
+func (f *FakeClient) ExecInstance(project, name string, command []string, _, _ io.Writer) (int, error) {
+	if !f.Running[project+"/"+name] {
+		return -1, &NotFoundError{Resource: "running instance", Name: name}
+	}
+	if f.ExecFunc != nil {
+		return f.ExecFunc(project, name, command)
+	}
+	return 0, nil
+}
+
+// FakeFile is an instance file pushed to the fake.
+type FakeFile struct {
+	Type    string
+	UID     int64
+	GID     int64
+	Mode    int
+	Content []byte
+}
+
+func (f *FakeClient) InstanceFileExists(project, name, path string) (bool, error) {
+	if exists, _ := f.InstanceExists(project, name); !exists {
+		return false, &NotFoundError{Resource: "instance", Name: name}
+	}
+	_, ok := f.Files[project+"/"+name+path]
+	return ok, nil
+}
+
+func (f *FakeClient) PushInstanceFile(project, name string, file InstanceFile) error {
+	if exists, _ := f.InstanceExists(project, name); !exists {
+		return &NotFoundError{Resource: "instance", Name: name}
+	}
+	ff := FakeFile{Type: file.Type, UID: file.UID, GID: file.GID, Mode: file.Mode}
+	if file.Content != nil {
+		b, err := io.ReadAll(file.Content)
+		if err != nil {
+			return err
+		}
+		ff.Content = b
+	}
+	f.Files[project+"/"+name+file.Path] = ff
 	return nil
 }
 
@@ -266,6 +733,16 @@ func (f *FakeClient) VolumeExists(project, pool, name string) (bool, error) {
 	return ok, nil
 }
 
+func (f *FakeClient) GetVolume(project, pool, name string) (Volume, error) {
+	if _, ok := f.Volumes[project][pool][name]; !ok {
+		return Volume{}, &NotFoundError{Resource: "volume", Name: pool + "/" + name}
+	}
+	if v, ok := f.VolumeDetails[project+"/"+pool+"/"+name]; ok {
+		return v, nil
+	}
+	return Volume{Project: project, Pool: pool, Name: name, ContentType: "filesystem"}, nil
+}
+
 func (f *FakeClient) CreateVolumeSnapshot(project, pool, name, snapshot string) error { return nil }
 func (f *FakeClient) DeleteVolumeSnapshot(project, pool, name, snapshot string) error { return nil }
 
@@ -299,6 +776,89 @@ func (f *FakeClient) DeleteVolume(project, pool, name string) error {
 	return nil
 }
 
+// Storage buckets
+func (f *FakeClient) ListBuckets(project string) ([]Bucket, error) {
+	var out []Bucket
+	for _, b := range f.BucketsMap {
+		if b.Project == project {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Pool == out[j].Pool {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Pool < out[j].Pool
+	})
+	return out, nil
+}
+
+func (f *FakeClient) BucketExists(project, pool, name string) (bool, error) {
+	_, ok := f.BucketsMap[project+"/"+pool+"/"+name]
+	return ok, nil
+}
+
+func (f *FakeClient) GetBucket(project, pool, name string) (Bucket, error) {
+	b, ok := f.BucketsMap[project+"/"+pool+"/"+name]
+	if !ok {
+		return Bucket{}, &NotFoundError{Resource: "bucket", Name: pool + "/" + name}
+	}
+	return b, nil
+}
+
+func (f *FakeClient) ListBucketKeys(project, pool, name string) ([]BucketKey, error) {
+	key := project + "/" + pool + "/" + name
+	if _, ok := f.BucketsMap[key]; !ok {
+		return nil, &NotFoundError{Resource: "bucket", Name: pool + "/" + name}
+	}
+	return append([]BucketKey(nil), f.BucketKeysMap[key]...), nil
+}
+
+func (f *FakeClient) CreateBucketKey(project, pool, bucket string, k BucketKey) error {
+	key := project + "/" + pool + "/" + bucket
+	if _, ok := f.BucketsMap[key]; !ok {
+		return &NotFoundError{Resource: "bucket", Name: pool + "/" + bucket}
+	}
+	for _, existing := range f.BucketKeysMap[key] {
+		if existing.Name == k.Name {
+			return &ConflictError{Resource: "bucket key", Name: k.Name}
+		}
+	}
+	f.BucketKeysMap[key] = append(f.BucketKeysMap[key], k)
+	return nil
+}
+
+func (f *FakeClient) ExportBucket(project, pool, name string, compression string, _ io.Writer) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(f.BucketData[project+"/"+pool+"/"+name])), nil
+}
+
+// ImportBucket stores the export bytes; unlike Incus it does not restore
+// keys from the tarball.
+func (f *FakeClient) ImportBucket(project, poolTarget, nameTarget string, r io.Reader, _ io.Writer) error {
+	key := project + "/" + poolTarget + "/" + nameTarget
+	if _, ok := f.BucketsMap[key]; ok {
+		return &ConflictError{Resource: "bucket", Name: poolTarget + "/" + nameTarget}
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.BucketsMap[key] = Bucket{Project: project, Pool: poolTarget, Name: nameTarget}
+	f.BucketData[key] = b
+	return nil
+}
+
+func (f *FakeClient) DeleteBucket(project, pool, name string) error {
+	key := project + "/" + pool + "/" + name
+	if _, ok := f.BucketsMap[key]; !ok {
+		return &NotFoundError{Resource: "bucket", Name: pool + "/" + name}
+	}
+	delete(f.BucketsMap, key)
+	delete(f.BucketData, key)
+	delete(f.BucketKeysMap, key)
+	return nil
+}
+
 type ConflictError struct{ Resource, Name string }
 
 func (e *ConflictError) Error() string { return e.Resource + " conflict: " + e.Name }
@@ -306,3 +866,64 @@ func (e *ConflictError) Error() string { return e.Resource + " conflict: " + e.N
 type NotFoundError struct{ Resource, Name string }
 
 func (e *NotFoundError) Error() string { return e.Resource + " not found: " + e.Name }
+
+// InUseError is returned, as by Incus, when deleting an object that profiles,
+// networks or network objects still refer to.
+type InUseError struct{ Resource, Name string }
+
+func (e *InUseError) Error() string { return e.Resource + " is in use: " + e.Name }
+
+// profileDeviceUses reports whether a profile device has name in the
+// comma-separated list of key.
+func (f *FakeClient) profileDeviceUses(key, name string) bool {
+	for _, p := range f.ProfilesMap {
+		for _, dev := range p.Devices {
+			if listHas(dev[key], name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// networkConfigUses reports whether a network has name in one of keys.
+func (f *FakeClient) networkConfigUses(name string, keys ...string) bool {
+	for _, n := range f.NetworksMap {
+		for _, key := range keys {
+			if listHas(n.Config[key], name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// networkHasObjects reports whether forwards, load balancers or peers exist
+// on a network.
+func (f *FakeClient) networkHasObjects(network string) bool {
+	for _, fw := range f.NetworkForwardsMap {
+		if fw.Network == network {
+			return true
+		}
+	}
+	for _, lb := range f.NetworkLoadBalancersMap {
+		if lb.Network == network {
+			return true
+		}
+	}
+	for _, p := range f.NetworkPeersMap {
+		if p.Network == network {
+			return true
+		}
+	}
+	return false
+}
+
+func listHas(list, name string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.TrimSpace(v) == name {
+			return true
+		}
+	}
+	return false
+}
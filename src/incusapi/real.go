@@ -7,6 +7,7 @@ import (
 	"github.com/lxc/incus/shared/api"
 	"github.com/lxc/incus/shared/ioprogress"
 	"io"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -30,7 +31,110 @@ func (r *RealClient) Server() (ServerInfo, error) {
 	if err != nil {
 		return ServerInfo{}, err
 	}
-	return ServerInfo{ServerVersion: s.Environment.ServerVersion}, nil
+	return ServerInfo{
+		ServerVersion: s.Environment.ServerVersion,
+		APIVersion:    s.APIVersion,
+		Architectures: s.Environment.Architectures,
+	}, nil
+}
+
+func (r *RealClient) GetServerConfig() (map[string]string, error) {
+	s, _, err := r.c.GetServer()
+	if err != nil {
+		return nil, err
+	}
+	return s.Config, nil
+}
+
+func (r *RealClient) UpdateServerConfig(config map[string]string) error {
+	_, etag, err := r.c.GetServer()
+	if err != nil {
+		return err
+	}
+	return r.c.UpdateServer(api.ServerPut{Config: config}, etag)
+}
+
+func (r *RealClient) ListCertificates() ([]Certificate, error) {
+	certs, err := r.c.GetCertificates()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Certificate, 0, len(certs))
+	for _, c := range certs {
+		out = append(out, Certificate{
+			Fingerprint: c.Fingerprint,
+			Name:        c.Name,
+			Type:        c.Type,
+			Restricted:  c.Restricted,
+			Projects:    c.Projects,
+			Description: c.Description,
+			Certificate: c.Certificate,
+		})
+	}
+	return out, nil
+}
+
+func certificatePut(c Certificate) api.CertificatePut {
+	return api.CertificatePut{
+		Name:        c.Name,
+		Type:        c.Type,
+		Restricted:  c.Restricted,
+		Projects:    c.Projects,
+		Description: c.Description,
+		Certificate: c.Certificate,
+	}
+}
+
+func (r *RealClient) CreateCertificate(c Certificate) error {
+	return r.c.CreateCertificate(api.CertificatesPost{CertificatePut: certificatePut(c)})
+}
+
+func (r *RealClient) UpdateCertificate(c Certificate) error {
+	_, etag, err := r.c.GetCertificate(c.Fingerprint)
+	if err != nil {
+		return err
+	}
+	return r.c.UpdateCertificate(c.Fingerprint, certificatePut(c), etag)
+}
+
+func (r *RealClient) DeleteCertificate(fingerprint string) error {
+	return r.c.DeleteCertificate(fingerprint)
+}
+
+func (r *RealClient) ListClusterGroups() ([]ClusterGroup, error) {
+	if !r.c.IsClustered() {
+		return nil, nil
+	}
+	groups, err := r.c.GetClusterGroups()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ClusterGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, ClusterGroup{Name: g.Name, Description: g.Description, Members: g.Members})
+	}
+	return out, nil
+}
+
+func (r *RealClient) CreateClusterGroup(g ClusterGroup) error {
+	req := api.ClusterGroupsPost{
+		Name:            g.Name,
+		ClusterGroupPut: api.ClusterGroupPut{Description: g.Description, Members: g.Members},
+	}
+	return r.c.CreateClusterGroup(req)
+}
+
+func (r *RealClient) UpdateClusterGroup(g ClusterGroup) error {
+	_, etag, err := r.c.GetClusterGroup(g.Name)
+	if err != nil {
+		return err
+	}
+	put := api.ClusterGroupPut{Description: g.Description, Members: g.Members}
+	return r.c.UpdateClusterGroup(g.Name, put, etag)
+}
+
+func (r *RealClient) DeleteClusterGroup(name string) error {
+	return r.c.DeleteClusterGroup(name)
 }
 
 func (r *RealClient) ListProjects() ([]Project, error) {
@@ -84,6 +188,31 @@ func (r *RealClient) ListProfiles() ([]Profile, error) {
 	return out, nil
 }
 
+func (r *RealClient) CreateProfile(p Profile) error {
+	req := api.ProfilesPost{
+		Name: p.Name,
+		ProfilePut: api.ProfilePut{
+			Description: p.Description,
+			Config:      p.Config,
+			Devices:     convertDevices(p.Devices),
+		},
+	}
+	return r.c.CreateProfile(req)
+}
+
+func (r *RealClient) UpdateProfile(p Profile) error {
+	_, etag, err := r.c.GetProfile(p.Name)
+	if err != nil {
+		return err
+	}
+	put := api.ProfilePut{Description: p.Description, Config: p.Config, Devices: convertDevices(p.Devices)}
+	return r.c.UpdateProfile(p.Name, put, etag)
+}
+
+func (r *RealClient) DeleteProfile(name string) error {
+	return r.c.DeleteProfile(name)
+}
+
 func convertDevices(in map[string]map[string]string) map[string]map[string]string {
 	if in == nil {
 		return nil
@@ -184,6 +313,305 @@ func (r *RealClient) DeleteStoragePool(name string) error {
 	return r.c.DeleteStoragePool(name)
 }
 
+func (r *RealClient) ListNetworkACLs() ([]NetworkACL, error) {
+	acls, err := r.c.GetNetworkACLs()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkACL, 0, len(acls))
+	for _, a := range acls {
+		out = append(out, NetworkACL{
+			Name:        a.Name,
+			Description: a.Description,
+			Ingress:     convertACLRules(a.Ingress),
+			Egress:      convertACLRules(a.Egress),
+			Config:      a.Config,
+		})
+	}
+	return out, nil
+}
+
+func convertACLRules(in []api.NetworkACLRule) []NetworkACLRule {
+	if in == nil {
+		return nil
+	}
+	out := make([]NetworkACLRule, 0, len(in))
+	for _, rule := range in {
+		out = append(out, NetworkACLRule(rule))
+	}
+	return out
+}
+
+func apiACLRules(in []NetworkACLRule) []api.NetworkACLRule {
+	out := make([]api.NetworkACLRule, 0, len(in))
+	for _, rule := range in {
+		out = append(out, api.NetworkACLRule(rule))
+	}
+	return out
+}
+
+func (r *RealClient) CreateNetworkACL(a NetworkACL) error {
+	req := api.NetworkACLsPost{
+		NetworkACLPost: api.NetworkACLPost{Name: a.Name},
+		NetworkACLPut: api.NetworkACLPut{
+			Description: a.Description,
+			Ingress:     apiACLRules(a.Ingress),
+			Egress:      apiACLRules(a.Egress),
+			Config:      a.Config,
+		},
+	}
+	return r.c.CreateNetworkACL(req)
+}
+
+func (r *RealClient) UpdateNetworkACL(a NetworkACL) error {
+	_, etag, err := r.c.GetNetworkACL(a.Name)
+	if err != nil {
+		return err
+	}
+	put := api.NetworkACLPut{
+		Description: a.Description,
+		Ingress:     apiACLRules(a.Ingress),
+		Egress:      apiACLRules(a.Egress),
+		Config:      a.Config,
+	}
+	return r.c.UpdateNetworkACL(a.Name, put, etag)
+}
+
+func (r *RealClient) DeleteNetworkACL(name string) error {
+	return r.c.DeleteNetworkACL(name)
+}
+
+func (r *RealClient) ListNetworkZones() ([]NetworkZone, error) {
+	zones, err := r.c.GetNetworkZones()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkZone, 0, len(zones))
+	for _, z := range zones {
+		out = append(out, NetworkZone{Name: z.Name, Description: z.Description, Config: z.Config})
+	}
+	return out, nil
+}
+
+func (r *RealClient) CreateNetworkZone(z NetworkZone) error {
+	req := api.NetworkZonesPost{
+		Name:           z.Name,
+		NetworkZonePut: api.NetworkZonePut{Description: z.Description, Config: z.Config},
+	}
+	return r.c.CreateNetworkZone(req)
+}
+
+func (r *RealClient) UpdateNetworkZone(z NetworkZone) error {
+	_, etag, err := r.c.GetNetworkZone(z.Name)
+	if err != nil {
+		return err
+	}
+	put := api.NetworkZonePut{Description: z.Description, Config: z.Config}
+	return r.c.UpdateNetworkZone(z.Name, put, etag)
+}
+
+func (r *RealClient) DeleteNetworkZone(name string) error {
+	return r.c.DeleteNetworkZone(name)
+}
+
+func (r *RealClient) ListNetworkZoneRecords(zone string) ([]NetworkZoneRecord, error) {
+	records, err := r.c.GetNetworkZoneRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkZoneRecord, 0, len(records))
+	for _, rec := range records {
+		entries := make([]NetworkZoneRecordEntry, 0, len(rec.Entries))
+		for _, e := range rec.Entries {
+			entries = append(entries, NetworkZoneRecordEntry(e))
+		}
+		out = append(out, NetworkZoneRecord{
+			Zone:        zone,
+			Name:        rec.Name,
+			Description: rec.Description,
+			Entries:     entries,
+			Config:      rec.Config,
+		})
+	}
+	return out, nil
+}
+
+func apiZoneRecordPut(rec NetworkZoneRecord) api.NetworkZoneRecordPut {
+	entries := make([]api.NetworkZoneRecordEntry, 0, len(rec.Entries))
+	for _, e := range rec.Entries {
+		entries = append(entries, api.NetworkZoneRecordEntry(e))
+	}
+	return api.NetworkZoneRecordPut{Description: rec.Description, Entries: entries, Config: rec.Config}
+}
+
+func (r *RealClient) CreateNetworkZoneRecord(rec NetworkZoneRecord) error {
+	req := api.NetworkZoneRecordsPost{Name: rec.Name, NetworkZoneRecordPut: apiZoneRecordPut(rec)}
+	return r.c.CreateNetworkZoneRecord(rec.Zone, req)
+}
+
+func (r *RealClient) UpdateNetworkZoneRecord(rec NetworkZoneRecord) error {
+	_, etag, err := r.c.GetNetworkZoneRecord(rec.Zone, rec.Name)
+	if err != nil {
+		return err
+	}
+	return r.c.UpdateNetworkZoneRecord(rec.Zone, rec.Name, apiZoneRecordPut(rec), etag)
+}
+
+func (r *RealClient) DeleteNetworkZoneRecord(zone, name string) error {
+	return r.c.DeleteNetworkZoneRecord(zone, name)
+}
+
+func (r *RealClient) ListNetworkForwards(network string) ([]NetworkForward, error) {
+	fwds, err := r.c.GetNetworkForwards(network)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkForward, 0, len(fwds))
+	for _, f := range fwds {
+		ports := make([]NetworkForwardPort, 0, len(f.Ports))
+		for _, p := range f.Ports {
+			ports = append(ports, NetworkForwardPort(p))
+		}
+		out = append(out, NetworkForward{
+			Network:       network,
+			ListenAddress: f.ListenAddress,
+			Description:   f.Description,
+			Config:        f.Config,
+			Ports:         ports,
+		})
+	}
+	return out, nil
+}
+
+func apiForwardPut(f NetworkForward) api.NetworkForwardPut {
+	ports := make([]api.NetworkForwardPort, 0, len(f.Ports))
+	for _, p := range f.Ports {
+		ports = append(ports, api.NetworkForwardPort(p))
+	}
+	return api.NetworkForwardPut{Description: f.Description, Config: f.Config, Ports: ports}
+}
+
+func (r *RealClient) CreateNetworkForward(f NetworkForward) error {
+	req := api.NetworkForwardsPost{ListenAddress: f.ListenAddress, NetworkForwardPut: apiForwardPut(f)}
+	return r.c.CreateNetworkForward(f.Network, req)
+}
+
+func (r *RealClient) UpdateNetworkForward(f NetworkForward) error {
+	_, etag, err := r.c.GetNetworkForward(f.Network, f.ListenAddress)
+	if err != nil {
+		return err
+	}
+	return r.c.UpdateNetworkForward(f.Network, f.ListenAddress, apiForwardPut(f), etag)
+}
+
+func (r *RealClient) DeleteNetworkForward(network, listenAddress string) error {
+	return r.c.DeleteNetworkForward(network, listenAddress)
+}
+
+func (r *RealClient) ListNetworkLoadBalancers(network string) ([]NetworkLoadBalancer, error) {
+	lbs, err := r.c.GetNetworkLoadBalancers(network)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkLoadBalancer, 0, len(lbs))
+	for _, lb := range lbs {
+		backends := make([]NetworkLoadBalancerBackend, 0, len(lb.Backends))
+		for _, b := range lb.Backends {
+			backends = append(backends, NetworkLoadBalancerBackend(b))
+		}
+		ports := make([]NetworkLoadBalancerPort, 0, len(lb.Ports))
+		for _, p := range lb.Ports {
+			ports = append(ports, NetworkLoadBalancerPort(p))
+		}
+		out = append(out, NetworkLoadBalancer{
+			Network:       network,
+			ListenAddress: lb.ListenAddress,
+			Description:   lb.Description,
+			Config:        lb.Config,
+			Backends:      backends,
+			Ports:         ports,
+		})
+	}
+	return out, nil
+}
+
+func apiLoadBalancerPut(lb NetworkLoadBalancer) api.NetworkLoadBalancerPut {
+	backends := make([]api.NetworkLoadBalancerBackend, 0, len(lb.Backends))
+	for _, b := range lb.Backends {
+		backends = append(backends, api.NetworkLoadBalancerBackend(b))
+	}
+	ports := make([]api.NetworkLoadBalancerPort, 0, len(lb.Ports))
+	for _, p := range lb.Ports {
+		ports = append(ports, api.NetworkLoadBalancerPort(p))
+	}
+	return api.NetworkLoadBalancerPut{Description: lb.Description, Config: lb.Config, Backends: backends, Ports: ports}
+}
+
+func (r *RealClient) CreateNetworkLoadBalancer(lb NetworkLoadBalancer) error {
+	req := api.NetworkLoadBalancersPost{ListenAddress: lb.ListenAddress, NetworkLoadBalancerPut: apiLoadBalancerPut(lb)}
+	return r.c.CreateNetworkLoadBalancer(lb.Network, req)
+}
+
+func (r *RealClient) UpdateNetworkLoadBalancer(lb NetworkLoadBalancer) error {
+	_, etag, err := r.c.GetNetworkLoadBalancer(lb.Network, lb.ListenAddress)
+	if err != nil {
+		return err
+	}
+	return r.c.UpdateNetworkLoadBalancer(lb.Network, lb.ListenAddress, apiLoadBalancerPut(lb), etag)
+}
+
+func (r *RealClient) DeleteNetworkLoadBalancer(network, listenAddress string) error {
+	return r.c.DeleteNetworkLoadBalancer(network, listenAddress)
+}
+
+func (r *RealClient) ListNetworkPeers(network string) ([]NetworkPeer, error) {
+	peers, err := r.c.GetNetworkPeers(network)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NetworkPeer, 0, len(peers))
+	for _, p := range peers {
+		out = append(out, NetworkPeer{
+			Network:           network,
+			Name:              p.Name,
+			Description:       p.Description,
+			Config:            p.Config,
+			Type:              p.Type,
+			TargetProject:     p.TargetProject,
+			TargetNetwork:     p.TargetNetwork,
+			TargetIntegration: p.TargetIntegration,
+		})
+	}
+	return out, nil
+}
+
+func (r *RealClient) CreateNetworkPeer(p NetworkPeer) error {
+	req := api.NetworkPeersPost{
+		Name:              p.Name,
+		NetworkPeerPut:    api.NetworkPeerPut{Description: p.Description, Config: p.Config},
+		TargetProject:     p.TargetProject,
+		TargetNetwork:     p.TargetNetwork,
+		Type:              p.Type,
+		TargetIntegration: p.TargetIntegration,
+	}
+	return r.c.CreateNetworkPeer(p.Network, req)
+}
+
+// UpdateNetworkPeer updates description and config; the peer target cannot
+// be changed in place.
+func (r *RealClient) UpdateNetworkPeer(p NetworkPeer) error {
+	_, etag, err := r.c.GetNetworkPeer(p.Network, p.Name)
+	if err != nil {
+		return err
+	}
+	put := api.NetworkPeerPut{Description: p.Description, Config: p.Config}
+	return r.c.UpdateNetworkPeer(p.Network, p.Name, put, etag)
+}
+
+func (r *RealClient) DeleteNetworkPeer(network, name string) error {
+	return r.c.DeleteNetworkPeer(network, name)
+}
+
 func (r *RealClient) ListInstances(project string) ([]Instance, error) {
 	srv := r.c
 	if project != "" && project != "default" {
@@ -200,6 +628,27 @@ func (r *RealClient) ListInstances(project string) ([]Instance, error) {
 	return out, nil
 }
 
+func (r *RealClient) GetInstance(project, name string) (Instance, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	in, _, err := srv.GetInstance(name)
+	if err != nil {
+		return Instance{}, err
+	}
+	return Instance{
+		Project:         project,
+		Name:            in.Name,
+		Type:            in.Type,
+		Architecture:    in.Architecture,
+		Profiles:        in.Profiles,
+		Config:          in.Config,
+		Devices:         convertDevices(in.Devices),
+		ExpandedDevices: convertDevices(in.ExpandedDevices),
+	}, nil
+}
+
 func (r *RealClient) ExportInstance(project, name string, optimized bool, snapshot string, compression string, progressOut io.Writer) (io.ReadCloser, error) {
 	srv := r.c
 	if project != "" && project != "default" {
@@ -391,6 +840,73 @@ func (r *RealClient) InstanceExists(project, name string) (bool, error) {
 	return true, nil
 }
 
+func (r *RealClient) StartInstance(project, name string) error {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	put := api.InstanceStatePut{Action: "start", Timeout: 60}
+	op, err := srv.UpdateInstanceState(name, put, "")
+	if err != nil {
+		return err
+	}
+	return op.Wait()
+}
+
+func (r *RealClient) ExecInstance(project, name string, command []string, stdout, stderr io.Writer) (int, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	req := api.InstanceExecPost{Command: command, WaitForWS: true, Interactive: false}
+	dataDone := make(chan bool)
+	args := incuscli.InstanceExecArgs{Stdin: strings.NewReader(""), Stdout: stdout, Stderr: stderr, DataDone: dataDone}
+	op, err := srv.ExecInstance(name, req, &args)
+	if err != nil {
+		return -1, err
+	}
+	if err := op.Wait(); err != nil {
+		return -1, err
+	}
+	<-dataDone
+	ret, ok := op.Get().Metadata["return"].(float64)
+	if !ok {
+		return -1, errors.New("exec: missing return code in operation metadata")
+	}
+	return int(ret), nil
+}
+
+func (r *RealClient) InstanceFileExists(project, name, path string) (bool, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	content, _, err := srv.GetInstanceFile(name, path)
+	if err != nil {
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	_ = content.Close()
+	return true, nil
+}
+
+func (r *RealClient) PushInstanceFile(project, name string, f InstanceFile) error {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	args := incuscli.InstanceFileArgs{Content: f.Content, UID: f.UID, GID: f.GID, Mode: f.Mode, Type: f.Type, WriteMode: "overwrite"}
+	return srv.CreateInstanceFile(name, f.Path, args)
+}
+
 func (r *RealClient) StopInstance(project, name string, force bool) error {
 	srv := r.c
 	if project != "" && project != "default" {
@@ -486,6 +1002,18 @@ func (r *RealClient) VolumeExists(project, pool, name string) (bool, error) {
 	return true, nil
 }
 
+func (r *RealClient) GetVolume(project, pool, name string) (Volume, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	v, _, err := srv.GetStoragePoolVolume(pool, "custom", name)
+	if err != nil {
+		return Volume{}, err
+	}
+	return Volume{Project: project, Pool: pool, Name: v.Name, ContentType: v.ContentType, Config: v.Config}, nil
+}
+
 func (r *RealClient) CreateVolumeSnapshot(project, pool, name, snapshot string) error {
 	srv := r.c
 	if project != "" && project != "default" {
@@ -624,3 +1152,176 @@ func (r *RealClient) DeleteVolume(project, pool, name string) error {
 	}
 	return srv.DeleteStoragePoolVolume(pool, "custom", name)
 }
+
+// Storage buckets
+func (r *RealClient) ListBuckets(project string) ([]Bucket, error) {
+	if !r.c.HasExtension("storage_buckets") {
+		return nil, nil
+	}
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	pools, err := srv.GetStoragePools()
+	if err != nil {
+		return nil, err
+	}
+	var out []Bucket
+	for _, p := range pools {
+		buckets, err := srv.GetStoragePoolBuckets(p.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range buckets {
+			out = append(out, Bucket{Project: project, Pool: p.Name, Name: b.Name, Description: b.Description, Config: b.Config, S3URL: b.S3URL})
+		}
+	}
+	return out, nil
+}
+
+func (r *RealClient) BucketExists(project, pool, name string) (bool, error) {
+	_, err := r.GetBucket(project, pool, name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *RealClient) GetBucket(project, pool, name string) (Bucket, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	b, _, err := srv.GetStoragePoolBucket(pool, name)
+	if err != nil {
+		return Bucket{}, err
+	}
+	return Bucket{Project: project, Pool: pool, Name: b.Name, Description: b.Description, Config: b.Config, S3URL: b.S3URL}, nil
+}
+
+func (r *RealClient) ListBucketKeys(project, pool, name string) ([]BucketKey, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	keys, err := srv.GetStoragePoolBucketKeys(pool, name)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]BucketKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, BucketKey{Name: k.Name, Description: k.Description, Role: k.Role, AccessKey: k.AccessKey, SecretKey: k.SecretKey})
+	}
+	return out, nil
+}
+
+func (r *RealClient) CreateBucketKey(project, pool, bucket string, key BucketKey) error {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	_, err := srv.CreateStoragePoolBucketKey(pool, bucket, api.StorageBucketKeysPost{
+		Name: key.Name,
+		StorageBucketKeyPut: api.StorageBucketKeyPut{
+			Description: key.Description,
+			Role:        key.Role,
+			AccessKey:   key.AccessKey,
+			SecretKey:   key.SecretKey,
+		},
+	})
+	return err
+}
+
+func (r *RealClient) ExportBucket(project, pool, name string, compression string, progressOut io.Writer) (io.ReadCloser, error) {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	op, err := srv.CreateStoragePoolBucketBackup(pool, name, api.StorageBucketBackupsPost{CompressionAlgorithm: compression})
+	if err != nil {
+		return nil, err
+	}
+	if err := waitOperation(op, progressOut); err != nil {
+		return nil, err
+	}
+	resources := op.Get().Resources
+	if len(resources["backups"]) == 0 {
+		return nil, errors.New("no bucket backup resource returned")
+	}
+	backupURL := resources["backups"][0]
+	seg := backupURL[strings.LastIndex(backupURL, "/")+1:]
+	pipeR, pipeW := io.Pipe()
+	writer := &pipeWriteSeeker{PipeWriter: pipeW}
+	done := make(chan error, 1)
+	reqFile := incuscli.BackupFileRequest{BackupFile: writer}
+	if progressOut != nil {
+		reqFile.ProgressHandler = func(pd ioprogress.ProgressData) {
+			fmt.Fprintf(progressOut, "\r[download] %s", pd.Text)
+		}
+	}
+	go func() {
+		var err error
+		if _, err = srv.GetStoragePoolBucketBackupFile(pool, name, seg, &reqFile); err != nil {
+			writer.CloseWithError(err)
+		} else {
+			writer.Close()
+			if progressOut != nil {
+				fmt.Fprint(progressOut, "\n")
+			}
+		}
+		if bop, _ := srv.DeleteStoragePoolBucketBackup(pool, name, seg); bop != nil {
+			_ = bop.Wait()
+		}
+		done <- err
+	}()
+	return &streamReadCloser{PipeReader: pipeR, wait: func() error { return <-done }}, nil
+}
+
+func (r *RealClient) ImportBucket(project, poolTarget, nameTarget string, reader io.Reader, progressOut io.Writer) error {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	op, err := srv.CreateStoragePoolBucketFromBackup(poolTarget, incuscli.StoragePoolBucketBackupArgs{BackupFile: reader, Name: nameTarget})
+	if err != nil {
+		return err
+	}
+	return waitOperation(op, progressOut)
+}
+
+func (r *RealClient) DeleteBucket(project, pool, name string) error {
+	srv := r.c
+	if project != "" && project != "default" {
+		srv = srv.UseProject(project)
+	}
+	return srv.DeleteStoragePoolBucket(pool, name)
+}
+
+// waitOperation waits for op, echoing its status to progressOut when set.
+func waitOperation(op incuscli.Operation, progressOut io.Writer) error {
+	if progressOut == nil {
+		return op.Wait()
+	}
+	last := ""
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		_ = op.Refresh()
+		if st := op.Get().Status; st != "" && st != last {
+			fmt.Fprintf(progressOut, "\r[server] %s", st)
+			last = st
+		}
+		if err := op.Wait(); err == nil {
+			break
+		} else if op.Get().StatusCode.IsFinal() {
+			fmt.Fprint(progressOut, "\n")
+			return err
+		}
+		<-ticker.C
+	}
+	fmt.Fprint(progressOut, "\n")
+	return nil
+}
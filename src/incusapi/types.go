@@ -33,11 +33,121 @@ type StoragePool struct {
 	Config      map[string]string
 }
 
-// Instance captures minimal instance info.
+// NetworkACLRule is one ingress or egress rule of a network ACL.
+type NetworkACLRule struct {
+	Action          string
+	Source          string
+	Destination     string
+	Protocol        string
+	SourcePort      string
+	DestinationPort string
+	ICMPType        string
+	ICMPCode        string
+	Description     string
+	State           string
+}
+
+// NetworkACL captures a network ACL and its rules.
+type NetworkACL struct {
+	Name        string
+	Description string
+	Ingress     []NetworkACLRule
+	Egress      []NetworkACLRule
+	Config      map[string]string
+}
+
+// NetworkZone captures a DNS zone. Its records are listed separately.
+type NetworkZone struct {
+	Name        string
+	Description string
+	Config      map[string]string
+}
+
+// NetworkZoneRecordEntry is one DNS entry of a zone record.
+type NetworkZoneRecordEntry struct {
+	Type  string
+	TTL   uint64
+	Value string
+}
+
+// NetworkZoneRecord captures a record within a DNS zone.
+type NetworkZoneRecord struct {
+	Zone        string
+	Name        string
+	Description string
+	Entries     []NetworkZoneRecordEntry
+	Config      map[string]string
+}
+
+// NetworkForwardPort maps a listen port range to a target.
+type NetworkForwardPort struct {
+	Description   string
+	Protocol      string
+	ListenPort    string
+	TargetPort    string
+	TargetAddress string
+}
+
+// NetworkForward captures an address forward on a network, keyed by
+// Network and ListenAddress.
+type NetworkForward struct {
+	Network       string
+	ListenAddress string
+	Description   string
+	Config        map[string]string
+	Ports         []NetworkForwardPort
+}
+
+// NetworkLoadBalancerBackend is a target of a network load balancer.
+type NetworkLoadBalancerBackend struct {
+	Name          string
+	Description   string
+	TargetPort    string
+	TargetAddress string
+}
+
+// NetworkLoadBalancerPort maps a listen port range to backends.
+type NetworkLoadBalancerPort struct {
+	Description   string
+	Protocol      string
+	ListenPort    string
+	TargetBackend []string
+}
+
+// NetworkLoadBalancer captures a load balancer on a network, keyed by
+// Network and ListenAddress.
+type NetworkLoadBalancer struct {
+	Network       string
+	ListenAddress string
+	Description   string
+	Config        map[string]string
+	Backends      []NetworkLoadBalancerBackend
+	Ports         []NetworkLoadBalancerPort
+}
+
+// NetworkPeer captures a peering from Network to another network.
+type NetworkPeer struct {
+	Network           string
+	Name              string
+	Description       string
+	Config            map[string]string
+	Type              string // local|remote
+	TargetProject     string
+	TargetNetwork     string
+	TargetIntegration string
+}
+
+// Instance captures minimal instance info. The detail fields are only
+// populated by GetInstance.
 type Instance struct {
-	Project string
-	Name    string
-	Type    string // container|virtual-machine
+	Project         string
+	Name            string
+	Type            string // container|virtual-machine
+	Architecture    string
+	Profiles        []string
+	Config          map[string]string
+	Devices         map[string]map[string]string
+	ExpandedDevices map[string]map[string]string
 }
 
 // Volume captures minimal custom storage volume info.
@@ -46,11 +156,64 @@ type Volume struct {
 	Pool        string
 	Name        string
 	ContentType string // filesystem|block
+	Config      map[string]string
+}
+
+// Bucket captures an S3 storage bucket on a pool.
+type Bucket struct {
+	Project     string
+	Pool        string
+	Name        string
+	Description string
+	Config      map[string]string
+	S3URL       string
+}
+
+// BucketKey is an access key of a storage bucket.
+type BucketKey struct {
+	Name        string
+	Description string
+	Role        string // admin|read-only
+	AccessKey   string
+	SecretKey   string
 }
 
 // ServerInfo exposes key server metadata we care about.
 type ServerInfo struct {
 	ServerVersion string
+	APIVersion    string
+	Architectures []string
+}
+
+// Certificate is an entry of the server trust store.
+type Certificate struct {
+	Fingerprint string
+	Name        string
+	Type        string // client|metrics
+	Restricted  bool
+	Projects    []string
+	Description string
+	Certificate string // PEM
+}
+
+// ClusterGroup captures a named group of cluster members.
+type ClusterGroup struct {
+	Name        string
+	Description string
+	Members     []string
+}
+
+// InstanceFile is a file, directory or symlink written into an instance
+// through the file API.
+type InstanceFile struct {
+	Path string
+	Type string // file|directory|symlink
+	UID  int64
+	GID  int64
+	Mode int
+	// Content is the file content or the symlink target; unused for
+	// directories.
+	Content io.ReadSeeker
 }
 
 // Client is a narrow interface over the Incus API used by our app.
@@ -59,6 +222,19 @@ type Client interface {
 	// Server
 	Server() (ServerInfo, error)
 
+	// Server config, trust store and cluster groups. ListClusterGroups
+	// returns nothing on a standalone server.
+	GetServerConfig() (map[string]string, error)
+	UpdateServerConfig(config map[string]string) error
+	ListCertificates() ([]Certificate, error)
+	CreateCertificate(c Certificate) error
+	UpdateCertificate(c Certificate) error
+	DeleteCertificate(fingerprint string) error
+	ListClusterGroups() ([]ClusterGroup, error)
+	CreateClusterGroup(g ClusterGroup) error
+	UpdateClusterGroup(g ClusterGroup) error
+	DeleteClusterGroup(name string) error
+
 	// Projects
 	ListProjects() ([]Project, error)
 	CreateProject(name string, config map[string]string) error
@@ -67,6 +243,9 @@ type Client interface {
 
 	// Profiles
 	ListProfiles() ([]Profile, error)
+	CreateProfile(p Profile) error
+	UpdateProfile(p Profile) error
+	DeleteProfile(name string) error
 
 	// Networks
 	ListNetworks() ([]Network, error)
@@ -74,6 +253,36 @@ type Client interface {
 	UpdateNetwork(n Network) error
 	DeleteNetwork(name string) error
 
+	// Network ACLs
+	ListNetworkACLs() ([]NetworkACL, error)
+	CreateNetworkACL(a NetworkACL) error
+	UpdateNetworkACL(a NetworkACL) error
+	DeleteNetworkACL(name string) error
+
+	// Network zones and their records
+	ListNetworkZones() ([]NetworkZone, error)
+	CreateNetworkZone(z NetworkZone) error
+	UpdateNetworkZone(z NetworkZone) error
+	DeleteNetworkZone(name string) error
+	ListNetworkZoneRecords(zone string) ([]NetworkZoneRecord, error)
+	CreateNetworkZoneRecord(r NetworkZoneRecord) error
+	UpdateNetworkZoneRecord(r NetworkZoneRecord) error
+	DeleteNetworkZoneRecord(zone, name string) error
+
+	// Network forwards, load balancers and peers (per network)
+	ListNetworkForwards(network string) ([]NetworkForward, error)
+	CreateNetworkForward(f NetworkForward) error
+	UpdateNetworkForward(f NetworkForward) error
+	DeleteNetworkForward(network, listenAddress string) error
+	ListNetworkLoadBalancers(network string) ([]NetworkLoadBalancer, error)
+	CreateNetworkLoadBalancer(lb NetworkLoadBalancer) error
+	UpdateNetworkLoadBalancer(lb NetworkLoadBalancer) error
+	DeleteNetworkLoadBalancer(network, listenAddress string) error
+	ListNetworkPeers(network string) ([]NetworkPeer, error)
+	CreateNetworkPeer(p NetworkPeer) error
+	UpdateNetworkPeer(p NetworkPeer) error
+	DeleteNetworkPeer(network, name string) error
+
 	// Storage pools
 	ListStoragePools() ([]StoragePool, error)
 	CreateStoragePool(p StoragePool) error
@@ -82,6 +291,7 @@ type Client interface {
 
 	// Instances
 	ListInstances(project string) ([]Instance, error)
+	GetInstance(project, name string) (Instance, error)
 	// ExportInstance returns a tar stream of the instance export. If snapshot is non-empty,
 	// it should export from that snapshot. If optimized is true, use backend-optimized export.
 	// compression should be "" for the server default (usually xz) or "none" to disable compression.
@@ -92,18 +302,38 @@ type Client interface {
 
 	// Instance lifecycle helpers
 	InstanceExists(project, name string) (bool, error)
+	StartInstance(project, name string) error
 	StopInstance(project, name string, force bool) error
+	// ExecInstance runs command inside a running instance and returns its exit code.
+	// stdout/stderr may be nil to discard output.
+	ExecInstance(project, name string, command []string, stdout, stderr io.Writer) (int, error)
 	DeleteInstance(project, name string) error
 	// Snapshot lifecycle
 	CreateInstanceSnapshot(project, name, snapshot string) error
 	DeleteInstanceSnapshot(project, name, snapshot string) error
+	// Instance files
+	InstanceFileExists(project, name, path string) (bool, error)
+	// PushInstanceFile creates or overwrites a file in the instance.
+	PushInstanceFile(project, name string, f InstanceFile) error
 
 	// Volumes (custom)
 	ListCustomVolumes(project string) ([]Volume, error)
 	VolumeExists(project, pool, name string) (bool, error)
+	GetVolume(project, pool, name string) (Volume, error)
 	CreateVolumeSnapshot(project, pool, name, snapshot string) error
 	DeleteVolumeSnapshot(project, pool, name, snapshot string) error
 	ExportVolume(project, pool, name string, optimized bool, snapshot string, compression string, progress io.Writer) (io.ReadCloser, error)
 	ImportVolume(project, poolTarget, nameTarget string, r io.Reader, progress io.Writer) error
 	DeleteVolume(project, pool, name string) error
+
+	// Storage buckets
+	ListBuckets(project string) ([]Bucket, error)
+	BucketExists(project, pool, name string) (bool, error)
+	GetBucket(project, pool, name string) (Bucket, error)
+	ListBucketKeys(project, pool, name string) ([]BucketKey, error)
+	CreateBucketKey(project, pool, bucket string, key BucketKey) error
+	// ExportBucket streams a bucket backup tarball (contents and keys).
+	ExportBucket(project, pool, name string, compression string, progress io.Writer) (io.ReadCloser, error)
+	ImportBucket(project, poolTarget, nameTarget string, r io.Reader, progress io.Writer) error
+	DeleteBucket(project, pool, name string) error
 }
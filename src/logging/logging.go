@@ -0,0 +1,100 @@
+// Package logging sets up the structured (log/slog) logger and the separate
+// progress stream used by the CLI.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Options selects the log level and record format.
+type Options struct {
+	Level  string // debug|info|warn|error
+	Format string // text|json
+}
+
+// ParseLevel parses a --log-level value.
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unsupported --log-level: %s (use debug, info, warn or error)", s)
+	}
+}
+
+// New returns a logger writing records to w.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	ho := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, ho)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, ho)), nil
+	default:
+		return nil, fmt.Errorf("unsupported --log-format: %s (use text or json)", opts.Format)
+	}
+}
+
+// Discard is a logger that drops every record.
+var Discard = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// IsTerminal reports whether w is a character device such as a TTY.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+type loggerKey struct{}
+type progressKey struct{}
+
+// NewContext returns a context carrying the logger and progress stream.
+func NewContext(ctx context.Context, l *slog.Logger, progress io.Writer) context.Context {
+	ctx = context.WithValue(ctx, loggerKey{}, l)
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// FromContext returns the logger carried by ctx, or nil.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(loggerKey{}).(*slog.Logger)
+	return l
+}
+
+// ProgressFromContext returns the progress stream carried by ctx, or
+// io.Discard.
+func ProgressFromContext(ctx context.Context) io.Writer {
+	if ctx != nil {
+		if w, ok := ctx.Value(progressKey{}).(io.Writer); ok && w != nil {
+			return w
+		}
+	}
+	return io.Discard
+}
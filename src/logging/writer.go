@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Writer adapts the line-oriented output of backup and restore code (the
+// progressOut streams) to the logger. Lines such as "[snapshot] create
+// web@tmp" become records with a phase attribute; carriage-return progress
+// redraws go to the progress stream, and their final state is logged at debug
+// level.
+type Writer struct {
+	mu       sync.Mutex
+	log      *slog.Logger
+	progress io.Writer
+	buf      []byte
+	// shown is how much of a pending progress segment was already written.
+	shown int
+}
+
+// NewWriter returns a Writer logging to l and drawing progress on progress
+// (nil discards it).
+func NewWriter(l *slog.Logger, progress io.Writer) *Writer {
+	if l == nil {
+		l = Discard
+	}
+	if progress == nil {
+		progress = io.Discard
+	}
+	return &Writer{log: l, progress: progress}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, c := range p {
+		switch c {
+		case '\r':
+			w.flush(false)
+			w.buf = append(w.buf, '\r')
+		case '\n':
+			w.flush(true)
+		default:
+			w.buf = append(w.buf, c)
+		}
+	}
+	// Draw a progress update right away rather than on the next redraw.
+	if len(w.buf) > w.shown && w.isProgress() {
+		_, _ = w.progress.Write(w.buf[w.shown:])
+		w.shown = len(w.buf)
+	}
+	return len(p), nil
+}
+
+func (w *Writer) isProgress() bool { return len(w.buf) > 0 && w.buf[0] == '\r' }
+
+// flush ends the current segment; newline is true when it ended a line.
+func (w *Writer) flush(newline bool) {
+	defer func() { w.buf, w.shown = w.buf[:0], 0 }()
+	if w.isProgress() {
+		_, _ = w.progress.Write(w.buf[w.shown:])
+		if newline {
+			_, _ = w.progress.Write([]byte("\n"))
+			w.logLine(slog.LevelDebug, string(w.buf[1:]))
+		}
+		return
+	}
+	w.logLine(slog.LevelInfo, string(w.buf))
+}
+
+func (w *Writer) logLine(level slog.Level, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	var args []any
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "] "); end > 1 {
+			args = append(args, "phase", line[1:end])
+			line = line[end+2:]
+		}
+	}
+	w.log.Log(context.Background(), level, line, args...)
+}
@@ -0,0 +1,324 @@
+// Package metrics collects backup metrics and renders them in the Prometheus
+// text exposition format, either served on /metrics by the daemon or written
+// to a node_exporter textfile collector file after one-shot runs.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Labels identify one series of a metric.
+type Labels map[string]string
+
+type series struct {
+	labels Labels
+	value  float64
+}
+
+// Registry holds the current value of every series. All methods are safe for
+// concurrent use and are no-ops on a nil Registry, so commands can record
+// unconditionally.
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]map[string]*series // metric name -> label key -> series
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{series: map[string]map[string]*series{}}
+}
+
+// Set sets a gauge series.
+func (r *Registry) Set(name string, labels Labels, v float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, labels).value = v
+}
+
+// Add increments a counter series.
+func (r *Registry) Add(name string, labels Labels, v float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.get(name, labels).value += v
+}
+
+// Value returns the value of a series and whether it exists.
+func (r *Registry) Value(name string, labels Labels) (float64, bool) {
+	if r == nil {
+		return 0, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[name][labelKey(labels)]
+	if !ok {
+		return 0, false
+	}
+	return s.value, true
+}
+
+// Delete removes every series of name whose labels include all of match.
+func (r *Registry) Delete(name string, match Labels) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, s := range r.series[name] {
+		if matches(s.labels, match) {
+			delete(r.series[name], key)
+		}
+	}
+}
+
+func (r *Registry) get(name string, labels Labels) *series {
+	m := r.series[name]
+	if m == nil {
+		m = map[string]*series{}
+		r.series[name] = m
+	}
+	key := labelKey(labels)
+	s := m[key]
+	if s == nil {
+		copied := Labels{}
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{labels: copied}
+		m[key] = s
+	}
+	return s
+}
+
+// WriteText renders all series in the Prometheus text format, sorted by
+// metric name and labels so output is stable.
+func (r *Registry) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.series))
+	for name, m := range r.series {
+		if len(m) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		if d, ok := descriptions[name]; ok {
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, d.help, name, d.typ)
+		}
+		keys := make([]string, 0, len(r.series[name]))
+		for key := range r.series[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(bw, "%s%s %s\n", name, key, strconv.FormatFloat(r.series[name][key].value, 'g', -1, 64))
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry on an HTTP endpoint.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+// WriteTextfile writes the registry to path via a temp file in the same
+// directory, so the node_exporter never reads a partial file.
+func (r *Registry) WriteTextfile(path string) error {
+	if r == nil {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := r.WriteText(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadTextfile merges series from a textfile written earlier, so one-shot runs
+// sharing a file keep the metrics of previous runs. A missing file is not an
+// error.
+func (r *Registry) LoadTextfile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, v, err := parseSample(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		r.get(name, labels).value = v
+	}
+	return scanner.Err()
+}
+
+func parseSample(line string) (string, Labels, float64, error) {
+	labels := Labels{}
+	var name, rest string
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		name = line[:i]
+		var err error
+		if rest, err = parseLabels(line[i+1:], labels); err != nil {
+			return "", nil, 0, err
+		}
+	} else {
+		var ok bool
+		if name, rest, ok = strings.Cut(line, " "); !ok {
+			return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+		}
+	}
+	fields := strings.Fields(rest)
+	if name == "" || len(fields) == 0 {
+		return "", nil, 0, fmt.Errorf("invalid sample %q", line)
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("invalid value in %q", line)
+	}
+	return name, labels, v, nil
+}
+
+// parseLabels reads `k="v",...}` and returns what follows the closing brace.
+func parseLabels(s string, into Labels) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		eq := strings.Index(s, `="`)
+		if eq <= 0 {
+			return "", fmt.Errorf("invalid labels")
+		}
+		key := s[:eq]
+		s = s[eq+2:]
+		var b strings.Builder
+		for {
+			if s == "" {
+				return "", fmt.Errorf("unterminated label %s", key)
+			}
+			c := s[0]
+			s = s[1:]
+			if c == '"' {
+				break
+			}
+			if c == '\\' && s != "" {
+				switch s[0] {
+				case 'n':
+					c = '\n'
+				default:
+					c = s[0]
+				}
+				s = s[1:]
+			}
+			b.WriteByte(c)
+		}
+		into[key] = b.String()
+	}
+}
+
+// labelKey renders labels in exposition syntax with sorted keys; empty
+// values are omitted, as Prometheus treats them as absent.
+func labelKey(labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escaper.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func matches(labels, match Labels) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying r for commands to record into.
+func NewContext(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the registry carried by ctx, or nil.
+func FromContext(ctx context.Context) *Registry {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(contextKey{}).(*Registry)
+	return r
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"time"
+
+	"incus-backup/src/backend"
+)
+
+// Metric names.
+const (
+	LastSuccess     = "incus_backup_last_success_timestamp_seconds"
+	LastDuration    = "incus_backup_last_duration_seconds"
+	LastBytes       = "incus_backup_last_exported_bytes"
+	Failures        = "incus_backup_failures_total"
+	Snapshots       = "incus_backup_snapshots"
+	LatestSnapshot  = "incus_backup_latest_snapshot_timestamp_seconds"
+	VerifyChecked   = "incus_backup_verify_checked"
+	VerifyFailures  = "incus_backup_verify_failures"
+	VerifyLastRun   = "incus_backup_verify_last_run_timestamp_seconds"
+	PruneDeleted    = "incus_backup_prune_deleted_total"
+	JobLastSuccess  = "incus_backup_job_last_success_timestamp_seconds"
+	JobLastDuration = "incus_backup_job_last_duration_seconds"
+	JobRuns         = "incus_backup_job_runs_total"
+)
+
+type description struct{ help, typ string }
+
+var descriptions = map[string]description{
+	LastSuccess:     {"Unix time of the last successful backup of a resource.", "gauge"},
+	LastDuration:    {"Duration of the last successful backup of a resource.", "gauge"},
+	LastBytes:       {"Bytes exported from Incus by the last successful backup of a resource.", "gauge"},
+	Failures:        {"Failed backups of a resource.", "counter"},
+	Snapshots:       {"Backup versions of a resource stored in the target.", "gauge"},
+	LatestSnapshot:  {"Unix time of the newest backup version of a resource stored in the target.", "gauge"},
+	VerifyChecked:   {"Versions checked by the last verify run.", "gauge"},
+	VerifyFailures:  {"Versions that failed the last verify run.", "gauge"},
+	VerifyLastRun:   {"Unix time of the last verify run.", "gauge"},
+	PruneDeleted:    {"Backup versions deleted by prune.", "counter"},
+	JobLastSuccess:  {"Unix time a scheduled job task last finished successfully.", "gauge"},
+	JobLastDuration: {"Duration of the last run of a scheduled job task.", "gauge"},
+	JobRuns:         {"Runs of a scheduled job task by status.", "counter"},
+}
+
+// Resource identifies a backed-up resource in metric labels.
+type Resource struct {
+	Type    string // instance|volume|bucket|image|config
+	Project string
+	Pool    string
+	Name    string
+}
+
+func (res Resource) labels(target string) Labels {
+	return Labels{"target": target, "type": res.Type, "project": res.Project, "pool": res.Pool, "name": res.Name}
+}
+
+// BackupSucceeded records a successful backup that finished at end.
+func (r *Registry) BackupSucceeded(target string, res Resource, end time.Time, d time.Duration, bytes int64) {
+	l := res.labels(target)
+	r.Set(LastSuccess, l, float64(end.Unix()))
+	r.Set(LastDuration, l, d.Seconds())
+	r.Set(LastBytes, l, float64(bytes))
+	// Make the failure counter visible before the first failure.
+	r.Add(Failures, l, 0)
+}
+
+// BackupFailed counts a failed backup.
+func (r *Registry) BackupFailed(target string, res Resource) {
+	r.Add(Failures, res.labels(target), 1)
+}
+
+// Inventory replaces the per-resource version counts and newest version
+// times of target with what entries lists.
+func (r *Registry) Inventory(target string, entries []backend.Entry) {
+	if r == nil {
+		return
+	}
+	r.Delete(Snapshots, Labels{"target": target})
+	r.Delete(LatestSnapshot, Labels{"target": target})
+	for _, e := range entries {
+		res := Resource{Type: e.Type, Project: e.Project, Pool: e.Pool, Name: e.Name}
+		if e.Type == "image" {
+			res.Name = e.Fingerprint
+		}
+		l := res.labels(target)
+		r.Add(Snapshots, l, 1)
+		ts, err := time.Parse("20060102T150405Z", e.Timestamp)
+		if err != nil {
+			continue
+		}
+		if cur, ok := r.Value(LatestSnapshot, l); !ok || float64(ts.Unix()) > cur {
+			r.Set(LatestSnapshot, l, float64(ts.Unix()))
+		}
+	}
+}
+
+// Verified records the outcome of a verify run for one resource type.
+func (r *Registry) Verified(target, typ string, checked, failed int, at time.Time) {
+	l := Labels{"target": target, "type": typ}
+	r.Set(VerifyChecked, l, float64(checked))
+	r.Set(VerifyFailures, l, float64(failed))
+	r.Set(VerifyLastRun, l, float64(at.Unix()))
+}
+
+// Pruned counts versions of one resource type deleted by prune.
+func (r *Registry) Pruned(target, typ string, deleted int) {
+	r.Add(PruneDeleted, Labels{"target": target, "type": typ}, float64(deleted))
+}
+
+// JobFinished records one run of a scheduled job task.
+func (r *Registry) JobFinished(job, task, status string, start, end time.Time) {
+	l := Labels{"job": job, "task": task}
+	if status == "ok" {
+		r.Set(JobLastSuccess, l, float64(end.Unix()))
+	}
+	r.Set(JobLastDuration, l, end.Sub(start).Seconds())
+	r.Add(JobRuns, Labels{"job": job, "task": task, "status": status}, 1)
+}
@@ -0,0 +1,152 @@
+// Package output renders command results as a table, JSON or YAML.
+//
+// JSON and YAML share field names and order (those of the JSON encoding) so
+// scripts can switch between them; the table view is drawn by the command.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats accepted by --output.
+const (
+	Table = "table"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+// Formats lists the formats Render supports, for flag help.
+const Formats = "table|json|yaml"
+
+// Check validates an --output value; empty means Table.
+func Check(format string) (string, error) {
+	switch format {
+	case "":
+		return Table, nil
+	case Table, JSON, YAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported --output: %s", format)
+	}
+}
+
+// Render writes v to w in format. table draws the Table view; it may be nil
+// when v is only ever rendered as JSON or YAML.
+func Render(w io.Writer, format string, v any, table func(io.Writer) error) error {
+	format, err := Check(format)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		b, err := MarshalYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	default:
+		if table == nil {
+			return fmt.Errorf("no table view; use --output json or yaml")
+		}
+		return table(w)
+	}
+}
+
+// MarshalYAML encodes v as YAML using its JSON field names and order.
+func MarshalYAML(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	doc, err := yamlValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// yamlValue reads the next JSON value from dec, keeping object key order by
+// building yaml.MapSlices.
+func yamlValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := yaml.MapSlice{}
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				val, err := yamlValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				m = append(m, yaml.MapItem{Key: key, Value: val})
+			}
+			_, err := dec.Token() // '}'
+			return m, err
+		case '[':
+			list := []any{}
+			for dec.More() {
+				val, err := yamlValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, val)
+			}
+			_, err := dec.Token() // ']'
+			return list, err
+		}
+		return nil, fmt.Errorf("unexpected JSON delimiter %v", t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	default:
+		return t, nil
+	}
+}
+
+// TableWriter draws aligned columns with a header row.
+type TableWriter struct {
+	tw *tabwriter.Writer
+}
+
+// NewTable starts a table on w with the given column headers.
+func NewTable(w io.Writer, columns ...string) *TableWriter {
+	t := &TableWriter{tw: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	fmt.Fprintln(t.tw, strings.Join(columns, "\t"))
+	return t
+}
+
+// Row adds one row; cells are formatted with %v.
+func (t *TableWriter) Row(cells ...any) {
+	s := make([]string, len(cells))
+	for i, c := range cells {
+		s[i] = fmt.Sprint(c)
+	}
+	fmt.Fprintln(t.tw, strings.Join(s, "\t"))
+}
+
+// Flush writes the table.
+func (t *TableWriter) Flush() error { return t.tw.Flush() }
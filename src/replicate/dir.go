@@ -0,0 +1,159 @@
+package replicate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"incus-backup/src/backend"
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/backup/manifest"
+)
+
+// DirStore reads and writes the directory backend layout.
+type DirStore struct {
+	*dir.Backend
+}
+
+// NewDirStore opens a directory target.
+func NewDirStore(root string) (*DirStore, error) {
+	b, err := dir.New(root)
+	if err != nil {
+		return nil, err
+	}
+	return &DirStore{Backend: b}, nil
+}
+
+// DataName returns the export filename written by directory backups.
+func (s *DirStore) DataName(kind string) string {
+	switch kind {
+	case "volume":
+		return "volume.tar.xz"
+	case "bucket":
+		return "bucket.tar.xz"
+	}
+	return "export.tar.xz"
+}
+
+func (s *DirStore) Open(e backend.Entry, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.versionDir(e), name))
+}
+
+// Put writes the version into a hidden staging directory next to its final
+// location, checks every file against the checksums it recorded on the way
+// in, and renames it into place. Uncompressed exports, as restic targets
+// hold them, are xz-compressed on the way.
+func (s *DirStore) Put(v Version) error {
+	final := s.versionDir(v.Entry)
+	if _, err := os.Stat(final); err == nil {
+		return fmt.Errorf("%s already exists", final)
+	}
+	parent := filepath.Dir(final)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	stage, err := os.MkdirTemp(parent, ".copy-"+filepath.Base(final)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+	if err := os.Chmod(stage, 0o755); err != nil {
+		return err
+	}
+
+	var sums []Checksum
+	files := append([]File(nil), v.Files...)
+	if v.Data != nil {
+		name := s.DataName(v.Entry.Type)
+		h := sha256.New()
+		data, err := asCompressed(io.TeeReader(v.Data, h))
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer data.Close()
+		var rec manifest.Recorder
+		sum, err := writeHashed(filepath.Join(stage, name), io.TeeReader(data, &rec))
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != v.DataSum {
+			return fmt.Errorf("%s: checksum mismatch on arrival (expected %s, got %s)", name, v.DataSum, got)
+		}
+		sums = append(sums, Checksum{Hash: sum, Name: name})
+		for i, f := range files {
+			if f.Name == "manifest.json" {
+				mf, err := RewriteManifest(f.Data, rec.Export(name), nil)
+				if err != nil {
+					return err
+				}
+				files[i].Data = mf
+			}
+		}
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(stage, f.Name), f.Data, 0o644); err != nil {
+			return err
+		}
+		sums = append(sums, Checksum{Hash: hashBytes(f.Data), Name: f.Name})
+	}
+	if err := os.WriteFile(filepath.Join(stage, "checksums.txt"), formatChecksums(sums), 0o644); err != nil {
+		return err
+	}
+	for _, c := range sums {
+		got, err := hashFile(filepath.Join(stage, c.Name))
+		if err != nil {
+			return err
+		}
+		if got != c.Hash {
+			return fmt.Errorf("%s: checksum mismatch after write (expected %s, got %s)", c.Name, c.Hash, got)
+		}
+	}
+	return os.Rename(stage, final)
+}
+
+func (s *DirStore) versionDir(e backend.Entry) string {
+	switch e.Type {
+	case "instance":
+		return filepath.Join(s.Root, "instances", e.Project, e.Name, e.Timestamp)
+	case "volume":
+		return filepath.Join(s.Root, "volumes", e.Project, e.Pool, e.Name, e.Timestamp)
+	case "bucket":
+		return filepath.Join(s.Root, "buckets", e.Project, e.Pool, e.Name, e.Timestamp)
+	default:
+		return filepath.Join(s.Root, "config", e.Timestamp)
+	}
+}
+
+func writeHashed(path string, r io.Reader) (string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var _ Store = (*DirStore)(nil)
@@ -0,0 +1,45 @@
+package replicate
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz"
+
+	"incus-backup/src/archive"
+)
+
+// asTar returns an export as the uncompressed tar stream restic targets
+// store, so that repeated exports deduplicate.
+func asTar(r io.Reader) (io.Reader, error) {
+	tr, _, err := archive.Decompress(r)
+	return tr, err
+}
+
+// asCompressed returns an export as directory targets store it. Exports
+// that are already compressed, or not recognised at all, pass through
+// unchanged; uncompressed tar streams, as restic targets store them, are
+// xz-compressed.
+func asCompressed(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1024)
+	head, err := br.Peek(archive.HeaderSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if archive.DetectCompression(head) != archive.CompressionNone {
+		return io.NopCloser(br), nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		xw, err := xz.NewWriter(pw)
+		if err == nil {
+			_, err = io.Copy(xw, br)
+			if cerr := xw.Close(); err == nil {
+				err = cerr
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
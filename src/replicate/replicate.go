@@ -0,0 +1,325 @@
+// Package replicate copies stored backup versions between targets without
+// taking a new export from Incus.
+package replicate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/backup/manifest"
+)
+
+// File is a small file of a backup version (manifest, config document).
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Version is one backup version read from a source store.
+type Version struct {
+	Entry backend.Entry
+	// Data streams the export of instance, volume and bucket versions; nil
+	// for config.
+	Data io.Reader
+	// DataSum is the sha256 the source recorded for Data.
+	DataSum string
+	// Files are the manifest and, for config, the documents in checksum order.
+	Files []File
+}
+
+// Store reads and writes backup versions on one target.
+type Store interface {
+	List(kind string) ([]backend.Entry, error)
+	// DataName is the export filename used for an entry type on this target.
+	DataName(kind string) string
+	// Open streams one file of a stored version.
+	Open(e backend.Entry, name string) (io.ReadCloser, error)
+	// Put stores a version, checking the data against v.DataSum as it
+	// arrives. Nothing is left behind when it fails.
+	Put(v Version) error
+}
+
+// Result reports what happened to one version.
+type Result struct {
+	Type      string `json:"type"`
+	Project   string `json:"project,omitempty"`
+	Pool      string `json:"pool,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Timestamp string `json:"timestamp"`
+	Status    string `json:"status"` // copied|skipped|planned|failed
+	Error     string `json:"error,omitempty"`
+}
+
+// Selector narrows the versions to copy.
+type Selector struct {
+	Kind    string   // backend.Kind* (default all)
+	Project string   // empty for every project
+	Names   []string // NAME for instances, POOL/NAME for volumes and buckets
+	Version string   // timestamp; empty for every version
+	Latest  bool     // only the newest version per resource
+}
+
+// Plan lists the source versions matching sel and marks those already
+// present on the destination as skipped.
+func Plan(src, dst Store, sel Selector) ([]Result, []backend.Entry, error) {
+	kind := sel.Kind
+	if kind == "" {
+		kind = backend.KindAll
+	}
+	if kind == backend.KindImage {
+		return nil, nil, fmt.Errorf("copy: images are not supported")
+	}
+	var kinds []string
+	if kind == backend.KindAll {
+		kinds = []string{backend.KindInstance, backend.KindVolume, backend.KindBucket, backend.KindConfig}
+	} else {
+		kinds = []string{kind}
+	}
+	var entries, existing []backend.Entry
+	for _, k := range kinds {
+		e, err := src.List(k)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list source: %w", err)
+		}
+		entries = append(entries, e...)
+		d, err := dst.List(k)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list destination: %w", err)
+		}
+		existing = append(existing, d...)
+	}
+	present := map[string]bool{}
+	for _, e := range existing {
+		present[entryKey(e)] = true
+	}
+	entries = selectEntries(entries, sel)
+	results := make([]Result, 0, len(entries))
+	var todo []backend.Entry
+	for _, e := range entries {
+		r := resultFor(e, "planned")
+		if present[entryKey(e)] {
+			r.Status = "skipped"
+		} else {
+			todo = append(todo, e)
+		}
+		results = append(results, r)
+	}
+	return results, todo, nil
+}
+
+// Copy transfers each entry from src to dst and returns one result per
+// entry. A failed version does not stop the others.
+func Copy(src, dst Store, entries []backend.Entry, progressOut io.Writer) []Result {
+	results := make([]Result, 0, len(entries))
+	for _, e := range entries {
+		if progressOut != nil {
+			fmt.Fprintf(progressOut, "[copy] %s %s@%s\n", e.Type, resourceLabel(e), e.Timestamp)
+		}
+		r := resultFor(e, "copied")
+		if err := copyVersion(src, dst, e); err != nil {
+			r.Status, r.Error = "failed", err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func copyVersion(src, dst Store, e backend.Entry) error {
+	sums, err := readSmall(src, e, "checksums.txt")
+	if err != nil {
+		return err
+	}
+	checksums, err := ParseChecksums(sums)
+	if err != nil {
+		return err
+	}
+	if e.Type == "config" {
+		v := Version{Entry: e}
+		for _, c := range checksums {
+			data, err := readVerified(src, e, c)
+			if err != nil {
+				return err
+			}
+			v.Files = append(v.Files, File{Name: c.Name, Data: data})
+		}
+		return dst.Put(v)
+	}
+
+	mf, err := readSmall(src, e, "manifest.json")
+	if err != nil {
+		return err
+	}
+	dataName := src.DataName(e.Type)
+	var dataSum string
+	for _, c := range checksums {
+		switch c.Name {
+		case "manifest.json":
+			if got := hashBytes(mf); got != c.Hash {
+				return fmt.Errorf("manifest.json: checksum mismatch at source (expected %s, got %s)", c.Hash, got)
+			}
+		case dataName:
+			dataSum = c.Hash
+		}
+	}
+	if dataSum == "" {
+		return fmt.Errorf("%s has no checksum at source", dataName)
+	}
+	data, err := src.Open(e, dataName)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	return dst.Put(Version{Entry: e, Data: data, DataSum: dataSum, Files: []File{{Name: "manifest.json", Data: mf}}})
+}
+
+// Checksum is one line of a checksums.txt file.
+type Checksum struct {
+	Hash string
+	Name string
+}
+
+// ParseChecksums parses "<sha256>  <name>" lines.
+func ParseChecksums(data []byte) ([]Checksum, error) {
+	var out []Checksum
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid checksum entry: %s", line)
+		}
+		out = append(out, Checksum{Hash: parts[0], Name: parts[1]})
+	}
+	return out, nil
+}
+
+func formatChecksums(sums []Checksum) []byte {
+	var b strings.Builder
+	for _, c := range sums {
+		fmt.Fprintf(&b, "%s  %s\n", c.Hash, c.Name)
+	}
+	return []byte(b.String())
+}
+
+// RewriteManifest replaces the export record of an instance, volume or
+// bucket manifest with exp, describing the data as stored on the
+// destination, and replaces its restic statistics (nil drops them). Other
+// fields are kept as they were.
+func RewriteManifest(data []byte, exp *manifest.Export, r *manifest.Restic) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if raw, ok := doc["export"]; ok && string(raw) != "null" && exp != nil {
+		b, err := json.Marshal(exp)
+		if err != nil {
+			return nil, err
+		}
+		doc["export"] = b
+	}
+	delete(doc, "restic")
+	if r != nil {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		doc["restic"] = b
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func readSmall(s Store, e backend.Entry, name string) ([]byte, error) {
+	rc, err := s.Open(e, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func readVerified(s Store, e backend.Entry, c Checksum) ([]byte, error) {
+	data, err := readSmall(s, e, c.Name)
+	if err != nil {
+		return nil, err
+	}
+	if got := hashBytes(data); got != c.Hash {
+		return nil, fmt.Errorf("%s: checksum mismatch at source (expected %s, got %s)", c.Name, c.Hash, got)
+	}
+	return data, nil
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func selectEntries(entries []backend.Entry, sel Selector) []backend.Entry {
+	names := map[string]bool{}
+	for _, n := range sel.Names {
+		names[n] = true
+	}
+	latest := map[string]backend.Entry{}
+	var out []backend.Entry
+	for _, e := range entries {
+		if sel.Project != "" && e.Type != "config" && e.Project != sel.Project {
+			continue
+		}
+		if len(names) > 0 && e.Type != "config" && !names[resourceName(e)] {
+			continue
+		}
+		if sel.Version != "" && e.Timestamp != sel.Version {
+			continue
+		}
+		if sel.Latest {
+			key := e.Type + "\x00" + e.Project + "\x00" + e.Pool + "\x00" + e.Name
+			if prev, ok := latest[key]; !ok || e.Timestamp > prev.Timestamp {
+				latest[key] = e
+			}
+			continue
+		}
+		out = append(out, e)
+	}
+	for _, e := range latest {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return entryKey(out[i]) < entryKey(out[j]) })
+	return out
+}
+
+func resourceName(e backend.Entry) string {
+	if e.Type == "volume" || e.Type == "bucket" {
+		return e.Pool + "/" + e.Name
+	}
+	return e.Name
+}
+
+func resourceLabel(e backend.Entry) string {
+	switch e.Type {
+	case "config":
+		return "config"
+	case "volume", "bucket":
+		return e.Project + "/" + e.Pool + "/" + e.Name
+	default:
+		return e.Project + "/" + e.Name
+	}
+}
+
+func entryKey(e backend.Entry) string {
+	return strings.Join([]string{e.Type, e.Project, e.Pool, e.Name, e.Timestamp}, "\x00")
+}
+
+func resultFor(e backend.Entry, status string) Result {
+	return Result{Type: e.Type, Project: e.Project, Pool: e.Pool, Name: e.Name, Timestamp: e.Timestamp, Status: status}
+}
@@ -0,0 +1,232 @@
+package replicate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"incus-backup/src/backend"
+	backendrestic "incus-backup/src/backend/restic"
+	"incus-backup/src/backup/buckets"
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/backup/instances"
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/backup/volumes"
+	"incus-backup/src/restic"
+)
+
+// ResticStore reads and writes backup versions in a restic repository, in
+// the same snapshot layout as restic backups.
+type ResticStore struct {
+	*backendrestic.Backend
+	ctx      context.Context
+	bin      restic.BinaryInfo
+	repo     string
+	progress io.Writer
+}
+
+// NewResticStore opens a restic repository; progress receives restic output.
+func NewResticStore(ctx context.Context, bin restic.BinaryInfo, repo string, progress io.Writer) (*ResticStore, error) {
+	b, err := backendrestic.New(ctx, bin, repo)
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &ResticStore{Backend: b, ctx: ctx, bin: bin, repo: repo, progress: progress}, nil
+}
+
+// DataName returns the export filename written by restic backups.
+func (s *ResticStore) DataName(kind string) string {
+	switch kind {
+	case "volume":
+		return "volume.tar"
+	case "bucket":
+		return "bucket.tar"
+	}
+	return "export.tar"
+}
+
+// Open dumps one file of a version, looking in the bundle snapshot or in the
+// legacy part snapshot that holds it.
+func (s *ResticStore) Open(e backend.Entry, name string) (io.ReadCloser, error) {
+	part := partForFile(e.Type, name)
+	snaps, err := restic.ListSnapshots(s.ctx, s.bin, s.repo, versionTags(e))
+	if err != nil {
+		return nil, err
+	}
+	var snap *restic.Snapshot
+	for i := range snaps {
+		if snaps[i].HasPart(part) {
+			snap = &snaps[i]
+		}
+	}
+	if snap == nil {
+		return nil, fmt.Errorf("%s: no snapshot holds %s", resourceLabel(e), name)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(restic.Dump(s.ctx, s.bin, s.repo, snap.ID, name, pw, nil))
+	}()
+	return pr, nil
+}
+
+// Put stores a version as a bundle snapshot, falling back to one snapshot
+// per part like BackupInstanceRestic. Compressed exports are stored
+// decompressed, as restic backups take them. The data is hashed as restic
+// reads it and the snapshot is forgotten again if it does not match
+// v.DataSum.
+func (s *ResticStore) Put(v Version) error {
+	e := v.Entry
+	if e.Type == "config" {
+		var files []restic.File
+		var sums []Checksum
+		for _, f := range v.Files {
+			files = append(files, restic.File{Name: f.Name, Data: f.Data})
+			sums = append(sums, Checksum{Hash: hashBytes(f.Data), Name: f.Name})
+		}
+		files = append(files, restic.File{Name: "checksums.txt", Data: formatChecksums(sums)})
+		_, err := restic.BackupFiles(s.ctx, s.bin, s.repo, files, cfg.ResticTags(e.Timestamp, ""), s.progress)
+		return err
+	}
+
+	var mf []byte
+	for _, f := range v.Files {
+		if f.Name == "manifest.json" {
+			mf = f.Data
+		}
+	}
+	if mf == nil {
+		return errors.New("manifest.json missing")
+	}
+	tags, err := s.tagger(e, mf)
+	if err != nil {
+		return err
+	}
+	name := s.DataName(e.Type)
+	h := sha256.New()
+	in := io.TeeReader(v.Data, h)
+	plain, err := asTar(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	stored := sha256.New()
+	var rec manifest.Recorder
+	data, err := restic.BackupStream(s.ctx, s.bin, s.repo, name, tags("data"), io.TeeReader(plain, io.MultiWriter(stored, &rec)), s.progress)
+	if err != nil {
+		return err
+	}
+	// Decompression may stop short of trailing bytes; hash the whole source.
+	if _, err := io.Copy(io.Discard, in); err != nil {
+		s.discard(data)
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != v.DataSum {
+		s.discard(data)
+		return fmt.Errorf("%s: checksum mismatch on arrival (expected %s, got %s)", name, v.DataSum, sum)
+	}
+	checksums := formatChecksums([]Checksum{{Hash: hex.EncodeToString(stored.Sum(nil)), Name: name}})
+	export := rec.Export(name)
+
+	stats := manifest.ResticFrom(data)
+	bundled, err := RewriteManifest(mf, export, stats.Bundled())
+	if err != nil {
+		s.discard(data)
+		return err
+	}
+	files := []restic.File{{Name: "manifest.json", Data: bundled}, {Name: "checksums.txt", Data: checksums}}
+	_, err = restic.BackupBundle(s.ctx, s.bin, s.repo, data, name, files, tags(""), s.progress)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, restic.ErrBundleUnsupported) {
+		s.discard(data)
+		return err
+	}
+	legacy, err := RewriteManifest(mf, export, stats)
+	if err != nil {
+		s.discard(data)
+		return err
+	}
+	if _, err := restic.BackupBytes(s.ctx, s.bin, s.repo, "manifest.json", tags("manifest"), legacy, s.progress); err != nil {
+		s.discard(data)
+		return err
+	}
+	_, err = restic.BackupBytes(s.ctx, s.bin, s.repo, "checksums.txt", tags("checksums"), checksums, s.progress)
+	return err
+}
+
+// tagger returns the tag builder for a version, carrying over the optimized
+// and snapshot options recorded in its manifest.
+func (s *ResticStore) tagger(e backend.Entry, mf []byte) (func(part string) []string, error) {
+	var doc struct {
+		Options map[string]string `json:"options"`
+	}
+	if err := json.Unmarshal(mf, &doc); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	optimized := doc.Options["optimized"] == "true"
+	snapshot := doc.Options["snapshot"] == "true"
+	switch e.Type {
+	case "volume":
+		return func(part string) []string {
+			return volumes.ResticTags(e.Project, e.Pool, e.Name, e.Timestamp, part, optimized, snapshot)
+		}, nil
+	case "bucket":
+		return func(part string) []string {
+			return buckets.ResticTags(e.Project, e.Pool, e.Name, e.Timestamp, part)
+		}, nil
+	}
+	return func(part string) []string {
+		return instances.ResticTags(e.Project, e.Name, e.Timestamp, part, optimized, snapshot)
+	}, nil
+}
+
+// discard forgets a data snapshot whose version could not be completed, so
+// a failed copy does not leave an orphaned part behind.
+func (s *ResticStore) discard(data restic.BackupSummary) {
+	if data.SnapshotID == "" {
+		return
+	}
+	if err := restic.ForgetSnapshots(s.ctx, s.bin, s.repo, []string{data.SnapshotID}, false); err != nil && s.progress != nil {
+		fmt.Fprintf(s.progress, "[restic] warning: could not forget data snapshot %s: %v\n", data.ShortID(), err)
+	}
+}
+
+func versionTags(e backend.Entry) []string {
+	tags := []string{"type=" + e.Type}
+	if e.Project != "" {
+		tags = append(tags, "project="+e.Project)
+	}
+	if e.Pool != "" {
+		tags = append(tags, "pool="+e.Pool)
+	}
+	if e.Name != "" {
+		tags = append(tags, "name="+e.Name)
+	}
+	return append(tags, "timestamp="+e.Timestamp)
+}
+
+// partForFile maps a file name to the legacy part tag that stores it.
+func partForFile(kind, name string) string {
+	switch name {
+	case "manifest.json":
+		return "manifest"
+	case "checksums.txt":
+		return "checksums"
+	case "export.tar", "volume.tar", "bucket.tar":
+		return "data"
+	}
+	if kind == "config" {
+		return strings.TrimSuffix(name, ".json")
+	}
+	return ""
+}
+
+var _ Store = (*ResticStore)(nil)
@@ -0,0 +1,96 @@
+package restic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	pg "incus-backup/src/util/progress"
+)
+
+// BackupSummary is the final `summary` message of `restic backup --json`.
+type BackupSummary struct {
+	SnapshotID          string  `json:"snapshot_id"`
+	FilesNew            int64   `json:"files_new"`
+	FilesChanged        int64   `json:"files_changed"`
+	FilesUnmodified     int64   `json:"files_unmodified"`
+	DataAdded           int64   `json:"data_added"`
+	DataAddedPacked     int64   `json:"data_added_packed"`
+	TotalBytesProcessed int64   `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+}
+
+// ShortID returns the first eight characters of the snapshot ID, matching
+// restic's own short form.
+func (s BackupSummary) ShortID() string {
+	if len(s.SnapshotID) > 8 {
+		return s.SnapshotID[:8]
+	}
+	return s.SnapshotID
+}
+
+// backupMessage covers the fields of the status, summary and error messages
+// restic emits as JSON lines.
+type backupMessage struct {
+	MessageType      string `json:"message_type"`
+	TotalFiles       int64  `json:"total_files"`
+	FilesDone        int64  `json:"files_done"`
+	TotalBytes       int64  `json:"total_bytes"`
+	BytesDone        int64  `json:"bytes_done"`
+	SecondsRemaining int64  `json:"seconds_remaining"`
+	Error            *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	During string `json:"during"`
+	Item   string `json:"item"`
+	BackupSummary
+}
+
+// parseBackupOutput consumes restic's JSON stdout, feeding status messages
+// into line and returning the summary. Lines that are not JSON (older restic
+// versions, warnings) and error messages are collected and returned as notes
+// so they can be shown once the progress line is finished.
+func parseBackupOutput(r io.Reader, line *pg.Line) (BackupSummary, []string) {
+	var summary BackupSummary
+	var notes []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var msg backupMessage
+		if !strings.HasPrefix(text, "{") || json.Unmarshal([]byte(text), &msg) != nil {
+			notes = append(notes, text)
+			continue
+		}
+		switch msg.MessageType {
+		case "status":
+			line.Update(pg.Status{
+				Done:      msg.BytesDone,
+				Total:     msg.TotalBytes,
+				Files:     msg.FilesDone,
+				Remaining: time.Duration(msg.SecondsRemaining) * time.Second,
+			})
+		case "summary":
+			summary = msg.BackupSummary
+		case "error":
+			if msg.Error != nil {
+				notes = append(notes, fmt.Sprintf("error during %s %s: %s", msg.During, msg.Item, msg.Error.Message))
+			}
+		}
+	}
+	// Drain anything left so restic never blocks on a full pipe.
+	_, _ = io.Copy(io.Discard, r)
+	return summary, notes
+}
+
+// describeSummary renders a one-line dedup report for progress output.
+func describeSummary(filename string, s BackupSummary) string {
+	return fmt.Sprintf("[restic] %s: snapshot %s, processed %d bytes, added %d bytes (%d packed) in %.1fs",
+		filename, s.ShortID(), s.TotalBytesProcessed, s.DataAdded, s.DataAddedPacked, s.TotalDuration)
+}
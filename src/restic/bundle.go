@@ -0,0 +1,151 @@
+package restic
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrBundleUnsupported is returned by BackupBundle when restic did not reuse
+// the streamed data snapshot. Callers fall back to the legacy per-part layout.
+var ErrBundleUnsupported = errors.New("restic: could not bundle streamed data into a single snapshot")
+
+// File is a small file stored alongside streamed data in a bundle snapshot.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// BackupFiles stores small files as one snapshot with the files at its root.
+// The files are staged in a temporary directory, so this is only meant for
+// manifests, checksums and config documents.
+func BackupFiles(ctx context.Context, bin BinaryInfo, repo string, files []File, tags []string, progress io.Writer) (BackupSummary, error) {
+	dir, err := stageFiles(files)
+	if err != nil {
+		return BackupSummary{}, err
+	}
+	defer os.RemoveAll(dir)
+	return runBackup(ctx, bin, repo, dir, nil, tags, nil, fileNames(files), progress)
+}
+
+// BackupBundle combines a data snapshot written by BackupStream with small
+// files into one snapshot, so a backup version is either fully present or
+// absent. restic cannot mix stdin with files, so the data file is staged as
+// a sparse placeholder with the streamed node's size and mtime and backed up
+// with the data snapshot as parent: restic then treats it as unmodified and
+// reuses the already stored content without reading the placeholder. The
+// data snapshot is forgotten once the bundle exists.
+//
+// If restic reports the data file as new or changed, the bundle is discarded
+// and ErrBundleUnsupported is returned with the data snapshot left intact.
+func BackupBundle(ctx context.Context, bin BinaryInfo, repo string, data BackupSummary, dataName string, files []File, tags []string, progress io.Writer) (BackupSummary, error) {
+	if data.SnapshotID == "" {
+		return BackupSummary{}, ErrBundleUnsupported
+	}
+	node, err := findFileNode(ctx, bin, repo, data.SnapshotID, dataName)
+	if err != nil {
+		return BackupSummary{}, err
+	}
+	dir, err := stageFiles(files)
+	if err != nil {
+		return BackupSummary{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := stagePlaceholder(filepath.Join(dir, dataName), node); err != nil {
+		return BackupSummary{}, err
+	}
+	args := []string{"--parent", data.SnapshotID, "--ignore-inode", "--ignore-ctime"}
+	summary, err := runBackup(ctx, bin, repo, dir, args, tags, nil, dataName+","+fileNames(files), progress)
+	if err != nil {
+		return BackupSummary{}, err
+	}
+	if summary.FilesUnmodified < 1 {
+		if summary.SnapshotID != "" {
+			_ = ForgetSnapshots(ctx, bin, repo, []string{summary.SnapshotID}, false)
+		}
+		return BackupSummary{}, ErrBundleUnsupported
+	}
+	if err := ForgetSnapshots(ctx, bin, repo, []string{data.SnapshotID}, false); err != nil && progress != nil {
+		// The bundle is complete; a leftover data snapshot only wastes a tag.
+		fmt.Fprintf(progress, "[restic] warning: could not forget data snapshot %s: %v\n", data.ShortID(), err)
+	}
+	// Report the data as part of the bundle so dedup stats describe the export.
+	summary.DataAdded += data.DataAdded
+	summary.DataAddedPacked += data.DataAddedPacked
+	return summary, nil
+}
+
+type lsNode struct {
+	Type  string    `json:"type"`
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+	MTime time.Time `json:"mtime"`
+}
+
+// findFileNode looks up a file at the root of a snapshot via `restic ls --json`.
+func findFileNode(ctx context.Context, bin BinaryInfo, repo, snapshotID, name string) (lsNode, error) {
+	stdout, stderr, err := runCommand(ctx, bin, repo, []string{"ls", "--json", snapshotID, "/" + name}, nil)
+	if err != nil {
+		return lsNode{}, fmt.Errorf("restic: list snapshot %s: %w: %s", snapshotID, err, stderr)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(stdout))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var node lsNode
+		if json.Unmarshal(scanner.Bytes(), &node) != nil {
+			continue
+		}
+		if node.Type == "file" && node.Path == "/"+name {
+			return node, nil
+		}
+	}
+	return lsNode{}, fmt.Errorf("restic: %s not found in snapshot %s", name, snapshotID)
+}
+
+func stageFiles(files []File) (string, error) {
+	dir, err := os.MkdirTemp("", "incus-backup-restic-")
+	if err != nil {
+		return "", fmt.Errorf("restic: stage files: %w", err)
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.Name), f.Data, 0o600); err != nil {
+			os.RemoveAll(dir)
+			return "", fmt.Errorf("restic: stage %s: %w", f.Name, err)
+		}
+	}
+	return dir, nil
+}
+
+// stagePlaceholder creates a sparse file matching node's size and mtime.
+func stagePlaceholder(path string, node lsNode) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("restic: stage placeholder: %w", err)
+	}
+	if err := f.Truncate(node.Size); err != nil {
+		f.Close()
+		return fmt.Errorf("restic: stage placeholder: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("restic: stage placeholder: %w", err)
+	}
+	if err := os.Chtimes(path, node.MTime, node.MTime); err != nil {
+		return fmt.Errorf("restic: stage placeholder: %w", err)
+	}
+	return nil
+}
+
+func fileNames(files []File) string {
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return strings.Join(names, ",")
+}
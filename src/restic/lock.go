@@ -0,0 +1,195 @@
+package restic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"incus-backup/src/util/flock"
+)
+
+// ErrRepositoryLocked is wrapped into errors from commands that kept failing
+// because another restic process holds a lock on the repository.
+var ErrRepositoryLocked = errors.New("restic repository is locked by another process")
+
+// lockBackoff is the wait schedule between attempts when restic reports lock
+// contention. Its sum is also passed to streaming commands as --retry-lock,
+// since their input cannot be replayed.
+var lockBackoff = []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 15 * time.Second}
+
+var sleepFn = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// isLockError reports whether restic's stderr indicates lock contention.
+func isLockError(stderr string) bool {
+	s := strings.ToLower(stderr)
+	return strings.Contains(s, "repository is already locked") || strings.Contains(s, "unable to create lock in backend")
+}
+
+func retryLockArgs() []string {
+	var total time.Duration
+	for _, d := range lockBackoff {
+		total += d
+	}
+	return []string{"--retry-lock", total.String()}
+}
+
+// LocalLockPath returns the host-local lock file used to serialise
+// incus-backup's restic invocations against repo. INCUS_BACKUP_LOCK_DIR
+// overrides the default location under the user cache directory.
+func LocalLockPath(repo string) string {
+	dir := os.Getenv("INCUS_BACKUP_LOCK_DIR")
+	if dir == "" {
+		if cache, err := os.UserCacheDir(); err == nil {
+			dir = filepath.Join(cache, "incus-backup", "locks")
+		} else {
+			dir = filepath.Join(os.TempDir(), "incus-backup-locks")
+		}
+	}
+	sum := sha256.Sum256([]byte(repo))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock")
+}
+
+// TargetLockPath returns the host-local lock file held for a whole run
+// against repo, next to LocalLockPath: shared by backups, which write a
+// snapshot set over several restic invocations, and exclusive by repairs that
+// forget incomplete sets.
+func TargetLockPath(repo string) string {
+	return strings.TrimSuffix(LocalLockPath(repo), ".lock") + ".target.lock"
+}
+
+// LockTarget takes repo's target lock without waiting; it fails when another
+// process holds it in a conflicting mode.
+func LockTarget(repo string, exclusive bool, owner string) (*flock.Lock, error) {
+	path := TargetLockPath(repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("restic: local lock dir: %w", err)
+	}
+	l, err := flock.TryLock(path, exclusive, owner)
+	if errors.Is(err, flock.ErrLocked) {
+		return nil, fmt.Errorf("restic repository %s is in use by another incus-backup process: %w", Redact(repo), err)
+	}
+	return l, err
+}
+
+// localLocks tracks the per-repo host lock held by this process. Nested or
+// concurrent calls within the process share it; other processes wait.
+var localLocks = struct {
+	sync.Mutex
+	held map[string]*localHold
+}{held: map[string]*localHold{}}
+
+type localHold struct {
+	lock *flock.Lock
+	refs int
+}
+
+const localLockPoll = 200 * time.Millisecond
+
+// acquireLocal blocks until this process holds the host-local lock for repo.
+// The process-wide mutex is only held while checking and taking the lock, not
+// while waiting for another process, so other repos are not held up.
+func acquireLocal(ctx context.Context, repo string) (func(), error) {
+	path := LocalLockPath(repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("restic: local lock dir: %w", err)
+	}
+	owner := fmt.Sprintf("pid %d", os.Getpid())
+	for {
+		release, err := tryAcquireLocal(repo, path, owner)
+		if err != nil || release != nil {
+			return release, err
+		}
+		if err := sleepFn(ctx, localLockPoll); err != nil {
+			return nil, fmt.Errorf("restic: waiting for local lock on %s (%s): %w", Redact(repo), flock.Holder(path), err)
+		}
+	}
+}
+
+// tryAcquireLocal shares the lock when this process already holds it, or
+// takes it when no other process does. It returns a nil release while the
+// lock is held elsewhere.
+func tryAcquireLocal(repo, path, owner string) (func(), error) {
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	if h, ok := localLocks.held[repo]; ok {
+		h.refs++
+		return func() { releaseLocal(repo) }, nil
+	}
+	l, err := flock.TryLock(path, true, owner)
+	if errors.Is(err, flock.ErrLocked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("restic: local lock: %w", err)
+	}
+	localLocks.held[repo] = &localHold{lock: l, refs: 1}
+	return func() { releaseLocal(repo) }, nil
+}
+
+func releaseLocal(repo string) {
+	localLocks.Lock()
+	defer localLocks.Unlock()
+	h, ok := localLocks.held[repo]
+	if !ok {
+		return
+	}
+	h.refs--
+	if h.refs == 0 {
+		_ = h.lock.Unlock()
+		delete(localLocks.held, repo)
+	}
+}
+
+// ListLocks returns the IDs of lock files currently present in the repository.
+func ListLocks(ctx context.Context, bin BinaryInfo, repo string) ([]string, error) {
+	stdout, stderr, err := runCommand(ctx, bin, repo, []string{"list", "locks", "--no-lock"}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("restic: list locks: %w: %s", err, stderr)
+	}
+	var ids []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ids = append(ids, line)
+		}
+	}
+	return ids, nil
+}
+
+// Unlock runs `restic unlock`, which removes only stale locks unless
+// removeAll is set.
+func Unlock(ctx context.Context, bin BinaryInfo, repo string, removeAll bool) error {
+	args := []string{"unlock"}
+	if removeAll {
+		args = append(args, "--remove-all")
+	}
+	if _, stderr, err := runCommand(ctx, bin, repo, args, nil); err != nil {
+		return fmt.Errorf("restic: unlock: %w: %s", err, stderr)
+	}
+	return nil
+}
+
+// SetLockBackoffForTest replaces the lock retry schedule and sleeper.
+func SetLockBackoffForTest(backoff []time.Duration, sleep func(context.Context, time.Duration) error) func() {
+	prevBackoff, prevSleep := lockBackoff, sleepFn
+	lockBackoff = backoff
+	if sleep != nil {
+		sleepFn = sleep
+	}
+	return func() { lockBackoff, sleepFn = prevBackoff, prevSleep }
+}
@@ -0,0 +1,238 @@
+package restic
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Options carries per-repository credentials and settings. They are applied
+// only to the environment and arguments of the restic child process; the
+// incus-backup process environment is never modified.
+type Options struct {
+	// PasswordFile is exported as RESTIC_PASSWORD_FILE.
+	PasswordFile string `json:"passwordFile,omitempty" yaml:"passwordFile,omitempty"`
+	// PasswordCommand is exported as RESTIC_PASSWORD_COMMAND.
+	PasswordCommand string `json:"passwordCommand,omitempty" yaml:"passwordCommand,omitempty"`
+	// CacheDir is exported as RESTIC_CACHE_DIR.
+	CacheDir string `json:"cacheDir,omitempty" yaml:"cacheDir,omitempty"`
+	// ExtendedOptions are passed as `-o key=value` (e.g. sftp.command=...).
+	ExtendedOptions []string `json:"options,omitempty" yaml:"options,omitempty"`
+	// Env holds backend credentials such as AWS_ACCESS_KEY_ID or B2_ACCOUNT_KEY.
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// passwordEnv lists the ambient variables dropped when a target configures
+// its own password source, so restic never sees two conflicting sources.
+var passwordEnv = []string{"RESTIC_PASSWORD", "RESTIC_PASSWORD_FILE", "RESTIC_PASSWORD_COMMAND"}
+
+var (
+	optionsMu sync.RWMutex
+	repoOpts  = map[string]Options{}
+)
+
+// Validate reports configuration errors without echoing secret values.
+func (o Options) Validate() error {
+	if o.PasswordFile != "" && o.PasswordCommand != "" {
+		return errors.New("restic: password file and password command are mutually exclusive")
+	}
+	for _, opt := range o.ExtendedOptions {
+		if k, _, ok := strings.Cut(opt, "="); !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("restic: invalid option %q; expected key=value", optionKey(opt))
+		}
+	}
+	for k := range o.Env {
+		if k == "" || strings.ContainsAny(k, "= \t\n") {
+			return fmt.Errorf("restic: invalid environment variable name %q", k)
+		}
+		if k == "RESTIC_REPOSITORY" {
+			return errors.New("restic: RESTIC_REPOSITORY is derived from the target and cannot be overridden")
+		}
+	}
+	return nil
+}
+
+func (o Options) hasPassword() bool {
+	if o.PasswordFile != "" || o.PasswordCommand != "" {
+		return true
+	}
+	for _, k := range passwordEnv {
+		if _, ok := o.Env[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Configure associates options with a repository. Every subsequent restic
+// invocation against repo uses them.
+func Configure(repo string, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	repoOpts[repo] = opts
+	return nil
+}
+
+// ResetOptionsForTest clears all configured repository options.
+func ResetOptionsForTest() {
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	repoOpts = map[string]Options{}
+}
+
+func optionsFor(repo string) Options {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	return repoOpts[repo]
+}
+
+// globalArgs returns the restic global flags for repo. They are placed before
+// the subcommand so that every command accepts them.
+func globalArgs(repo string) []string {
+	var args []string
+	for _, opt := range optionsFor(repo).ExtendedOptions {
+		args = append(args, "-o", opt)
+	}
+	return args
+}
+
+// LoadEnvFile reads KEY=VALUE lines (blank lines and # comments ignored),
+// as used for per-target backend credentials.
+func LoadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("restic: read env file: %w", err)
+	}
+	defer f.Close()
+	env := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		k, v, ok := strings.Cut(text, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			// Never print the line itself: it may hold a secret.
+			return nil, fmt.Errorf("restic: env file %s line %d: expected KEY=VALUE", path, line)
+		}
+		env[k] = unquote(strings.TrimSpace(v))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("restic: read env file: %w", err)
+	}
+	return env, nil
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+var userinfoPattern = regexp.MustCompile(`(://[^:/@\s]+):[^@/\s]+@`)
+
+// Redact masks configured secrets and URL passwords in s. It is applied to
+// restic's stderr before it is surfaced in errors.
+func Redact(s string) string {
+	s = userinfoPattern.ReplaceAllString(s, "$1:***@")
+	optionsMu.RLock()
+	var secrets []string
+	for _, o := range repoOpts {
+		if o.PasswordCommand != "" {
+			secrets = append(secrets, o.PasswordCommand)
+		}
+		for _, opt := range o.ExtendedOptions {
+			if _, v, ok := strings.Cut(opt, "="); ok && isSecretKey(opt) && v != "" {
+				secrets = append(secrets, v)
+			}
+		}
+		for k, v := range o.Env {
+			if v != "" && isSecretKey(k) {
+				secrets = append(secrets, v)
+			}
+		}
+	}
+	optionsMu.RUnlock()
+	// Replace longer secrets first so overlapping values are fully masked.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return s
+}
+
+// isSecretKey reports whether an option or environment key names a secret,
+// such as RESTIC_PASSWORD, AWS_SECRET_ACCESS_KEY or azure.account-key. Other
+// settings stay readable in errors.
+func isSecretKey(k string) bool {
+	k = strings.ToUpper(optionKey(k))
+	for _, secret := range []string{"PASSWORD", "SECRET", "KEY", "TOKEN", "CREDENTIALS"} {
+		if strings.Contains(k, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func optionKey(opt string) string {
+	k, _, _ := strings.Cut(opt, "=")
+	return k
+}
+
+// repoEnv builds the child environment for repo from the ambient environment.
+func repoEnv(base []string, repo string) []string {
+	opts := optionsFor(repo)
+	env := make([]string, 0, len(base)+len(opts.Env)+4)
+	for _, kv := range base {
+		k := optionKey(kv)
+		if k == "RESTIC_REPOSITORY" || (opts.hasPassword() && contains(passwordEnv, k)) {
+			continue
+		}
+		if _, override := opts.Env[k]; override {
+			continue
+		}
+		env = append(env, kv)
+	}
+	env = append(env, "RESTIC_REPOSITORY="+repo)
+	if opts.PasswordFile != "" {
+		env = append(env, "RESTIC_PASSWORD_FILE="+opts.PasswordFile)
+	}
+	if opts.PasswordCommand != "" {
+		env = append(env, "RESTIC_PASSWORD_COMMAND="+opts.PasswordCommand)
+	}
+	if opts.CacheDir != "" {
+		env = append(env, "RESTIC_CACHE_DIR="+opts.CacheDir)
+	}
+	keys := make([]string, 0, len(opts.Env))
+	for k := range opts.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+opts.Env[k])
+	}
+	return env
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -11,6 +11,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	pg "incus-backup/src/util/progress"
 )
 
 // EnsureRepository verifies that the given repository path has been
@@ -59,58 +61,103 @@ func isUnknownLimitFlag(err error) bool {
 	return strings.Contains(err.Error(), "unknown flag: --limit") || strings.Contains(err.Error(), "unknown option --limit")
 }
 
-// BackupStream runs `restic backup --stdin` with the provided reader.
-func BackupStream(ctx context.Context, bin BinaryInfo, repo string, filename string, tags []string, r io.Reader, progress io.Writer) error {
-	args := []string{"backup", "--stdin", "--stdin-filename", filename}
+// BackupStream runs `restic backup --stdin --json` with the provided reader.
+// restic's status messages are rendered as a progress line on progress and
+// the final summary (snapshot ID and dedup statistics) is returned.
+func BackupStream(ctx context.Context, bin BinaryInfo, repo string, filename string, tags []string, r io.Reader, progress io.Writer) (BackupSummary, error) {
+	args := []string{"--stdin", "--stdin-filename", filename}
+	return runBackup(ctx, bin, repo, "", args, tags, r, filename, progress)
+}
+
+// runBackup runs `restic backup --json` with extra args, optionally from dir
+// and feeding stdin, and reports progress under label.
+func runBackup(ctx context.Context, bin BinaryInfo, repo, dir string, extra, tags []string, stdinData io.Reader, label string, progress io.Writer) (BackupSummary, error) {
+	release, err := acquireLocal(ctx, repo)
+	if err != nil {
+		return BackupSummary{}, err
+	}
+	defer release()
+	args := append(append(globalArgs(repo), retryLockArgs()...), "backup", "--json")
+	args = append(args, extra...)
 	for _, tag := range tags {
 		args = append(args, "--tag", tag)
 	}
-	cmd := exec.CommandContext(ctx, bin.Path, args...)
-	cmd.Env = appendRepoEnv(cmd.Env, repo)
-	if progress != nil {
-		cmd.Stdout = progress
-		cmd.Stderr = progress
-	} else {
-		cmd.Stdout = io.Discard
-		cmd.Stderr = io.Discard
+	if stdinData == nil {
+		args = append(args, ".")
 	}
-	stdin, err := cmd.StdinPipe()
+	cmd := exec.CommandContext(ctx, bin.Path, args...)
+	cmd.Env = repoEnv(os.Environ(), repo)
+	cmd.Dir = dir
+	var stderrBuf bytes.Buffer
+	cmd.Stderr = &stderrBuf
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("restic: acquire stdin: %w", err)
+		return BackupSummary{}, fmt.Errorf("restic: acquire stdout: %w", err)
+	}
+	var stdin io.WriteCloser
+	if stdinData != nil {
+		if stdin, err = cmd.StdinPipe(); err != nil {
+			return BackupSummary{}, fmt.Errorf("restic: acquire stdin: %w", err)
+		}
 	}
 	if err := cmd.Start(); err != nil {
-		stdin.Close()
-		return fmt.Errorf("restic: start backup: %w", err)
+		if stdin != nil {
+			stdin.Close()
+		}
+		return BackupSummary{}, fmt.Errorf("restic: start backup: %w", err)
 	}
 	copyErr := make(chan error, 1)
-	go func() {
-		_, err := io.Copy(stdin, r)
-		stdin.Close()
-		copyErr <- err
-	}()
+	if stdin != nil {
+		go func() {
+			_, err := io.Copy(stdin, stdinData)
+			stdin.Close()
+			copyErr <- err
+		}()
+	} else {
+		copyErr <- nil
+	}
+	line := pg.NewLine("restic backup", progress)
+	summary, notes := parseBackupOutput(stdout, line)
 	waitErr := cmd.Wait()
 	streamErr := <-copyErr
+	line.Finish()
+	if progress != nil {
+		for _, note := range notes {
+			fmt.Fprintf(progress, "[restic] %s\n", Redact(note))
+		}
+	}
 	if streamErr != nil {
-		return fmt.Errorf("restic: stream backup data: %w", streamErr)
+		return BackupSummary{}, fmt.Errorf("restic: stream backup data: %w", streamErr)
 	}
 	if waitErr != nil {
-		return fmt.Errorf("restic: backup failed: %w", waitErr)
+		if msg := strings.TrimSpace(Redact(stderrBuf.String())); msg != "" {
+			return BackupSummary{}, fmt.Errorf("restic: backup failed: %w: %s", waitErr, msg)
+		}
+		return BackupSummary{}, fmt.Errorf("restic: backup failed: %w", waitErr)
 	}
-	return nil
+	if progress != nil && summary.SnapshotID != "" {
+		fmt.Fprintln(progress, describeSummary(label, summary))
+	}
+	return summary, nil
 }
 
 // BackupBytes is a convenience wrapper around BackupStream for small payloads
 // such as manifests or checksums.
-func BackupBytes(ctx context.Context, bin BinaryInfo, repo string, filename string, tags []string, data []byte, progress io.Writer) error {
+func BackupBytes(ctx context.Context, bin BinaryInfo, repo string, filename string, tags []string, data []byte, progress io.Writer) (BackupSummary, error) {
 	return BackupStream(ctx, bin, repo, filename, tags, bytes.NewReader(data), progress)
 }
 
 // Dump streams the specified file from a snapshot to the writer via
 // `restic dump`.
 func Dump(ctx context.Context, bin BinaryInfo, repo string, snapshotID string, path string, w io.Writer, progress io.Writer) error {
-	args := []string{"dump", snapshotID, path}
+	release, err := acquireLocal(ctx, repo)
+	if err != nil {
+		return err
+	}
+	defer release()
+	args := append(append(globalArgs(repo), retryLockArgs()...), "dump", snapshotID, path)
 	cmd := exec.CommandContext(ctx, bin.Path, args...)
-	cmd.Env = appendRepoEnv(cmd.Env, repo)
+	cmd.Env = repoEnv(os.Environ(), repo)
 	cmd.Stdout = w
 	if progress != nil {
 		cmd.Stderr = progress
@@ -150,6 +197,26 @@ type Snapshot struct {
 	Paths   []string  `json:"paths"`
 }
 
+// BundleSchemaTag marks snapshots that hold every file of one backup version
+// (data, manifest.json and checksums.txt, or all config files). Backups written
+// before it used one snapshot per file, distinguished by a part= tag.
+const BundleSchemaTag = "schema=v2"
+
+// IsBundle reports whether the snapshot holds a complete backup version.
+func (s Snapshot) IsBundle() bool {
+	tags := s.TagMap()
+	return tags["part"] == "" && "schema="+tags["schema"] == BundleSchemaTag
+}
+
+// HasPart reports whether the snapshot provides the given part, either as a
+// legacy part= snapshot or as a bundle containing every part.
+func (s Snapshot) HasPart(part string) bool {
+	if s.IsBundle() {
+		return true
+	}
+	return s.TagMap()["part"] == part
+}
+
 // TagMap converts a snapshot's tags (key=value) into a map.
 func (s Snapshot) TagMap() map[string]string {
 	out := make(map[string]string, len(s.Tags))
@@ -212,21 +279,37 @@ func snapshotHasAllTags(have []string, want []string) bool {
 	return true
 }
 
-func appendRepoEnv(env []string, repo string) []string {
-	if env == nil {
-		env = os.Environ()
-	}
-	return append(env, fmt.Sprintf("RESTIC_REPOSITORY=%s", repo))
-}
-
 func isNotRepository(stderr string) bool {
 	s := strings.ToLower(stderr)
 	return strings.Contains(s, "is not a repository") || strings.Contains(s, "does not look like a restic repository")
 }
 
+// runCommand runs restic while holding the host-local repository lock and
+// retries with backoff when restic reports that the repository is locked.
 func runCommand(ctx context.Context, bin BinaryInfo, repo string, args []string, stdin io.Reader) (string, string, error) {
-	cmd := exec.CommandContext(ctx, bin.Path, args...)
-	cmd.Env = appendRepoEnv(nil, repo)
+	release, err := acquireLocal(ctx, repo)
+	if err != nil {
+		return "", "", err
+	}
+	defer release()
+	for attempt := 0; ; attempt++ {
+		stdout, stderr, err := runCommandOnce(ctx, bin, repo, args, stdin)
+		if err == nil || !isLockError(stderr) {
+			return stdout, stderr, err
+		}
+		// Inputs cannot be replayed once consumed, so only retry stdin-less calls.
+		if stdin != nil || attempt >= len(lockBackoff) {
+			return stdout, stderr, fmt.Errorf("%w: %v", ErrRepositoryLocked, err)
+		}
+		if serr := sleepFn(ctx, lockBackoff[attempt]); serr != nil {
+			return stdout, stderr, fmt.Errorf("%w: %v", ErrRepositoryLocked, serr)
+		}
+	}
+}
+
+func runCommandOnce(ctx context.Context, bin BinaryInfo, repo string, args []string, stdin io.Reader) (string, string, error) {
+	cmd := exec.CommandContext(ctx, bin.Path, append(globalArgs(repo), args...)...)
+	cmd.Env = repoEnv(os.Environ(), repo)
 	if stdin != nil {
 		cmd.Stdin = stdin
 	}
@@ -234,5 +317,6 @@ func runCommand(ctx context.Context, bin BinaryInfo, repo string, args []string,
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 	err := cmd.Run()
-	return stdoutBuf.String(), stderrBuf.String(), err
+	// stderr ends up in error messages, so strip any secrets restic echoed.
+	return stdoutBuf.String(), Redact(stderrBuf.String()), err
 }
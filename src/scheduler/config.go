@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the daemon configuration file.
+type Config struct {
+	// StateFile persists the last run of every job across restarts.
+	StateFile string `yaml:"stateFile"`
+	Jobs      []Job  `yaml:"jobs"`
+}
+
+// Job is one scheduled backup definition.
+type Job struct {
+	Name   string `yaml:"name"`
+	Target string `yaml:"target"`
+	// Kind is what to back up: all|instances|volumes|buckets|config.
+	Kind    string   `yaml:"kind"`
+	Project string   `yaml:"project"`
+	Names   []string `yaml:"names"`
+	// Schedule is the cron expression for backups.
+	Schedule  string `yaml:"schedule"`
+	Optimized bool   `yaml:"optimized"`
+	// Keep prunes to the newest Keep versions per resource after each
+	// successful backup; 0 disables pruning.
+	Keep int `yaml:"keep"`
+	// Verify is an optional cron expression for checksum verification runs.
+	Verify string `yaml:"verify"`
+	// ResticConfig is a --restic-config file for restic targets.
+	ResticConfig string `yaml:"resticConfig"`
+}
+
+// Task kinds run for a job.
+const (
+	TaskBackup = "backup"
+	TaskVerify = "verify"
+)
+
+// LoadConfig reads and validates a daemon configuration file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read daemon config: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse daemon config %s: %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks every job and its schedules.
+func (c Config) Validate() error {
+	if len(c.Jobs) == 0 {
+		return errors.New("daemon config defines no jobs")
+	}
+	seen := map[string]bool{}
+	for i, j := range c.Jobs {
+		if j.Name == "" {
+			return fmt.Errorf("job %d: name is required", i+1)
+		}
+		if seen[j.Name] {
+			return fmt.Errorf("job %s: duplicate name", j.Name)
+		}
+		seen[j.Name] = true
+		if j.Target == "" {
+			return fmt.Errorf("job %s: target is required", j.Name)
+		}
+		switch j.Kind {
+		case "all", "instances", "volumes", "buckets", "config":
+		default:
+			return fmt.Errorf("job %s: kind must be all, instances, volumes, buckets or config", j.Name)
+		}
+		if len(j.Names) > 0 && j.Kind != "instances" && j.Kind != "volumes" && j.Kind != "buckets" {
+			return fmt.Errorf("job %s: names require kind instances, volumes or buckets", j.Name)
+		}
+		if _, err := ParseSchedule(j.Schedule); err != nil {
+			return fmt.Errorf("job %s: schedule: %w", j.Name, err)
+		}
+		if j.Verify != "" {
+			if _, err := ParseSchedule(j.Verify); err != nil {
+				return fmt.Errorf("job %s: verify: %w", j.Name, err)
+			}
+		}
+		if j.Keep < 0 {
+			return fmt.Errorf("job %s: keep must not be negative", j.Name)
+		}
+	}
+	// Each job prunes only what it backs up, but jobs covering the same
+	// resources would still prune each other's versions to their own keep.
+	for i, a := range c.Jobs {
+		for _, b := range c.Jobs[i+1:] {
+			if a.Keep > 0 && b.Keep > 0 && a.Keep != b.Keep && a.overlaps(b) {
+				return fmt.Errorf("jobs %s and %s back up the same resources to %s with different keep values", a.Name, b.Name, a.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// Kinds returns the resource kinds a job backs up; "all" covers config,
+// volumes and instances.
+func (j Job) Kinds() []string {
+	if j.Kind == "all" {
+		return []string{"config", "volumes", "instances"}
+	}
+	return []string{j.Kind}
+}
+
+// ProjectName returns the job's project, "default" when unset.
+func (j Job) ProjectName() string {
+	if j.Project == "" {
+		return "default"
+	}
+	return j.Project
+}
+
+// overlaps reports whether two jobs back up any common resource.
+func (j Job) overlaps(o Job) bool {
+	if j.Target != o.Target {
+		return false
+	}
+	for _, k := range j.Kinds() {
+		for _, ok := range o.Kinds() {
+			if k != ok {
+				continue
+			}
+			if k == "config" {
+				return true
+			}
+			if j.ProjectName() == o.ProjectName() && namesOverlap(j.Names, o.Names) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// namesOverlap reports whether two name selections share a resource; no
+// names selects everything.
+func namesOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+// Package scheduler runs configured backup jobs on cron schedules for the
+// daemon command.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"incus-backup/src/logging"
+)
+
+// Clock abstracts time so tests can drive the scheduler with a fake clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// ExecFunc runs one task (TaskBackup or TaskVerify) of a job. It must stop
+// promptly and clean up when ctx is cancelled.
+type ExecFunc func(ctx context.Context, job Job, task string) error
+
+// Scheduler runs job tasks one at a time as they fall due. Running tasks
+// serially means two jobs never export from Incus or write to a target at the
+// same time; occurrences missed while another task ran are coalesced into a
+// single run.
+type Scheduler struct {
+	Jobs      []Job
+	Exec      ExecFunc
+	Clock     Clock
+	StatePath string
+	// Logger receives scheduling and run records; nil discards them.
+	Logger *slog.Logger
+	// Notify, if set, is called after every run has been recorded.
+	Notify func(job Job, task string, run RunState)
+}
+
+type task struct {
+	job   Job
+	kind  string
+	sched Schedule
+	next  time.Time
+	order int
+}
+
+// Run executes tasks until ctx is cancelled. Cancellation is passed to the
+// running task, whose outcome is recorded as cancelled before Run returns.
+// A task whose last recorded run is older than its previous occurrence (the
+// daemon was down) runs once right away.
+func (s *Scheduler) Run(ctx context.Context) error {
+	clock := s.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	state, err := LoadState(s.StatePath)
+	if err != nil {
+		return err
+	}
+	tasks, err := s.tasks(state, clock.Now())
+	if err != nil {
+		return err
+	}
+	log := s.Logger
+	if log == nil {
+		log = logging.Discard
+	}
+	for _, t := range tasks {
+		log.Info("task scheduled", "job", t.job.Name, "task", t.kind, "next", t.next.Format(time.RFC3339))
+	}
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		sort.SliceStable(tasks, func(i, j int) bool {
+			if !tasks[i].next.Equal(tasks[j].next) {
+				return tasks[i].next.Before(tasks[j].next)
+			}
+			return tasks[i].order < tasks[j].order
+		})
+		t := tasks[0]
+		now := clock.Now()
+		if t.next.After(now) {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-clock.After(t.next.Sub(now)):
+			}
+			continue
+		}
+
+		run := RunState{Start: clock.Now()}
+		log.Info("task started", "job", t.job.Name, "task", t.kind)
+		err := s.Exec(ctx, t.job, t.kind)
+		run.End = clock.Now()
+		switch {
+		case ctx.Err() != nil:
+			run.Status = StatusCancelled
+		case err != nil:
+			run.Status = StatusFailed
+		default:
+			run.Status = StatusOK
+		}
+		attrs := []any{"job", t.job.Name, "task", t.kind, "status", run.Status, "duration", run.End.Sub(run.Start).Round(time.Second)}
+		if err != nil {
+			run.Error = err.Error()
+			log.Error("task finished", append(attrs, "error", err)...)
+		} else {
+			log.Info("task finished", attrs...)
+		}
+		state.record(t.job.Name, t.kind, run)
+		if err := state.Save(s.StatePath); err != nil {
+			log.Error("save state failed", "path", s.StatePath, "error", err)
+		}
+		if s.Notify != nil {
+			s.Notify(t.job, t.kind, run)
+		}
+		tasks[0].next = t.sched.Next(clock.Now())
+	}
+}
+
+// NextRuns returns when each task would next run, in configuration order.
+func (s *Scheduler) NextRuns(now time.Time) ([]string, error) {
+	state, err := LoadState(s.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := s.tasks(state, now)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, fmt.Sprintf("%s\t%s\t%s\t%s", t.job.Name, t.kind, t.sched, t.next.Format(time.RFC3339)))
+	}
+	return out, nil
+}
+
+func (s *Scheduler) tasks(state State, now time.Time) ([]*task, error) {
+	var tasks []*task
+	add := func(j Job, kind, expr string) error {
+		sched, err := ParseSchedule(expr)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", j.Name, err)
+		}
+		next := sched.Next(now)
+		if last, ok := state.Last(j.Name, kind); ok {
+			if missed := sched.Next(last.Start); missed.Before(now) {
+				next = now
+			}
+		}
+		tasks = append(tasks, &task{job: j, kind: kind, sched: sched, next: next, order: len(tasks)})
+		return nil
+	}
+	for _, j := range s.Jobs {
+		if err := add(j, TaskBackup, j.Schedule); err != nil {
+			return nil, err
+		}
+		if j.Verify != "" {
+			if err := add(j, TaskVerify, j.Verify); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("no jobs to schedule")
+	}
+	return tasks, nil
+}
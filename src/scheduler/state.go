@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Run statuses recorded in the state file.
+const (
+	StatusOK        = "ok"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// RunState records the last run of one task.
+type RunState struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// State is the persisted last-run state, keyed by job name and task.
+type State struct {
+	Jobs map[string]map[string]RunState `json:"jobs"`
+}
+
+// LoadState reads the state file; a missing file yields an empty state.
+func LoadState(path string) (State, error) {
+	st := State{Jobs: map[string]map[string]RunState{}}
+	if path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if st.Jobs == nil {
+		st.Jobs = map[string]map[string]RunState{}
+	}
+	return st, nil
+}
+
+// Save writes the state via a temp file so a crash never truncates it.
+func (s State) Save(path string) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Last returns the last recorded run of a task.
+func (s State) Last(job, task string) (RunState, bool) {
+	r, ok := s.Jobs[job][task]
+	return r, ok
+}
+
+func (s State) record(job, task string, r RunState) {
+	if s.Jobs[job] == nil {
+		s.Jobs[job] = map[string]RunState{}
+	}
+	s.Jobs[job][task] = r
+}
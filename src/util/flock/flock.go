@@ -0,0 +1,71 @@
+// Package flock provides advisory file locks used to keep concurrent
+// incus-backup processes from interfering with each other on the same target.
+package flock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrLocked is returned when a lock is held by another process.
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is an acquired advisory lock. Locks are released automatically by the
+// kernel when the process exits, so a crashed run never leaves a stale lock.
+type Lock struct {
+	f         *os.File
+	path      string
+	exclusive bool
+}
+
+// TryLock acquires a shared or exclusive lock on path without blocking. The
+// file is created if needed. When exclusive, owner is recorded in the file so
+// contending processes can report who holds it.
+func TryLock(path string, exclusive bool, owner string) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock %s: %w", path, err)
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			if holder := Holder(path); holder != "" {
+				return nil, fmt.Errorf("%w (%s)", ErrLocked, holder)
+			}
+		}
+		return nil, err
+	}
+	if exclusive && owner != "" {
+		_ = f.Truncate(0)
+		_, _ = f.WriteAt([]byte(owner+"\n"), 0)
+	}
+	return &Lock{f: f, path: path, exclusive: exclusive}, nil
+}
+
+// Holder returns the owner recorded by the last exclusive holder, if any.
+func Holder(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	if l.exclusive {
+		// Clear the owner so later contention is not blamed on us.
+		_ = l.f.Truncate(0)
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package flock
+
+import "os"
+
+// Advisory locking is only implemented on Unix hosts, which is where Incus runs.
+func lockFile(*os.File, bool) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
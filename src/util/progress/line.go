@@ -0,0 +1,70 @@
+package progress
+
+import (
+    "fmt"
+    "io"
+    "sync"
+    "time"
+)
+
+// Status is a progress report from an external tool such as restic.
+type Status struct {
+    Done      int64
+    Total     int64
+    Files     int64
+    Remaining time.Duration
+}
+
+// Line renders Status updates in the same format as Reader, for producers
+// that report progress themselves instead of being read through.
+type Line struct {
+    out         io.Writer
+    label       string
+    mu          sync.Mutex
+    last        Status
+    started     bool
+    lastPrinted time.Time
+}
+
+// NewLine creates a Line. A nil out discards all updates.
+func NewLine(label string, out io.Writer) *Line {
+    return &Line{out: out, label: label}
+}
+
+// Update records s and redraws the line at most every 200ms.
+func (l *Line) Update(s Status) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.last = s
+    l.started = true
+    now := time.Now()
+    if now.Sub(l.lastPrinted) >= 200*time.Millisecond {
+        l.print()
+        l.lastPrinted = now
+    }
+}
+
+// Finish draws the final state and terminates the line. It is a no-op when
+// no update was ever received.
+func (l *Line) Finish() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if !l.started || l.out == nil {
+        return
+    }
+    l.last.Remaining = 0
+    l.print()
+    fmt.Fprint(l.out, "\n")
+    l.started = false
+}
+
+func (l *Line) print() {
+    suffix := ""
+    if l.last.Files > 0 {
+        suffix += fmt.Sprintf(" files=%d", l.last.Files)
+    }
+    if l.last.Remaining > 0 {
+        suffix += fmt.Sprintf(" eta=%s", l.last.Remaining.Round(time.Second))
+    }
+    render(l.out, l.label, l.last.Done, l.last.Total, suffix)
+}
@@ -45,14 +45,19 @@ func (p *Reader) Read(b []byte) (int, error) {
 }
 
 func (p *Reader) print() {
-    if p.out == nil {
+    render(p.out, p.label, p.read, p.total, "")
+}
+
+// render writes one self-overwriting progress line shared by Reader and Line.
+func render(out io.Writer, label string, done, total int64, suffix string) {
+    if out == nil {
         return
     }
-    if p.total > 0 {
-        pct := float64(p.read) / float64(p.total) * 100
-        fmt.Fprintf(p.out, "\r[%s] %.1f%% (%d/%d bytes)", p.label, pct, p.read, p.total)
+    if total > 0 {
+        pct := float64(done) / float64(total) * 100
+        fmt.Fprintf(out, "\r[%s] %.1f%% (%d/%d bytes)%s", label, pct, done, total, suffix)
     } else {
-        fmt.Fprintf(p.out, "\r[%s] %d bytes", p.label, p.read)
+        fmt.Fprintf(out, "\r[%s] %d bytes%s", label, done, suffix)
     }
 }
 
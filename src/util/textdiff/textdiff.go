@@ -0,0 +1,154 @@
+// Package textdiff renders line-based unified diffs of small documents.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// Unified returns a unified diff turning a into b, labelled with the given
+// names, or "" when they are equal. Documents are split on newlines; a
+// trailing newline does not add an empty line.
+func Unified(fromName, toName, a, b string) string {
+	ops := diff(splitLines(a), splitLines(b))
+	changed := false
+	for _, o := range ops {
+		if o.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks(ops) {
+		sb.WriteString(h)
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diff computes an edit script from the longest common subsequence of a and
+// b. It is quadratic, which is fine for config documents.
+func diff(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
+
+// hunks groups ops into hunks with up to context unchanged lines around
+// each change, merging hunks whose context would overlap.
+func hunks(ops []op) []string {
+	var out []string
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		// Extend until a run of more than 2*context unchanged lines.
+		last := first
+		for k := first; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				last = k
+				continue
+			}
+			if k-last > 2*context {
+				break
+			}
+		}
+		lo := max(first-context, 0)
+		hi := min(last+context+1, len(ops))
+
+		// Line numbers of the hunk start in a and b.
+		aLine, bLine := 1, 1
+		for _, o := range ops[:lo] {
+			if o.kind != '+' {
+				aLine++
+			}
+			if o.kind != '-' {
+				bLine++
+			}
+		}
+		var body strings.Builder
+		aCount, bCount := 0, 0
+		for _, o := range ops[lo:hi] {
+			if o.kind != '+' {
+				aCount++
+			}
+			if o.kind != '-' {
+				bCount++
+			}
+			body.WriteByte(o.kind)
+			body.WriteString(o.line)
+			body.WriteByte('\n')
+		}
+		out = append(out, fmt.Sprintf("@@ -%s +%s @@\n%s", hunkRange(aLine, aCount), hunkRange(bLine, bCount), body.String()))
+		start = hi
+	}
+	return out
+}
+
+// hunkRange formats a hunk's start and length; an empty range starts at
+// the line before it, as in diff -u.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,99 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/archive"
+)
+
+func extractMembers() []member {
+	return append(containerMembers(),
+		member{name: "backup/container/rootfs/etc/nginx/", dir: true},
+		member{name: "backup/container/rootfs/etc/nginx/nginx.conf", body: "worker_processes 1;\n"},
+		member{name: "backup/container/rootfs/etc/nginx/mime.types", body: "types {}\n"},
+	)
+}
+
+func TestExtractSelectsGlobsAndSubtrees(t *testing.T) {
+	dest := t.TempDir()
+	m, err := archive.NewPathMatcher([]string{"/etc/nginx", "etc/host*"})
+	if err != nil {
+		t.Fatalf("matcher: %v", err)
+	}
+	data := gzipBytes(t, buildTar(t, extractMembers()))
+	got, err := archive.Extract(bytes.NewReader(data), dest, m, archive.ExtractOptions{})
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected nginx dir, its two files and hostname, got %+v", got)
+	}
+	b, err := os.ReadFile(filepath.Join(dest, "etc", "nginx", "nginx.conf"))
+	if err != nil || string(b) != "worker_processes 1;\n" {
+		t.Fatalf("unexpected nginx.conf: %q %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "bin", "sh")); !os.IsNotExist(err) {
+		t.Fatalf("unselected file extracted: %v", err)
+	}
+
+	// Existing files are kept unless Overwrite is set.
+	if err := os.WriteFile(filepath.Join(dest, "etc", "hostname"), []byte("local\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, _ = archive.NewPathMatcher([]string{"/etc/hostname"})
+	got, err = archive.Extract(bytes.NewReader(data), dest, m, archive.ExtractOptions{})
+	if err != nil || len(got) != 1 || got[0].Status != archive.SkippedExists {
+		t.Fatalf("expected skipped existing file, got %+v %v", got, err)
+	}
+	m, _ = archive.NewPathMatcher([]string{"/etc/hostname"})
+	if _, err := archive.Extract(bytes.NewReader(data), dest, m, archive.ExtractOptions{Overwrite: true}); err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dest, "etc", "hostname")); string(b) != "web\n" {
+		t.Fatalf("file not overwritten: %q", b)
+	}
+}
+
+func TestExtractDryRunAndUnmatched(t *testing.T) {
+	dest := t.TempDir()
+	m, _ := archive.NewPathMatcher([]string{"/etc/nginx/*.conf", "/nope"})
+	got, err := archive.Extract(bytes.NewReader(buildTar(t, extractMembers())), dest, m, archive.ExtractOptions{DryRun: true})
+	if err == nil || !strings.Contains(err.Error(), "no paths match /nope") {
+		t.Fatalf("expected unmatched pattern error, got %v", err)
+	}
+	if len(got) != 1 || got[0].Status != archive.WouldExtract || got[0].Path != "/etc/nginx/nginx.conf" {
+		t.Fatalf("unexpected dry-run result: %+v", got)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Fatalf("dry run wrote files: %v", entries)
+	}
+	if _, err := archive.NewPathMatcher([]string{"/etc/["}); err == nil {
+		t.Fatalf("expected invalid pattern error")
+	}
+}
+
+func TestExtractRefusesToWriteThroughSymlinks(t *testing.T) {
+	dest, outside := t.TempDir(), t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "backup/index.yaml", Mode: 0o644, Size: int64(len(containerIndex)), Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte(containerIndex))
+	_ = tw.WriteHeader(&tar.Header{Name: "backup/container/rootfs/etc", Linkname: outside, Typeflag: tar.TypeSymlink})
+	_ = tw.WriteHeader(&tar.Header{Name: "backup/container/rootfs/etc/passwd", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+
+	m, _ := archive.NewPathMatcher([]string{"/etc"})
+	_, err := archive.Extract(bytes.NewReader(buf.Bytes()), dest, m, archive.ExtractOptions{})
+	if err == nil || !strings.Contains(err.Error(), "symlink") {
+		t.Fatalf("expected symlink error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "passwd")); !os.IsNotExist(err) {
+		t.Fatalf("file written outside destination")
+	}
+}
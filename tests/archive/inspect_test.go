@@ -0,0 +1,140 @@
+package archive_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+
+	"incus-backup/src/archive"
+)
+
+const containerIndex = `name: web
+backend: dir
+pool: default
+optimized: false
+type: container
+config:
+  container:
+    name: web
+    project: default
+    type: container
+    architecture: x86_64
+`
+
+type member struct {
+	name string
+	body string
+	dir  bool
+}
+
+func buildTar(t *testing.T, members []member) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.body)), Typeflag: tar.TypeReg}
+		if m.dir {
+			hdr = &tar.Header{Name: m.name, Mode: 0o755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("header: %v", err)
+		}
+		if !m.dir {
+			if _, err := tw.Write([]byte(m.body)); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func containerMembers() []member {
+	return []member{
+		{name: "backup/", dir: true},
+		{name: "backup/index.yaml", body: containerIndex},
+		{name: "backup/container/rootfs/", dir: true},
+		{name: "backup/container/rootfs/etc/hostname", body: "web\n"},
+		{name: "backup/container/rootfs/bin/sh", body: "#!binary"},
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectGzipContainer(t *testing.T) {
+	data := gzipBytes(t, buildTar(t, containerMembers()))
+	sum, err := archive.Inspect(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if sum.Compression != archive.CompressionGzip {
+		t.Fatalf("compression = %s", sum.Compression)
+	}
+	if sum.Index == nil || sum.Index.Name != "web" || sum.Index.Type != "container" || sum.Index.Project() != "default" {
+		t.Fatalf("unexpected index: %+v", sum.Index)
+	}
+	if sum.DataPath != "backup/container/rootfs/" || sum.DataFiles != 2 || sum.DataBytes != int64(len("web\n")+len("#!binary")) {
+		t.Fatalf("unexpected data summary: %+v", sum)
+	}
+	if probs := sum.Index.CheckAgainst("instance", "default", "web"); len(probs) != 0 {
+		t.Fatalf("unexpected problems: %v", probs)
+	}
+	if probs := sum.Index.CheckAgainst("volume", "other", "db"); len(probs) != 3 {
+		t.Fatalf("expected name, type and project problems; got %v", probs)
+	}
+}
+
+func TestInspectXzAndPlainTar(t *testing.T) {
+	raw := buildTar(t, containerMembers())
+	var xzBuf bytes.Buffer
+	xw, err := xz.NewWriter(&xzBuf)
+	if err != nil {
+		t.Fatalf("xz: %v", err)
+	}
+	xw.Write(raw)
+	xw.Close()
+
+	for name, data := range map[string][]byte{archive.CompressionXz: xzBuf.Bytes(), archive.CompressionNone: raw} {
+		sum, err := archive.Inspect(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: inspect: %v", name, err)
+		}
+		if sum.Compression != name || sum.DataFiles != 2 {
+			t.Fatalf("%s: unexpected summary %+v", name, sum)
+		}
+	}
+}
+
+func TestInspectDetectsTruncationAndMissingIndex(t *testing.T) {
+	data := gzipBytes(t, buildTar(t, containerMembers()))
+	if _, err := archive.Inspect(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Fatalf("expected error for truncated export")
+	}
+
+	noIndex := gzipBytes(t, buildTar(t, []member{{name: "backup/container/rootfs/a", body: "x"}}))
+	_, err := archive.Inspect(bytes.NewReader(noIndex))
+	if err == nil || !strings.Contains(err.Error(), "index.yaml not found") {
+		t.Fatalf("expected missing index error, got %v", err)
+	}
+
+	if _, err := archive.Inspect(strings.NewReader("definitely not an archive")); err == nil {
+		t.Fatalf("expected unrecognised format error")
+	}
+}
@@ -0,0 +1,41 @@
+package archive_test
+
+import (
+	"bytes"
+	"testing"
+
+	"incus-backup/src/archive"
+)
+
+func TestReadTreeListsRootfs(t *testing.T) {
+	members := append(containerMembers(),
+		member{name: "backup/snapshots/snap0/etc/hostname", body: "old\n"})
+	tree, err := archive.ReadTree(bytes.NewReader(gzipBytes(t, buildTar(t, members))))
+	if err != nil {
+		t.Fatalf("read tree: %v", err)
+	}
+	if tree.Index == nil || tree.Index.Name != "web" || tree.DataPath != "backup/container/rootfs/" {
+		t.Fatalf("unexpected tree: %+v", tree)
+	}
+	if len(tree.Entries) != 2 {
+		t.Fatalf("expected only rootfs files, got %+v", tree.Entries)
+	}
+	e := tree.Entries["/etc/hostname"]
+	if e.Type != archive.EntryFile || e.Size != 4 || e.Mode != 0o644 || len(e.SHA256) != 64 {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+}
+
+func TestReadTreeListsDiskImage(t *testing.T) {
+	members := []member{
+		{name: "backup/index.yaml", body: "name: vm\ntype: virtual-machine\n"},
+		{name: "backup/virtual-machine.img", body: "disk"},
+	}
+	tree, err := archive.ReadTree(bytes.NewReader(buildTar(t, members)))
+	if err != nil {
+		t.Fatalf("read tree: %v", err)
+	}
+	if e, ok := tree.Entries["virtual-machine.img"]; !ok || e.Size != 4 {
+		t.Fatalf("expected disk image entry, got %+v", tree.Entries)
+	}
+}
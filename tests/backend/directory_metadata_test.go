@@ -0,0 +1,78 @@
+package backend_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/util/flock"
+)
+
+func TestDirectoryMetadata_InitLoadAndValidate(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "repo")
+	if err := dir.ValidateMetadata(root); err != nil {
+		t.Fatalf("uninitialized target should validate: %v", err)
+	}
+	md, err := dir.Init(root, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if md.SchemaVersion != dir.MetadataSchemaVersion || len(md.RepoID) != 32 || md.Defaults.Encryption != "none" {
+		t.Fatalf("unexpected metadata: %+v", md)
+	}
+	if _, err := dir.Init(root, time.Now()); !errors.Is(err, dir.ErrAlreadyInitialized) {
+		t.Fatalf("expected already initialized error, got %v", err)
+	}
+	loaded, err := dir.EnsureMetadata(root, time.Now())
+	if err != nil || loaded.RepoID != md.RepoID {
+		t.Fatalf("ensure should load existing header: %+v err=%v", loaded, err)
+	}
+
+	path := filepath.Join(root, dir.MetadataFile)
+	if err := os.WriteFile(path, []byte(`{"schemaVersion":9,"repoId":"x"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.ValidateMetadata(root); err == nil || !strings.Contains(err.Error(), "schema v9") {
+		t.Fatalf("expected future schema error, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`not json`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.ValidateMetadata(root); err == nil {
+		t.Fatalf("expected malformed metadata error")
+	}
+}
+
+func TestDirectoryLock_SharedWritersExcludePrune(t *testing.T) {
+	root := t.TempDir()
+	a, err := dir.LockShared(root)
+	if err != nil {
+		t.Fatalf("shared lock: %v", err)
+	}
+	b, err := dir.LockShared(root)
+	if err != nil {
+		t.Fatalf("second shared lock: %v", err)
+	}
+	if _, err := dir.LockExclusive(root, "prune"); !errors.Is(err, flock.ErrLocked) {
+		t.Fatalf("expected exclusive lock to fail while backups run, got %v", err)
+	}
+	a.Unlock()
+	b.Unlock()
+
+	ex, err := dir.LockExclusive(root, "pid 1: incus-backup prune")
+	if err != nil {
+		t.Fatalf("exclusive lock: %v", err)
+	}
+	_, err = dir.LockShared(root)
+	if !errors.Is(err, flock.ErrLocked) || !strings.Contains(err.Error(), "incus-backup prune") {
+		t.Fatalf("expected backup to be blocked by prune, got %v", err)
+	}
+	ex.Unlock()
+	if flock.Holder(filepath.Join(root, dir.LockFile)) != "" {
+		t.Fatalf("owner should be cleared after unlock")
+	}
+}
@@ -36,3 +36,22 @@ func mustMkdirAll(t *testing.T, path string) {
     }
 }
 
+
+func TestDirectory_List_Buckets(t *testing.T) {
+    root := t.TempDir()
+
+    mustMkdirAll(t, filepath.Join(root, "volumes", "default", "pool1", "volA", "20250102T020202Z"))
+    mustMkdirAll(t, filepath.Join(root, "buckets", "default", "s3", "assets", "20250105T050505Z"))
+
+    b, err := dir.New(root)
+    if err != nil {
+        t.Fatalf("new backend: %v", err)
+    }
+    entries, err := b.List("buckets")
+    if err != nil {
+        t.Fatalf("list: %v", err)
+    }
+    if len(entries) != 1 || entries[0].Type != "bucket" || entries[0].Pool != "s3" || entries[0].Name != "assets" {
+        t.Fatalf("unexpected entries: %+v", entries)
+    }
+}
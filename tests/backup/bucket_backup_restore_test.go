@@ -0,0 +1,176 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/archive"
+	bkt "incus-backup/src/backup/buckets"
+	"incus-backup/src/incusapi"
+)
+
+// bucketIndex is the backup/index.yaml of the fake bucket export; like
+// Incus it records the bucket keys in plaintext.
+const bucketIndex = `name: assets
+pool: s3
+bucket:
+  name: assets
+bucket_keys:
+- name: admin
+  role: admin
+  access-key: AK1
+  secret-key: SK1
+`
+
+// bucketExport returns an uncompressed bucket export tarball.
+func bucketExport() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range []struct{ name, body string }{
+		{"backup/index.yaml", bucketIndex},
+		{"backup/bucket/logo.png", "BUCKET-DATA"},
+	} {
+		_ = tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.body)), Typeflag: tar.TypeReg})
+		_, _ = tw.Write([]byte(m.body))
+	}
+	_ = tw.Close()
+	return buf.Bytes()
+}
+
+func bucketFake() *incusapi.FakeClient {
+	fake := incusapi.NewFake()
+	fake.StoragePoolsMap["s3"] = incusapi.StoragePool{Name: "s3", Driver: "cephobject"}
+	fake.BucketsMap["default/s3/assets"] = incusapi.Bucket{Project: "default", Pool: "s3", Name: "assets", Description: "static files"}
+	fake.BucketData["default/s3/assets"] = bucketExport()
+	fake.BucketKeysMap["default/s3/assets"] = []incusapi.BucketKey{
+		{Name: "admin", Role: "admin", AccessKey: "AK1", SecretKey: "SK1"},
+		{Name: "ro", Role: "read-only", AccessKey: "AK2", SecretKey: "SK2"},
+	}
+	return fake
+}
+
+func TestBucketBackupAndRestore_WithFakeClient(t *testing.T) {
+	root := t.TempDir()
+	fake := bucketFake()
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	dir, err := bkt.BackupBucket(fake, root, "default", "s3", "assets", nil, now, nil)
+	if err != nil {
+		t.Fatalf("backup bucket: %v", err)
+	}
+	if want := filepath.Join(root, "buckets", "default", "s3", "assets", "20250102T030405Z"); dir != want {
+		t.Fatalf("unexpected dir %s, want %s", dir, want)
+	}
+	for _, f := range []string{"bucket.tar.xz", "manifest.json", "checksums.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("missing %s: %v", f, err)
+		}
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	mf, err := bkt.ParseManifest(b)
+	if err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	if len(mf.Keys) != 2 || mf.EncryptedKeys != nil || mf.Source.PoolDriver != "cephobject" {
+		t.Fatalf("unexpected manifest: %+v", mf)
+	}
+
+	if err := fake.DeleteBucket("default", "s3", "assets"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := bkt.RestoreBucket(fake, dir, "default", "s3", "assets", nil, nil); err != nil {
+		t.Fatalf("restore bucket: %v", err)
+	}
+	if got := fake.BucketData["default/s3/assets"]; !bytes.Equal(got, bucketExport()) {
+		t.Fatalf("restored export differs from the original")
+	}
+	want := bucketFake().BucketKeysMap["default/s3/assets"]
+	if got := fake.BucketKeysMap["default/s3/assets"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys not restored:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestBucketBackup_EncryptedKeys(t *testing.T) {
+	root := t.TempDir()
+	fake := bucketFake()
+	pass := []byte("correct horse")
+
+	dir, err := bkt.BackupBucket(fake, root, "default", "s3", "assets", pass, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("backup bucket: %v", err)
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if strings.Contains(string(raw), "SK1") {
+		t.Fatalf("manifest leaks secret key: %s", raw)
+	}
+	var mf bkt.Manifest
+	if err := json.Unmarshal(raw, &mf); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, err := mf.BucketKeys(nil); !errors.Is(err, bkt.ErrKeysLocked) {
+		t.Fatalf("expected ErrKeysLocked, got %v", err)
+	}
+	if _, err := mf.BucketKeys([]byte("wrong")); err == nil {
+		t.Fatalf("expected error for wrong passphrase")
+	}
+	keys, err := mf.BucketKeys(pass)
+	if err != nil || len(keys) != 2 || keys[0].SecretKey != "SK1" {
+		t.Fatalf("unexpected keys %+v (%v)", keys, err)
+	}
+
+	// The export no longer holds the keys in its index; the data is kept.
+	f, err := os.Open(filepath.Join(dir, "bucket.tar.xz"))
+	if err != nil {
+		t.Fatalf("open export: %v", err)
+	}
+	defer f.Close()
+	plain, _, err := archive.Decompress(f)
+	if err != nil {
+		t.Fatalf("decompress export: %v", err)
+	}
+	members := map[string]string{}
+	tr := tar.NewReader(plain)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read export: %v", err)
+		}
+		body, _ := io.ReadAll(tr)
+		members[hdr.Name] = string(body)
+	}
+	if idx := members["backup/index.yaml"]; strings.Contains(idx, "bucket_keys") || strings.Contains(idx, "SK1") || !strings.Contains(idx, "pool: s3") {
+		t.Fatalf("unexpected index in export:\n%s", idx)
+	}
+	if members["backup/bucket/logo.png"] != "BUCKET-DATA" {
+		t.Fatalf("bucket data not kept: %v", members)
+	}
+
+	// A wrong passphrase fails before the bucket is imported.
+	_ = fake.DeleteBucket("default", "s3", "assets")
+	if err := bkt.RestoreBucket(fake, dir, "default", "s3", "assets", []byte("wrong"), nil); err == nil {
+		t.Fatalf("expected restore to fail with wrong passphrase")
+	}
+	if ok, _ := fake.BucketExists("default", "s3", "assets"); ok {
+		t.Fatalf("bucket imported despite wrong passphrase")
+	}
+
+	// Without a passphrase the contents are restored and keys skipped.
+	if err := bkt.RestoreBucket(fake, dir, "default", "s3", "assets", nil, nil); err != nil {
+		t.Fatalf("restore without passphrase: %v", err)
+	}
+	if keys, _ := fake.ListBucketKeys("default", "s3", "assets"); len(keys) != 0 {
+		t.Fatalf("expected no keys without passphrase, got %+v", keys)
+	}
+}
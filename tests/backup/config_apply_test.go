@@ -22,7 +22,7 @@ func TestApplyProjectsPlan(t *testing.T) {
         {Name: "gamma", Config: nil},
     }
     plan := cfg.BuildProjectsPlan(current, desired)
-    summary, err := cfg.ApplyProjectsPlan(fake, plan)
+    summary, err := cfg.ApplyProjectsPlan(fake, plan, true)
     if err != nil { t.Fatalf("apply plan: %v", err) }
     if summary == "" { t.Fatalf("empty summary") }
 
@@ -0,0 +1,64 @@
+package backup_test
+
+import (
+	"testing"
+
+	cfg "incus-backup/src/backup/config"
+)
+
+func TestDiff_ReportsAddedRemovedAndChanged(t *testing.T) {
+	live, err := cfg.ListState(planFake())
+	if err != nil {
+		t.Fatalf("list state: %v", err)
+	}
+	changes := cfg.Diff(desiredState(), live, cfg.Selection{})
+
+	got := map[string]string{}
+	for _, c := range changes {
+		got[c.Kind+"/"+c.Name] = c.Change
+	}
+	want := map[string]string{
+		"networks/incusbr1": cfg.Added,
+		"projects/scratch":  cfg.Added,
+		"projects/dev":      cfg.Removed,
+		"profiles/extra":    cfg.Added,
+		"profiles/web":      cfg.Changed,
+		"profiles/db":       cfg.Removed,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("%s: expected %s, got %q (all: %+v)", k, v, got[k], changes)
+		}
+	}
+	for _, c := range changes {
+		if c.Kind == "profiles" && c.Name == "web" && (c.From == nil || c.To == nil) {
+			t.Fatalf("changed profile should carry both sides: %+v", c)
+		}
+	}
+}
+
+func TestDiff_HonoursSelection(t *testing.T) {
+	live, _ := cfg.ListState(planFake())
+	sel, err := cfg.ParseSelection([]string{"profiles/web"}, nil)
+	if err != nil {
+		t.Fatalf("parse selection: %v", err)
+	}
+	changes := cfg.Diff(desiredState(), live, sel)
+	if len(changes) != 1 || changes[0].Name != "web" {
+		t.Fatalf("expected only web profile, got %+v", changes)
+	}
+
+	// Snapshots taken before network objects and server settings were
+	// backed up do not report them as drift.
+	old := desiredState()
+	old.NetworkObjects.Missing, old.Server.Missing = true, true
+	if changes := cfg.Diff(old, desiredState(), cfg.Selection{}); len(changes) != 0 {
+		t.Fatalf("expected no drift for kinds the snapshot lacks, got %+v", changes)
+	}
+	if changes := cfg.Diff(live, live, cfg.Selection{}); len(changes) != 0 {
+		t.Fatalf("expected no drift against itself, got %+v", changes)
+	}
+}
@@ -0,0 +1,129 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/incusapi"
+)
+
+func TestApplyPlan_RollsBackOnFailure(t *testing.T) {
+	fake := planFake()
+	current, _ := cfg.ListState(fake)
+	plan := cfg.BuildPlan(current, desiredState())
+
+	path := filepath.Join(t.TempDir(), "journal.json")
+	journal, err := cfg.StartJournal(fake, path, "20250102T030405Z", time.Now())
+	if err != nil {
+		t.Fatalf("start journal: %v", err)
+	}
+	// Someone creates the db profile after the plan was built, so creating
+	// it fails after networks and projects were changed.
+	_ = fake.CreateProfile(incusapi.Profile{Name: "db", Description: "not ours"})
+
+	var out strings.Builder
+	err = cfg.ApplyPlan(fake, plan, cfg.ApplyOptions{PruneExtra: true, Journal: journal}, &out)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected rolled back error, got %v\n%s", err, out.String())
+	}
+	if _, ok := fake.ProjectsMap["dev"]; ok {
+		t.Fatalf("created project not rolled back")
+	}
+	if _, ok := fake.ProjectsMap["scratch"]; !ok {
+		t.Fatalf("deleted project not recreated")
+	}
+	if _, ok := fake.NetworksMap["incusbr1"]; !ok {
+		t.Fatalf("deleted network not recreated")
+	}
+	if got := fake.ProfilesMap["db"].Description; got != "not ours" {
+		t.Fatalf("rollback touched a profile the apply failed to create: %q", got)
+	}
+
+	loaded, err := cfg.LoadJournal(path)
+	if err != nil {
+		t.Fatalf("load journal: %v", err)
+	}
+	if loaded.Status != cfg.JournalRolledBack || len(loaded.Undo()) != 0 {
+		t.Fatalf("unexpected journal after rollback: %+v", loaded)
+	}
+	if last := loaded.Steps[len(loaded.Steps)-1]; last.Kind != "profiles" || last.Status != cfg.StepFailed {
+		t.Fatalf("expected failed profile step last, got %+v", last)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("journal should be private: %v %v", info.Mode(), err)
+	}
+}
+
+func TestRollback_UndoesCompletedApply(t *testing.T) {
+	fake := planFake()
+	before, _ := cfg.ListState(fake)
+	plan := cfg.BuildPlan(before, desiredState())
+
+	path := filepath.Join(t.TempDir(), "journal.json")
+	journal, err := cfg.StartJournal(fake, path, "20250102T030405Z", time.Now())
+	if err != nil {
+		t.Fatalf("start journal: %v", err)
+	}
+	if err := cfg.ApplyPlan(fake, plan, cfg.ApplyOptions{PruneExtra: true, Journal: journal}, &strings.Builder{}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	loaded, err := cfg.LoadJournal(path)
+	if err != nil {
+		t.Fatalf("load journal: %v", err)
+	}
+	if loaded.Status != cfg.JournalApplied || len(loaded.Undo()) == 0 {
+		t.Fatalf("unexpected journal after apply: %+v", loaded)
+	}
+	if err := cfg.Rollback(fake, loaded, &strings.Builder{}); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	after, _ := cfg.ListState(fake)
+	undo := cfg.BuildPlan(after, before)
+	if c, u, d := undo.NetworkObjectsPlan.Counts(); c+u+d != 0 || !undo.Profiles.Empty() ||
+		len(undo.Projects.ToCreate)+len(undo.Projects.ToUpdate)+len(undo.Projects.ToDelete) != 0 ||
+		len(undo.Networks.ToCreate)+len(undo.Networks.ToUpdate)+len(undo.Networks.ToDelete) != 0 {
+		t.Fatalf("server not back to its state before apply: %+v", undo)
+	}
+
+	// A second rollback has nothing left to undo.
+	var out strings.Builder
+	if err := cfg.Rollback(fake, loaded, &out); err != nil || !strings.Contains(out.String(), "undone=0") {
+		t.Fatalf("expected no-op rollback, got %v\n%s", err, out.String())
+	}
+}
+
+func TestRollback_RecreatesDeletedZoneWithRecords(t *testing.T) {
+	fake := incusapi.NewFake()
+	_ = fake.CreateNetworkZone(incusapi.NetworkZone{Name: "example.net"})
+	for _, name := range []string{"www", "mail"} {
+		_ = fake.CreateNetworkZoneRecord(incusapi.NetworkZoneRecord{Zone: "example.net", Name: name,
+			Entries: []incusapi.NetworkZoneRecordEntry{{Type: "A", Value: "10.0.0.1"}}})
+	}
+	journal, err := cfg.StartJournal(fake, filepath.Join(t.TempDir(), "journal.json"), "20250102T030405Z", time.Now())
+	if err != nil {
+		t.Fatalf("start journal: %v", err)
+	}
+	// A record was pruned on its own, then its zone with the rest.
+	_ = fake.DeleteNetworkZoneRecord("example.net", "www")
+	_ = fake.DeleteNetworkZone("example.net")
+	journal.Steps = []cfg.JournalStep{
+		{Kind: "network_zone_records", Action: "delete", Name: "example.net/www", Status: cfg.StepDone},
+		{Kind: "network_zones", Action: "delete", Name: "example.net", Status: cfg.StepDone},
+	}
+
+	var out strings.Builder
+	if err := cfg.Rollback(fake, journal, &out); err != nil {
+		t.Fatalf("rollback: %v\n%s", err, out.String())
+	}
+	if _, ok := fake.NetworkZonesMap["example.net"]; !ok {
+		t.Fatalf("zone not recreated")
+	}
+	if len(fake.NetworkZoneRecordsMap) != 2 {
+		t.Fatalf("records not recreated: %v", fake.NetworkZoneRecordsMap)
+	}
+}
@@ -0,0 +1,149 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/incusapi"
+)
+
+func networkObjectsFake() *incusapi.FakeClient {
+	fake := incusapi.NewFake()
+	fake.NetworksMap["br0"] = incusapi.Network{Name: "br0", Managed: true, Type: "bridge"}
+	fake.NetworksMap["ovn0"] = incusapi.Network{Name: "ovn0", Managed: true, Type: "ovn"}
+	fake.NetworksMap["eth0"] = incusapi.Network{Name: "eth0", Managed: false, Type: "physical"}
+	_ = fake.CreateNetworkACL(incusapi.NetworkACL{
+		Name:    "web",
+		Ingress: []incusapi.NetworkACLRule{{Action: "allow", Protocol: "tcp", DestinationPort: "443", State: "enabled"}},
+	})
+	_ = fake.CreateNetworkZone(incusapi.NetworkZone{Name: "example.net"})
+	_ = fake.CreateNetworkZoneRecord(incusapi.NetworkZoneRecord{
+		Zone:    "example.net",
+		Name:    "www",
+		Entries: []incusapi.NetworkZoneRecordEntry{{Type: "A", TTL: 300, Value: "10.0.0.10"}},
+	})
+	_ = fake.CreateNetworkForward(incusapi.NetworkForward{
+		Network:       "br0",
+		ListenAddress: "192.0.2.1",
+		Ports:         []incusapi.NetworkForwardPort{{Protocol: "tcp", ListenPort: "80", TargetAddress: "10.0.0.10"}},
+	})
+	_ = fake.CreateNetworkLoadBalancer(incusapi.NetworkLoadBalancer{
+		Network:       "ovn0",
+		ListenAddress: "192.0.2.2",
+		Backends:      []incusapi.NetworkLoadBalancerBackend{{Name: "web1", TargetAddress: "10.0.1.10"}},
+		Ports:         []incusapi.NetworkLoadBalancerPort{{Protocol: "tcp", ListenPort: "443", TargetBackend: []string{"web1"}}},
+	})
+	_ = fake.CreateNetworkPeer(incusapi.NetworkPeer{Network: "ovn0", Name: "to-ovn1", Type: "local", TargetProject: "default", TargetNetwork: "ovn1"})
+	return fake
+}
+
+func TestBackupAll_WritesNetworkObjects(t *testing.T) {
+	root := t.TempDir()
+	fake := networkObjectsFake()
+
+	dir, err := cfg.BackupAll(fake, root, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("backup all: %v", err)
+	}
+	for _, f := range []string{"network_acls.json", "network_zones.json", "network_zone_records.json", "network_forwards.json", "network_load_balancers.json", "network_peers.json"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("missing %s: %v", f, err)
+		}
+	}
+
+	loaded, err := cfg.LoadNetworkObjectsDir(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want, err := cfg.ListNetworkObjects(fake)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", loaded, want)
+	}
+	if len(loaded.ACLs) != 1 || len(loaded.ZoneRecords) != 1 || len(loaded.Forwards) != 1 || len(loaded.LoadBalancers) != 1 || len(loaded.Peers) != 1 {
+		t.Fatalf("unexpected objects: %+v", loaded)
+	}
+}
+
+func TestLoadNetworkObjectsDir_OlderSnapshot(t *testing.T) {
+	objs, err := cfg.LoadNetworkObjectsDir(t.TempDir())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(objs, cfg.NetworkObjects{Missing: true}) {
+		t.Fatalf("expected missing objects, got %+v", objs)
+	}
+	current, _ := cfg.ListNetworkObjects(networkObjectsFake())
+	if c, u, d := cfg.BuildNetworkObjectsPlan(current, objs).Counts(); c+u+d != 0 {
+		t.Fatalf("older snapshot planned changes: %d %d %d", c, u, d)
+	}
+}
+
+func TestBuildNetworkObjectsPlan(t *testing.T) {
+	current, _ := cfg.ListNetworkObjects(networkObjectsFake())
+	desired, _ := cfg.ListNetworkObjects(networkObjectsFake())
+
+	desired.ACLs[0].Ingress[0].DestinationPort = "8443"
+	desired.Zones = nil
+	desired.ZoneRecords = nil
+	desired.Forwards = append(desired.Forwards, incusapi.NetworkForward{Network: "br0", ListenAddress: "192.0.2.3"})
+
+	plan := cfg.BuildNetworkObjectsPlan(current, desired)
+	if len(plan.ACLs.ToUpdate) != 1 || plan.ACLs.ToUpdate[0].Name != "web" {
+		t.Fatalf("unexpected ACL updates: %+v", plan.ACLs.ToUpdate)
+	}
+	if len(plan.Zones.ToDelete) != 1 {
+		t.Fatalf("unexpected zone deletes: %+v", plan.Zones.ToDelete)
+	}
+	if len(plan.ZoneRecords.ToDelete) != 0 {
+		t.Fatalf("records of a deleted zone should go with it: %+v", plan.ZoneRecords.ToDelete)
+	}
+	if len(plan.Forwards.ToCreate) != 1 || plan.Forwards.Key(plan.Forwards.ToCreate[0]) != "br0/192.0.2.3" {
+		t.Fatalf("unexpected forward creates: %+v", plan.Forwards.ToCreate)
+	}
+	if !plan.LoadBalancers.Empty() || !plan.Peers.Empty() {
+		t.Fatalf("expected no load balancer or peer changes: %+v %+v", plan.LoadBalancers, plan.Peers)
+	}
+	if c, u, d := plan.Counts(); c != 1 || u != 1 || d != 1 {
+		t.Fatalf("unexpected counts: %d %d %d", c, u, d)
+	}
+}
+
+func TestApplyNetworkObjectsPlan(t *testing.T) {
+	desired, _ := cfg.ListNetworkObjects(networkObjectsFake())
+
+	fake := incusapi.NewFake()
+	fake.NetworksMap["br0"] = incusapi.Network{Name: "br0", Managed: true, Type: "bridge"}
+	fake.NetworksMap["ovn0"] = incusapi.Network{Name: "ovn0", Managed: true, Type: "ovn"}
+	_ = fake.CreateNetworkACL(incusapi.NetworkACL{Name: "stale"})
+
+	current, _ := cfg.ListNetworkObjects(fake)
+	plan := cfg.BuildNetworkObjectsPlan(current, desired)
+	sums, err := cfg.ApplyNetworkObjectsPlan(fake, plan, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(sums) != 6 || sums[0] != "network_acls: created=1 updated=0 deleted=0" {
+		t.Fatalf("unexpected summaries: %v", sums)
+	}
+	if _, ok := fake.NetworkACLsMap["stale"]; !ok {
+		t.Fatalf("stale ACL deleted without allowDelete")
+	}
+	got, _ := cfg.ListNetworkObjects(fake)
+	if !reflect.DeepEqual(got.ZoneRecords, desired.ZoneRecords) || !reflect.DeepEqual(got.LoadBalancers, desired.LoadBalancers) || !reflect.DeepEqual(got.Peers, desired.Peers) {
+		t.Fatalf("objects not restored: %+v", got)
+	}
+
+	if _, err := cfg.ApplyNetworkObjectsPlan(fake, cfg.BuildNetworkObjectsPlan(got, desired), true); err != nil {
+		t.Fatalf("apply with delete: %v", err)
+	}
+	if _, ok := fake.NetworkACLsMap["stale"]; ok {
+		t.Fatalf("stale ACL kept with allowDelete")
+	}
+}
@@ -0,0 +1,193 @@
+package backup_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/incusapi"
+)
+
+// planFake returns a server that has grown a project, a profile and a
+// network since desiredState was backed up, and changed the web profile.
+func planFake() *incusapi.FakeClient {
+	fake := incusapi.NewFake()
+	_ = fake.CreateProject("default", nil)
+	_ = fake.CreateProject("scratch", nil)
+	_ = fake.CreateProfile(incusapi.Profile{Name: "default"})
+	_ = fake.CreateProfile(incusapi.Profile{Name: "web", Config: map[string]string{"limits.cpu": "8"}})
+	_ = fake.CreateProfile(incusapi.Profile{Name: "extra"})
+	_ = fake.CreateNetwork(incusapi.Network{Name: "incusbr0", Type: "bridge", Managed: true})
+	_ = fake.CreateNetwork(incusapi.Network{Name: "incusbr1", Type: "bridge", Managed: true})
+	return fake
+}
+
+func desiredState() cfg.State {
+	return cfg.State{
+		Projects: []incusapi.Project{{Name: "default"}, {Name: "dev"}},
+		Profiles: []incusapi.Profile{
+			{Name: "default"},
+			{Name: "web", Config: map[string]string{"limits.cpu": "2"}, Devices: map[string]map[string]string{"eth0": {"type": "nic", "network": "incusbr0"}}},
+			{Name: "db"},
+		},
+		Networks: []incusapi.Network{{Name: "incusbr0", Type: "bridge", Managed: true}},
+	}
+}
+
+func TestApplyPlan_KeepsExtraObjectsWithoutPruneExtra(t *testing.T) {
+	fake := planFake()
+	current, err := cfg.ListState(fake)
+	if err != nil {
+		t.Fatalf("list state: %v", err)
+	}
+	plan := cfg.BuildPlan(current, desiredState())
+	if len(plan.Profiles.ToDelete) != 1 || plan.Profiles.ToDelete[0].Name != "extra" {
+		t.Fatalf("expected only extra profile planned for deletion, got %+v", plan.Profiles.ToDelete)
+	}
+
+	var out strings.Builder
+	if err := cfg.ApplyPlan(fake, plan, cfg.ApplyOptions{}, &out); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	for _, want := range []string{"projects: created=1 updated=0 deleted=0", "profiles: created=1 updated=1 deleted=0", "networks: created=0 updated=0 deleted=0"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in:\n%s", want, out.String())
+		}
+	}
+	if _, ok := fake.ProjectsMap["scratch"]; !ok {
+		t.Fatalf("project deleted without --prune-extra")
+	}
+	if _, ok := fake.ProfilesMap["extra"]; !ok {
+		t.Fatalf("profile deleted without --prune-extra")
+	}
+	if got := fake.ProfilesMap["web"]; got.Config["limits.cpu"] != "2" || got.Devices["eth0"]["network"] != "incusbr0" {
+		t.Fatalf("web profile not updated: %+v", got)
+	}
+
+	current, _ = cfg.ListState(fake)
+	out.Reset()
+	if err := cfg.ApplyPlan(fake, cfg.BuildPlan(current, desiredState()), cfg.ApplyOptions{PruneExtra: true}, &out); err != nil {
+		t.Fatalf("apply with prune: %v", err)
+	}
+	if _, ok := fake.ProjectsMap["scratch"]; ok {
+		t.Fatalf("expected scratch project deleted with --prune-extra")
+	}
+	if _, ok := fake.ProfilesMap["extra"]; ok {
+		t.Fatalf("expected extra profile deleted with --prune-extra")
+	}
+	if _, ok := fake.NetworksMap["incusbr1"]; ok {
+		t.Fatalf("expected incusbr1 deleted with --prune-extra")
+	}
+	if _, ok := fake.ProfilesMap["default"]; !ok {
+		t.Fatalf("default profile must never be deleted")
+	}
+}
+
+func TestApplyPlan_PrunesUsersBeforeWhatTheyUse(t *testing.T) {
+	fake := planFake()
+	_ = fake.CreateStoragePool(incusapi.StoragePool{Name: "extra-pool", Driver: "dir"})
+	_ = fake.CreateProfile(incusapi.Profile{Name: "extra-disk", Devices: map[string]map[string]string{
+		"data": {"type": "disk", "pool": "extra-pool", "path": "/data"},
+		"eth0": {"type": "nic", "network": "incusbr1"},
+	}})
+	_ = fake.CreateNetworkForward(incusapi.NetworkForward{Network: "incusbr1", ListenAddress: "192.0.2.10"})
+	current, err := cfg.ListState(fake)
+	if err != nil {
+		t.Fatalf("list state: %v", err)
+	}
+	plan := cfg.BuildPlan(current, desiredState())
+	if len(plan.StoragePools.ToDelete) != 1 || len(plan.Forwards.ToDelete) != 1 {
+		t.Fatalf("expected the extra pool and forward planned for deletion, got %+v", plan)
+	}
+
+	var out strings.Builder
+	if err := cfg.ApplyPlan(fake, plan, cfg.ApplyOptions{PruneExtra: true}, &out); err != nil {
+		t.Fatalf("apply with prune: %v\n%s", err, out.String())
+	}
+	if _, ok := fake.StoragePoolsMap["extra-pool"]; ok {
+		t.Fatalf("expected extra-pool deleted")
+	}
+	if _, ok := fake.ProfilesMap["extra-disk"]; ok {
+		t.Fatalf("expected extra-disk profile deleted")
+	}
+	if _, ok := fake.NetworksMap["incusbr1"]; ok || len(fake.NetworkForwardsMap) != 0 {
+		t.Fatalf("expected incusbr1 and its forward deleted")
+	}
+	if !strings.Contains(out.String(), "storage_pools: created=0 updated=0 deleted=1") {
+		t.Fatalf("missing storage pool summary in:\n%s", out.String())
+	}
+}
+
+func TestPlanSelect_OnlyOneProfile(t *testing.T) {
+	fake := planFake()
+	current, _ := cfg.ListState(fake)
+	sel, err := cfg.ParseSelection([]string{"profiles/web"}, nil)
+	if err != nil {
+		t.Fatalf("parse selection: %v", err)
+	}
+	plan := cfg.BuildPlan(current, desiredState()).Select(sel)
+	if len(plan.Projects.ToCreate)+len(plan.Projects.ToDelete)+len(plan.Networks.ToDelete) != 0 {
+		t.Fatalf("expected only the web profile selected, got %+v", plan)
+	}
+	if len(plan.Profiles.ToCreate) != 0 || len(plan.Profiles.ToDelete) != 0 || len(plan.Profiles.ToUpdate) != 1 {
+		t.Fatalf("unexpected profile plan: %+v", plan.Profiles)
+	}
+
+	if err := cfg.ApplyPlan(fake, plan, cfg.ApplyOptions{PruneExtra: true}, &strings.Builder{}); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if _, ok := fake.ProjectsMap["dev"]; ok {
+		t.Fatalf("project created despite selection")
+	}
+	if _, ok := fake.ProfilesMap["extra"]; !ok {
+		t.Fatalf("profile deleted despite selection")
+	}
+	if fake.ProfilesMap["web"].Config["limits.cpu"] != "2" {
+		t.Fatalf("web profile not restored")
+	}
+}
+
+func TestPlanSelect_ExcludePattern(t *testing.T) {
+	current, _ := cfg.ListState(planFake())
+	sel, err := cfg.ParseSelection(nil, []string{"profiles/d*", "networks"})
+	if err != nil {
+		t.Fatalf("parse selection: %v", err)
+	}
+	plan := cfg.BuildPlan(current, desiredState()).Select(sel)
+	if len(plan.Profiles.ToCreate) != 0 {
+		t.Fatalf("expected db profile excluded, got %+v", plan.Profiles.ToCreate)
+	}
+	if len(plan.Networks.ToDelete) != 0 {
+		t.Fatalf("expected networks excluded, got %+v", plan.Networks)
+	}
+	if len(plan.Projects.ToCreate) != 1 {
+		t.Fatalf("expected projects kept, got %+v", plan.Projects)
+	}
+}
+
+func TestParseSelection_UnknownKind(t *testing.T) {
+	if _, err := cfg.ParseSelection([]string{"profile/web"}, nil); err == nil {
+		t.Fatalf("expected error for unknown kind")
+	}
+	if _, err := cfg.ParseSelection(nil, []string{"profiles/[web"}); err == nil {
+		t.Fatalf("expected error for malformed pattern")
+	}
+}
+
+func TestLoadStateDir_RoundTrip(t *testing.T) {
+	fake := planFake()
+	dir, err := cfg.BackupAll(fake, t.TempDir(), time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("backup all: %v", err)
+	}
+	loaded, err := cfg.LoadStateDir(dir)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	current, _ := cfg.ListState(fake)
+	plan := cfg.BuildPlan(current, loaded)
+	if c, u, d := plan.NetworkObjectsPlan.Counts(); c+u+d != 0 || !plan.Profiles.Empty() || len(plan.Projects.ToCreate)+len(plan.Projects.ToDelete) != 0 {
+		t.Fatalf("expected empty plan against own backup, got %+v", plan)
+	}
+}
@@ -0,0 +1,123 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/incusapi"
+)
+
+func serverFake() *incusapi.FakeClient {
+	fake := incusapi.NewFake()
+	fake.ServerConfig = map[string]string{
+		"core.https_address":          ":8443",
+		"images.auto_update_interval": "6",
+	}
+	_ = fake.CreateCertificate(incusapi.Certificate{Fingerprint: "abc123", Name: "admin", Type: "client", Certificate: "PEM"})
+	_ = fake.CreateClusterGroup(incusapi.ClusterGroup{Name: "default"})
+	_ = fake.CreateClusterGroup(incusapi.ClusterGroup{Name: "gpu", Members: []string{"node1"}})
+	return fake
+}
+
+func TestBackupAll_WritesServerState(t *testing.T) {
+	root := t.TempDir()
+	fake := serverFake()
+
+	dir, err := cfg.BackupAll(fake, root, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("backup all: %v", err)
+	}
+	for _, f := range []string{"server_config.json", "certificates.json", "cluster_groups.json"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("missing %s: %v", f, err)
+		}
+	}
+	loaded, err := cfg.LoadServerStateDir(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want, _ := cfg.ListServerState(fake)
+	if !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", loaded, want)
+	}
+
+	older, err := cfg.LoadServerStateDir(t.TempDir())
+	if err != nil || !older.Missing {
+		t.Fatalf("expected missing server state, got %+v (%v)", older, err)
+	}
+	if plan := cfg.BuildServerPlan(want, older); !plan.Empty() {
+		t.Fatalf("older snapshot planned changes: %+v", plan)
+	}
+}
+
+func TestApplyServerConfigPlan_RiskyKeysNeedForce(t *testing.T) {
+	desired, _ := cfg.ListServerState(serverFake())
+	desired.Config["core.https_address"] = ":9443"
+	desired.Config["images.auto_update_interval"] = "12"
+
+	fake := serverFake()
+	current, _ := cfg.ListServerState(fake)
+	plan := cfg.BuildServerConfigPlan(current.Config, desired.Config)
+	if len(plan.ToSet) != 2 || plan.ToSet[0].Risk == "" || plan.ToSet[1].Risk != "" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+
+	sum, err := cfg.ApplyServerConfigPlan(fake, plan, false)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if sum != "server_config: set=1 unset=0 skipped=1" {
+		t.Fatalf("unexpected summary: %s", sum)
+	}
+	if fake.ServerConfig["core.https_address"] != ":8443" || fake.ServerConfig["images.auto_update_interval"] != "12" {
+		t.Fatalf("unexpected config: %v", fake.ServerConfig)
+	}
+
+	if _, err := cfg.ApplyServerConfigPlan(fake, plan, true); err != nil {
+		t.Fatalf("apply with force: %v", err)
+	}
+	if fake.ServerConfig["core.https_address"] != ":9443" {
+		t.Fatalf("risky key not applied with force: %v", fake.ServerConfig)
+	}
+}
+
+func TestApplyCertificatesPlan_CreateOnlyWithoutForce(t *testing.T) {
+	desired, _ := cfg.ListServerState(serverFake())
+	desired.Certificates = append(desired.Certificates, incusapi.Certificate{Fingerprint: "def456", Name: "ci", Type: "client", Certificate: "PEM"})
+
+	fake := serverFake()
+	_ = fake.CreateCertificate(incusapi.Certificate{Fingerprint: "zzz999", Name: "old", Type: "client"})
+	current, _ := cfg.ListServerState(fake)
+	plan := cfg.BuildCertificatesPlan(current.Certificates, desired.Certificates)
+
+	sum, err := cfg.ApplyCertificatesPlan(fake, plan, false, true)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if sum != "certificates: created=1 updated=0 deleted=0 skipped=1" {
+		t.Fatalf("unexpected summary: %s", sum)
+	}
+	if _, ok := fake.CertificatesMap["zzz999"]; !ok {
+		t.Fatalf("certificate deleted without force")
+	}
+	current, _ = cfg.ListServerState(fake)
+	plan = cfg.BuildCertificatesPlan(current.Certificates, desired.Certificates)
+	if _, err := cfg.ApplyCertificatesPlan(fake, plan, true, true); err != nil {
+		t.Fatalf("apply with force: %v", err)
+	}
+	if _, ok := fake.CertificatesMap["zzz999"]; ok {
+		t.Fatalf("certificate kept with force")
+	}
+}
+
+func TestBuildClusterGroupsPlan_KeepsDefault(t *testing.T) {
+	current, _ := cfg.ListServerState(serverFake())
+	plan := cfg.BuildClusterGroupsPlan(current.ClusterGroups, nil)
+	if len(plan.ToDelete) != 1 || plan.ToDelete[0].Name != "gpu" {
+		t.Fatalf("unexpected deletes: %+v", plan.ToDelete)
+	}
+}
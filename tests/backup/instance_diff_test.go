@@ -0,0 +1,70 @@
+package backup_test
+
+import (
+	"testing"
+
+	"incus-backup/src/archive"
+	inst "incus-backup/src/backup/instances"
+)
+
+func instanceTree(config map[string]string, devices map[string]map[string]string, snapshots []string, entries map[string]archive.Entry) *archive.Tree {
+	return &archive.Tree{
+		Index: &archive.Index{Name: "web", Type: "container", Snapshots: snapshots, Config: &archive.IndexConfig{
+			Container: &archive.IndexInstance{Name: "web", Profiles: []string{"default"}, Config: config, Devices: devices},
+		}},
+		Entries: entries,
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	from := instanceTree(
+		map[string]string{"limits.cpu": "2", "boot.autostart": "true", "volatile.eth0.hwaddr": "00:16:3e:00:00:01"},
+		map[string]map[string]string{"eth0": {"type": "nic", "network": "incusbr0"}},
+		[]string{"snap0", "snap1"},
+		map[string]archive.Entry{
+			"/etc":          {Type: archive.EntryDir, Mode: 0o755},
+			"/etc/hostname": {Type: archive.EntryFile, Size: 4, Mode: 0o644, SHA256: "aa"},
+			"/etc/motd":     {Type: archive.EntryFile, Size: 10, Mode: 0o644, SHA256: "bb"},
+		})
+	to := instanceTree(
+		map[string]string{"limits.cpu": "4", "limits.memory": "1GiB", "volatile.eth0.hwaddr": "00:16:3e:00:00:02", "volatile.uuid": "u1"},
+		map[string]map[string]string{"eth0": {"type": "nic", "network": "incusbr1"}, "data": {"type": "disk"}},
+		[]string{"snap1", "snap2"},
+		map[string]archive.Entry{
+			"/etc":          {Type: archive.EntryDir, Mode: 0o755},
+			"/etc/hostname": {Type: archive.EntryFile, Size: 4, Mode: 0o600, SHA256: "aa"},
+			"/etc/issue":    {Type: archive.EntryFile, Size: 7, Mode: 0o644, SHA256: "cc"},
+		})
+
+	d := inst.DiffVersions(from, to)
+	keys := func(changes []inst.KeyChange) map[string]string {
+		out := map[string]string{}
+		for _, c := range changes {
+			out[c.Key] = c.Change
+		}
+		return out
+	}
+	check := func(what string, got, want map[string]string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Fatalf("%s: got %v, want %v", what, got, want)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Fatalf("%s: got %v, want %v", what, got, want)
+			}
+		}
+	}
+	check("config", keys(d.Config), map[string]string{"boot.autostart": inst.Removed, "limits.cpu": inst.Changed, "limits.memory": inst.Added})
+	check("devices", keys(d.Devices), map[string]string{"data.type": inst.Added, "eth0.network": inst.Changed})
+	check("snapshots", keys(d.Snapshots), map[string]string{"snap0": inst.Removed, "snap2": inst.Added})
+	files := map[string]string{}
+	for _, f := range d.Files {
+		files[f.Path] = f.Change
+	}
+	check("files", files, map[string]string{"/etc/hostname": inst.Changed, "/etc/issue": inst.Added, "/etc/motd": inst.Removed})
+
+	if !inst.DiffVersions(from, from).Empty() {
+		t.Fatalf("expected no changes between identical versions")
+	}
+}
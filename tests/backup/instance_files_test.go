@@ -0,0 +1,119 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+
+	"incus-backup/src/archive"
+	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/incusapi"
+)
+
+func appExport(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	add := func(hdr *tar.Header, body string) {
+		hdr.Size = int64(len(body))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		_, _ = tw.Write([]byte(body))
+	}
+	add(&tar.Header{Name: "backup/index.yaml", Mode: 0o644, Typeflag: tar.TypeReg}, "name: web\ntype: container\n")
+	add(&tar.Header{Name: "backup/container/rootfs/var/lib/app/", Mode: 0o750, Uid: 1000, Gid: 1000, Typeflag: tar.TypeDir}, "")
+	add(&tar.Header{Name: "backup/container/rootfs/var/lib/app/data.db", Mode: 0o640, Uid: 1000, Gid: 1000, Typeflag: tar.TypeReg}, "rows")
+	add(&tar.Header{Name: "backup/container/rootfs/var/lib/app/current", Linkname: "data.db", Typeflag: tar.TypeSymlink}, "")
+	add(&tar.Header{Name: "backup/container/rootfs/var/lib/app/fifo", Mode: 0o600, Typeflag: tar.TypeFifo}, "")
+	add(&tar.Header{Name: "backup/container/rootfs/etc/hostname", Mode: 0o644, Typeflag: tar.TypeReg}, "web\n")
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func filesFake() *incusapi.FakeClient {
+	fake := incusapi.NewFake()
+	fake.Instances["default"] = map[string][]byte{"web": nil}
+	return fake
+}
+
+func TestRestoreFiles_PushesWithOwnershipAndModes(t *testing.T) {
+	fake := filesFake()
+	m, _ := archive.NewPathMatcher([]string{"/var/lib/app/"})
+	got, err := inst.RestoreFiles(fake, "default", "web", bytes.NewReader(appExport(t)), m, inst.FilesOptions{OnExisting: inst.OnExistingSkip})
+	if err != nil {
+		t.Fatalf("restore files: %v", err)
+	}
+	if len(got) != 4 || got[3].Status != inst.FileUnsupported {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+	if f := fake.Files["default/web/var/lib/app"]; f.Type != "directory" || f.Mode != 0o750 || f.UID != 1000 {
+		t.Fatalf("unexpected directory: %+v", f)
+	}
+	if f := fake.Files["default/web/var/lib/app/data.db"]; f.Type != "file" || string(f.Content) != "rows" || f.Mode != 0o640 || f.GID != 1000 {
+		t.Fatalf("unexpected file: %+v", f)
+	}
+	if f := fake.Files["default/web/var/lib/app/current"]; f.Type != "symlink" || string(f.Content) != "data.db" {
+		t.Fatalf("unexpected symlink: %+v", f)
+	}
+	if _, ok := fake.Files["default/web/etc/hostname"]; ok {
+		t.Fatalf("unselected file pushed")
+	}
+}
+
+func TestRestoreFiles_ExistingFilePolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    inst.FilesOptions
+		content string
+		status  string
+		asked   bool
+	}{
+		{"skip", inst.FilesOptions{OnExisting: inst.OnExistingSkip}, "local", inst.FileSkipped, false},
+		{"overwrite", inst.FilesOptions{OnExisting: inst.OnExistingOverwrite}, "web\n", inst.FileRestored, false},
+		{"ask declined", inst.FilesOptions{OnExisting: inst.OnExistingAsk}, "local", inst.FileSkipped, true},
+		{"dry run", inst.FilesOptions{OnExisting: inst.OnExistingOverwrite, DryRun: true}, "local", inst.FileConflict, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := filesFake()
+			fake.Files["default/web/etc/hostname"] = incusapi.FakeFile{Type: "file", Content: []byte("local")}
+			asked := false
+			tc.opts.Confirm = func(string) (bool, error) { asked = true; return false, nil }
+			m, _ := archive.NewPathMatcher([]string{"/etc/hostname"})
+			got, err := inst.RestoreFiles(fake, "default", "web", bytes.NewReader(appExport(t)), m, tc.opts)
+			if err != nil {
+				t.Fatalf("restore files: %v", err)
+			}
+			if len(got) != 1 || got[0].Status != tc.status || asked != tc.asked {
+				t.Fatalf("unexpected results %+v (asked=%v)", got, asked)
+			}
+			if c := string(fake.Files["default/web/etc/hostname"].Content); c != tc.content {
+				t.Fatalf("unexpected content %q", c)
+			}
+		})
+	}
+}
+
+func TestRestoreFiles_Errors(t *testing.T) {
+	m, _ := archive.NewPathMatcher([]string{"/nope"})
+	_, err := inst.RestoreFiles(filesFake(), "default", "web", bytes.NewReader(appExport(t)), m, inst.FilesOptions{OnExisting: inst.OnExistingSkip})
+	if err == nil || !strings.Contains(err.Error(), "no paths match /nope") {
+		t.Fatalf("expected unmatched path error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	_ = tw.WriteHeader(&tar.Header{Name: "backup/index.yaml", Mode: 0o644, Size: 3, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("a: "))
+	_ = tw.WriteHeader(&tar.Header{Name: "backup/virtual-machine.img", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	m, _ = archive.NewPathMatcher([]string{"/"})
+	_, err = inst.RestoreFiles(filesFake(), "default", "web", bytes.NewReader(buf.Bytes()), m, inst.FilesOptions{OnExisting: inst.OnExistingSkip})
+	if err == nil || !strings.Contains(err.Error(), "disk image") {
+		t.Fatalf("expected disk image error, got %v", err)
+	}
+}
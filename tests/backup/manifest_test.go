@@ -0,0 +1,224 @@
+package backup_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	inst "incus-backup/src/backup/instances"
+	"incus-backup/src/backup/manifest"
+	vol "incus-backup/src/backup/volumes"
+	"incus-backup/src/incusapi"
+)
+
+func TestInstanceManifestRecordsSourceMetadata(t *testing.T) {
+	root := t.TempDir()
+	fake := incusapi.NewFake()
+	fake.ServerVersionStr = "6.0.1"
+	fake.ServerArches = []string{"x86_64", "i686"}
+	fake.StoragePoolsMap["fast"] = incusapi.StoragePool{Name: "fast", Driver: "zfs"}
+	fake.Instances["default"] = map[string][]byte{"web": []byte("\x1f\x8bnot-really-gzip")}
+	fake.InstanceDetails["default/web"] = incusapi.Instance{
+		Project:         "default",
+		Name:            "web",
+		Type:            "virtual-machine",
+		Architecture:    "x86_64",
+		Profiles:        []string{"default"},
+		Config:          map[string]string{"limits.cpu": "2"},
+		Devices:         map[string]map[string]string{"eth0": {"type": "nic", "network": "incusbr0"}},
+		ExpandedDevices: map[string]map[string]string{"root": {"type": "disk", "path": "/", "pool": "fast"}},
+	}
+
+	dir, err := inst.BackupInstance(fake, root, "default", "web", false, false, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	mf, err := inst.ParseManifest(b)
+	if err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	if mf.SchemaVersion != manifest.SchemaVersion || mf.ToolVersion == "" {
+		t.Fatalf("unexpected schema/tool version: %+v", mf)
+	}
+	if mf.Server == nil || mf.Server.Version != "6.0.1" {
+		t.Fatalf("server version not recorded: %+v", mf.Server)
+	}
+	src := mf.Source
+	if src == nil || src.InstanceType != "virtual-machine" || src.Architecture != "x86_64" || src.Pool != "fast" || src.PoolDriver != "zfs" {
+		t.Fatalf("unexpected source: %+v", src)
+	}
+	if src.Config["limits.cpu"] != "2" || src.Devices["eth0"]["network"] != "incusbr0" {
+		t.Fatalf("config/devices not recorded: %+v", src)
+	}
+	if mf.Export == nil || mf.Export.Size != int64(len("\x1f\x8bnot-really-gzip")) || mf.Export.Compression != "gzip" {
+		t.Fatalf("unexpected export metadata: %+v", mf.Export)
+	}
+}
+
+func TestVolumeManifestRecordsPoolDriver(t *testing.T) {
+	root := t.TempDir()
+	fake := incusapi.NewFake()
+	fake.StoragePoolsMap["pool"] = incusapi.StoragePool{Name: "pool", Driver: "btrfs"}
+	fake.Volumes["default"] = map[string]map[string][]byte{"pool": {"data": []byte("VOL")}}
+	fake.VolumeDetails["default/pool/data"] = incusapi.Volume{Project: "default", Pool: "pool", Name: "data", ContentType: "block", Config: map[string]string{"size": "10GiB"}}
+
+	dir, err := vol.BackupVolume(fake, root, "default", "pool", "data", false, false, time.Now(), nil)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	mf, err := vol.ParseManifest(b)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if mf.Source == nil || mf.Source.PoolDriver != "btrfs" || mf.Source.ContentType != "block" || mf.Source.Config["size"] != "10GiB" {
+		t.Fatalf("unexpected source: %+v", mf.Source)
+	}
+	if mf.Export == nil || mf.Export.Size != 3 {
+		t.Fatalf("unexpected export: %+v", mf.Export)
+	}
+}
+
+// metadataFailingClient fails the metadata lookups that only feed the
+// manifest, leaving the export itself available.
+type metadataFailingClient struct {
+	*incusapi.FakeClient
+}
+
+func (metadataFailingClient) Server() (incusapi.ServerInfo, error) {
+	return incusapi.ServerInfo{}, errors.New("server unavailable")
+}
+
+func (metadataFailingClient) ListStoragePools() ([]incusapi.StoragePool, error) {
+	return nil, errors.New("pools unavailable")
+}
+
+func TestManifestMetadataFailuresOnlyWarn(t *testing.T) {
+	root := t.TempDir()
+	fake := incusapi.NewFake()
+	fake.Instances["default"] = map[string][]byte{"web": []byte("DATA")}
+	fake.InstanceDetails["default/web"] = incusapi.Instance{Project: "default", Name: "web", ExpandedDevices: map[string]map[string]string{"root": {"type": "disk", "path": "/", "pool": "fast"}}}
+	fake.Volumes["default"] = map[string]map[string][]byte{"pool": {"data": []byte("VOL")}}
+	client := metadataFailingClient{fake}
+
+	var out strings.Builder
+	dir, err := inst.BackupInstance(client, root, "default", "web", false, false, time.Now(), &out)
+	if err != nil {
+		t.Fatalf("instance backup should survive metadata failures: %v", err)
+	}
+	b, _ := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	imf, err := inst.ParseManifest(b)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if imf.Server != nil || imf.Source == nil || imf.Source.Pool != "fast" || imf.Source.PoolDriver != "" {
+		t.Fatalf("unexpected metadata: server=%+v source=%+v", imf.Server, imf.Source)
+	}
+
+	dir, err = vol.BackupVolume(client, root, "default", "pool", "data", false, false, time.Now(), &out)
+	if err != nil {
+		t.Fatalf("volume backup should survive metadata failures: %v", err)
+	}
+	b, _ = os.ReadFile(filepath.Join(dir, "manifest.json"))
+	vmf, err := vol.ParseManifest(b)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if vmf.Server != nil || vmf.Source == nil || vmf.Source.PoolDriver != "" {
+		t.Fatalf("unexpected metadata: server=%+v source=%+v", vmf.Server, vmf.Source)
+	}
+	for _, want := range []string{
+		"[warn] default/web: server info not recorded: server unavailable",
+		"[warn] default/web: storage pool driver not recorded: pools unavailable",
+		"[warn] pool/data: server info not recorded: server unavailable",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing warning %q in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseManifestMigratesV1AndRejectsFuture(t *testing.T) {
+	v1 := `{"type":"instance","project":"default","name":"web","createdAt":"2025-01-01T00:00:00Z","options":{"snapshot":"true"}}`
+	mf, err := inst.ParseManifest([]byte(v1))
+	if err != nil {
+		t.Fatalf("parse v1: %v", err)
+	}
+	if mf.SchemaVersion != 1 || mf.Name != "web" || mf.Source != nil {
+		t.Fatalf("unexpected migrated manifest: %+v", mf)
+	}
+	if w := mf.Compatibility(incusapi.ServerInfo{ServerVersion: "6.0", Architectures: []string{"aarch64"}}); len(w) != 0 {
+		t.Fatalf("v1 manifests should not produce warnings: %v", w)
+	}
+
+	if _, err := vol.ParseManifest([]byte(`{"schemaVersion":99,"type":"volume"}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected future schema error, got %v", err)
+	}
+}
+
+func TestManifestCompatibilityWarnings(t *testing.T) {
+	src := &manifest.Server{Version: "6.10"}
+	dst := incusapi.ServerInfo{ServerVersion: "6.2", Architectures: []string{"aarch64"}}
+	warnings := manifest.Compatibility(src, "x86_64", dst)
+	if len(warnings) != 2 {
+		t.Fatalf("expected architecture and version warnings, got %v", warnings)
+	}
+	if w := manifest.Compatibility(&manifest.Server{Version: "6.0.1"}, "aarch64", dst); len(w) != 0 {
+		t.Fatalf("expected no warnings, got %v", w)
+	}
+}
+
+func TestReadStoredDescribesDirectoryBackup(t *testing.T) {
+	root := t.TempDir()
+	fake := incusapi.NewFake()
+	fake.Instances["default"] = map[string][]byte{"web": []byte("export-bytes")}
+	dir, err := inst.BackupInstance(fake, root, "default", "web", false, false, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	s, err := manifest.ReadStored(dir, "export.tar.xz")
+	if err != nil {
+		t.Fatalf("ReadStored: %v", err)
+	}
+	if s.Version != "20250102T030405Z" || s.Path != dir {
+		t.Fatalf("unexpected version/path: %+v", s)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "export.tar.xz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Bytes != fi.Size() {
+		t.Fatalf("bytes = %d, want %d", s.Bytes, fi.Size())
+	}
+	sums, _ := os.ReadFile(filepath.Join(dir, "checksums.txt"))
+	if len(s.SHA256) != 64 || !strings.Contains(string(sums), s.SHA256+"  export.tar.xz") {
+		t.Fatalf("sha256 %q not in checksums.txt:\n%s", s.SHA256, sums)
+	}
+
+	if _, err := manifest.ReadStored(filepath.Join(root, "missing"), "export.tar.xz"); err == nil {
+		t.Fatal("expected error for missing data file")
+	}
+}
+
+func TestBundledResticStatsOmitSnapshotID(t *testing.T) {
+	r := &manifest.Restic{SnapshotID: "abc123", BytesProcessed: 10, DataAdded: 4}
+	b, err := json.Marshal(r.Bundled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "snapshotId") || !strings.Contains(string(b), `"dataAdded":4`) {
+		t.Fatalf("unexpected bundled stats: %s", b)
+	}
+	b, _ = json.Marshal(r)
+	if !strings.Contains(string(b), `"snapshotId":"abc123"`) {
+		t.Fatalf("legacy stats must keep the snapshot ID: %s", b)
+	}
+}
@@ -0,0 +1,325 @@
+package browse_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+	"syscall"
+	"testing"
+
+	"incus-backup/src/browse"
+)
+
+type member struct {
+	name     string
+	typeflag byte
+	body     string
+	link     string
+	mode     int64
+}
+
+func exportBytes(t *testing.T, members []member) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Typeflag: m.typeflag, Linkname: m.link, Mode: m.mode, Uid: 1000, Gid: 1000}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(m.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(m.body)); err != nil {
+				t.Fatalf("tar write: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func containerExport(t *testing.T, hostname string) []byte {
+	return exportBytes(t, []member{
+		{name: "backup/index.yaml", body: "name: web\ntype: container\n"},
+		{name: "backup/container/rootfs/", typeflag: tar.TypeDir, mode: 0o755},
+		{name: "backup/container/rootfs/etc/", typeflag: tar.TypeDir, mode: 0o755},
+		{name: "backup/container/rootfs/etc/hostname", body: hostname},
+		{name: "backup/container/rootfs/etc/motd", body: "hello\n", mode: 0o600},
+		{name: "backup/container/rootfs/etc/issue", typeflag: tar.TypeLink, link: "backup/container/rootfs/etc/motd"},
+		{name: "backup/container/rootfs/etc/localtime", typeflag: tar.TypeSymlink, link: "/usr/share/zoneinfo/UTC"},
+		// No member for var/ or var/log/: parents are synthesized.
+		{name: "backup/container/rootfs/var/log/app.log", body: "started\n"},
+		{name: "backup/snapshots/snap0/etc/hostname", body: "old\n"},
+	})
+}
+
+// fakeSource serves exports from memory and counts how often each is opened.
+type fakeSource struct {
+	mu      sync.Mutex
+	exports map[browse.Backup][]byte
+	opens   map[browse.Backup]int
+	lists   int
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{exports: map[browse.Backup][]byte{}, opens: map[browse.Backup]int{}}
+}
+
+func (s *fakeSource) List() ([]browse.Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists++
+	var out []browse.Backup
+	for b := range s.exports {
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func (s *fakeSource) Open(b browse.Backup) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opens[b]++
+	data, ok := s.exports[b]
+	if !ok {
+		return nil, fmt.Errorf("no export for %v", b)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *fakeSource) openCount(b browse.Backup) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opens[b]
+}
+
+var (
+	v1 = browse.Backup{Project: "default", Name: "web", Version: "20250101T000000Z"}
+	v2 = browse.Backup{Project: "default", Name: "web", Version: "20250102T000000Z"}
+)
+
+func names(t *testing.T, fsys *browse.FS, p string) []string {
+	t.Helper()
+	entries, err := fsys.ReadDir(p)
+	if err != nil {
+		t.Fatalf("readdir %s: %v", p, err)
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Name)
+	}
+	return out
+}
+
+func readFile(t *testing.T, fsys *browse.FS, p string) string {
+	t.Helper()
+	f, err := fsys.Open(p)
+	if err != nil {
+		t.Fatalf("open %s: %v", p, err)
+	}
+	defer f.Close()
+	buf := make([]byte, f.Size()+16)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		t.Fatalf("read %s: %v", p, err)
+	}
+	return string(buf[:n])
+}
+
+func TestFSListsBackupsWithoutReadingExports(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = containerExport(t, "web\n")
+	src.exports[v2] = containerExport(t, "web-2\n")
+	src.exports[browse.Backup{Project: "dev", Name: "db", Version: "20250101T000000Z"}] = containerExport(t, "db\n")
+	fsys := browse.New(src, nil)
+
+	if got := fmt.Sprint(names(t, fsys, "")); got != "[instances]" {
+		t.Fatalf("root = %s", got)
+	}
+	if got := fmt.Sprint(names(t, fsys, "instances")); got != "[default dev]" {
+		t.Fatalf("projects = %s", got)
+	}
+	if got := fmt.Sprint(names(t, fsys, "instances/default/web")); got != "[20250101T000000Z 20250102T000000Z]" {
+		t.Fatalf("versions = %s", got)
+	}
+	attr, err := fsys.Stat("instances/default/web/20250101T000000Z")
+	if err != nil || !attr.Mode.IsDir() || attr.ModTime.Year() != 2025 {
+		t.Fatalf("version attr = %+v, %v", attr, err)
+	}
+	if src.openCount(v1)+src.openCount(v2) != 0 {
+		t.Fatalf("exports opened before their directories were read: %v", src.opens)
+	}
+	if src.lists != 1 {
+		t.Fatalf("expected one listing, got %d", src.lists)
+	}
+}
+
+func TestFSIndexesBackupOnceAndReadsFiles(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = containerExport(t, "web\n")
+	src.exports[v2] = containerExport(t, "web-2\n")
+	fsys := browse.New(src, nil)
+	base := "instances/default/web/20250101T000000Z"
+
+	if got := fmt.Sprint(names(t, fsys, base)); got != "[rootfs]" {
+		t.Fatalf("version dir = %s", got)
+	}
+	if got := fmt.Sprint(names(t, fsys, base+"/rootfs/etc")); got != "[hostname issue localtime motd]" {
+		t.Fatalf("etc = %s", got)
+	}
+	if got := fmt.Sprint(names(t, fsys, base+"/rootfs/var/log")); got != "[app.log]" {
+		t.Fatalf("var/log = %s", got)
+	}
+	if src.openCount(v1) != 1 {
+		t.Fatalf("expected one index read, got %d", src.openCount(v1))
+	}
+	if src.openCount(v2) != 0 {
+		t.Fatalf("unread backup was indexed")
+	}
+
+	attr, err := fsys.Stat(base + "/rootfs/etc/motd")
+	if err != nil || attr.Size != 6 || attr.Mode != 0o600 || attr.UID != 1000 {
+		t.Fatalf("motd attr = %+v, %v", attr, err)
+	}
+	if got := readFile(t, fsys, base+"/rootfs/etc/hostname"); got != "web\n" {
+		t.Fatalf("hostname = %q", got)
+	}
+	if got := readFile(t, fsys, base+"/rootfs/var/log/app.log"); got != "started\n" {
+		t.Fatalf("app.log = %q", got)
+	}
+	if got := readFile(t, fsys, base+"/rootfs/etc/issue"); got != "hello\n" {
+		t.Fatalf("hard link = %q", got)
+	}
+	if got := readFile(t, fsys, "instances/default/web/20250102T000000Z/rootfs/etc/hostname"); got != "web-2\n" {
+		t.Fatalf("second version hostname = %q", got)
+	}
+	if got := readFile(t, fsys, base+"/rootfs/etc/hostname"); got != "web\n" {
+		t.Fatalf("reopened hostname = %q", got)
+	}
+	if got := src.openCount(v1); got != 4 {
+		t.Fatalf("expected the index read plus one read per file, got %d", got)
+	}
+
+	link, err := fsys.Readlink(base + "/rootfs/etc/localtime")
+	if err != nil || link != "/usr/share/zoneinfo/UTC" {
+		t.Fatalf("readlink = %q, %v", link, err)
+	}
+}
+
+func TestFSRefreshesListingAndKeepsIndexes(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = containerExport(t, "web\n")
+	fsys := browse.New(src, nil)
+	base := "instances/default/web/20250101T000000Z"
+	if got := readFile(t, fsys, base+"/rootfs/etc/hostname"); got != "web\n" {
+		t.Fatalf("hostname = %q", got)
+	}
+
+	src.mu.Lock()
+	src.exports[v2] = containerExport(t, "web-2\n")
+	src.mu.Unlock()
+	if got := fmt.Sprint(names(t, fsys, "instances/default/web")); got != "[20250101T000000Z]" {
+		t.Fatalf("listing refreshed before its TTL: %s", got)
+	}
+
+	fsys.ListTTL = 0
+	if got := fmt.Sprint(names(t, fsys, "instances/default/web")); got != "[20250101T000000Z 20250102T000000Z]" {
+		t.Fatalf("versions after refresh = %s", got)
+	}
+	if got := readFile(t, fsys, base+"/rootfs/etc/hostname"); got != "web\n" {
+		t.Fatalf("hostname after refresh = %q", got)
+	}
+	if got := src.openCount(v1); got != 2 {
+		t.Fatalf("refresh dropped the index or cache: %d opens", got)
+	}
+}
+
+func TestFSReadAtOffsets(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = containerExport(t, "web-server\n")
+	fsys := browse.New(src, nil)
+	f, err := fsys.Open("instances/default/web/20250101T000000Z/rootfs/etc/hostname")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	buf := make([]byte, 6)
+	n, err := f.ReadAt(buf, 4)
+	if err != nil || string(buf[:n]) != "server" {
+		t.Fatalf("read at 4 = %q, %v", buf[:n], err)
+	}
+	if _, err := f.ReadAt(buf, f.Size()); !errors.Is(err, io.EOF) {
+		t.Fatalf("read past end: %v", err)
+	}
+}
+
+func TestFSVirtualMachineShowsDiskImage(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = exportBytes(t, []member{
+		{name: "backup/index.yaml", body: "name: web\ntype: virtual-machine\n"},
+		{name: "backup/virtual-machine.img", body: "disk"},
+	})
+	fsys := browse.New(src, nil)
+	base := "instances/default/web/20250101T000000Z"
+	if got := fmt.Sprint(names(t, fsys, base)); got != "[virtual-machine.img]" {
+		t.Fatalf("version dir = %s", got)
+	}
+	if got := readFile(t, fsys, base+"/virtual-machine.img"); got != "disk" {
+		t.Fatalf("image = %q", got)
+	}
+}
+
+func TestFSErrors(t *testing.T) {
+	src := newFakeSource()
+	src.exports[v1] = containerExport(t, "web\n")
+	src.exports[v2] = []byte("not an export")
+	fsys := browse.New(src, nil)
+	base := "instances/default/web/20250101T000000Z"
+
+	cases := []struct {
+		name string
+		err  error
+		run  func() error
+	}{
+		{"missing", syscall.ENOENT, func() error { _, err := fsys.Stat(base + "/rootfs/nope"); return err }},
+		{"not a dir", syscall.ENOTDIR, func() error { _, err := fsys.ReadDir(base + "/rootfs/etc/motd"); return err }},
+		{"open dir", syscall.EISDIR, func() error { _, err := fsys.Open(base + "/rootfs/etc"); return err }},
+		{"open symlink", syscall.EINVAL, func() error { _, err := fsys.Open(base + "/rootfs/etc/localtime"); return err }},
+		{"readlink file", syscall.EINVAL, func() error { _, err := fsys.Readlink(base + "/rootfs/etc/motd"); return err }},
+		{"bad export", syscall.EIO, func() error { _, err := fsys.ReadDir("instances/default/web/20250102T000000Z"); return err }},
+	}
+	for _, tc := range cases {
+		err := tc.run()
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) || !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+	if !errors.Is(func() error { _, err := fsys.Stat(base + "/rootfs/nope"); return err }(), fs.ErrNotExist) {
+		t.Errorf("missing path should match fs.ErrNotExist")
+	}
+	// A failed index is not retried on every access.
+	_, _ = fsys.ReadDir("instances/default/web/20250102T000000Z")
+	if got := src.openCount(v2); got != 1 {
+		t.Errorf("expected the bad export to be read once, got %d", got)
+	}
+}
@@ -0,0 +1,129 @@
+package cli_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/cli"
+)
+
+func seedCopySource(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "instances", "default", "web", "20240101T000000Z")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var sums strings.Builder
+	for _, f := range [][2]string{{"export.tar.xz", "payload"}, {"manifest.json", `{"type":"instance","project":"default","name":"web"}`}} {
+		if err := os.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(f[1]))
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), f[0])
+	}
+	if err := os.WriteFile(filepath.Join(dir, "checksums.txt"), []byte(sums.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestCopyCmd_DryRunThenCopyThenSkip(t *testing.T) {
+	src := seedCopySource(t)
+	dst := filepath.Join(t.TempDir(), "offsite")
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	run := func(extra ...string) []map[string]string {
+		t.Helper()
+		var out, errBuf strings.Builder
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append([]string{"copy", "instances", "--from", "dir:" + src, "--to", "dir:" + dst, "-o", "json"}, extra...))
+		if _, err := cmd.ExecuteC(); err != nil {
+			t.Fatalf("copy failed: %v\nstderr=%s", err, errBuf.String())
+		}
+		var rows []map[string]string
+		if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+		}
+		return rows
+	}
+
+	rows := run("--dry-run")
+	if len(rows) != 1 || rows[0]["status"] != "planned" {
+		t.Fatalf("unexpected dry-run rows: %v", rows)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "instances")); !os.IsNotExist(err) {
+		t.Fatalf("dry-run must not write to the destination")
+	}
+
+	rows = run()
+	if len(rows) != 1 || rows[0]["status"] != "copied" {
+		t.Fatalf("unexpected copy rows: %v", rows)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "instances", "default", "web", "20240101T000000Z", "export.tar.xz")); err != nil {
+		t.Fatalf("copied export missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "metadata.json")); err != nil {
+		t.Fatalf("destination should be initialised: %v", err)
+	}
+
+	rows = run()
+	if len(rows) != 1 || rows[0]["status"] != "skipped" {
+		t.Fatalf("expected the existing version to be skipped: %v", rows)
+	}
+}
+
+func TestCopyCmd_RejectsSameTargetAndImages(t *testing.T) {
+	src := seedCopySource(t)
+	for _, args := range [][]string{
+		{"copy", "--from", "dir:" + src, "--to", "dir:" + src},
+		{"copy", "images", "--from", "dir:" + src, "--to", "dir:" + t.TempDir()},
+	} {
+		var out, errBuf strings.Builder
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(args)
+		if _, err := cmd.ExecuteC(); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestCopyCmd_DryRunToMissingTargetCreatesNothing(t *testing.T) {
+	src := seedCopySource(t)
+	dst := filepath.Join(t.TempDir(), "offsite")
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"copy", "--from", "dir:" + src, "--to", "dir:" + dst, "--dry-run", "-o", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("copy failed: %v\nstderr=%s", err, errBuf.String())
+	}
+	if !strings.Contains(out.String(), `"planned"`) {
+		t.Fatalf("expected a planned version: %s", out.String())
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("dry-run must not create the destination (err=%v)", err)
+	}
+}
+
+func TestCopyCmd_SourceLockedByPrune(t *testing.T) {
+	src := seedCopySource(t)
+	l, err := dir.LockExclusive(src, "prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock()
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"copy", "--from", "dir:" + src, "--to", "dir:" + t.TempDir()})
+	if _, err := cmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected the source lock to be taken, got %v", err)
+	}
+}
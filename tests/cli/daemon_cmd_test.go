@@ -0,0 +1,57 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestDaemonCheck_PrintsNextRuns(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "daemon.yaml")
+	cfg := `stateFile: ` + filepath.Join(dir, "state.json") + `
+jobs:
+  - name: nightly
+    target: dir:` + dir + `
+    kind: all
+    schedule: "0 2 * * *"
+    keep: 7
+    verify: "@weekly"
+`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errb bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errb)
+	cmd.SetArgs([]string{"daemon", "--config", cfgPath, "--check"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("daemon --check: %v (stderr: %s)", err, errb.String())
+	}
+	o := out.String()
+	for _, want := range []string{"JOB", "nightly  backup  0 2 * * *", "nightly  verify  @weekly"} {
+		if !strings.Contains(o, want) {
+			t.Fatalf("missing %q in output:\n%s", want, o)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.json.lock")); !os.IsNotExist(err) {
+		t.Fatalf("--check must not take the daemon lock")
+	}
+}
+
+func TestDaemon_RejectsInvalidConfig(t *testing.T) {
+	cfgPath := filepath.Join(t.TempDir(), "daemon.yaml")
+	if err := os.WriteFile(cfgPath, []byte("jobs:\n  - {name: a, target: 'dir:/x', kind: all, schedule: 'every day'}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errb bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errb)
+	cmd.SetArgs([]string{"daemon", "--config", cfgPath, "--check"})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "job a: schedule") {
+		t.Fatalf("expected schedule error, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "incus-backup/src/backup/config"
+	"incus-backup/src/cli"
+	"incus-backup/src/incusapi"
+)
+
+// writeConfigSnapshots backs up two servers that differ in one profile and
+// one project, and returns the snapshot timestamps.
+func writeConfigSnapshots(t *testing.T, root string) (string, string) {
+	t.Helper()
+	first := incusapi.NewFake()
+	_ = first.CreateProject("default", nil)
+	_ = first.CreateProfile(incusapi.Profile{Name: "web", Config: map[string]string{"limits.cpu": "2"}})
+	second := incusapi.NewFake()
+	_ = second.CreateProject("default", nil)
+	_ = second.CreateProject("dev", nil)
+	_ = second.CreateProfile(incusapi.Profile{Name: "web", Config: map[string]string{"limits.cpu": "4"}})
+
+	t1 := time.Date(2025, 1, 1, 1, 1, 1, 0, time.UTC)
+	t2 := t1.Add(24 * time.Hour)
+	if _, err := cfg.BackupAll(first, root, t1); err != nil {
+		t.Fatalf("backup first: %v", err)
+	}
+	if _, err := cfg.BackupAll(second, root, t2); err != nil {
+		t.Fatalf("backup second: %v", err)
+	}
+	return t1.Format("20060102T150405Z"), t2.Format("20060102T150405Z")
+}
+
+func TestDiffConfigCmd_ReportsDriftWithExitCode(t *testing.T) {
+	root := t.TempDir()
+	from, to := writeConfigSnapshots(t, root)
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "config", "--target", "dir:" + root, "--from", from, "--to", to})
+	_, err := cmd.ExecuteC()
+	var coder interface{ ExitCode() int }
+	if !errors.As(err, &coder) || coder.ExitCode() != 2 {
+		t.Fatalf("expected drift error with exit code 2, got %v", err)
+	}
+	for _, want := range []string{"Config drift between " + from + " and " + to, "projects", "dev", "changed", "web"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDiffConfigCmd_UnifiedAndJSON(t *testing.T) {
+	root := t.TempDir()
+	from, to := writeConfigSnapshots(t, root)
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "config", "--target", "dir:" + root, "--from", from, "--to", to, "--only", "profiles", "-o", "unified"})
+	if _, err := cmd.ExecuteC(); err == nil {
+		t.Fatalf("expected drift error")
+	}
+	for _, want := range []string{"--- " + from + "/profiles/web", "+++ " + to + "/profiles/web", "-    \"limits.cpu\": \"2\"", "+    \"limits.cpu\": \"4\""} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in output:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "projects") {
+		t.Fatalf("--only profiles should leave out projects:\n%s", out.String())
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "config", "--target", "dir:" + root, "--from", from, "--to", to, "-o", "json"})
+	_, _ = cmd.ExecuteC()
+	var got struct {
+		Drift   bool         `json:"drift"`
+		Changes []cfg.Change `json:"changes"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode json: %v\n%s", err, out.String())
+	}
+	if !got.Drift || len(got.Changes) != 2 {
+		t.Fatalf("unexpected json result: %+v", got)
+	}
+}
+
+func TestDiffConfigCmd_NoDrift(t *testing.T) {
+	root := t.TempDir()
+	_, to := writeConfigSnapshots(t, root)
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "config", "--target", "dir:" + root, "--from", to, "--to", to})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("expected no drift, got %v", err)
+	}
+	if !strings.Contains(out.String(), "No config drift") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "config", "--target", "dir:" + root, "--from", to, "--version", to})
+	if _, err := cmd.ExecuteC(); err == nil {
+		t.Fatalf("expected error for --from with --version")
+	}
+}
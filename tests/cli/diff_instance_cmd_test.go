@@ -0,0 +1,122 @@
+package cli_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+// writeInstanceExport stores a gzip-compressed export of default/web with
+// the given config and rootfs files as backup ts.
+func writeInstanceExport(t *testing.T, root, ts, config string, files map[string]string) {
+	t.Helper()
+	index := "name: web\ntype: container\nsnapshots:\n- snap0\nconfig:\n  container:\n    name: web\n    project: default\n    config:\n" + config
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	write := func(name, body string) {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	write("backup/index.yaml", index)
+	for name, body := range files {
+		write("backup/container/rootfs/"+name, body)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	dir := filepath.Join(root, "instances", "default", "web", ts)
+	mustMkdirAll(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "export.tar.xz"), buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+}
+
+func TestDiffInstanceCmd_ReportsChanges(t *testing.T) {
+	root := t.TempDir()
+	writeInstanceExport(t, root, "20250101T000000Z", "      limits.cpu: \"2\"\n      volatile.last_state.power: RUNNING\n",
+		map[string]string{"etc/hostname": "web\n", "etc/motd": "hello\n"})
+	writeInstanceExport(t, root, "20250102T000000Z", "      limits.cpu: \"4\"\n      volatile.last_state.power: STOPPED\n",
+		map[string]string{"etc/hostname": "web-2\n", "var/log/app.log": "started\n"})
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "instance", "web", "--target", "dir:" + root, "--from", "20250101T000000Z"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("expected exit 0 without --exit-code, got %v", err)
+	}
+	if strings.Contains(out.String(), "volatile.") {
+		t.Fatalf("volatile keys were compared:\n%s", out.String())
+	}
+	for _, want := range []string{"20250101T000000Z -> 20250102T000000Z", "limits.cpu", "/etc/hostname", "/etc/motd", "/var/log/app.log", "files: added=1 removed=1 changed=1"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %q in output:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "instance", "web", "--target", "dir:" + root, "--from", "20250101T000000Z", "--exit-code"})
+	_, err := cmd.ExecuteC()
+	var coder interface{ ExitCode() int }
+	if !errors.As(err, &coder) || coder.ExitCode() != 2 {
+		t.Fatalf("expected changes with exit code 2, got %v", err)
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "instance", "web", "--target", "dir:" + root, "--from", "20250101T000000Z", "--to", "20250102T000000Z", "-o", "json"})
+	_, _ = cmd.ExecuteC()
+	var got struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Files []struct {
+			Path   string `json:"path"`
+			Change string `json:"change"`
+			To     *struct {
+				Size int64 `json:"size"`
+			} `json:"to"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode json: %v\n%s", err, out.String())
+	}
+	if got.From != "20250101T000000Z" || got.To != "20250102T000000Z" || len(got.Files) != 3 {
+		t.Fatalf("unexpected json result: %+v", got)
+	}
+	if f := got.Files[0]; f.Path != "/etc/hostname" || f.Change != "changed" || f.To == nil || f.To.Size != 6 {
+		t.Fatalf("unexpected first file change: %+v", f)
+	}
+}
+
+func TestDiffInstanceCmd_NoChanges(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{"etc/hostname": "web\n"}
+	writeInstanceExport(t, root, "20250101T000000Z", "      limits.cpu: \"2\"\n", files)
+	writeInstanceExport(t, root, "20250102T000000Z", "      limits.cpu: \"2\"\n", files)
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"diff", "instance", "web", "--target", "dir:" + root, "--from", "20250101T000000Z", "--to", "20250102T000000Z", "--exit-code"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("expected no changes, got %v", err)
+	}
+	if !strings.Contains(out.String(), "No changes to instance default/web") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+}
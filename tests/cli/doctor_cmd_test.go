@@ -0,0 +1,153 @@
+package cli_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/cli"
+	"incus-backup/src/restic"
+)
+
+// stubDoctorRestic serves a repository with one complete legacy instance set,
+// one orphaned data snapshot, a bundle with a leftover data part, an
+// in-progress volume backup and a config set missing its checksums.
+func stubDoctorRestic(t *testing.T) *[]string {
+	t.Helper()
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin := restic.BinaryInfo{Path: "/bin/echo", Version: restic.RequiredVersion}
+	t.Cleanup(cli.SetResticDetectorForTest(func(context.Context) (restic.BinaryInfo, error) { return bin, nil }))
+	t.Cleanup(cli.SetResticPruneListSnapshotsForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, tags []string) ([]restic.Snapshot, error) {
+		inst := func(id, part, ts string) restic.Snapshot {
+			return snapshotWithTags(id, map[string]string{"type": "instance", "schema": "v1", "part": part, "project": "default", "name": "web", "timestamp": ts})
+		}
+		switch tags[0] {
+		case "type=instance":
+			return []restic.Snapshot{
+				inst("ok-data", "data", "20240101T000000Z"),
+				inst("ok-manifest", "manifest", "20240101T000000Z"),
+				inst("ok-checksums", "checksums", "20240101T000000Z"),
+				inst("orphan-data", "data", "20240102T000000Z"),
+				snapshotWithTags("bundle", map[string]string{"type": "instance", "schema": "v2", "project": "default", "name": "web", "timestamp": "20240103T000000Z"}),
+				inst("stale-data", "data", "20240103T000000Z"),
+			}, nil
+		case "type=volume":
+			fresh := snapshotWithTags("fresh-data", map[string]string{"type": "volume", "schema": "v1", "part": "data", "project": "default", "pool": "fast", "name": "vol1", "timestamp": "20240104T000000Z"})
+			fresh.Time = time.Now()
+			return []restic.Snapshot{fresh}, nil
+		case "type=config":
+			var snaps []restic.Snapshot
+			for _, part := range []string{"projects", "profiles", "networks", "storage_pools", "manifest"} {
+				snaps = append(snaps, snapshotWithTags("cfg-"+part, map[string]string{"type": "config", "schema": "v1", "part": part, "timestamp": "20240105T000000Z"}))
+			}
+			return snaps, nil
+		}
+		return nil, nil
+	}))
+	var forgotten []string
+	t.Cleanup(cli.SetResticPruneForgetForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, ids []string, prune bool) error {
+		if !prune {
+			t.Errorf("expected doctor to prune after forgetting")
+		}
+		forgotten = append(forgotten, ids...)
+		return nil
+	}))
+	return &forgotten
+}
+
+func TestDoctorCmd_ReportsIncompleteSetsAsJSON(t *testing.T) {
+	forgotten := stubDoctorRestic(t)
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"doctor", "--target", "restic:/repo", "-o", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	var issues []struct {
+		Type      string   `json:"type"`
+		Timestamp string   `json:"timestamp"`
+		Status    string   `json:"status"`
+		Missing   []string `json:"missing"`
+		Snapshots []string `json:"snapshots"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &issues); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out.String())
+	}
+	got := map[string]string{}
+	for _, issue := range issues {
+		got[issue.Timestamp] = issue.Status + " " + strings.Join(issue.Missing, ",") + " " + strings.Join(issue.Snapshots, ",")
+	}
+	want := map[string]string{
+		"20240102T000000Z": "incomplete manifest,checksums orphan-data",
+		"20240103T000000Z": "superseded  stale-data",
+		"20240104T000000Z": "recent manifest,checksums fresh-data",
+		"20240105T000000Z": "incomplete checksums cfg-manifest,cfg-networks,cfg-profiles,cfg-projects,cfg-storage_pools",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected issues: %v", got)
+	}
+	for ts, w := range want {
+		if got[ts] != w {
+			t.Fatalf("issue %s: got %q, want %q", ts, got[ts], w)
+		}
+	}
+	if len(*forgotten) != 0 {
+		t.Fatalf("doctor without --repair must not forget snapshots")
+	}
+}
+
+func TestDoctorCmd_RepairForgetsAllButRecentSets(t *testing.T) {
+	forgotten := stubDoctorRestic(t)
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"doctor", "--target", "restic:/repo", "--repair", "--dry-run"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("doctor dry-run failed: %v", err)
+	}
+	if len(*forgotten) != 0 || !strings.Contains(out.String(), "Would forget 7 snapshots") {
+		t.Fatalf("dry-run must only preview, got %v\n%s", *forgotten, out.String())
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"doctor", "--target", "restic:/repo", "--repair", "--yes"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("doctor repair failed: %v", err)
+	}
+	for _, id := range *forgotten {
+		if strings.HasPrefix(id, "ok-") || id == "bundle" || id == "fresh-data" {
+			t.Fatalf("repair forgot a snapshot it must keep: %v", *forgotten)
+		}
+	}
+	if len(*forgotten) != 7 || !strings.Contains(out.String(), "Forgot 7 snapshots") {
+		t.Fatalf("expected 7 forgotten snapshots, got %v\n%s", *forgotten, out.String())
+	}
+}
+
+func TestDoctorCmd_RepairWaitsForRunningBackups(t *testing.T) {
+	forgotten := stubDoctorRestic(t)
+	// A backup on this host holds the target lock while it writes its set.
+	backup, err := restic.LockTarget("/repo", false, "")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer backup.Unlock()
+
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"doctor", "--target", "restic:/repo", "--repair", "--yes"})
+	if _, err := cmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected repair to refuse while a backup runs, got %v", err)
+	}
+	if len(*forgotten) != 0 {
+		t.Fatalf("repair forgot snapshots while a backup runs: %v", *forgotten)
+	}
+
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"doctor", "--target", "restic:/repo"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("report-only doctor must not need the lock: %v", err)
+	}
+}
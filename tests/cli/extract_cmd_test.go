@@ -0,0 +1,104 @@
+package cli_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestExtractInstanceCmd_WritesSelectedPaths(t *testing.T) {
+	root, dest := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	writeInstanceExport(t, root, "20250101T000000Z", "      limits.cpu: \"2\"\n",
+		map[string]string{"etc/nginx/nginx.conf": "old\n"})
+	writeInstanceExport(t, root, "20250102T000000Z", "      limits.cpu: \"2\"\n",
+		map[string]string{"etc/nginx/nginx.conf": "new\n", "etc/hostname": "web\n"})
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"extract", "instance", "web", "--target", "dir:" + root, "--version", "20250101T000000Z", "--path", "/etc/nginx/*.conf", "--to", dest})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("extract failed: %v; stderr=%s", err, errBuf.String())
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "etc", "nginx", "nginx.conf")); err != nil || string(b) != "old\n" {
+		t.Fatalf("unexpected extracted file: %q %v", b, err)
+	}
+	if !strings.Contains(out.String(), "extracted=1 skipped=0 from 20250101T000000Z") {
+		t.Fatalf("unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"extract", "instance", "web", "--target", "dir:" + root, "--path", "/etc/missing", "--to", dest})
+	if _, err := cmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "no paths match /etc/missing") {
+		t.Fatalf("expected unmatched path error, got %v", err)
+	}
+}
+
+func TestExtractVolumeCmd_DryRun(t *testing.T) {
+	root, dest := t.TempDir(), filepath.Join(t.TempDir(), "out")
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, m := range [][2]string{{"backup/index.yaml", "name: data\ntype: custom\n"}, {"backup/volume/app/db.sqlite", "sqlite"}} {
+		_ = tw.WriteHeader(&tar.Header{Name: m[0], Mode: 0o644, Size: int64(len(m[1])), Typeflag: tar.TypeReg})
+		_, _ = tw.Write([]byte(m[1]))
+	}
+	_ = tw.Close()
+	dir := filepath.Join(root, "volumes", "default", "pool1", "data", "20250101T000000Z")
+	mustMkdirAll(t, dir)
+	if err := os.WriteFile(filepath.Join(dir, "volume.tar.xz"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"extract", "volume", "pool1/data", "--target", "dir:" + root, "--path", "/app", "--to", dest, "--dry-run", "-o", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("extract failed: %v", err)
+	}
+	var got struct {
+		Paths []struct{ Path, Status string } `json:"paths"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("decode json: %v\n%s", err, out.String())
+	}
+	if len(got.Paths) != 1 || got.Paths[0].Path != "/app/db.sqlite" || got.Paths[0].Status != "would_extract" {
+		t.Fatalf("unexpected result: %+v", got)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatalf("dry run created the destination: %v", err)
+	}
+}
+
+func TestExtractLsCmd(t *testing.T) {
+	root := t.TempDir()
+	writeInstanceExport(t, root, "20250101T000000Z", "      limits.cpu: \"2\"\n",
+		map[string]string{"etc/nginx/nginx.conf": "conf\n", "etc/hostname": "web\n", "bin/sh": "sh"})
+
+	run := func(args ...string) string {
+		t.Helper()
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append([]string{"extract", "ls", "instance", "web", "--target", "dir:" + root}, args...))
+		if _, err := cmd.ExecuteC(); err != nil {
+			t.Fatalf("ls failed: %v", err)
+		}
+		return out.String()
+	}
+
+	top := run("--path", "/etc")
+	if !strings.Contains(top, "/etc/hostname") || strings.Contains(top, "/etc/nginx/nginx.conf") || strings.Contains(top, "/bin/sh") {
+		t.Fatalf("expected only direct children of /etc:\n%s", top)
+	}
+	if all := run("--path", "/etc", "-R"); !strings.Contains(all, "/etc/nginx/nginx.conf") {
+		t.Fatalf("expected recursive listing:\n%s", all)
+	}
+	if glob := run("--path", "/bin/s*"); !strings.Contains(glob, "/bin/sh") || strings.Contains(glob, "/etc") {
+		t.Fatalf("unexpected glob listing:\n%s", glob)
+	}
+}
@@ -1,6 +1,8 @@
 package cli_test
 
 import (
+    "bytes"
+    "strings"
     "testing"
 
     "incus-backup/src/cli"
@@ -15,3 +17,22 @@ func TestGlobalFlags_Present(t *testing.T) {
     }
 }
 
+
+func TestGlobalFlags_Logging(t *testing.T) {
+    cmd := cli.NewRootCmd(nil, nil)
+    for _, name := range []string{"log-level", "log-format", "quiet"} {
+        if f := cmd.PersistentFlags().Lookup(name); f == nil {
+            t.Fatalf("missing global flag --%s", name)
+        }
+    }
+    if f := cmd.PersistentFlags().ShorthandLookup("q"); f == nil || f.Name != "quiet" {
+        t.Fatalf("expected -q for --quiet")
+    }
+
+    var out, errb bytes.Buffer
+    cmd = cli.NewRootCmd(&out, &errb)
+    cmd.SetArgs([]string{"list", "--target", "dir:" + t.TempDir(), "--log-level", "chatty"})
+    if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "--log-level") {
+        t.Fatalf("expected --log-level error, got %v", err)
+    }
+}
@@ -0,0 +1,70 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dir "incus-backup/src/backend/directory"
+	"incus-backup/src/cli"
+)
+
+func TestInitCmd_WritesMetadataAndRejectsReinit(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "backups")
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"init", "--target", "dir:" + root})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Initialized directory repository") {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+	if _, err := dir.LoadMetadata(root); err != nil {
+		t.Fatalf("metadata not written: %v", err)
+	}
+
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"init", "--target", "dir:" + root})
+	if _, err := cmd.ExecuteC(); err == nil {
+		t.Fatalf("expected second init to fail")
+	}
+}
+
+func TestCommandsRejectInvalidMetadata(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, dir.MetadataFile), []byte(`{"schemaVersion":42,"repoId":"abc"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"list", "--target", "dir:" + root})
+	_, err := cmd.ExecuteC()
+	if err == nil || !strings.Contains(err.Error(), "schema v42") {
+		t.Fatalf("expected metadata validation error, got %v", err)
+	}
+}
+
+func TestPruneCmd_RefusesWhileBackupHoldsLock(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "instances", "default", "web", "20240101T010101Z"))
+	mustMkdirAll(t, filepath.Join(root, "instances", "default", "web", "20240202T020202Z"))
+	l, err := dir.LockShared(root)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer l.Unlock()
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"prune", "instances", "--target", "dir:" + root, "--keep", "1", "-y"})
+	if _, err := cmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Fatalf("expected lock error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "instances", "default", "web", "20240101T010101Z")); err != nil {
+		t.Fatalf("snapshot must not be deleted while locked: %v", err)
+	}
+}
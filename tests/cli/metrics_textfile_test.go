@@ -0,0 +1,98 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestMetricsTextfile_VerifyAndPrune(t *testing.T) {
+	root := t.TempDir()
+	prom := filepath.Join(t.TempDir(), "incus_backup.prom")
+	for _, ts := range []string{"20240101T010101Z", "20240202T020202Z", "20240303T030303Z"} {
+		dir := filepath.Join(root, "instances", "default", "web", ts)
+		mustMkdirAll(t, dir)
+		if err := os.WriteFile(filepath.Join(dir, "export.tar.xz"), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7" // sha256("data")
+		if ts == "20240303T030303Z" {
+			sum = strings.Repeat("0", 64)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "checksums.txt"), []byte(sum+"  export.tar.xz\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	target := "dir:" + root
+
+	run := func(args ...string) {
+		t.Helper()
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(args, "--target", target, "--metrics-textfile", prom))
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("%v: %v; stderr=%s", args, err, errBuf.String())
+		}
+	}
+	run("verify", "instances")
+	run("prune", "instances", "--keep", "2", "-y")
+
+	data, err := os.ReadFile(prom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	labels := `{name="web",project="default",target="` + target + `",type="instance"}`
+	for _, want := range []string{
+		`incus_backup_verify_checked{target="` + target + `",type="instance"} 3`,
+		`incus_backup_verify_failures{target="` + target + `",type="instance"} 1`,
+		`incus_backup_prune_deleted_total{target="` + target + `",type="instance"} 1`,
+		`incus_backup_snapshots` + labels + ` 2`,
+		`incus_backup_latest_snapshot_timestamp_seconds` + labels + ` 1.709434983e+09`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+}
+
+func TestMetricsTextfile_VerifyBucketsKeepsOtherTypes(t *testing.T) {
+	root := t.TempDir()
+	prom := filepath.Join(t.TempDir(), "incus_backup.prom")
+	instDir := filepath.Join(root, "instances", "default", "web", "20240101T010101Z")
+	mustMkdirAll(t, instDir)
+	writeFileWithHash(t, filepath.Join(instDir, "export.tar.xz"), "data")
+	writeChecksums(t, filepath.Join(instDir, "checksums.txt"), map[string]string{"export.tar.xz": "0000"})
+	bucketDir := filepath.Join(root, "buckets", "default", "s3", "assets", "20240101T010101Z")
+	mustMkdirAll(t, bucketDir)
+	sum := writeFileWithHash(t, filepath.Join(bucketDir, "bucket.tar.xz"), "bucket-data")
+	writeChecksums(t, filepath.Join(bucketDir, "checksums.txt"), map[string]string{"bucket.tar.xz": sum})
+	target := "dir:" + root
+
+	for _, kind := range []string{"instances", "buckets"} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs([]string{"verify", kind, "--target", target, "--metrics-textfile", prom})
+		_ = cmd.Execute()
+	}
+
+	data, err := os.ReadFile(prom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		`incus_backup_verify_checked{target="` + target + `",type="instance"} 1`,
+		`incus_backup_verify_failures{target="` + target + `",type="instance"} 1`,
+		`incus_backup_verify_checked{target="` + target + `",type="bucket"} 1`,
+		`incus_backup_verify_failures{target="` + target + `",type="bucket"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestMountCmd_ValidatesArgs(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{dir}, "--target is required"},
+		{[]string{"--target", "s3:bucket", dir}, "unsupported"},
+		{[]string{"--target", "dir:" + dir, filepath.Join(dir, "missing")}, "no such file"},
+		{[]string{"--target", "dir:" + dir, file}, "not a directory"},
+	} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append([]string{"mount"}, tc.args...))
+		_, err := cmd.ExecuteC()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%v: expected %q error, got %v", tc.args, tc.want, err)
+		}
+	}
+}
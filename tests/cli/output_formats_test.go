@@ -0,0 +1,95 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+
+	"incus-backup/src/cli"
+)
+
+func runOutputCmd(t *testing.T, args ...string) (string, string) {
+	t.Helper()
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("%v: %v; stderr=%s", args, err, errBuf.String())
+	}
+	return out.String(), errBuf.String()
+}
+
+func TestOutputFormats_ListYAMLMatchesJSON(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "instances", "default", "web", "20250101T010101Z"))
+	mustMkdirAll(t, filepath.Join(root, "config", "20250104T040404Z"))
+
+	js, _ := runOutputCmd(t, "list", "all", "--target", "dir:"+root, "-o", "json")
+	ys, _ := runOutputCmd(t, "list", "all", "--target", "dir:"+root, "-o", "yaml")
+	var fromJSON, fromYAML []map[string]any
+	if err := json.Unmarshal([]byte(js), &fromJSON); err != nil {
+		t.Fatalf("json: %v\n%s", err, js)
+	}
+	if err := yaml.Unmarshal([]byte(ys), &fromYAML); err != nil {
+		t.Fatalf("yaml: %v\n%s", err, ys)
+	}
+	if len(fromJSON) != 2 || len(fromYAML) != 2 {
+		t.Fatalf("expected 2 entries, json=%d yaml=%d", len(fromJSON), len(fromYAML))
+	}
+	for i := range fromJSON {
+		for k, v := range fromJSON[i] {
+			if fromYAML[i][k] != v {
+				t.Fatalf("entry %d field %s: json=%v yaml=%v", i, k, v, fromYAML[i][k])
+			}
+		}
+	}
+}
+
+func TestOutputFormats_VerifyYAML(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "instances", "default", "web", "20250101T010101Z")
+	mustMkdirAll(t, dir)
+	sum := writeFileWithHash(t, filepath.Join(dir, "export.tar.xz"), "data")
+	writeChecksums(t, filepath.Join(dir, "checksums.txt"), map[string]string{"export.tar.xz": sum})
+
+	out, _ := runOutputCmd(t, "verify", "instances", "--target", "dir:"+root, "-o", "yaml")
+	for _, want := range []string{"- type: instance", "  name: web", "  status: ok", "  - name: export.tar.xz"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestOutputFormats_PruneDryRunYAML(t *testing.T) {
+	root := t.TempDir()
+	for _, ts := range []string{"20250101T010101Z", "20250102T010101Z"} {
+		mustMkdirAll(t, filepath.Join(root, "instances", "default", "web", ts))
+	}
+	out, _ := runOutputCmd(t, "prune", "instances", "--keep", "1", "--dry-run", "--target", "dir:"+root, "-o", "yaml")
+	var plan []map[string]string
+	if err := yaml.Unmarshal([]byte(out), &plan); err != nil {
+		t.Fatalf("yaml: %v\n%s", err, out)
+	}
+	if len(plan) != 1 || plan[0]["type"] != "instance" || plan[0]["timestamp"] != "20250101T010101Z" {
+		t.Fatalf("unexpected prune plan: %v", plan)
+	}
+}
+
+func TestOutputFormats_RejectUnknown(t *testing.T) {
+	for _, args := range [][]string{
+		{"list", "all"},
+		{"verify"},
+		{"prune", "--keep", "1"},
+	} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(args, "--target", "dir:"+t.TempDir(), "-o", "xml"))
+		if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "unsupported --output: xml") {
+			t.Fatalf("%v: expected unsupported output error, got %v", args, err)
+		}
+	}
+}
@@ -53,3 +53,49 @@ func TestPruneCmd_DryRunDoesNotDelete(t *testing.T) {
 		t.Fatalf("expected preview of deletions even in dry-run; got:\n%s", out.String())
 	}
 }
+
+func TestPruneCmd_LimitsToSelectedResources(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"instances/default/web", "instances/default/db", "instances/other/web",
+		"buckets/default/pool/b1", "buckets/default/pool/b2",
+	} {
+		mustMkdirAll(t, filepath.Join(root, dir, "20240101T010101Z"))
+		mustMkdirAll(t, filepath.Join(root, dir, "20240202T020202Z"))
+	}
+	run := func(args ...string) {
+		t.Helper()
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(append([]string{"prune"}, args...), "--target", "dir:"+root, "--keep", "1", "-y"))
+		if _, err := cmd.ExecuteC(); err != nil {
+			t.Fatalf("prune %v: %v; stderr=%s", args, err, errBuf.String())
+		}
+	}
+	run("instances", "web", "--project", "default")
+	run("buckets", "pool/b1")
+
+	for dir, pruned := range map[string]bool{
+		"instances/default/web":   true,
+		"instances/default/db":    false,
+		"instances/other/web":     false,
+		"buckets/default/pool/b1": true,
+		"buckets/default/pool/b2": false,
+	} {
+		_, err := os.Stat(filepath.Join(root, dir, "20240101T010101Z"))
+		if pruned != os.IsNotExist(err) {
+			t.Errorf("%s: pruned=%v, stat err=%v", dir, pruned, err)
+		}
+	}
+}
+
+func TestPruneCmd_RejectsNamesForUnscopedKinds(t *testing.T) {
+	for _, args := range [][]string{{"config", "x"}, {"volumes", "novolume"}} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(append([]string{"prune"}, args...), "--target", "dir:"+t.TempDir(), "--keep", "1"))
+		if _, err := cmd.ExecuteC(); err == nil {
+			t.Errorf("prune %v: expected an error", args)
+		}
+	}
+}
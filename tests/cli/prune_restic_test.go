@@ -103,6 +103,44 @@ func TestResticPruneDeletesOldSnapshots(t *testing.T) {
 	}
 }
 
+func TestResticPruneGroupsBundlesWithLegacyParts(t *testing.T) {
+	bin := restic.BinaryInfo{Path: "/bin/echo", Version: restic.RequiredVersion}
+	restoreDetector := cli.SetResticDetectorForTest(func(context.Context) (restic.BinaryInfo, error) {
+		return bin, nil
+	})
+	defer restoreDetector()
+
+	restoreList := cli.SetResticPruneListSnapshotsForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, tags []string) ([]restic.Snapshot, error) {
+		if len(tags) == 0 || tags[0] != "type=instance" {
+			return nil, nil
+		}
+		return []restic.Snapshot{
+			snapshotWithTags("legacy-data", map[string]string{"type": "instance", "schema": "v1", "part": "data", "project": "alpha", "name": "vm1", "timestamp": "20240101T000000Z"}),
+			snapshotWithTags("legacy-manifest", map[string]string{"type": "instance", "schema": "v1", "part": "manifest", "project": "alpha", "name": "vm1", "timestamp": "20240101T000000Z"}),
+			snapshotWithTags("bundle-old", map[string]string{"type": "instance", "schema": "v2", "project": "alpha", "name": "vm1", "timestamp": "20240102T000000Z"}),
+			snapshotWithTags("bundle-new", map[string]string{"type": "instance", "schema": "v2", "project": "alpha", "name": "vm1", "timestamp": "20240103T000000Z"}),
+		}, nil
+	})
+	defer restoreList()
+
+	var receivedIDs []string
+	restoreForget := cli.SetResticPruneForgetForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, ids []string, _ bool) error {
+		receivedIDs = append([]string(nil), ids...)
+		return nil
+	})
+	defer restoreForget()
+
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"prune", "instances", "--target", "restic:/repo", "--keep", "1", "--yes"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("prune failed: %v\nstderr=%s", err, errBuf.String())
+	}
+	if strings.Join(receivedIDs, ",") != "bundle-old,legacy-data,legacy-manifest" {
+		t.Fatalf("expected the two oldest versions to be forgotten, got %v", receivedIDs)
+	}
+}
+
 func snapshotWithTags(id string, tags map[string]string) restic.Snapshot {
 	var tagList []string
 	for k, v := range tags {
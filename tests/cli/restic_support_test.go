@@ -2,6 +2,8 @@ package cli_test
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -80,3 +82,50 @@ func TestResticTarget_VersionPromptAutoYes(t *testing.T) {
 		t.Fatalf("expected warning message, got %q", errBuf.String())
 	}
 }
+
+func TestResticCredentialFlagsReachChild(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	defer restic.ResetOptionsForTest()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	script := "#!/bin/sh\necho \"ARGS $*\" > " + record + "\nenv | grep -E '^(RESTIC_|B2_)' >> " + record + "\necho '[]'\n"
+	bin := filepath.Join(dir, "restic")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	envFile := filepath.Join(dir, "b2.env")
+	if err := os.WriteFile(envFile, []byte("B2_ACCOUNT_ID=id\nB2_ACCOUNT_KEY=key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := filepath.Join(dir, "restic.yaml")
+	if err := os.WriteFile(cfg, []byte("cacheDir: /var/cache/restic\noptions:\n  - b2.connections=4\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	restore := cli.SetResticDetectorForTest(func(context.Context) (restic.BinaryInfo, error) {
+		return restic.BinaryInfo{Path: bin, Version: restic.RequiredVersion}, nil
+	})
+	defer restore()
+
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"init", "--target", "restic:b2:bucket:/incus",
+		"--restic-config", cfg,
+		"--restic-password-file", "/etc/incus-backup/pw",
+		"--restic-option", "b2.timeout=1m",
+		"--restic-env-file", envFile})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("init failed: %v (stderr=%s)", err, errBuf.String())
+	}
+	got, _ := os.ReadFile(record)
+	for _, want := range []string{
+		"ARGS -o b2.connections=4 -o b2.timeout=1m snapshots",
+		"RESTIC_REPOSITORY=b2:bucket:/incus",
+		"RESTIC_PASSWORD_FILE=/etc/incus-backup/pw",
+		"RESTIC_CACHE_DIR=/var/cache/restic",
+		"B2_ACCOUNT_KEY=key",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Fatalf("missing %q in restic invocation:\n%s", want, got)
+		}
+	}
+}
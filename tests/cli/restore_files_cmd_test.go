@@ -0,0 +1,29 @@
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestRestoreFilesCmd_ValidatesFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--target", "dir:/tmp/x"}, "--path is required"},
+		{[]string{"--target", "dir:/tmp/x", "--path", "/etc", "--overwrite", "--skip-existing"}, "mutually exclusive"},
+		{[]string{"--path", "/etc"}, "--target is required"},
+		{[]string{"--target", "dir:/tmp/x", "--path", "/etc/["}, "invalid path pattern"},
+	} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append([]string{"restore", "files", "instance", "web"}, tc.args...))
+		_, err := cmd.ExecuteC()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%v: expected %q error, got %v", tc.args, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cli_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"incus-backup/src/cli"
+)
+
+func TestResultOutput_RejectsUnknownFormat(t *testing.T) {
+	for _, args := range [][]string{
+		{"backup", "config"},
+		{"backup", "instances", "web"},
+		{"restore", "instance", "web"},
+		{"restore", "volumes"},
+	} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(args, "--target", "dir:"+t.TempDir(), "--output", "xml"))
+		err := cmd.Execute()
+		if err == nil || !strings.Contains(err.Error(), "unsupported --output: xml") {
+			t.Fatalf("%v: expected unsupported output error, got %v", args, err)
+		}
+	}
+}
+
+func TestResultOutput_HelpListsFormats(t *testing.T) {
+	for _, args := range [][]string{
+		{"backup", "all"},
+		{"backup", "volumes"},
+		{"restore", "all"},
+		{"restore", "volume"},
+		{"restore", "instances"},
+	} {
+		var out, errBuf bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs(append(args, "--help"))
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out.String(), "table|json|yaml|ndjson") {
+			t.Fatalf("%v: --output not documented:\n%s", args, out.String())
+		}
+	}
+}
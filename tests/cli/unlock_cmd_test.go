@@ -0,0 +1,94 @@
+package cli_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"incus-backup/src/backend/directory"
+	"incus-backup/src/cli"
+	"incus-backup/src/restic"
+)
+
+func stubResticUnlock(t *testing.T, locks []string) *[]bool {
+	t.Helper()
+	bin := restic.BinaryInfo{Path: "/bin/echo", Version: restic.RequiredVersion}
+	t.Cleanup(cli.SetResticDetectorForTest(func(context.Context) (restic.BinaryInfo, error) { return bin, nil }))
+	var unlocked []bool
+	t.Cleanup(cli.SetResticUnlockForTest(
+		func(context.Context, restic.BinaryInfo, string) ([]string, error) {
+			if len(unlocked) > 0 {
+				return nil, nil
+			}
+			return locks, nil
+		},
+		func(_ context.Context, _ restic.BinaryInfo, _ string, removeAll bool) error {
+			unlocked = append(unlocked, removeAll)
+			return nil
+		},
+	))
+	return &unlocked
+}
+
+func TestUnlockCmd_RemovesStaleLocksAfterConfirmation(t *testing.T) {
+	unlocked := stubResticUnlock(t, []string{"abc123"})
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"unlock", "--target", "restic:/repo", "-y"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if len(*unlocked) != 1 || (*unlocked)[0] {
+		t.Fatalf("expected a single stale-only unlock, got %v", *unlocked)
+	}
+	if !strings.Contains(out.String(), "abc123") || !strings.Contains(out.String(), "Removed 1 lock(s)") {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+}
+
+func TestUnlockCmd_DryRunAndRemoveAllGuard(t *testing.T) {
+	unlocked := stubResticUnlock(t, []string{"abc123"})
+	var out, errBuf strings.Builder
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"unlock", "--target", "restic:/repo", "--dry-run"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("dry-run unlock failed: %v", err)
+	}
+	if len(*unlocked) != 0 {
+		t.Fatalf("dry-run must not unlock")
+	}
+
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"unlock", "--target", "restic:/repo", "--all", "-y"})
+	if _, err := cmd.ExecuteC(); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("expected --all to require --force, got %v", err)
+	}
+}
+
+func TestUnlockCmd_DirTarget(t *testing.T) {
+	root := t.TempDir()
+	run := func(target string) (string, error) {
+		var out, errBuf strings.Builder
+		cmd := cli.NewRootCmd(&out, &errBuf)
+		cmd.SetArgs([]string{"unlock", "--target", target})
+		_, err := cmd.ExecuteC()
+		return out.String(), err
+	}
+	if out, err := run("dir:" + root); err != nil || !strings.Contains(out, "is not locked") {
+		t.Fatalf("unlocked target: %q, %v", out, err)
+	}
+
+	l, err := directory.LockShared(root)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if out, err := run("dir:" + root); err != nil || !strings.Contains(out, "in use") {
+		t.Fatalf("locked target: %q, %v", out, err)
+	}
+	_ = l.Unlock()
+
+	if out, err := run("dir:" + filepath.Join(root, "missing")); err == nil {
+		t.Fatalf("expected an error for a missing target, got %q", out)
+	}
+}
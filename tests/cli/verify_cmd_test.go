@@ -142,3 +142,35 @@ func mustMkdirAll(t *testing.T, path string) {
 		t.Fatalf("mkdir -p %s: %v", path, err)
 	}
 }
+
+func TestVerifyCmd_CoversBuckets(t *testing.T) {
+	root := t.TempDir()
+	snapDir := filepath.Join(root, "buckets", "default", "s3", "assets", "20250103T030303Z")
+	mustMkdirAll(t, snapDir)
+
+	manifestSum := writeFileWithHash(t, filepath.Join(snapDir, "manifest.json"), "{\"name\":\"assets\"}\n")
+	writeFileWithHash(t, filepath.Join(snapDir, "bucket.tar.xz"), "bucket-data")
+	writeChecksums(t, filepath.Join(snapDir, "checksums.txt"), map[string]string{
+		"manifest.json": manifestSum,
+		"bucket.tar.xz": "0000",
+	})
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"verify", "buckets", "--target", "dir:" + root, "--output", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("verify command failed: %v; stderr=%s", err, errBuf.String())
+	}
+
+	var results []struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("unmarshal verify json: %v\n%s", err, out.String())
+	}
+	if len(results) != 1 || results[0].Type != "bucket" || results[0].Status != "mismatch" {
+		t.Fatalf("expected one mismatched bucket result, got %+v", results)
+	}
+}
@@ -0,0 +1,186 @@
+package cli_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	backendpkg "incus-backup/src/backend"
+	"incus-backup/src/cli"
+	"incus-backup/src/restic"
+)
+
+// gzipExport builds a minimal gzip-compressed Incus export for project/name.
+func gzipExport(t *testing.T, project, name, indexType string) []byte {
+	t.Helper()
+	index := "name: " + name + "\nbackend: dir\npool: default\ntype: " + indexType + "\nconfig:\n  container:\n    name: " + name + "\n    project: " + project + "\n"
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, m := range []struct{ name, body string }{
+		{"backup/index.yaml", index},
+		{"backup/container/rootfs/etc/hostname", name + "\n"},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: m.name, Mode: 0o644, Size: int64(len(m.body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(m.body)); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+type deepJSONResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Deep   *struct {
+		Status    string   `json:"status"`
+		IndexName string   `json:"indexName"`
+		DataFiles int      `json:"dataFiles"`
+		Problems  []string `json:"problems"`
+	} `json:"deep"`
+}
+
+func TestVerifyCmd_DeepChecksIndexAgainstManifest(t *testing.T) {
+	root := t.TempDir()
+	for _, tc := range []struct{ name, indexName string }{{"web", "web"}, {"db", "other"}} {
+		snapDir := filepath.Join(root, "instances", "default", tc.name, "20250101T010101Z")
+		manifestSum := writeFileWithHash(t, filepath.Join(snapDir, "manifest.json"), `{"type":"instance","project":"default","name":"`+tc.name+`"}`)
+		dataSum := writeFileWithHash(t, filepath.Join(snapDir, "export.tar.xz"), string(gzipExport(t, "default", tc.indexName, "container")))
+		writeChecksums(t, filepath.Join(snapDir, "checksums.txt"), map[string]string{
+			"manifest.json": manifestSum,
+			"export.tar.xz": dataSum,
+		})
+	}
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"verify", "instances", "--deep", "--target", "dir:" + root, "--output", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("verify command failed: %v; stderr=%s", err, errBuf.String())
+	}
+	var results []deepJSONResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, out.String())
+	}
+	byName := map[string]deepJSONResult{}
+	for _, r := range results {
+		byName[r.Name] = r
+	}
+	web := byName["web"]
+	if web.Status != "ok" || web.Deep == nil || web.Deep.Status != "ok" || web.Deep.DataFiles != 1 {
+		t.Fatalf("unexpected web result: %+v", web)
+	}
+	db := byName["db"]
+	if db.Status != "invalid" || db.Deep == nil || db.Deep.Status != "invalid" || len(db.Deep.Problems) == 0 {
+		t.Fatalf("expected db to fail deep verification: %+v", db)
+	}
+
+	out.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"verify", "instances", "--deep", "--target", "dir:" + root})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("verify command failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "- deep: ok index=container/web") {
+		t.Fatalf("expected deep detail line; got:\n%s", out.String())
+	}
+}
+
+func TestVerifyCmd_DeepReportsTypeMismatches(t *testing.T) {
+	root := t.TempDir()
+	for name, manifest := range map[string]string{
+		"web": `{"type":"volume","project":"default","name":"web"}`,
+		"db":  `{"type":"instance","project":"default","name":"db","source":{"instanceType":"virtual-machine"}}`,
+	} {
+		snapDir := filepath.Join(root, "instances", "default", name, "20250101T010101Z")
+		manifestSum := writeFileWithHash(t, filepath.Join(snapDir, "manifest.json"), manifest)
+		dataSum := writeFileWithHash(t, filepath.Join(snapDir, "export.tar.xz"), string(gzipExport(t, "default", name, "container")))
+		writeChecksums(t, filepath.Join(snapDir, "checksums.txt"), map[string]string{
+			"manifest.json": manifestSum,
+			"export.tar.xz": dataSum,
+		})
+	}
+
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"verify", "instances", "--deep", "--target", "dir:" + root, "--output", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("verify command failed: %v; stderr=%s", err, errBuf.String())
+	}
+	var results []deepJSONResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, out.String())
+	}
+	want := map[string]string{
+		"web": `manifest type "volume" does not match instance backup`,
+		"db":  `index type "container" does not match manifest instance type "virtual-machine"`,
+	}
+	for _, r := range results {
+		if r.Deep == nil || r.Deep.Status != "invalid" || !strings.Contains(strings.Join(r.Deep.Problems, "; "), want[r.Name]) {
+			t.Fatalf("expected %q for %s: %+v", want[r.Name], r.Name, r.Deep)
+		}
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+}
+
+func TestCollectResticVerifyResults_DeepStreamsExport(t *testing.T) {
+	ctx := context.Background()
+	bin := restic.BinaryInfo{Path: "/bin/echo", Version: restic.RequiredVersion}
+	dataContent := gzipExport(t, "alpha", "vm1", "virtual-machine")
+	manifestContent := []byte(`{"type":"instance","project":"alpha","name":"vm1"}`)
+
+	restoreList := cli.SetResticVerifyListSnapshotsForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, tags []string) ([]restic.Snapshot, error) {
+		if tags[0] != "type=instance" {
+			return nil, nil
+		}
+		base := []string{"type=instance", "project=alpha", "name=vm1", "timestamp=20240101T000000Z"}
+		return []restic.Snapshot{
+			{ID: "snap-data", Time: time.Unix(0, 0), Tags: append([]string{"part=data"}, base...)},
+			{ID: "snap-manifest", Time: time.Unix(0, 0), Tags: append([]string{"part=manifest"}, base...)},
+			{ID: "snap-checksums", Time: time.Unix(0, 0), Tags: append([]string{"part=checksums"}, base...)},
+		}, nil
+	})
+	defer restoreList()
+	restoreDump := cli.SetResticVerifyDumpForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, snapshotID string, _ string, w io.Writer, _ io.Writer) error {
+		var err error
+		switch snapshotID {
+		case "snap-data":
+			_, err = w.Write(dataContent)
+		case "snap-manifest":
+			_, err = w.Write(manifestContent)
+		case "snap-checksums":
+			_, err = w.Write([]byte(hexHash(dataContent) + "  export.tar\n" + hexHash(manifestContent) + "  manifest.json\n"))
+		}
+		return err
+	})
+	defer restoreDump()
+
+	results, err := cli.CollectResticDeepVerifyResultsForTest(ctx, bin, "repo", backendpkg.KindInstance)
+	if err != nil {
+		t.Fatalf("collect results: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	res := results[0]
+	if res.Status != "ok" || res.Deep == nil || res.Deep.Status != "ok" || res.Deep.IndexType != "virtual-machine" {
+		t.Fatalf("unexpected deep result: status=%s deep=%+v", res.Status, res.Deep)
+	}
+}
@@ -154,3 +154,57 @@ func hexHash(data []byte) string {
 	sum := sha256.Sum256(data)
 	return hex.EncodeToString(sum[:])
 }
+
+func TestCollectResticVerifyResults_BundleAlongsideLegacy(t *testing.T) {
+	ctx := context.Background()
+	bin := restic.BinaryInfo{Path: "/bin/echo", Version: restic.RequiredVersion}
+
+	dataContent := []byte("instance-data")
+	manifestContent := []byte("instance-manifest")
+	sums := hexHash(dataContent) + "  export.tar\n" + hexHash(manifestContent) + "  manifest.json\n"
+
+	restoreList := cli.SetResticVerifyListSnapshotsForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, tags []string) ([]restic.Snapshot, error) {
+		if len(tags) == 0 || tags[0] != "type=instance" {
+			return nil, nil
+		}
+		return []restic.Snapshot{
+			{ID: "legacy-data", Tags: []string{"type=instance", "schema=v1", "part=data", "project=alpha", "name=vm1", "timestamp=20240101T000000Z"}},
+			{ID: "legacy-manifest", Tags: []string{"type=instance", "schema=v1", "part=manifest", "project=alpha", "name=vm1", "timestamp=20240101T000000Z"}},
+			{ID: "legacy-checksums", Tags: []string{"type=instance", "schema=v1", "part=checksums", "project=alpha", "name=vm1", "timestamp=20240101T000000Z"}},
+			{ID: "bundle", Tags: []string{"type=instance", restic.BundleSchemaTag, "project=alpha", "name=vm1", "timestamp=20240102T000000Z"}},
+		}, nil
+	})
+	defer restoreList()
+
+	dumped := map[string][]string{}
+	restoreDump := cli.SetResticVerifyDumpForTest(func(_ context.Context, _ restic.BinaryInfo, _ string, snapshotID string, path string, w io.Writer, _ io.Writer) error {
+		dumped[snapshotID] = append(dumped[snapshotID], path)
+		var err error
+		switch path {
+		case "export.tar":
+			_, err = w.Write(dataContent)
+		case "manifest.json":
+			_, err = w.Write(manifestContent)
+		case "checksums.txt":
+			_, err = w.Write([]byte(sums))
+		}
+		return err
+	})
+	defer restoreDump()
+
+	results, err := cli.CollectResticVerifyResultsForTest(ctx, bin, "repo", backendpkg.KindInstance)
+	if err != nil {
+		t.Fatalf("collect results: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected one result per version, got %+v", results)
+	}
+	for _, res := range results {
+		if res.Status != "ok" {
+			t.Fatalf("expected ok for %s, got %+v", res.Timestamp, res)
+		}
+	}
+	if results[1].Path != "bundle" || len(dumped["bundle"]) != 3 {
+		t.Fatalf("expected every file of the bundle version to come from one snapshot: path=%s dumped=%v", results[1].Path, dumped)
+	}
+}
@@ -0,0 +1,120 @@
+package drill_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/drill"
+	"incus-backup/src/incusapi"
+)
+
+func TestSelectLatestAndRandom(t *testing.T) {
+	entries := []backend.Entry{
+		{Type: "instance", Project: "default", Name: "web", Timestamp: "20250101T000000Z", Path: "/b/web/1"},
+		{Type: "instance", Project: "default", Name: "web", Timestamp: "20250103T000000Z", Path: "/b/web/3"},
+		{Type: "instance", Project: "default", Name: "web", Timestamp: "20250102T000000Z", Path: "/b/web/2"},
+		{Type: "instance", Project: "default", Name: "db", Timestamp: "20250101T000000Z", Path: "/b/db/1"},
+		{Type: "instance", Project: "other", Name: "web", Timestamp: "20250109T000000Z", Path: "/o/web/9"},
+		{Type: "volume", Project: "default", Pool: "p", Name: "web", Timestamp: "20250109T000000Z"},
+	}
+
+	latest, err := drill.Select(entries, "default", nil, drill.SelectLatest, nil)
+	if err != nil {
+		t.Fatalf("select latest: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Name != "db" || latest[1].Name != "web" || latest[1].Timestamp != "20250103T000000Z" || latest[1].Ref != "/b/web/3" {
+		t.Fatalf("unexpected latest selection: %+v", latest)
+	}
+
+	pick := func(seed int64) string {
+		got, err := drill.Select(entries, "default", []string{"web"}, drill.SelectRandom, rand.New(rand.NewSource(seed)))
+		if err != nil {
+			t.Fatalf("select random: %v", err)
+		}
+		if len(got) != 1 {
+			t.Fatalf("expected single candidate, got %+v", got)
+		}
+		return got[0].Timestamp
+	}
+	if pick(42) != pick(42) {
+		t.Fatalf("random selection should be deterministic for a fixed seed")
+	}
+
+	if _, err := drill.Select(entries, "default", []string{"missing"}, drill.SelectLatest, nil); err == nil {
+		t.Fatalf("expected error for instance without backups")
+	}
+}
+
+func TestRunRecordsPassFailAndTearsDown(t *testing.T) {
+	fake := incusapi.NewFake()
+	fake.ExecFunc = func(project, name string, command []string) (int, error) {
+		if name == "db-drill" {
+			return 3, nil
+		}
+		return 0, nil
+	}
+	restore := func(c drill.Candidate, project, targetName string) error {
+		if c.Name == "broken" {
+			return errors.New("truncated export")
+		}
+		if fake.Instances[project] == nil {
+			fake.Instances[project] = map[string][]byte{}
+		}
+		fake.Instances[project][targetName] = []byte(c.Ref)
+		return nil
+	}
+	candidates := []drill.Candidate{
+		{Project: "default", Name: "broken", Timestamp: "20250101T000000Z"},
+		{Project: "default", Name: "db", Timestamp: "20250101T000000Z"},
+		{Project: "default", Name: "web", Timestamp: "20250101T000000Z"},
+	}
+	report := drill.Run(fake, candidates, restore, drill.Options{
+		ScratchProject: "drill-test",
+		Start:          true,
+		HealthCommand:  []string{"true"},
+		HealthTimeout:  time.Second,
+		Sleep:          func(time.Duration) {},
+	})
+
+	if report.Passed != 1 || report.Failed != 2 {
+		t.Fatalf("expected 1 pass / 2 fail, got %+v", report)
+	}
+	byName := map[string]drill.Result{}
+	for _, r := range report.Results {
+		byName[r.Name] = r
+	}
+	if r := byName["broken"]; r.Restored || r.Status != drill.StatusFail {
+		t.Fatalf("unexpected result for broken: %+v", r)
+	}
+	if r := byName["db"]; r.HealthExitCode == nil || *r.HealthExitCode != 3 || r.Status != drill.StatusFail {
+		t.Fatalf("unexpected result for db: %+v", r)
+	}
+	if r := byName["web"]; !r.Restored || !r.Started || r.Status != drill.StatusPass {
+		t.Fatalf("unexpected result for web: %+v", r)
+	}
+	if len(fake.Instances["drill-test"]) != 0 {
+		t.Fatalf("expected drilled instances to be deleted, got %v", fake.Instances["drill-test"])
+	}
+	if _, ok := fake.ProjectsMap["drill-test"]; ok {
+		t.Fatalf("expected scratch project to be deleted")
+	}
+}
+
+// projectLeakClient fails to delete projects, as when a drill instance could
+// not be torn down.
+type projectLeakClient struct{ *incusapi.FakeClient }
+
+func (projectLeakClient) DeleteProject(string) error { return errors.New("project is not empty") }
+
+func TestRunWarnsWhenScratchProjectIsNotDeleted(t *testing.T) {
+	var progress bytes.Buffer
+	drill.Run(projectLeakClient{incusapi.NewFake()}, nil, nil, drill.Options{ScratchProject: "drill-test", Progress: &progress})
+	if !strings.Contains(progress.String(), "[warn] delete project drill-test: project is not empty") {
+		t.Fatalf("missing cleanup warning:\n%s", progress.String())
+	}
+}
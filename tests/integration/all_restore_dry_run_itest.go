@@ -61,6 +61,21 @@ func TestRestoreAll_DryRun_NoChanges(t *testing.T) {
         }
     }
 
+    // The plan is rendered in the requested format, with nothing on stderr.
+    {
+        var out, errb bytes.Buffer
+        cmd := cli.NewRootCmd(&out, &errb)
+        cmd.SetArgs([]string{"restore", "all", "--project", proj, "--target", "dir:" + root, "--dry-run", "-o", "yaml"})
+        if _, err := cmd.ExecuteC(); err != nil { t.Fatalf("restore all --dry-run -o yaml: %v; stderr=%s", err, errb.String()) }
+        s := out.String()
+        if !strings.Contains(s, "resources:") || !strings.Contains(s, "action: create") || !strings.Contains(s, "name: " + inst) || strings.Contains(s, "ACTION") {
+            t.Fatalf("expected a YAML plan; got: %s", s)
+        }
+        if strings.Contains(errb.String(), "ACTION") {
+            t.Fatalf("expected no preview table on stderr; got: %s", errb.String())
+        }
+    }
+
     // Verify instance still absent
     if _, err := exec.Command("incus", "--project", proj, "list", "-c", "n", "--format", "csv").CombinedOutput(); err == nil {
         t.Fatalf("expected no instances present after dry-run restore")
@@ -0,0 +1,61 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/cli"
+)
+
+// Back up a container, delete a directory in it and push the directory back
+// from the backup.
+func TestRestoreFiles_UndoesRemovedDirectory(t *testing.T) {
+	if os.Getenv("INCUS_TESTS") != "1" {
+		t.Skip("INCUS_TESTS=1 not set")
+	}
+
+	proj := "itest-files-" + time.Now().UTC().Format("20060102T150405")
+	run(t, "incus", "project", "create", proj)
+	t.Cleanup(func() { _ = exec.Command("incus", "project", "delete", proj).Run() })
+
+	instName := "f1"
+	run(t, "incus", "--project", proj, "launch", "images:alpine/3.18", instName)
+	t.Cleanup(func() { _ = exec.Command("incus", "--project", proj, "delete", "--force", instName).Run() })
+	run(t, "incus", "--project", proj, "exec", instName, "--", "sh", "-c",
+		"mkdir -p /var/lib/app && echo rows > /var/lib/app/data.db && chown -R 1000:1000 /var/lib/app && chmod 640 /var/lib/app/data.db")
+
+	root := t.TempDir()
+	{
+		var out, errb bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errb)
+		cmd.SetArgs([]string{"backup", "instances", instName, "--project", proj, "--target", "dir:" + root})
+		if _, err := cmd.ExecuteC(); err != nil {
+			t.Fatalf("backup: %v; stderr=%s", err, errb.String())
+		}
+	}
+
+	run(t, "incus", "--project", proj, "exec", instName, "--", "rm", "-rf", "/var/lib/app")
+
+	{
+		var out, errb bytes.Buffer
+		cmd := cli.NewRootCmd(&out, &errb)
+		cmd.SetArgs([]string{"restore", "files", "instance", instName, "--project", proj, "--target", "dir:" + root, "--path", "/var/lib/app/", "--skip-existing"})
+		if _, err := cmd.ExecuteC(); err != nil {
+			t.Fatalf("restore files: %v; stderr=%s", err, errb.String())
+		}
+	}
+
+	got := run(t, "incus", "--project", proj, "exec", instName, "--", "stat", "-c", "%u:%g %a", "/var/lib/app/data.db")
+	if strings.TrimSpace(got) != "1000:1000 640" {
+		t.Fatalf("unexpected ownership and mode: %q", got)
+	}
+	if got := run(t, "incus", "--project", proj, "exec", instName, "--", "cat", "/var/lib/app/data.db"); strings.TrimSpace(got) != "rows" {
+		t.Fatalf("unexpected content: %q", got)
+	}
+}
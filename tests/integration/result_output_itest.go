@@ -0,0 +1,81 @@
+//go:build integration
+
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"incus-backup/src/cli"
+)
+
+type opResultJSON struct {
+	Event      string  `json:"event"`
+	Operation  string  `json:"operation"`
+	Resource   string  `json:"resource"`
+	TargetName string  `json:"targetName"`
+	Version    string  `json:"version"`
+	Path       string  `json:"path"`
+	Bytes      int64   `json:"bytes"`
+	SHA256     string  `json:"sha256"`
+	Duration   float64 `json:"duration"`
+	Status     string  `json:"status"`
+}
+
+// Backup with NDJSON events, then restore with a JSON result array.
+func TestResultOutput_BackupNDJSONRestoreJSON(t *testing.T) {
+	if os.Getenv("INCUS_TESTS") != "1" {
+		t.Skip("INCUS_TESTS=1 not set")
+	}
+
+	proj := "itest-results-" + time.Now().UTC().Format("20060102T150405")
+	run(t, "incus", "project", "create", proj)
+	t.Cleanup(func() { _ = exec.Command("incus", "project", "delete", proj).Run() })
+	inst := "rinst"
+	run(t, "incus", "--project", proj, "launch", "images:alpine/3.18", inst)
+	t.Cleanup(func() { _ = exec.Command("incus", "--project", proj, "delete", "--force", inst).Run() })
+
+	root := t.TempDir()
+	var out, errBuf bytes.Buffer
+	cmd := cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"backup", "instances", inst, "--project", proj, "--target", "dir:" + root, "-o", "ndjson"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("backup: %v; stderr=%s", err, errBuf.String())
+	}
+	var events []opResultJSON
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		var ev opResultJSON
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatalf("stdout line is not JSON: %v: %s", err, sc.Text())
+		}
+		events = append(events, ev)
+	}
+	if len(events) != 2 || events[0].Event != "start" || events[1].Event != "result" {
+		t.Fatalf("expected start and result events, got %+v", events)
+	}
+	res := events[1]
+	if res.Status != "ok" || res.Resource != "instance/"+proj+"/"+inst || res.Version == "" || res.Path == "" || res.Bytes == 0 || len(res.SHA256) != 64 {
+		t.Fatalf("unexpected backup result: %+v", res)
+	}
+
+	out.Reset()
+	errBuf.Reset()
+	cmd = cli.NewRootCmd(&out, &errBuf)
+	cmd.SetArgs([]string{"restore", "instance", inst, "--project", proj, "--target", "dir:" + root, "--skip-existing", "-o", "json"})
+	if _, err := cmd.ExecuteC(); err != nil {
+		t.Fatalf("restore: %v; stderr=%s", err, errBuf.String())
+	}
+	var results []opResultJSON
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("restore stdout is not JSON: %v\n%s", err, out.String())
+	}
+	if len(results) != 1 || results[0].Status != "skipped" || results[0].TargetName != inst || results[0].Version != res.Version {
+		t.Fatalf("unexpected restore results: %+v", results)
+	}
+}
@@ -0,0 +1,86 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"incus-backup/src/logging"
+)
+
+func records(t *testing.T, b *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("invalid JSON record %q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+func TestWriter_SplitsEventsAndProgress(t *testing.T) {
+	var logs, progress bytes.Buffer
+	l, err := logging.New(&logs, logging.Options{Level: "debug", Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := logging.NewWriter(l.With("project", "default", "name", "web"), &progress)
+	fmt.Fprintf(w, "[snapshot] create web@tmp-1\n")
+	fmt.Fprint(w, "\r[write] 10.0% (1/10 bytes)")
+	fmt.Fprint(w, "\r[write] 100.0% (10/10 bytes)")
+	fmt.Fprint(w, "\n")
+	// A line may arrive in pieces.
+	fmt.Fprint(w, "plain ")
+	fmt.Fprint(w, "message\n")
+
+	if got, want := progress.String(), "\r[write] 10.0% (1/10 bytes)\r[write] 100.0% (10/10 bytes)\n"; got != want {
+		t.Fatalf("progress = %q, want %q", got, want)
+	}
+	recs := records(t, &logs)
+	if len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %v", recs)
+	}
+	if r := recs[0]; r["level"] != "INFO" || r["msg"] != "create web@tmp-1" || r["phase"] != "snapshot" || r["project"] != "default" || r["name"] != "web" {
+		t.Fatalf("event record: %v", r)
+	}
+	if r := recs[1]; r["level"] != "DEBUG" || r["msg"] != "100.0% (10/10 bytes)" || r["phase"] != "write" {
+		t.Fatalf("progress record: %v", r)
+	}
+	if r := recs[2]; r["msg"] != "plain message" || r["phase"] != nil {
+		t.Fatalf("plain record: %v", r)
+	}
+}
+
+func TestWriter_InfoLevelHidesProgressRecords(t *testing.T) {
+	var logs bytes.Buffer
+	l, err := logging.New(&logs, logging.Options{Format: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := logging.NewWriter(l, nil)
+	fmt.Fprint(w, "\r[download] 5 MB\n[restic] export.tar: snapshot 0123abcd\n")
+	got := logs.String()
+	if strings.Contains(got, "download") || !strings.Contains(got, `msg="export.tar: snapshot 0123abcd" phase=restic`) {
+		t.Fatalf("unexpected log output: %q", got)
+	}
+}
+
+func TestNew_RejectsUnknownOptions(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, logging.Options{Level: "verbose"}); err == nil {
+		t.Fatal("expected level error")
+	}
+	if _, err := logging.New(&bytes.Buffer{}, logging.Options{Format: "xml"}); err == nil {
+		t.Fatal("expected format error")
+	}
+	if logging.IsTerminal(&bytes.Buffer{}) {
+		t.Fatal("a buffer is not a terminal")
+	}
+}
@@ -0,0 +1,131 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/backend"
+	"incus-backup/src/metrics"
+)
+
+func render(t *testing.T, r *metrics.Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestWriteText_Format(t *testing.T) {
+	r := metrics.NewRegistry()
+	end := time.Unix(1700000000, 0)
+	res := metrics.Resource{Type: "instance", Project: "default", Name: `we"b`}
+	r.BackupSucceeded("dir:/b", res, end, 90*time.Second, 1024)
+	r.BackupFailed("dir:/b", metrics.Resource{Type: "config"})
+
+	got := render(t, r)
+	for _, want := range []string{
+		"# HELP incus_backup_last_success_timestamp_seconds Unix time of the last successful backup of a resource.\n# TYPE incus_backup_last_success_timestamp_seconds gauge\n",
+		`incus_backup_last_success_timestamp_seconds{name="we\"b",project="default",target="dir:/b",type="instance"} 1.7e+09`,
+		`incus_backup_last_duration_seconds{name="we\"b",project="default",target="dir:/b",type="instance"} 90`,
+		`incus_backup_last_exported_bytes{name="we\"b",project="default",target="dir:/b",type="instance"} 1024`,
+		"# TYPE incus_backup_failures_total counter\n",
+		`incus_backup_failures_total{target="dir:/b",type="config"} 1`,
+		`incus_backup_failures_total{name="we\"b",project="default",target="dir:/b",type="instance"} 0`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("missing %q in:\n%s", want, got)
+		}
+	}
+	if got != render(t, r) {
+		t.Fatal("output is not stable")
+	}
+}
+
+func TestInventory_ReplacesTargetSeries(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Inventory("dir:/b", []backend.Entry{
+		{Type: "instance", Project: "default", Name: "web", Timestamp: "20240101T000000Z"},
+		{Type: "instance", Project: "default", Name: "web", Timestamp: "20240301T000000Z"},
+		{Type: "instance", Project: "default", Name: "db", Timestamp: "20240201T000000Z"},
+	})
+	r.Inventory("dir:/other", []backend.Entry{{Type: "config", Timestamp: "20240101T000000Z"}})
+	web := metrics.Labels{"target": "dir:/b", "type": "instance", "project": "default", "name": "web"}
+	if v, _ := r.Value(metrics.Snapshots, web); v != 2 {
+		t.Fatalf("web snapshots = %v", v)
+	}
+	if v, _ := r.Value(metrics.LatestSnapshot, web); v != float64(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix()) {
+		t.Fatalf("web latest = %v", v)
+	}
+
+	// db was pruned away; web is down to one version.
+	r.Inventory("dir:/b", []backend.Entry{{Type: "instance", Project: "default", Name: "web", Timestamp: "20240301T000000Z"}})
+	if v, _ := r.Value(metrics.Snapshots, web); v != 1 {
+		t.Fatalf("web snapshots after prune = %v", v)
+	}
+	if _, ok := r.Value(metrics.Snapshots, metrics.Labels{"target": "dir:/b", "type": "instance", "project": "default", "name": "db"}); ok {
+		t.Fatal("db series should be gone")
+	}
+	if _, ok := r.Value(metrics.Snapshots, metrics.Labels{"target": "dir:/other", "type": "config"}); !ok {
+		t.Fatal("other target must be untouched")
+	}
+}
+
+func TestTextfile_RoundTripMerges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "incus_backup.prom")
+	first := metrics.NewRegistry()
+	first.Pruned("dir:/b", "instance", 3)
+	first.Verified("dir:/b", "instance", 4, 1, time.Unix(1700000000, 0))
+	first.Set("custom_metric", metrics.Labels{"path": "a\\b\nc"}, 0.5)
+	if err := first.WriteTextfile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	second := metrics.NewRegistry()
+	if err := second.LoadTextfile(path); err != nil {
+		t.Fatal(err)
+	}
+	second.Pruned("dir:/b", "instance", 2)
+	if v, _ := second.Value(metrics.PruneDeleted, metrics.Labels{"target": "dir:/b", "type": "instance"}); v != 5 {
+		t.Fatalf("prune counter = %v", v)
+	}
+	if v, _ := second.Value(metrics.VerifyFailures, metrics.Labels{"target": "dir:/b", "type": "instance"}); v != 1 {
+		t.Fatalf("verify failures = %v", v)
+	}
+	if v, _ := second.Value("custom_metric", metrics.Labels{"path": "a\\b\nc"}); v != 0.5 {
+		t.Fatalf("escaped labels did not round-trip: %v", v)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Fatalf("temp files left behind: %v", entries)
+	}
+
+	if err := metrics.NewRegistry().LoadTextfile(filepath.Join(t.TempDir(), "missing.prom")); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+}
+
+func TestHandler_ServesText(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.JobFinished("nightly", "backup", "ok", time.Unix(100, 0), time.Unix(160, 0))
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`incus_backup_job_last_success_timestamp_seconds{job="nightly",task="backup"} 160`,
+		`incus_backup_job_last_duration_seconds{job="nightly",task="backup"} 60`,
+		`incus_backup_job_runs_total{job="nightly",status="ok",task="backup"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+}
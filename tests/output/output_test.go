@@ -0,0 +1,83 @@
+package output_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"incus-backup/src/output"
+)
+
+type row struct {
+	Type    string  `json:"type"`
+	Name    string  `json:"name,omitempty"`
+	Size    int64   `json:"size"`
+	Ratio   float64 `json:"ratio"`
+	Tags    []string
+	Skipped string `json:"-"`
+}
+
+func TestCheck(t *testing.T) {
+	for in, want := range map[string]string{"": "table", "table": "table", "json": "json", "yaml": "yaml"} {
+		got, err := output.Check(in)
+		if err != nil || got != want {
+			t.Fatalf("Check(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := output.Check("xml"); err == nil || err.Error() != "unsupported --output: xml" {
+		t.Fatalf("expected unsupported error, got %v", err)
+	}
+}
+
+func TestRenderYAMLUsesJSONFieldNamesAndOrder(t *testing.T) {
+	rows := []row{{Type: "instance", Name: "web", Size: 1234567890, Ratio: 0.5, Tags: []string{"a"}, Skipped: "x"}, {Type: "config"}}
+	var buf bytes.Buffer
+	if err := output.Render(&buf, output.YAML, rows, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `- type: instance
+  name: web
+  size: 1234567890
+  ratio: 0.5
+  Tags:
+  - a
+- type: config
+  size: 0
+  ratio: 0
+  Tags: null
+`
+	if buf.String() != want {
+		t.Fatalf("yaml:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestRenderJSONAndTable(t *testing.T) {
+	rows := []row{{Type: "volume", Name: "data", Size: 3}}
+	var buf bytes.Buffer
+	if err := output.Render(&buf, output.JSON, rows, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"type": "volume"`) || strings.Contains(buf.String(), "Skipped") {
+		t.Fatalf("unexpected json: %s", buf.String())
+	}
+
+	buf.Reset()
+	err := output.Render(&buf, "", rows, func(w io.Writer) error {
+		tbl := output.NewTable(w, "TYPE", "NAME", "SIZE")
+		for _, r := range rows {
+			tbl.Row(r.Type, r.Name, r.Size)
+		}
+		return tbl.Flush()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "TYPE    NAME  SIZE\nvolume  data  3\n"; buf.String() != want {
+		t.Fatalf("table:\n%q\nwant:\n%q", buf.String(), want)
+	}
+
+	if err := output.Render(&buf, output.Table, rows, nil); err == nil {
+		t.Fatal("expected error without a table view")
+	}
+}
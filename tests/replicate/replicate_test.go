@@ -0,0 +1,347 @@
+package replicate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+
+	"incus-backup/src/archive"
+	"incus-backup/src/backend"
+	"incus-backup/src/backup/manifest"
+	"incus-backup/src/replicate"
+	"incus-backup/src/restic"
+)
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeVersion lays out one directory-backend version with a checksums.txt
+// covering every file, in the given order.
+func writeVersion(t *testing.T, dir string, files [][2]string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var sums strings.Builder
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", sha([]byte(f[1])), f[0])
+	}
+	if err := os.WriteFile(filepath.Join(dir, "checksums.txt"), []byte(sums.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tarball returns an uncompressed tar holding one file.
+func tarball(t *testing.T, name, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func xzCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	xw, err := xz.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const instanceManifest = `{"schemaVersion":2,"type":"instance","project":"default","name":"web","options":{"optimized":"false","snapshot":"true"},"export":{"filename":"export.tar.xz","size":7,"compression":"xz"}}`
+
+func seedSource(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeVersion(t, filepath.Join(root, "instances", "default", "web", "20240101T000000Z"), [][2]string{{"export.tar.xz", "old-data"}, {"manifest.json", instanceManifest}})
+	writeVersion(t, filepath.Join(root, "instances", "default", "web", "20240102T000000Z"), [][2]string{{"export.tar.xz", string(xzCompress(t, tarball(t, "backup/index.yaml", "name: web\n")))}, {"manifest.json", instanceManifest}})
+	writeVersion(t, filepath.Join(root, "volumes", "default", "fast", "vol1", "20240101T000000Z"), [][2]string{{"volume.tar.xz", "volume"}, {"manifest.json", `{"type":"volume","project":"default","pool":"fast","name":"vol1"}`}})
+	writeVersion(t, filepath.Join(root, "buckets", "default", "s3", "assets", "20240101T000000Z"), [][2]string{{"bucket.tar.xz", "bucket"}, {"manifest.json", `{"type":"bucket","project":"default","pool":"s3","name":"assets"}`}})
+	writeVersion(t, filepath.Join(root, "config", "20240103T000000Z"), [][2]string{{"projects.json", "[]"}, {"profiles.json", "[]"}, {"manifest.json", `{"type":"config"}`}})
+	return root
+}
+
+func TestCopyDirToDirKeepsVersionsAndSkipsExisting(t *testing.T) {
+	srcRoot := seedSource(t)
+	dstRoot := t.TempDir()
+	src, err := replicate.NewDirStore(srcRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := replicate.NewDirStore(dstRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, todo, err := replicate.Plan(src, dst, replicate.Selector{Kind: backend.KindAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 5 || len(todo) != 5 {
+		t.Fatalf("expected 5 planned versions, got %+v", plan)
+	}
+	for _, r := range replicate.Copy(src, dst, todo, nil) {
+		if r.Status != "copied" {
+			t.Fatalf("copy failed: %+v", r)
+		}
+	}
+	for _, rel := range []string{
+		"instances/default/web/20240102T000000Z/export.tar.xz",
+		"volumes/default/fast/vol1/20240101T000000Z/volume.tar.xz",
+		"buckets/default/s3/assets/20240101T000000Z/bucket.tar.xz",
+		"config/20240103T000000Z/profiles.json",
+	} {
+		if _, err := os.Stat(filepath.Join(dstRoot, rel)); err != nil {
+			t.Fatalf("missing %s: %v", rel, err)
+		}
+	}
+	got, _ := os.ReadFile(filepath.Join(dstRoot, "config", "20240103T000000Z", "checksums.txt"))
+	want, _ := os.ReadFile(filepath.Join(srcRoot, "config", "20240103T000000Z", "checksums.txt"))
+	if string(got) != string(want) {
+		t.Fatalf("config checksums changed:\n%s\nvs\n%s", got, want)
+	}
+
+	plan, todo, err = replicate.Plan(src, dst, replicate.Selector{Kind: backend.KindAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todo) != 0 {
+		t.Fatalf("expected every version to be skipped on the second run, got %+v", plan)
+	}
+}
+
+func TestCopySelectorsAndCorruptSource(t *testing.T) {
+	srcRoot := seedSource(t)
+	src, _ := replicate.NewDirStore(srcRoot)
+	dstRoot := t.TempDir()
+	dst, _ := replicate.NewDirStore(dstRoot)
+
+	_, todo, err := replicate.Plan(src, dst, replicate.Selector{Kind: backend.KindInstance, Names: []string{"web"}, Latest: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todo) != 1 || todo[0].Timestamp != "20240102T000000Z" {
+		t.Fatalf("expected only the latest web version, got %+v", todo)
+	}
+
+	// Corrupt the export after its checksum was recorded.
+	if err := os.WriteFile(filepath.Join(srcRoot, "instances", "default", "web", "20240102T000000Z", "export.tar.xz"), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	results := replicate.Copy(src, dst, todo, nil)
+	if results[0].Status != "failed" || !strings.Contains(results[0].Error, "checksum mismatch") {
+		t.Fatalf("expected checksum failure, got %+v", results[0])
+	}
+	entries, _ := os.ReadDir(filepath.Join(dstRoot, "instances", "default", "web"))
+	if len(entries) != 0 {
+		t.Fatalf("failed copy left files behind: %v", entries)
+	}
+
+	if _, _, err := replicate.Plan(src, dst, replicate.Selector{Kind: backend.KindImage}); err == nil {
+		t.Fatalf("expected images to be rejected")
+	}
+}
+
+func TestRewriteManifest(t *testing.T) {
+	out, err := replicate.RewriteManifest([]byte(instanceManifest), &manifest.Export{Filename: "export.tar", Size: 10240, Compression: "none"}, &manifest.Restic{DataAdded: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Name   string           `json:"name"`
+		Export manifest.Export  `json:"export"`
+		Restic *manifest.Restic `json:"restic"`
+	}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Name != "web" || doc.Export.Filename != "export.tar" || doc.Export.Size != 10240 || doc.Export.Compression != "none" || doc.Restic == nil || doc.Restic.DataAdded != 5 {
+		t.Fatalf("unexpected rewritten manifest: %s", out)
+	}
+	out, _ = replicate.RewriteManifest(out, nil, nil)
+	if strings.Contains(string(out), "restic") || !strings.Contains(string(out), `"filename": "export.tar"`) {
+		t.Fatalf("expected restic stats to be dropped and the export kept: %s", out)
+	}
+}
+
+// TestCopyDirToResticBundlesVersion drives ResticStore.Put against a fake
+// restic that accepts the streamed data and the bundle snapshot.
+func TestCopyDirToResticBundlesVersion(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	script := `#!/bin/sh
+echo "CALL $*" >> "` + record + `"
+case " $* " in
+  *" snapshots "*)
+    echo '[]'
+    ;;
+  *" ls "*)
+    echo '{"name":"export.tar","type":"file","path":"/export.tar","size":7,"mtime":"2024-01-02T00:00:00Z","struct_type":"node"}'
+    ;;
+  *" --parent "*)
+    echo "MANIFEST $(cat manifest.json | tr -d ' \n')" >> "` + record + `"
+    echo '{"message_type":"summary","files_new":2,"files_unmodified":1,"snapshot_id":"bundle1"}'
+    ;;
+  *" --stdin "*)
+    cat > /dev/null
+    echo '{"message_type":"summary","files_new":1,"data_added":7,"snapshot_id":"data1"}'
+    ;;
+esac
+`
+	bin := filepath.Join(dir, "restic")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := replicate.NewResticStore(context.Background(), restic.BinaryInfo{Path: bin, Version: restic.RequiredVersion}, "/repo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, _ := replicate.NewDirStore(seedSource(t))
+	_, todo, err := replicate.Plan(src, dst, replicate.Selector{Kind: backend.KindInstance, Version: "20240102T000000Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := replicate.Copy(src, dst, todo, nil)
+	if len(results) != 1 || results[0].Status != "copied" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	calls, _ := os.ReadFile(record)
+	for _, want := range []string{
+		"--stdin --stdin-filename export.tar --tag type=instance --tag schema=v1 --tag project=default --tag name=web --tag timestamp=20240102T000000Z --tag part=data --tag snapshot=true",
+		"--tag schema=v2",
+		`"filename":"export.tar"`,
+		"forget data1",
+	} {
+		if !strings.Contains(string(calls), want) {
+			t.Fatalf("missing %q in restic calls:\n%s", want, calls)
+		}
+	}
+}
+
+// fakeResticRepo writes a restic stand-in that keeps the streamed export and
+// the bundle files of one instance version in store and serves them back.
+func fakeResticRepo(t *testing.T, store string) string {
+	t.Helper()
+	script := `#!/bin/sh
+S="` + store + `"
+for last; do :; done
+case " $* " in
+  *" snapshots "*)
+    if [ -f "$S/bundle" ]; then
+      echo '[{"id":"bundle1","short_id":"bundle1","time":"2024-01-02T00:00:00Z","tags":["type=instance","schema=v2","project=default","name=web","timestamp=20240102T000000Z"],"paths":["/"]}]'
+    else
+      echo '[]'
+    fi
+    ;;
+  *" ls "*)
+    echo "{\"name\":\"export.tar\",\"type\":\"file\",\"path\":\"/export.tar\",\"size\":$(wc -c < "$S/export.tar"),\"mtime\":\"2024-01-02T00:00:00Z\",\"struct_type\":\"node\"}"
+    ;;
+  *" dump "*)
+    cat "$S/$(basename "$last")"
+    ;;
+  *" --parent "*)
+    cp manifest.json checksums.txt "$S/" && touch "$S/bundle"
+    echo '{"message_type":"summary","files_new":2,"files_unmodified":1,"snapshot_id":"bundle1"}'
+    ;;
+  *" --stdin "*)
+    cat > "$S/export.tar"
+    echo '{"message_type":"summary","files_new":1,"data_added":7,"snapshot_id":"data1"}'
+    ;;
+esac
+`
+	bin := filepath.Join(t.TempDir(), "restic")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return bin
+}
+
+func TestCopyDirToResticToDirRecompresses(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	store := t.TempDir()
+	mid, err := replicate.NewResticStore(context.Background(), restic.BinaryInfo{Path: fakeResticRepo(t, store), Version: restic.RequiredVersion}, "/repo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcRoot := seedSource(t)
+	src, _ := replicate.NewDirStore(srcRoot)
+	_, todo, err := replicate.Plan(src, mid, replicate.Selector{Kind: backend.KindInstance, Version: "20240102T000000Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := replicate.Copy(src, mid, todo, nil); r[0].Status != "copied" {
+		t.Fatalf("dir to restic failed: %+v", r[0])
+	}
+	plain := tarball(t, "backup/index.yaml", "name: web\n")
+	stored, _ := os.ReadFile(filepath.Join(store, "export.tar"))
+	if !bytes.Equal(stored, plain) {
+		t.Fatalf("restic should hold the uncompressed tar")
+	}
+	sums, _ := os.ReadFile(filepath.Join(store, "checksums.txt"))
+	if !strings.Contains(string(sums), sha(plain)+"  export.tar") {
+		t.Fatalf("restic checksums do not describe the stored tar: %s", sums)
+	}
+
+	dstRoot := t.TempDir()
+	dst, _ := replicate.NewDirStore(dstRoot)
+	if r := replicate.Copy(mid, dst, todo, nil); r[0].Status != "copied" {
+		t.Fatalf("restic to dir failed: %+v", r[0])
+	}
+	snapDir := filepath.Join(dstRoot, "instances", "default", "web", "20240102T000000Z")
+	export, _ := os.ReadFile(filepath.Join(snapDir, "export.tar.xz"))
+	tr, compression, err := archive.Decompress(bytes.NewReader(export))
+	if err != nil || compression != archive.CompressionXz {
+		t.Fatalf("dir copy should be xz-compressed, got %q (%v)", compression, err)
+	}
+	var back bytes.Buffer
+	if _, err := back.ReadFrom(tr); err != nil || !bytes.Equal(back.Bytes(), plain) {
+		t.Fatalf("round trip changed the export (%v)", err)
+	}
+	sums, _ = os.ReadFile(filepath.Join(snapDir, "checksums.txt"))
+	if !strings.Contains(string(sums), sha(export)+"  export.tar.xz") {
+		t.Fatalf("dir checksums do not describe the stored export: %s", sums)
+	}
+	var mf struct {
+		Export *manifest.Export `json:"export"`
+		Restic *manifest.Restic `json:"restic"`
+	}
+	data, _ := os.ReadFile(filepath.Join(snapDir, "manifest.json"))
+	if err := json.Unmarshal(data, &mf); err != nil {
+		t.Fatal(err)
+	}
+	if mf.Export == nil || mf.Export.Filename != "export.tar.xz" || mf.Export.Compression != "xz" || mf.Export.Size != int64(len(export)) || mf.Restic != nil {
+		t.Fatalf("unexpected manifest after round trip: %s", data)
+	}
+}
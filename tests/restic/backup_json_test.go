@@ -0,0 +1,67 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	restic "incus-backup/src/restic"
+)
+
+// jsonRestic writes a script that consumes stdin and prints restic-style
+// `backup --json` output, recording its arguments.
+func jsonRestic(t *testing.T) (restic.BinaryInfo, string) {
+	t.Helper()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "args")
+	script := `#!/bin/sh
+echo "$*" > "` + record + `"
+cat > /dev/null
+echo '{"message_type":"status","percent_done":0.5,"total_files":1,"files_done":0,"total_bytes":2048,"bytes_done":1024,"seconds_remaining":3}'
+echo '{"message_type":"error","error":{"message":"short read"},"during":"archival","item":"/export.tar"}'
+echo '{"message_type":"summary","files_new":1,"files_changed":0,"files_unmodified":0,"data_added":300,"data_added_packed":120,"total_files_processed":1,"total_bytes_processed":2048,"total_duration":1.5,"snapshot_id":"0123456789abcdef"}'
+`
+	path := filepath.Join(dir, "restic")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return restic.BinaryInfo{Path: path, Version: restic.RequiredVersion}, record
+}
+
+func TestBackupStreamParsesJSONProgress(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin, record := jsonRestic(t)
+	var progress bytes.Buffer
+	summary, err := restic.BackupStream(context.Background(), bin, "/repo", "export.tar", []string{"type=instance"}, strings.NewReader(strings.Repeat("x", 2048)), &progress)
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if summary.SnapshotID != "0123456789abcdef" || summary.ShortID() != "01234567" {
+		t.Fatalf("unexpected snapshot id: %+v", summary)
+	}
+	if summary.DataAdded != 300 || summary.DataAddedPacked != 120 || summary.TotalBytesProcessed != 2048 {
+		t.Fatalf("unexpected dedup stats: %+v", summary)
+	}
+
+	args, _ := os.ReadFile(record)
+	if !strings.Contains(string(args), "backup --json --stdin --stdin-filename export.tar --tag type=instance") {
+		t.Fatalf("expected --json backup invocation, got %q", args)
+	}
+
+	out := progress.String()
+	for _, want := range []string{
+		"[restic backup] 50.0% (1024/2048 bytes) eta=3s",
+		"[restic] error during archival /export.tar: short read",
+		"[restic] export.tar: snapshot 01234567, processed 2048 bytes, added 300 bytes (120 packed) in 1.5s",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in progress output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "message_type") {
+		t.Fatalf("raw restic JSON leaked into progress output:\n%s", out)
+	}
+}
@@ -0,0 +1,115 @@
+package restic_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	restic "incus-backup/src/restic"
+)
+
+// bundleRestic fakes the restic subcommands used by BackupBundle. The bundle
+// backup reports `unmodified` files as unchanged and records what it found in
+// the staging directory.
+func bundleRestic(t *testing.T, unmodified int) (restic.BinaryInfo, string) {
+	t.Helper()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	script := `#!/bin/sh
+echo "CALL $*" >> "` + record + `"
+case " $* " in
+  *" ls "*)
+    echo '{"time":"2024-05-01T10:00:00Z","id":"data1","struct_type":"snapshot"}'
+    echo '{"name":"export.tar","type":"file","path":"/export.tar","size":4096,"mtime":"2024-05-01T10:00:00.123456789Z","struct_type":"node"}'
+    ;;
+  *" --parent "*)
+    echo "PLACEHOLDER $(stat -c '%s %Y' export.tar)" >> "` + record + `"
+    echo "FILES $(ls | tr '\n' ' ')" >> "` + record + `"
+    echo '{"message_type":"summary","files_new":2,"files_unmodified":` + strconv.Itoa(unmodified) + `,"data_added":512,"snapshot_id":"bundle1"}'
+    ;;
+  *" forget "*)
+    ;;
+  *" --stdin "*)
+    cat > /dev/null
+    echo '{"message_type":"summary","files_new":1,"data_added":4096,"snapshot_id":"data1"}'
+    ;;
+esac
+`
+	path := filepath.Join(dir, "restic")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return restic.BinaryInfo{Path: path, Version: restic.RequiredVersion}, record
+}
+
+func bundleFiles() []restic.File {
+	return []restic.File{
+		{Name: "manifest.json", Data: []byte("{}")},
+		{Name: "checksums.txt", Data: []byte("abc  export.tar\n")},
+	}
+}
+
+func TestBackupBundleReusesStreamedData(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin, record := bundleRestic(t, 1)
+	ctx := context.Background()
+	data, err := restic.BackupStream(ctx, bin, "/repo", "export.tar", []string{"part=data"}, strings.NewReader("payload"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := restic.BackupBundle(ctx, bin, "/repo", data, "export.tar", bundleFiles(), []string{restic.BundleSchemaTag}, nil)
+	if err != nil {
+		t.Fatalf("bundle: %v", err)
+	}
+	if summary.SnapshotID != "bundle1" || summary.DataAdded != 4096+512 {
+		t.Fatalf("unexpected bundle summary: %+v", summary)
+	}
+
+	got, _ := os.ReadFile(record)
+	for _, want := range []string{
+		"ls --json data1 /export.tar",
+		"backup --json --parent data1 --ignore-inode --ignore-ctime --tag schema=v2 .",
+		// Sparse placeholder with the streamed node's size and mtime.
+		"PLACEHOLDER 4096 1714557600",
+		"FILES checksums.txt export.tar manifest.json",
+		"forget data1",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Fatalf("missing %q in restic calls:\n%s", want, got)
+		}
+	}
+}
+
+func TestBackupBundleFallsBackWhenDataReread(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin, record := bundleRestic(t, 0)
+	ctx := context.Background()
+	data := restic.BackupSummary{SnapshotID: "data1"}
+	_, err := restic.BackupBundle(ctx, bin, "/repo", data, "export.tar", bundleFiles(), []string{restic.BundleSchemaTag}, nil)
+	if !errors.Is(err, restic.ErrBundleUnsupported) {
+		t.Fatalf("expected ErrBundleUnsupported, got %v", err)
+	}
+	got, _ := os.ReadFile(record)
+	if !strings.Contains(string(got), "forget bundle1") || strings.Contains(string(got), "forget data1") {
+		t.Fatalf("expected the bundle to be discarded and the data snapshot kept:\n%s", got)
+	}
+
+	if _, err := restic.BackupBundle(ctx, bin, "/repo", restic.BackupSummary{}, "export.tar", bundleFiles(), nil, nil); !errors.Is(err, restic.ErrBundleUnsupported) {
+		t.Fatalf("expected ErrBundleUnsupported without a data snapshot, got %v", err)
+	}
+}
+
+func TestSnapshotParts(t *testing.T) {
+	bundle := restic.Snapshot{Tags: []string{"type=instance", restic.BundleSchemaTag}}
+	legacy := restic.Snapshot{Tags: []string{"type=instance", "schema=v1", "part=manifest"}}
+	if !bundle.IsBundle() || !bundle.HasPart("data") || !bundle.HasPart("manifest") {
+		t.Fatal("expected a bundle to provide every part")
+	}
+	if legacy.IsBundle() || legacy.HasPart("data") || !legacy.HasPart("manifest") {
+		t.Fatal("expected a legacy snapshot to provide only its own part")
+	}
+}
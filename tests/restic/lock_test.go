@@ -0,0 +1,144 @@
+package restic_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	restic "incus-backup/src/restic"
+	"incus-backup/src/util/flock"
+)
+
+// fakeRestic writes a script that reports a locked repository for the first
+// `failures` invocations and then prints an empty snapshot list.
+func fakeRestic(t *testing.T, failures int) (restic.BinaryInfo, string) {
+	t.Helper()
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+n=$(cat "` + counter + `" 2>/dev/null || echo 0)
+n=$((n+1))
+echo $n > "` + counter + `"
+if [ $n -le ` + strconv.Itoa(failures) + ` ]; then
+  echo "Fatal: unable to create lock in backend: repository is already locked by PID 42 on host" >&2
+  exit 1
+fi
+echo "[]"
+`
+	path := filepath.Join(dir, "restic")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return restic.BinaryInfo{Path: path, Version: restic.RequiredVersion}, counter
+}
+
+func calls(t *testing.T, counter string) string {
+	t.Helper()
+	b, _ := os.ReadFile(counter)
+	return strings.TrimSpace(string(b))
+}
+
+func TestRunRetriesOnLockContention(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	var waits []time.Duration
+	restore := restic.SetLockBackoffForTest([]time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}, func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	})
+	defer restore()
+
+	bin, counter := fakeRestic(t, 2)
+	snaps, err := restic.ListSnapshots(context.Background(), bin, "/repo", nil)
+	if err != nil {
+		t.Fatalf("expected success after retries: %v", err)
+	}
+	if len(snaps) != 0 || calls(t, counter) != "3" || len(waits) != 2 || waits[1] != 2*time.Millisecond {
+		t.Fatalf("unexpected retry behaviour: snaps=%v calls=%s waits=%v", snaps, calls(t, counter), waits)
+	}
+
+	bin, _ = fakeRestic(t, 9)
+	_, err = restic.ListSnapshots(context.Background(), bin, "/repo", nil)
+	if !errors.Is(err, restic.ErrRepositoryLocked) {
+		t.Fatalf("expected ErrRepositoryLocked after exhausting retries, got %v", err)
+	}
+}
+
+func TestLocalLockSerialisesInvocations(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin, counter := fakeRestic(t, 0)
+	path := restic.LocalLockPath("/repo")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate another incus-backup process holding the repository.
+	other, err := flock.TryLock(path, true, "pid 999")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	_, err = restic.ListSnapshots(ctx, bin, "/repo", nil)
+	if err == nil || !strings.Contains(err.Error(), "pid 999") {
+		t.Fatalf("expected to wait on the local lock, got %v", err)
+	}
+	if calls(t, counter) != "" {
+		t.Fatalf("restic must not run while another process holds the lock")
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		other.Unlock()
+	}()
+	if _, err := restic.ListSnapshots(context.Background(), bin, "/repo", nil); err != nil {
+		t.Fatalf("expected to proceed once the lock is released: %v", err)
+	}
+	// A different repository uses a different lock.
+	if restic.LocalLockPath("/other") == path {
+		t.Fatalf("lock paths must be per repository")
+	}
+}
+
+func TestLocalLockWaitDoesNotBlockOtherRepos(t *testing.T) {
+	t.Setenv("INCUS_BACKUP_LOCK_DIR", t.TempDir())
+	bin, _ := fakeRestic(t, 0)
+	path := restic.LocalLockPath("/busy")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	other, err := flock.TryLock(path, true, "pid 999")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer other.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := restic.ListSnapshots(ctx, bin, "/busy", nil)
+		waiting <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := restic.ListSnapshots(context.Background(), bin, "/idle", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("list other repo: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("waiting on one repository's lock blocked another repository")
+	}
+	cancel()
+	if err := <-waiting; err == nil {
+		t.Fatalf("expected the busy repository to stay locked")
+	}
+}
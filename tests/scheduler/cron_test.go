@@ -0,0 +1,51 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"incus-backup/src/scheduler"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestScheduleNext(t *testing.T) {
+	cases := []struct {
+		expr, from, want string
+	}{
+		{"*/15 * * * *", "2024-03-01T10:07:30Z", "2024-03-01T10:15:00Z"},
+		{"30 2 * * *", "2024-03-01T02:30:00Z", "2024-03-02T02:30:00Z"},
+		{"0 0 * * 1-5", "2024-03-01T12:00:00Z", "2024-03-04T00:00:00Z"}, // Friday -> Monday
+		{"0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},  // next leap day
+		{"0 0 13 * 5", "2024-03-01T00:00:00Z", "2024-03-08T00:00:00Z"},  // dom or dow
+		{"0 12 * * 7", "2024-03-01T00:00:00Z", "2024-03-03T12:00:00Z"},  // 7 is Sunday
+		{"@daily", "2024-12-31T23:59:00Z", "2025-01-01T00:00:00Z"},
+		{"@hourly", "2024-03-01T10:00:00Z", "2024-03-01T11:00:00Z"},
+		{"5,10 8-9 * 1,6 *", "2024-03-01T00:00:00Z", "2024-06-01T08:05:00Z"},
+	}
+	for _, c := range cases {
+		s, err := scheduler.ParseSchedule(c.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		got := s.Next(mustTime(t, c.from))
+		if want := mustTime(t, c.want); !got.Equal(want) {
+			t.Errorf("%s after %s: got %s want %s", c.expr, c.from, got.Format(time.RFC3339), c.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@often"} {
+		if _, err := scheduler.ParseSchedule(expr); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"incus-backup/src/scheduler"
+)
+
+// fakeClock jumps forward instead of sleeping, so a scheduler loop runs
+// through hours of schedule instantly.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+type call struct {
+	job, task string
+	at        time.Time
+}
+
+// recorder returns an ExecFunc that takes `work` of fake time per task and
+// cancels the run during call number `stopAt`.
+func recorder(clock *fakeClock, cancel context.CancelFunc, work time.Duration, stopAt int, calls *[]call) scheduler.ExecFunc {
+	return func(ctx context.Context, job scheduler.Job, task string) error {
+		*calls = append(*calls, call{job.Name, task, clock.now})
+		clock.now = clock.now.Add(work)
+		if len(*calls) == stopAt {
+			cancel()
+			return ctx.Err()
+		}
+		if job.Name == "broken" {
+			return errors.New("export failed")
+		}
+		return nil
+	}
+}
+
+func TestSchedulerRunsTasksSeriallyAndRecordsState(t *testing.T) {
+	clock := &fakeClock{now: mustTime(t, "2024-03-01T10:00:00Z")}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []call
+	s := &scheduler.Scheduler{
+		Jobs: []scheduler.Job{
+			{Name: "a", Target: "dir:/x", Kind: "all", Schedule: "@hourly", Verify: "30 * * * *"},
+			{Name: "broken", Target: "dir:/x", Kind: "config", Schedule: "0 */2 * * *"},
+		},
+		Exec:      recorder(clock, cancel, 10*time.Minute, 6, &calls),
+		Clock:     clock,
+		StatePath: statePath,
+	}
+	var notified []string
+	s.Notify = func(job scheduler.Job, task string, run scheduler.RunState) {
+		notified = append(notified, job.Name+"/"+task+"="+run.Status)
+	}
+	if err := s.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(notified) != 6 || notified[4] != "broken/backup=failed" || notified[5] != "a/verify=cancelled" {
+		t.Fatalf("notifications: %v", notified)
+	}
+	var got []string
+	for _, c := range calls {
+		got = append(got, fmt.Sprintf("%s/%s@%s", c.job, c.task, c.at.Format("15:04")))
+	}
+	// At 12:00 both backups are due: "a" runs first (config order) and
+	// "broken" starts when it finishes instead of overlapping.
+	want := []string{"a/verify@10:30", "a/backup@11:00", "a/verify@11:30", "a/backup@12:00", "broken/backup@12:10", "a/verify@12:30"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("calls:\n got %v\nwant %v", got, want)
+	}
+
+	st, err := scheduler.LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := st.Last("a", scheduler.TaskBackup); r.Status != scheduler.StatusOK || !r.Start.Equal(mustTime(t, "2024-03-01T12:00:00Z")) || !r.End.Equal(mustTime(t, "2024-03-01T12:10:00Z")) {
+		t.Fatalf("a backup state: %+v", r)
+	}
+	if r, _ := st.Last("broken", scheduler.TaskBackup); r.Status != scheduler.StatusFailed || r.Error != "export failed" {
+		t.Fatalf("broken backup state: %+v", r)
+	}
+	if r, _ := st.Last("a", scheduler.TaskVerify); r.Status != scheduler.StatusCancelled {
+		t.Fatalf("cancelled verify state: %+v", r)
+	}
+}
+
+func TestSchedulerCatchesUpMissedRunsOnce(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	// "late" last ran two days ago; "fresh" already ran at today's slot.
+	state := `{"jobs":{
+  "late":{"backup":{"start":"2024-02-28T02:00:00Z","end":"2024-02-28T02:05:00Z","status":"ok"}},
+  "fresh":{"backup":{"start":"2024-03-01T02:00:00Z","end":"2024-03-01T02:05:00Z","status":"ok"}}}}`
+	if err := os.WriteFile(statePath, []byte(state), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	jobs := []scheduler.Job{
+		{Name: "late", Target: "dir:/x", Kind: "all", Schedule: "0 2 * * *"},
+		{Name: "fresh", Target: "dir:/x", Kind: "all", Schedule: "0 2 * * *"},
+	}
+	clock := &fakeClock{now: mustTime(t, "2024-03-01T09:00:00Z")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls []call
+	s := &scheduler.Scheduler{Jobs: jobs, Exec: recorder(clock, cancel, time.Minute, 3, &calls), Clock: clock, StatePath: statePath}
+
+	runs, err := s.NextRuns(clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRuns := []string{
+		"late\tbackup\t0 2 * * *\t2024-03-01T09:00:00Z",
+		"fresh\tbackup\t0 2 * * *\t2024-03-02T02:00:00Z",
+	}
+	if strings.Join(runs, "\n") != strings.Join(wantRuns, "\n") {
+		t.Fatalf("next runs:\n%s", strings.Join(runs, "\n"))
+	}
+
+	if err := s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Two missed days coalesce into one immediate run.
+	if len(calls) != 3 || calls[0].job != "late" || !calls[0].at.Equal(mustTime(t, "2024-03-01T09:00:00Z")) ||
+		calls[1].job != "late" || !calls[1].at.Equal(mustTime(t, "2024-03-02T02:00:00Z")) ||
+		calls[2].job != "fresh" {
+		t.Fatalf("calls: %+v", calls)
+	}
+}
+
+func TestSchedulerStopsWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &scheduler.Scheduler{
+		Jobs: []scheduler.Job{{Name: "a", Target: "dir:/x", Kind: "all", Schedule: "@daily"}},
+		Exec: func(context.Context, scheduler.Job, string) error {
+			t.Fatal("no task should run after cancellation")
+			return nil
+		},
+		Clock: &fakeClock{now: mustTime(t, "2024-03-01T09:00:00Z")},
+	}
+	if err := s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(body string) string {
+		p := filepath.Join(dir, "daemon.yaml")
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	cfg, err := scheduler.LoadConfig(write(`stateFile: /var/lib/incus-backup/daemon.json
+jobs:
+  - name: web
+    target: restic:/srv/repo
+    kind: instances
+    names: [web1, web2]
+    schedule: "30 1 * * *"
+    keep: 7
+    verify: "@weekly"
+    resticConfig: /etc/incus-backup/restic.yaml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j := cfg.Jobs[0]; cfg.StateFile != "/var/lib/incus-backup/daemon.json" || j.Keep != 7 || len(j.Names) != 2 || j.ResticConfig == "" || j.Verify != "@weekly" {
+		t.Fatalf("config: %+v", cfg)
+	}
+
+	bad := map[string]string{
+		"no jobs":         "jobs: []\n",
+		"unknown key":     "jobs:\n  - name: a\n    target: dir:/x\n    kind: all\n    schedule: '@daily'\n    retain: 3\n",
+		"bad kind":        "jobs:\n  - name: a\n    target: dir:/x\n    kind: images\n    schedule: '@daily'\n",
+		"bad schedule":    "jobs:\n  - name: a\n    target: dir:/x\n    kind: all\n    schedule: '61 * * * *'\n",
+		"names on all":    "jobs:\n  - name: a\n    target: dir:/x\n    kind: all\n    names: [x]\n    schedule: '@daily'\n",
+		"duplicate":       "jobs:\n  - {name: a, target: 'dir:/x', kind: all, schedule: '@daily'}\n  - {name: a, target: 'dir:/y', kind: all, schedule: '@daily'}\n",
+		"missing target":  "jobs:\n  - {name: a, kind: all, schedule: '@daily'}\n",
+		"keep conflict":   "jobs:\n  - {name: a, target: 'dir:/x', kind: all, schedule: '@daily', keep: 3}\n  - {name: b, target: 'dir:/x', kind: instances, names: [web], schedule: '@daily', keep: 7}\n",
+		"config conflict": "jobs:\n  - {name: a, target: 'dir:/x', kind: all, project: p1, schedule: '@daily', keep: 3}\n  - {name: b, target: 'dir:/x', kind: config, schedule: '@daily', keep: 7}\n",
+	}
+	for name, body := range bad {
+		if _, err := scheduler.LoadConfig(write(body)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadConfig_AllowsDisjointJobsOnOneTarget(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "daemon.yaml")
+	body := `jobs:
+  - {name: web, target: 'dir:/x', kind: instances, names: [web], schedule: '@daily', keep: 3}
+  - {name: db, target: 'dir:/x', kind: instances, names: [db], schedule: '@daily', keep: 14}
+  - {name: other, target: 'dir:/x', kind: instances, project: other, schedule: '@daily', keep: 7}
+  - {name: buckets, target: 'dir:/x', kind: buckets, names: [pool/b], schedule: '@daily', keep: 2}
+  - {name: elsewhere, target: 'dir:/y', kind: all, schedule: '@daily', keep: 5}
+`
+	if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := scheduler.LoadConfig(p); err != nil {
+		t.Fatalf("expected disjoint jobs to be accepted: %v", err)
+	}
+}
+
+func TestJobKinds(t *testing.T) {
+	if got := (scheduler.Job{Kind: "all"}).Kinds(); len(got) != 3 || got[0] != "config" {
+		t.Fatalf("all kinds = %v", got)
+	}
+	if got := (scheduler.Job{Kind: "buckets"}).Kinds(); len(got) != 1 || got[0] != "buckets" {
+		t.Fatalf("bucket kinds = %v", got)
+	}
+	if got := (scheduler.Job{}).ProjectName(); got != "default" {
+		t.Fatalf("project = %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package textdiff_test
+
+import (
+	"testing"
+
+	"incus-backup/src/util/textdiff"
+)
+
+func TestUnified_EqualIsEmpty(t *testing.T) {
+	if got := textdiff.Unified("a", "b", "x\ny\n", "x\ny\n"); got != "" {
+		t.Fatalf("expected no diff, got:\n%s", got)
+	}
+}
+
+func TestUnified_ChangedLineWithContext(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	b := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n"
+	want := "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"
+	if got := textdiff.Unified("old", "new", a, b); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_AddedDocument(t *testing.T) {
+	want := "--- /dev/null\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := textdiff.Unified("/dev/null", "new", "", "a\nb\n"); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnified_SplitsDistantChanges(t *testing.T) {
+	a := "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n"
+	b := "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n"
+	want := "--- x\n+++ y\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n"
+	if got := textdiff.Unified("x", "y", a, b); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}